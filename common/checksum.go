@@ -1,6 +1,69 @@
 package common
 
-// For simplicity, ignore efficiency.
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+// The algorithm used to checksum the blocks of a database file. The ChecksumType of a file is recorded in its
+// MainHeader, so that files keep verifying when the default changes.
+type ChecksumType uint8
+
+const (
+	ChecksumDJB2     ChecksumType = iota // Byte-at-a-time djb2 hash, used by files written before the checksum type was recorded.
+	ChecksumCRC32C                       // CRC32C (Castagnoli), computed with the SSE4.2/ARMv8 CRC instructions where available.
+	ChecksumXXHash64                     // 64-bit xxHash.
+)
+
+// The checksum algorithm used for new database files.
+const DefaultChecksumType = ChecksumCRC32C
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Whether the checksum type is known, a file recording an unknown checksum type cannot be verified.
+func (checksumType ChecksumType) Valid() bool {
+	return checksumType <= ChecksumXXHash64
+}
+
+func (checksumType ChecksumType) String() string {
+	switch checksumType {
+	case ChecksumDJB2:
+		return "djb2"
+	case ChecksumCRC32C:
+		return "crc32c"
+	case ChecksumXXHash64:
+		return "xxhash64"
+	default:
+		return fmt.Sprintf("ChecksumType(%d)", uint8(checksumType))
+	}
+}
+
+// Compute the checksum of the buffer with the default checksum algorithm.
 func Checksum(buffer []byte) uint64 {
-	return Hash(buffer)
+	return ComputeChecksum(DefaultChecksumType, buffer)
+}
+
+// Compute the checksum of the buffer with the given checksum algorithm.
+func ComputeChecksum(checksumType ChecksumType, buffer []byte) uint64 {
+	switch checksumType {
+	case ChecksumDJB2:
+		return checksumDJB2(buffer)
+	case ChecksumCRC32C:
+		return uint64(crc32.Checksum(buffer, castagnoliTable))
+	case ChecksumXXHash64:
+		return xxHash64(buffer, 0)
+	default:
+		panic(fmt.Sprintf("Unknown checksum type: %d", checksumType))
+	}
+}
+
+// The original checksum, kept separately from the hash functions so that old files keep verifying if those change.
+func checksumDJB2(buffer []byte) uint64 {
+	var hash uint64 = 5381
+
+	for _, b := range buffer {
+		hash = ((hash << 5) + hash) + uint64(b)
+	}
+
+	return hash
 }
@@ -18,3 +18,97 @@ func TestChecksum(t *testing.T) {
 		t.Errorf("Expect Checksum({1,2,2}) != Checksum({1, 2, 3}), got true")
 	}
 }
+
+func TestChecksumTypes(t *testing.T) {
+	buffer := make([]byte, 4096)
+
+	for i := range buffer {
+		buffer[i] = byte(i * 7)
+	}
+
+	for _, checksumType := range []ChecksumType{ChecksumDJB2, ChecksumCRC32C, ChecksumXXHash64} {
+		checksum := ComputeChecksum(checksumType, buffer)
+		buffer[1000] ^= 1
+
+		if ComputeChecksum(checksumType, buffer) == checksum {
+			t.Errorf("Expect %s checksum to change after flipping a bit", checksumType)
+		}
+
+		buffer[1000] ^= 1
+	}
+
+	if ComputeChecksum(ChecksumDJB2, []byte{1, 2, 3}) != 193378155 {
+		t.Errorf("Expect the djb2 checksum to stay compatible with existing files")
+	}
+}
+
+func TestXXHash64(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"a", 0xd24ec4f1a98c6e5b},
+		{"abc", 0x44bc2cf5ad770999},
+		{"Nobody inspects the spammish repetition", 0xfbcea83c8a378bf1},
+	}
+
+	for _, test := range tests {
+		if got := xxHash64([]byte(test.input), 0); got != test.expected {
+			t.Errorf("xxHash64(%q) = %x, expect %x", test.input, got, test.expected)
+		}
+	}
+}
+
+func BenchmarkChecksum(b *testing.B) {
+	buffer := make([]byte, 262144)
+
+	for i := range buffer {
+		buffer[i] = byte(i)
+	}
+
+	for _, checksumType := range []ChecksumType{ChecksumDJB2, ChecksumCRC32C, ChecksumXXHash64} {
+		b.Run(checksumType.String(), func(b *testing.B) {
+			b.SetBytes(int64(len(buffer)))
+
+			for i := 0; i < b.N; i++ {
+				ComputeChecksum(checksumType, buffer)
+			}
+		})
+	}
+}
+
+// Benchmark reading a block from a file, including the verification of its checksum: the share of the checksum in the
+// cost of a block read is the difference to BenchmarkChecksum.
+func BenchmarkFileBufferRead(b *testing.B) {
+	fs := NewMemoryFileSystem()
+	buffer := NewFileBuffer(262144)
+
+	for i := range buffer.Buffer() {
+		buffer.Buffer()[i] = byte(i)
+	}
+
+	for _, checksumType := range []ChecksumType{ChecksumDJB2, ChecksumCRC32C, ChecksumXXHash64} {
+		b.Run(checksumType.String(), func(b *testing.B) {
+			handle, err := fs.OpenFile("/"+checksumType.String(), WriteOnly|Create, NoLock)
+
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer handle.Close()
+
+			if err := buffer.Write(handle, 0, checksumType); err != nil {
+				b.Fatal(err)
+			}
+
+			b.SetBytes(int64(buffer.Size()))
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if err := buffer.Read(handle, 0, checksumType); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
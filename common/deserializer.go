@@ -1,6 +1,301 @@
 package common
 
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// A DataReader is the source a BinaryDeserializer reads encoded values from. ReadData fills the whole buffer, or fails.
+type DataReader interface {
+	ReadData(buffer []byte) error
+}
+
+// A Deserializer reads values that were written by a Serializer. Values have to be read in the order and with the
+// types they were written with.
 type Deserializer interface {
-	ReadData(buffer []byte)
-	Read(v interface{})
+	DataReader
+	ReadBool() (bool, error)
+	ReadUint8() (uint8, error)
+	ReadInt8() (int8, error)
+	ReadUint16() (uint16, error)
+	ReadInt16() (int16, error)
+	ReadUint32() (uint32, error)
+	ReadInt32() (int32, error)
+	ReadUint64() (uint64, error)
+	ReadInt64() (int64, error)
+	ReadFloat32() (float32, error)
+	ReadFloat64() (float64, error)
+	ReadVarint() (uint64, error)
+	ReadSignedVarint() (int64, error)
+	ReadString() (string, error)
+	ReadBytes() ([]byte, error)
+	// Read a list, readElement is called to read the element at each index.
+	ReadList(readElement func(index int) error) error
+	// Read an optional value, readValue is only called if the value is present.
+	ReadOptional(readValue func() error) (bool, error)
+	// Read a nested object, which must consume exactly the bytes that were written for it.
+	ReadObject(object Deserializable) error
+}
+
+// A Deserializable is an object that can be read with a Deserializer.
+type Deserializable interface {
+	Deserialize(deserializer Deserializer) error
+}
+
+// The BinaryDeserializer implements the Deserializer on top of a DataReader.
+type BinaryDeserializer struct {
+	reader  DataReader
+	scratch [8]byte // Reused to decode a single value without allocating.
+}
+
+func NewBinaryDeserializer(reader DataReader) *BinaryDeserializer {
+	return &BinaryDeserializer{reader: reader}
+}
+
+func (deserializer *BinaryDeserializer) ReadData(buffer []byte) error {
+	return deserializer.reader.ReadData(buffer)
+}
+
+func (deserializer *BinaryDeserializer) ReadBool() (bool, error) {
+	v, err := deserializer.ReadUint8()
+
+	if err != nil {
+		return false, err
+	}
+
+	if v > 1 {
+		return false, NewSerializationError(fmt.Sprintf("invalid bool value %d", v))
+	}
+
+	return v == 1, nil
+}
+
+func (deserializer *BinaryDeserializer) ReadUint8() (uint8, error) {
+	if err := deserializer.reader.ReadData(deserializer.scratch[:1]); err != nil {
+		return 0, err
+	}
+
+	return deserializer.scratch[0], nil
+}
+
+func (deserializer *BinaryDeserializer) ReadInt8() (int8, error) {
+	v, err := deserializer.ReadUint8()
+
+	return int8(v), err
+}
+
+func (deserializer *BinaryDeserializer) ReadUint16() (uint16, error) {
+	if err := deserializer.reader.ReadData(deserializer.scratch[:2]); err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint16(deserializer.scratch[:]), nil
+}
+
+func (deserializer *BinaryDeserializer) ReadInt16() (int16, error) {
+	v, err := deserializer.ReadUint16()
+
+	return int16(v), err
+}
+
+func (deserializer *BinaryDeserializer) ReadUint32() (uint32, error) {
+	if err := deserializer.reader.ReadData(deserializer.scratch[:4]); err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint32(deserializer.scratch[:]), nil
+}
+
+func (deserializer *BinaryDeserializer) ReadInt32() (int32, error) {
+	v, err := deserializer.ReadUint32()
+
+	return int32(v), err
+}
+
+func (deserializer *BinaryDeserializer) ReadUint64() (uint64, error) {
+	if err := deserializer.reader.ReadData(deserializer.scratch[:8]); err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint64(deserializer.scratch[:]), nil
+}
+
+func (deserializer *BinaryDeserializer) ReadInt64() (int64, error) {
+	v, err := deserializer.ReadUint64()
+
+	return int64(v), err
+}
+
+func (deserializer *BinaryDeserializer) ReadFloat32() (float32, error) {
+	v, err := deserializer.ReadUint32()
+
+	return math.Float32frombits(v), err
+}
+
+func (deserializer *BinaryDeserializer) ReadFloat64() (float64, error) {
+	v, err := deserializer.ReadUint64()
+
+	return math.Float64frombits(v), err
+}
+
+func (deserializer *BinaryDeserializer) ReadVarint() (uint64, error) {
+	v, err := binary.ReadUvarint(deserializer)
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return v, err
+}
+
+func (deserializer *BinaryDeserializer) ReadSignedVarint() (int64, error) {
+	v, err := binary.ReadVarint(deserializer)
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return v, err
+}
+
+// Read a single byte, this makes the BinaryDeserializer an io.ByteReader for decoding varints.
+func (deserializer *BinaryDeserializer) ReadByte() (byte, error) {
+	return deserializer.ReadUint8()
+}
+
+func (deserializer *BinaryDeserializer) ReadString() (string, error) {
+	v, err := deserializer.ReadBytes()
+
+	return string(v), err
+}
+
+func (deserializer *BinaryDeserializer) ReadBytes() ([]byte, error) {
+	length, err := deserializer.readLength()
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The buffer is only allocated for data that exists: a corrupt length must not allocate up to MaxSerializedLength
+	// bytes. The length is checked against the remaining data if it is known, otherwise the data is read in chunks.
+	if reader, ok := deserializer.reader.(interface{ Remaining() int }); ok && length > reader.Remaining() {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	buffer := []byte{}
+
+	for len(buffer) < length {
+		start := len(buffer)
+		size := length - start
+
+		if size > readChunkSize {
+			size = readChunkSize
+		}
+
+		buffer = append(buffer, make([]byte, size)...)
+
+		if err := deserializer.reader.ReadData(buffer[start:]); err != nil {
+			return nil, err
+		}
+	}
+
+	return buffer, nil
+}
+
+func (deserializer *BinaryDeserializer) ReadList(readElement func(index int) error) error {
+	count, err := deserializer.readLength()
+
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		if err := readElement(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (deserializer *BinaryDeserializer) ReadOptional(readValue func() error) (bool, error) {
+	present, err := deserializer.ReadBool()
+
+	if err != nil || !present {
+		return false, err
+	}
+
+	return true, readValue()
+}
+
+func (deserializer *BinaryDeserializer) ReadObject(object Deserializable) error {
+	data, err := deserializer.ReadBytes()
+
+	if err != nil {
+		return err
+	}
+
+	buffered := NewBufferedDeserializer(data)
+
+	if err := object.Deserialize(buffered); err != nil {
+		return err
+	}
+
+	if remaining := buffered.Remaining(); remaining > 0 {
+		return NewSerializationError(fmt.Sprintf("%d trailing bytes after object", remaining))
+	}
+
+	return nil
+}
+
+// Read a length or count. Lengths are bounded, so that a corrupt length fails instead of allocating huge buffers.
+func (deserializer *BinaryDeserializer) readLength() (int, error) {
+	length, err := deserializer.ReadVarint()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if length > MaxSerializedLength {
+		return 0, NewSerializationError(fmt.Sprintf("length %d exceeds the maximum of %d", length, MaxSerializedLength))
+	}
+
+	return int(length), nil
+}
+
+// The maximum length of a serialized string, byte slice, list or object.
+const MaxSerializedLength = 1 << 30
+
+// The size of the chunks that strings and byte slices are read in if the size of the remaining data is unknown.
+const readChunkSize = 1 << 20
+
+// The BufferedDeserializer is a Deserializer that reads from an in-memory byte buffer.
+type BufferedDeserializer struct {
+	*BinaryDeserializer
+	buffer []byte
+}
+
+func NewBufferedDeserializer(buffer []byte) *BufferedDeserializer {
+	deserializer := &BufferedDeserializer{buffer: buffer}
+	deserializer.BinaryDeserializer = NewBinaryDeserializer(deserializer)
+
+	return deserializer
+}
+
+func (deserializer *BufferedDeserializer) ReadData(buffer []byte) error {
+	if len(buffer) > len(deserializer.buffer) {
+		return io.ErrUnexpectedEOF
+	}
+
+	copy(buffer, deserializer.buffer)
+	deserializer.buffer = deserializer.buffer[len(buffer):]
+
+	return nil
+}
+
+// The number of bytes that have not been read yet.
+func (deserializer *BufferedDeserializer) Remaining() int {
+	return len(deserializer.buffer)
 }
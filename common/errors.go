@@ -0,0 +1,72 @@
+package common
+
+import "fmt"
+
+// An IOError is returned when an operation on a file or directory fails. The underlying error (e.g. fs.ErrNotExist
+// or syscall.ENOSPC) can be inspected with errors.Is.
+type IOError struct {
+	Op   string // The operation that failed, e.g. "open", "read" or "sync".
+	Path string // The path of the file or directory the operation was performed on.
+	Err  error  // The underlying error.
+}
+
+func NewIOError(op string, path string, err error) *IOError {
+	return &IOError{Op: op, Path: path, Err: err}
+}
+
+func (e *IOError) Error() string {
+	return fmt.Sprintf("IO Error: could not %s %q: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *IOError) Unwrap() error {
+	return e.Err
+}
+
+// A CorruptionError is returned when data that was read from a file fails verification, e.g. because the stored
+// checksum of a block does not match its content.
+type CorruptionError struct {
+	Path   string // The path of the corrupt file.
+	Offset uint64 // The offset in the file at which the corrupt data was found.
+	Reason string // A description of the corruption.
+}
+
+func NewCorruptionError(path string, offset uint64, reason string) *CorruptionError {
+	return &CorruptionError{Path: path, Offset: offset, Reason: reason}
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("Corrupt database file %q at offset %d: %s", e.Path, e.Offset, e.Reason)
+}
+
+// A LockConflictError is returned when a lock on a file cannot be acquired because another process (or another handle)
+// holds a conflicting lock.
+type LockConflictError struct {
+	Path string // The path of the locked file.
+	Err  error  // The underlying error.
+}
+
+func NewLockConflictError(path string, err error) *LockConflictError {
+	return &LockConflictError{Path: path, Err: err}
+}
+
+func (e *LockConflictError) Error() string {
+	return fmt.Sprintf("IO Error: could not set lock on file %q: %v", e.Path, e.Err)
+}
+
+func (e *LockConflictError) Unwrap() error {
+	return e.Err
+}
+
+// A SerializationError is returned when serialized data cannot be deserialized, e.g. because it was written with a
+// different format or has been corrupted.
+type SerializationError struct {
+	Reason string // A description of what is wrong with the data.
+}
+
+func NewSerializationError(reason string) *SerializationError {
+	return &SerializationError{Reason: reason}
+}
+
+func (e *SerializationError) Error() string {
+	return fmt.Sprintf("Serialization Error: %s", e.Reason)
+}
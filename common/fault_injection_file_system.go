@@ -0,0 +1,432 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"syscall"
+)
+
+// The kind of fault a FaultInjectionFileSystem injects.
+type FaultType uint8
+
+const (
+	NoFault    FaultType = iota
+	TornWrite            // Only the first half of the N-th write reaches the disk, then the power is lost.
+	FailedSync           // The N-th sync fails, the writes it should have made durable are not.
+	ShortRead            // The N-th read returns only half of the requested bytes.
+	NoSpace              // The N-th write fails with ENOSPC without writing anything.
+	PowerLoss            // The power is lost right before the N-th write.
+)
+
+func (faultType FaultType) String() string {
+	switch faultType {
+	case NoFault:
+		return "NoFault"
+	case TornWrite:
+		return "TornWrite"
+	case FailedSync:
+		return "FailedSync"
+	case ShortRead:
+		return "ShortRead"
+	case NoSpace:
+		return "NoSpace"
+	case PowerLoss:
+		return "PowerLoss"
+	default:
+		return fmt.Sprintf("FaultType(%d)", uint8(faultType))
+	}
+}
+
+// ErrSimulatedCrash is returned (wrapped in an IOError) by every operation of a FaultInjectionFileSystem after it
+// simulated a power loss, until Restart is called.
+var ErrSimulatedCrash = errors.New("simulated power loss")
+
+// ErrInjectedFault is the underlying error of injected failed syncs.
+var ErrInjectedFault = errors.New("injected fault")
+
+// The FaultInjectionFileSystem wraps another FileSystem and injects a single fault at the N-th operation of the
+// faulted kind: reads for ShortRead, syncs for FailedSync and positional writes for all other faults. It is
+// used to test that the database survives crashes.
+//
+// To simulate a power loss, the file system remembers the previous content of every region that is written and not
+// yet synced. Restart rolls back all of those writes, leaving the underlying file system in the state the disk would
+// be in after a power loss, so the database can be reopened on it. Moving and removing files are passed through and
+// cannot be rolled back.
+type FaultInjectionFileSystem struct {
+	FileSystem // The wrapped file system.
+
+	lock      sync.Mutex
+	faultType FaultType
+	faultAt   int  // The fault is injected at the faultAt-th operation of the faulted kind, starting at 1.
+	count     int  // The number of operations of the faulted kind performed since the fault was set.
+	triggered bool // Whether the fault has been injected.
+	crashed   bool // Whether the power was lost, every operation fails until Restart is called.
+	undo      []undoRecord
+}
+
+var _ FileSystem = (*FaultInjectionFileSystem)(nil)
+
+// An undoRecord stores the content of a file region before an unsynced write, rolling it back restores the region.
+type undoRecord struct {
+	path    string
+	offset  int64
+	oldData []byte
+	oldSize int64
+}
+
+type faultInjectionFileHandle struct {
+	fs    *FaultInjectionFileSystem
+	inner FileHandle
+}
+
+func NewFaultInjectionFileSystem(fs FileSystem) *FaultInjectionFileSystem {
+	return &FaultInjectionFileSystem{FileSystem: fs}
+}
+
+// Inject a fault of the given type at the at-th operation of the faulted kind, counting from now on.
+func (fs *FaultInjectionFileSystem) SetFault(faultType FaultType, at int) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	fs.faultType = faultType
+	fs.faultAt = at
+	fs.count = 0
+	fs.triggered = false
+}
+
+// Whether the configured fault has been injected.
+func (fs *FaultInjectionFileSystem) Triggered() bool {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	return fs.triggered
+}
+
+// Simulate a power loss now: all subsequent operations fail until Restart is called.
+func (fs *FaultInjectionFileSystem) Crash() {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	fs.crashed = true
+}
+
+// Restart after a (simulated) crash: roll back every write that was not synced, clear the crashed state and disable
+// the fault. Handles opened before the restart must be closed and reopened.
+func (fs *FaultInjectionFileSystem) Restart() error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	handles := make(map[string]FileHandle)
+
+	defer func() {
+		for _, handle := range handles {
+			handle.Close()
+		}
+	}()
+
+	for i := len(fs.undo) - 1; i >= 0; i-- {
+		record := fs.undo[i]
+		handle, ok := handles[record.path]
+
+		if !ok {
+			var err error
+
+			if handle, err = fs.FileSystem.OpenFile(record.path, WriteOnly, NoLock); err != nil {
+				return err
+			}
+
+			handles[record.path] = handle
+		}
+
+		if len(record.oldData) > 0 {
+			if err := fs.FileSystem.WriteFromOffset(handle, record.oldData, uint64(record.offset)); err != nil {
+				return err
+			}
+		}
+
+		if err := fs.FileSystem.Truncate(handle, record.oldSize); err != nil {
+			return err
+		}
+	}
+
+	fs.undo = nil
+	fs.crashed = false
+	fs.faultType = NoFault
+
+	return nil
+}
+
+// Count an operation of the given kind, returns whether the fault has to be injected now.
+func (fs *FaultInjectionFileSystem) inject(faultTypes ...FaultType) bool {
+	for _, faultType := range faultTypes {
+		if fs.faultType == faultType && !fs.triggered {
+			fs.count++
+
+			if fs.count == fs.faultAt {
+				fs.triggered = true
+				return true
+			}
+
+			return false
+		}
+	}
+
+	return false
+}
+
+func (fs *FaultInjectionFileSystem) crashError(op string, path string) error {
+	return NewIOError(op, path, ErrSimulatedCrash)
+}
+
+// Remember the current content of length bytes at the offset of the file, so that it can be restored by Restart.
+func (fs *FaultInjectionFileSystem) recordUndo(handle *faultInjectionFileHandle, offset int64, length int64) error {
+	size, err := fs.FileSystem.GetFileSize(handle.inner)
+
+	if err != nil {
+		return err
+	}
+
+	record := undoRecord{path: handle.inner.Path(), offset: offset, oldSize: size}
+
+	if end := offset + length; offset < size {
+		if end > size {
+			end = size
+		}
+
+		record.oldData = make([]byte, end-offset)
+
+		if err := fs.FileSystem.ReadFromOffset(handle.inner, record.oldData, uint64(offset)); err != nil {
+			return err
+		}
+	}
+
+	fs.undo = append(fs.undo, record)
+
+	return nil
+}
+
+func (fs *FaultInjectionFileSystem) OpenFile(path string, flags FileFlags, lockType FileLockType) (FileHandle, error) {
+	fs.lock.Lock()
+	crashed := fs.crashed
+	fs.lock.Unlock()
+
+	if crashed {
+		return nil, fs.crashError("open file", path)
+	}
+
+	inner, err := fs.FileSystem.OpenFile(path, flags, lockType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &faultInjectionFileHandle{fs: fs, inner: inner}, nil
+}
+
+func (fs *FaultInjectionFileSystem) ReadFromOffset(handle FileHandle, buffer []byte, offset uint64) error {
+	faultHandle := handle.(*faultInjectionFileHandle)
+	fs.lock.Lock()
+
+	if fs.crashed {
+		fs.lock.Unlock()
+		return fs.crashError("read from file", faultHandle.Path())
+	}
+
+	shortRead := fs.inject(ShortRead)
+	fs.lock.Unlock()
+
+	if shortRead {
+		if err := fs.FileSystem.ReadFromOffset(faultHandle.inner, buffer[:len(buffer)/2], offset); err != nil {
+			return err
+		}
+
+		return NewIOError("read sufficient bytes from file", faultHandle.Path(), io.ErrUnexpectedEOF)
+	}
+
+	return fs.FileSystem.ReadFromOffset(faultHandle.inner, buffer, offset)
+}
+
+func (fs *FaultInjectionFileSystem) WriteFromOffset(handle FileHandle, buffer []byte, offset uint64) error {
+	faultHandle := handle.(*faultInjectionFileHandle)
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	if fs.crashed {
+		return fs.crashError("write file", faultHandle.Path())
+	}
+
+	if !fs.inject(TornWrite, NoSpace, PowerLoss) {
+		if err := fs.recordUndo(faultHandle, int64(offset), int64(len(buffer))); err != nil {
+			return err
+		}
+
+		return fs.FileSystem.WriteFromOffset(faultHandle.inner, buffer, offset)
+	}
+
+	switch fs.faultType {
+	case TornWrite:
+		// The first half of the write reached the disk before the power was lost: it is not rolled back.
+		if err := fs.FileSystem.WriteFromOffset(faultHandle.inner, buffer[:len(buffer)/2], offset); err != nil {
+			return err
+		}
+
+		fs.crashed = true
+
+		return fs.crashError("write file", faultHandle.Path())
+	case NoSpace:
+		return NewIOError("write file", faultHandle.Path(), syscall.ENOSPC)
+	default:
+		fs.crashed = true
+
+		return fs.crashError("write file", faultHandle.Path())
+	}
+}
+
+// Sequential reads go through ReadFromOffset, so that short reads can be injected.
+func (fs *FaultInjectionFileSystem) Read(handle FileHandle, buffer []byte) (int64, error) {
+	faultHandle := handle.(*faultInjectionFileHandle)
+	fs.lock.Lock()
+
+	if fs.crashed {
+		fs.lock.Unlock()
+		return 0, fs.crashError("read from file", faultHandle.Path())
+	}
+
+	shortRead := fs.inject(ShortRead)
+	fs.lock.Unlock()
+
+	if shortRead {
+		buffer = buffer[:len(buffer)/2]
+	}
+
+	return fs.FileSystem.Read(faultHandle.inner, buffer)
+}
+
+// Sequential writes are not rolled back by Restart.
+func (fs *FaultInjectionFileSystem) Write(handle FileHandle, buffer []byte) (int64, error) {
+	faultHandle := handle.(*faultInjectionFileHandle)
+	fs.lock.Lock()
+	crashed := fs.crashed
+	fs.lock.Unlock()
+
+	if crashed {
+		return 0, fs.crashError("write file", faultHandle.Path())
+	}
+
+	return fs.FileSystem.Write(faultHandle.inner, buffer)
+}
+
+func (fs *FaultInjectionFileSystem) GetFileSize(handle FileHandle) (int64, error) {
+	faultHandle := handle.(*faultInjectionFileHandle)
+	fs.lock.Lock()
+	crashed := fs.crashed
+	fs.lock.Unlock()
+
+	if crashed {
+		return -1, fs.crashError("get size of file", faultHandle.Path())
+	}
+
+	return fs.FileSystem.GetFileSize(faultHandle.inner)
+}
+
+func (fs *FaultInjectionFileSystem) Truncate(handle FileHandle, newSize int64) error {
+	faultHandle := handle.(*faultInjectionFileHandle)
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	if fs.crashed {
+		return fs.crashError("truncate file", faultHandle.Path())
+	}
+
+	size, err := fs.FileSystem.GetFileSize(faultHandle.inner)
+
+	if err != nil {
+		return err
+	}
+
+	if newSize < size {
+		if err := fs.recordUndo(faultHandle, newSize, size-newSize); err != nil {
+			return err
+		}
+	} else if err := fs.recordUndo(faultHandle, size, 0); err != nil {
+		return err
+	}
+
+	return fs.FileSystem.Truncate(faultHandle.inner, newSize)
+}
+
+// Sync a file handle, the writes to the file can no longer be rolled back by Restart.
+func (fs *FaultInjectionFileSystem) FileSync(handle FileHandle) error {
+	faultHandle := handle.(*faultInjectionFileHandle)
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	if fs.crashed {
+		return fs.crashError("sync file", faultHandle.Path())
+	}
+
+	if fs.inject(FailedSync) {
+		return NewIOError("sync file", faultHandle.Path(), ErrInjectedFault)
+	}
+
+	if err := fs.FileSystem.FileSync(faultHandle.inner); err != nil {
+		return err
+	}
+
+	// Everything written to the file is durable now.
+	path := faultHandle.inner.Path()
+	undo := fs.undo[:0]
+
+	for _, record := range fs.undo {
+		if record.path != path {
+			undo = append(undo, record)
+		}
+	}
+
+	fs.undo = undo
+
+	return nil
+}
+
+// Sync a directory, which counts as a sync for FailedSync faults.
+func (fs *FaultInjectionFileSystem) SyncDirectory(directory string) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	if fs.crashed {
+		return fs.crashError("sync directory", directory)
+	}
+
+	if fs.inject(FailedSync) {
+		return NewIOError("sync directory", directory, ErrInjectedFault)
+	}
+
+	return fs.FileSystem.SyncDirectory(directory)
+}
+
+func (fs *FaultInjectionFileSystem) SetFilePointer(handle FileHandle, offset uint64) error {
+	return fs.FileSystem.SetFilePointer(handle.(*faultInjectionFileHandle).inner, offset)
+}
+
+func (handle *faultInjectionFileHandle) Read(buffer []byte, offset uint64) error {
+	return handle.fs.ReadFromOffset(handle, buffer, offset)
+}
+
+func (handle *faultInjectionFileHandle) Write(buffer []byte, offset uint64) error {
+	return handle.fs.WriteFromOffset(handle, buffer, offset)
+}
+
+func (handle *faultInjectionFileHandle) Sync() error {
+	return handle.fs.FileSync(handle)
+}
+
+// Close always releases the wrapped handle, also after a crash.
+func (handle *faultInjectionFileHandle) Close() error {
+	return handle.inner.Close()
+}
+
+func (handle *faultInjectionFileHandle) Path() string {
+	return handle.inner.Path()
+}
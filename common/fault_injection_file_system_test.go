@@ -0,0 +1,69 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFaultInjectionFileSystemRestart(t *testing.T) {
+	fs := NewFaultInjectionFileSystem(NewMemoryFileSystem())
+	handle, err := fs.OpenFile("/foo.db", WriteOnly|Create, WriteLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	synced := bytes.Repeat([]byte{1}, 1024)
+	unsynced := bytes.Repeat([]byte{2}, 1024)
+
+	if err := handle.Write(synced, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := handle.Sync(); err != nil {
+		t.Fatal(err)
+	}
+
+	fs.SetFault(PowerLoss, 3)
+
+	// Overwrite the synced data and extend the file, neither write is synced.
+	if err := handle.Write(unsynced, 512); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := handle.Write(unsynced, 2048); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := handle.Write(unsynced, 0); !errors.Is(err, ErrSimulatedCrash) || !fs.Triggered() {
+		t.Fatalf("Expect the third write to lose power, got %v", err)
+	}
+
+	if err := handle.Sync(); !errors.Is(err, ErrSimulatedCrash) {
+		t.Errorf("Expect sync to fail after the power loss, got %v", err)
+	}
+
+	handle.Close()
+
+	if err := fs.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	handle, err = fs.OpenFile("/foo.db", ReadOnly, NoLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	if size, _ := fs.GetFileSize(handle); size != int64(len(synced)) {
+		t.Errorf("Expect file size %d after restart, got %d", len(synced), size)
+	}
+
+	result := make([]byte, len(synced))
+
+	if err := handle.Read(result, 0); err != nil || !bytes.Equal(result, synced) {
+		t.Errorf("Expect only the synced data to survive the restart (%v)", err)
+	}
+}
@@ -0,0 +1,128 @@
+package common
+
+import "fmt"
+
+// The FieldReader reads the fields of an object that was written by a FieldWriter. Fields must be read in increasing
+// order of their ids: fields with ids that are not read are skipped, so that data written by a newer version (with
+// fields this version does not know about) can be read.
+type FieldReader struct {
+	deserializer Deserializer
+	nextField    FieldID // The id of the next field in the data.
+	peeked       bool    // Whether nextField has been read from the data.
+	lastField    FieldID
+	started      bool
+}
+
+func NewFieldReader(deserializer Deserializer) *FieldReader {
+	return &FieldReader{deserializer: deserializer}
+}
+
+// Read a field that must be present, read is called with a Deserializer for the payload of the field.
+func (reader *FieldReader) ReadField(id FieldID, read func(deserializer Deserializer) error) error {
+	present, err := reader.ReadFieldWithDefault(id, read)
+
+	if err != nil {
+		return err
+	}
+
+	if !present {
+		return NewSerializationError(fmt.Sprintf("missing required field %d", id))
+	}
+
+	return nil
+}
+
+// Read a field that may be missing, e.g. because it was added after the data was written, or because it was omitted
+// as it had its default value. Returns whether the field was present; if not, read is not called and the caller keeps
+// the default value.
+func (reader *FieldReader) ReadFieldWithDefault(id FieldID, read func(deserializer Deserializer) error) (bool, error) {
+	if id == FieldTerminator || (reader.started && id <= reader.lastField) {
+		panic(fmt.Sprintf("Field %d read out of order after field %d", id, reader.lastField))
+	}
+
+	reader.lastField = id
+	reader.started = true
+
+	// Skip the fields that this version does not know about.
+	for {
+		nextField, err := reader.peekField()
+
+		if err != nil {
+			return false, err
+		}
+
+		if nextField >= id {
+			break
+		}
+
+		if err := reader.skipField(); err != nil {
+			return false, err
+		}
+	}
+
+	if reader.nextField != id {
+		return false, nil
+	}
+
+	reader.peeked = false
+	payload, err := reader.deserializer.ReadBytes()
+
+	if err != nil {
+		return false, err
+	}
+
+	deserializer := NewBufferedDeserializer(payload)
+
+	if err := read(deserializer); err != nil {
+		return false, err
+	}
+
+	if remaining := deserializer.Remaining(); remaining > 0 {
+		return false, NewSerializationError(fmt.Sprintf("%d trailing bytes after field %d", remaining, id))
+	}
+
+	return true, nil
+}
+
+// Finish reading the object: the remaining fields are skipped up to and including the FieldTerminator.
+func (reader *FieldReader) Finalize() error {
+	for {
+		nextField, err := reader.peekField()
+
+		if err != nil {
+			return err
+		}
+
+		if nextField == FieldTerminator {
+			reader.peeked = false
+
+			return nil
+		}
+
+		if err := reader.skipField(); err != nil {
+			return err
+		}
+	}
+}
+
+func (reader *FieldReader) peekField() (FieldID, error) {
+	if !reader.peeked {
+		id, err := reader.deserializer.ReadUint16()
+
+		if err != nil {
+			return 0, err
+		}
+
+		reader.nextField = FieldID(id)
+		reader.peeked = true
+	}
+
+	return reader.nextField, nil
+}
+
+func (reader *FieldReader) skipField() error {
+	reader.peeked = false
+	_, err := reader.deserializer.ReadBytes()
+
+	return err
+}
@@ -0,0 +1,61 @@
+package common
+
+import "fmt"
+
+// A FieldID identifies a property of a serialized object. Field ids are part of the on-disk format: once a field id has
+// been used for a property, it must never be reused for a different property.
+type FieldID uint16
+
+// The FieldID that terminates the fields of an object.
+const FieldTerminator FieldID = 0xFFFF
+
+// The FieldWriter writes the properties of an object as tagged fields: every field is written as its FieldID followed
+// by its length-prefixed payload, and the object ends with FieldTerminator. This makes the format forward and backward
+// compatible: a reader skips fields it does not know (written by a newer version), and fields that are missing (written
+// by an older version) can be read with a default value.
+type FieldWriter struct {
+	serializer Serializer
+	lastField  FieldID
+	started    bool
+}
+
+func NewFieldWriter(serializer Serializer) *FieldWriter {
+	return &FieldWriter{serializer: serializer}
+}
+
+// Write a field, write is called with a Serializer for the payload of the field. Fields must be written in
+// increasing order of their ids.
+func (writer *FieldWriter) WriteField(id FieldID, write func(serializer Serializer) error) error {
+	if id == FieldTerminator || (writer.started && id <= writer.lastField) {
+		panic(fmt.Sprintf("Field %d written out of order after field %d", id, writer.lastField))
+	}
+
+	writer.lastField = id
+	writer.started = true
+	payload := NewBufferedSerializer()
+
+	if err := write(payload); err != nil {
+		return err
+	}
+
+	if err := writer.serializer.WriteUint16(uint16(id)); err != nil {
+		return err
+	}
+
+	return writer.serializer.WriteBytes(payload.Data())
+}
+
+// Write a field that has a default value. The field is omitted if the value is the default, a reader then falls back to
+// the default as well.
+func (writer *FieldWriter) WriteFieldWithDefault(id FieldID, isDefault bool, write func(serializer Serializer) error) error {
+	if isDefault {
+		return nil
+	}
+
+	return writer.WriteField(id, write)
+}
+
+// Finish the object by writing the FieldTerminator.
+func (writer *FieldWriter) Finalize() error {
+	return writer.serializer.WriteUint16(uint16(FieldTerminator))
+}
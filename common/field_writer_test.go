@@ -0,0 +1,214 @@
+package common
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// The "old" definition of a table: the version of goduckdb that wrote the first files.
+type oldTable struct {
+	Name     string
+	RowCount uint64
+}
+
+func (table *oldTable) Serialize(serializer Serializer) error {
+	writer := NewFieldWriter(serializer)
+
+	if err := writer.WriteField(1, func(serializer Serializer) error { return serializer.WriteString(table.Name) }); err != nil {
+		return err
+	}
+
+	if err := writer.WriteField(2, func(serializer Serializer) error { return serializer.WriteVarint(table.RowCount) }); err != nil {
+		return err
+	}
+
+	return writer.Finalize()
+}
+
+func (table *oldTable) Deserialize(deserializer Deserializer) error {
+	reader := NewFieldReader(deserializer)
+	err := reader.ReadField(1, func(deserializer Deserializer) (err error) {
+		table.Name, err = deserializer.ReadString()
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = reader.ReadField(2, func(deserializer Deserializer) (err error) {
+		table.RowCount, err = deserializer.ReadVarint()
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return reader.Finalize()
+}
+
+// The "new" definition of a table: a later version added an optional comment (field 3, defaults to "") and the column
+// names (field 4, defaults to no columns).
+type newTable struct {
+	Name     string
+	RowCount uint64
+	Comment  string
+	Columns  []string
+}
+
+func (table *newTable) Serialize(serializer Serializer) error {
+	writer := NewFieldWriter(serializer)
+
+	if err := writer.WriteField(1, func(serializer Serializer) error { return serializer.WriteString(table.Name) }); err != nil {
+		return err
+	}
+
+	if err := writer.WriteField(2, func(serializer Serializer) error { return serializer.WriteVarint(table.RowCount) }); err != nil {
+		return err
+	}
+
+	err := writer.WriteFieldWithDefault(3, table.Comment == "", func(serializer Serializer) error {
+		return serializer.WriteString(table.Comment)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteFieldWithDefault(4, len(table.Columns) == 0, func(serializer Serializer) error {
+		return serializer.WriteList(len(table.Columns), func(index int) error {
+			return serializer.WriteString(table.Columns[index])
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return writer.Finalize()
+}
+
+func (table *newTable) Deserialize(deserializer Deserializer) error {
+	reader := NewFieldReader(deserializer)
+	err := reader.ReadField(1, func(deserializer Deserializer) (err error) {
+		table.Name, err = deserializer.ReadString()
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = reader.ReadField(2, func(deserializer Deserializer) (err error) {
+		table.RowCount, err = deserializer.ReadVarint()
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = reader.ReadFieldWithDefault(3, func(deserializer Deserializer) (err error) {
+		table.Comment, err = deserializer.ReadString()
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = reader.ReadFieldWithDefault(4, func(deserializer Deserializer) error {
+		return deserializer.ReadList(func(index int) error {
+			column, err := deserializer.ReadString()
+			table.Columns = append(table.Columns, column)
+
+			return err
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return reader.Finalize()
+}
+
+// Serialize the objects back to back followed by a marker, deserialize them and check that the marker is intact.
+func roundTrip(t *testing.T, objects []Serializable, results []Deserializable) {
+	serializer := NewBufferedSerializer()
+
+	for _, object := range objects {
+		if err := object.Serialize(serializer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	serializer.WriteUint64(0xdeadbeef)
+	deserializer := NewBufferedDeserializer(serializer.Data())
+
+	for _, result := range results {
+		if err := result.Deserialize(deserializer); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if marker, err := deserializer.ReadUint64(); err != nil || marker != 0xdeadbeef {
+		t.Errorf("Expect the data after the objects to be intact, got %x (%v)", marker, err)
+	}
+}
+
+func TestFieldsNewReadsOld(t *testing.T) {
+	old := []*oldTable{{Name: "orders", RowCount: 1500}, {Name: "lineitem", RowCount: 6000}}
+	result := []*newTable{{}, {}}
+	roundTrip(t, []Serializable{old[0], old[1]}, []Deserializable{result[0], result[1]})
+
+	for i := range old {
+		expected := &newTable{Name: old[i].Name, RowCount: old[i].RowCount}
+
+		if !reflect.DeepEqual(result[i], expected) {
+			t.Errorf("Expect %+v, got %+v", expected, result[i])
+		}
+	}
+}
+
+func TestFieldsOldReadsNew(t *testing.T) {
+	table := []*newTable{
+		{Name: "orders", RowCount: 1500, Comment: "all orders", Columns: []string{"o_orderkey", "o_custkey"}},
+		{Name: "lineitem", RowCount: 6000, Columns: []string{"l_orderkey"}},
+	}
+	result := []*oldTable{{}, {}}
+	roundTrip(t, []Serializable{table[0], table[1]}, []Deserializable{result[0], result[1]})
+
+	for i := range table {
+		expected := &oldTable{Name: table[i].Name, RowCount: table[i].RowCount}
+
+		if !reflect.DeepEqual(result[i], expected) {
+			t.Errorf("Expect %+v, got %+v", expected, result[i])
+		}
+	}
+}
+
+func TestFieldsNewReadsNew(t *testing.T) {
+	table := &newTable{Name: "orders", RowCount: 1500, Comment: "all orders", Columns: []string{"o_orderkey"}}
+	result := &newTable{}
+	roundTrip(t, []Serializable{table}, []Deserializable{result})
+
+	if !reflect.DeepEqual(result, table) {
+		t.Errorf("Expect %+v, got %+v", table, result)
+	}
+}
+
+func TestFieldsMissingRequired(t *testing.T) {
+	serializer := NewBufferedSerializer()
+	writer := NewFieldWriter(serializer)
+	writer.WriteField(2, func(serializer Serializer) error { return serializer.WriteVarint(1500) })
+	writer.Finalize()
+
+	var serializationErr *SerializationError
+
+	if err := (&oldTable{}).Deserialize(NewBufferedDeserializer(serializer.Data())); !errors.As(err, &serializationErr) {
+		t.Errorf("Expect a SerializationError, got %v", err)
+	}
+}
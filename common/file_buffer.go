@@ -9,66 +9,86 @@ import (
 const FileBufferBlockSize = 4096
 const FileBufferHeaderSize = uint64(unsafe.Sizeof(uint64(0)))
 
-// The FileBuffer represents a buffer that can be read or written to a Direct IO FileHandle.
+// The FileBuffer represents a buffer that can be read or written to a Direct IO FileHandle. Direct IO requires the
+// memory of the buffer to be aligned, therefore the FileBuffer allocates FileBufferBlockSize-1 additional bytes and
+// reads and writes an aligned slice of that allocation.
 type FileBuffer struct {
-	size         uint64 // The size of the portion that users can write to, this is equivalent to internal_size - FILE_BUFFER_HEADER_SIZE
-	internalSize uint64 // The aligned size as passed to the constructor. This is the size that is read or written to disk.
-	buffer       []byte // The buffer that users can write to
-	// internalBuffer *[]byte // The pointer to the internal buffer that will be read or written, including the buffer header
-	// mallocedBuffer []byte  // The buffer that was actually malloc'd, i.e. the pointer that must be freed when the FileBuffer is destroyed
+	size           uint64 // The size of the portion that users can write to, this is equivalent to internal_size - FILE_BUFFER_HEADER_SIZE
+	internalSize   uint64 // The aligned size as passed to the constructor. This is the size that is read or written to disk.
+	buffer         []byte // The buffer that users can write to
+	internalBuffer []byte // The internal buffer that will be read or written, including the buffer header
+	mallocedBuffer []byte // The buffer that was actually allocated, internalBuffer is an aligned slice of it
 }
 
-// TODO: ignore the alignment
+// Create a new FileBuffer, bufSize must be a multiple of FileBufferBlockSize.
 func NewFileBuffer(bufSize uint64) *FileBuffer {
+	if bufSize%FileBufferBlockSize != 0 {
+		panic(fmt.Sprintf("FileBuffer size %d is not a multiple of %d", bufSize, FileBufferBlockSize))
+	}
+
+	mallocedBuffer := make([]byte, bufSize+FileBufferBlockSize-1)
+	unalignedPtr := uint64(uintptr(unsafe.Pointer(&mallocedBuffer[0])))
+	alignedPtr := unalignedPtr
+
+	if remainder := alignedPtr % FileBufferBlockSize; remainder != 0 {
+		alignedPtr += FileBufferBlockSize - remainder
+	}
+
+	internalBuffer := mallocedBuffer[alignedPtr-unalignedPtr : alignedPtr-unalignedPtr+bufSize]
+
 	return &FileBuffer{
-		size:         bufSize - FileBufferHeaderSize,
-		internalSize: bufSize,
-		buffer:       make([]byte, bufSize),
+		buffer:         internalBuffer[FileBufferHeaderSize:],
+		size:           bufSize - FileBufferHeaderSize,
+		internalBuffer: internalBuffer,
+		internalSize:   bufSize,
+		mallocedBuffer: mallocedBuffer,
 	}
-	// mallocedBuffer := make([]byte, bufSize+FileBufferBlockSize-1)
-	// unalignedPtr := uint64(uintptr(unsafe.Pointer(&mallocedBuffer[0])))
-	// alignedPtr := unalignedPtr
-
-	// if remainder := alignedPtr % FileBufferBlockSize; remainder != 0 {
-	// 	alignedPtr += FileBufferBlockSize - remainder
-	// }
-
-	// internalBuffer := mallocedBuffer[alignedPtr-unalignedPtr:]
-	// internalSize := bufSize
-	// buffer := internalBuffer[FileBufferHeaderSize:]
-	// size := internalSize - FileBufferHeaderSize
-
-	// return &FileBuffer{
-	// 	buffer:         buffer,
-	// 	size:           size,
-	// 	internalBuffer: internalBuffer,
-	// 	internalSize:   bufSize,
-	// 	mallocedBuffer: mallocedBuffer,
-	// }
 }
 
 func (fb *FileBuffer) Buffer() []byte {
-	return fb.buffer[FileBufferHeaderSize:]
+	return fb.buffer
 }
 
 func (fb *FileBuffer) Size() uint64 {
 	return fb.size
 }
 
-func (fb *FileBuffer) Read(handle FileHandle, offset uint64) {
-	handle.Read(fb.buffer, offset)
-	storedChecksum := binary.LittleEndian.Uint64(fb.buffer[:FileBufferHeaderSize])
-	computedChecksum := Checksum(fb.buffer[FileBufferHeaderSize:])
+// Read the buffer from the specified offset in the file and verify its checksum with the given algorithm. Returns a
+// *CorruptionError if the stored checksum does not match the content of the buffer.
+func (fb *FileBuffer) Read(handle FileHandle, offset uint64, checksumType ChecksumType) error {
+	if err := fb.ReadUnchecked(handle, offset); err != nil {
+		return err
+	}
+
+	return fb.Verify(handle.Path(), offset, checksumType)
+}
+
+// Read the buffer from the specified offset in the file without verifying its checksum. This is used when the
+// checksum algorithm is only known after (part of) the buffer has been read, e.g. for the MainHeader.
+func (fb *FileBuffer) ReadUnchecked(handle FileHandle, offset uint64) error {
+	return handle.Read(fb.internalBuffer, offset)
+}
+
+// Verify that the stored checksum of the buffer, which was read from the specified offset in the file, matches its
+// content.
+func (fb *FileBuffer) Verify(path string, offset uint64, checksumType ChecksumType) error {
+	storedChecksum := binary.LittleEndian.Uint64(fb.internalBuffer)
+	computedChecksum := ComputeChecksum(checksumType, fb.buffer)
 
 	if computedChecksum != storedChecksum {
-		panic(fmt.Sprintf("Corrupt database file: computed checksum %x does not match stored checksum %x in block", computedChecksum, storedChecksum))
+		return NewCorruptionError(path, offset,
+			fmt.Sprintf("computed %s checksum %x does not match stored checksum %x in block", checksumType, computedChecksum, storedChecksum))
 	}
+
+	return nil
 }
 
-func (fb *FileBuffer) Write(handle FileHandle, offset uint64) {
-	checksum := Checksum(fb.buffer[FileBufferHeaderSize:])
-	binary.LittleEndian.PutUint64(fb.buffer, checksum)
-	handle.Write(fb.buffer, offset)
+// Compute the checksum of the buffer with the given algorithm and write the buffer to the specified offset in the file.
+func (fb *FileBuffer) Write(handle FileHandle, offset uint64, checksumType ChecksumType) error {
+	checksum := ComputeChecksum(checksumType, fb.buffer)
+	binary.LittleEndian.PutUint64(fb.internalBuffer, checksum)
+
+	return handle.Write(fb.internalBuffer, offset)
 }
 
 func bzero(data []byte) {
@@ -78,5 +98,5 @@ func bzero(data []byte) {
 }
 
 func (fb *FileBuffer) Clear() {
-	bzero(fb.buffer)
+	bzero(fb.internalBuffer)
 }
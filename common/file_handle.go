@@ -2,39 +2,59 @@ package common
 
 import "os"
 
+// A FileHandle is an open file of a FileSystem. Read and Write are positional: they read or write exactly len(buffer)
+// bytes at the given offset without using a shared file pointer, so a single handle can safely be used concurrently by
+// many goroutines (e.g. scan threads reading different blocks).
 type FileHandle interface {
-	Read(buffer []byte, offset uint64)
-	Write(buffer []byte, offset uint64)
-	Sync()
-	Close()
+	Read(buffer []byte, offset uint64) error
+	Write(buffer []byte, offset uint64) error
+	Sync() error
+	Close() error
+	Path() string
 }
 
 type UnixFileHandle struct {
-	*FileSystem
-	file *os.File
-	path string
+	*LocalFileSystem
+	file     *os.File
+	path     string
+	directIO bool // Whether reads and writes bypass the page cache.
 }
 
-func NewFileHandle(fs *FileSystem, file *os.File, path string) *UnixFileHandle {
+func NewFileHandle(fs *LocalFileSystem, file *os.File, path string, directIO bool) *UnixFileHandle {
 	return &UnixFileHandle{
-		FileSystem: fs,
-		file:       file,
-		path:       path,
+		LocalFileSystem: fs,
+		file:            file,
+		path:            path,
+		directIO:        directIO,
 	}
 }
 
-func (handle *UnixFileHandle) Read(buffer []byte, offset uint64) {
-	handle.ReadFromOffset(handle, buffer, offset)
+func (handle *UnixFileHandle) Read(buffer []byte, offset uint64) error {
+	return handle.ReadFromOffset(handle, buffer, offset)
 }
 
-func (handle *UnixFileHandle) Write(buffer []byte, offset uint64) {
-	handle.WriteFromOffset(handle, buffer, offset)
+func (handle *UnixFileHandle) Write(buffer []byte, offset uint64) error {
+	return handle.WriteFromOffset(handle, buffer, offset)
 }
 
-func (handle *UnixFileHandle) Sync() {
-	handle.FileSync(handle)
+func (handle *UnixFileHandle) Sync() error {
+	return handle.FileSync(handle)
 }
 
-func (handle *UnixFileHandle) Close() {
-	handle.file.Close()
+func (handle *UnixFileHandle) Close() error {
+	if err := handle.file.Close(); err != nil {
+		return NewIOError("close file", handle.path, err)
+	}
+
+	return nil
+}
+
+func (handle *UnixFileHandle) Path() string {
+	return handle.path
+}
+
+// Whether the file was opened with direct IO. This is false if direct IO was requested but is not supported by the
+// file system, in which case the handle falls back to buffered IO.
+func (handle *UnixFileHandle) DirectIO() bool {
+	return handle.directIO
 }
@@ -1,13 +1,5 @@
 package common
 
-import (
-	"fmt"
-	"io"
-	"os"
-	"path/filepath"
-	"syscall"
-)
-
 type FileLockType uint8
 type FileFlags uint8
 
@@ -24,238 +16,52 @@ const (
 	Create
 )
 
-type FileSystem struct{}
-
-func (fs *FileSystem) OpenFile(path string, flags FileFlags, lockType FileLockType) FileHandle {
-	var openFlags int
-
-	if flags&ReadOnly != 0 {
-		openFlags = os.O_RDONLY
-	} else {
-		// TODO: seems no O_CLOEXEC
-		// since we don't need to fork, just ignore it temporarily
-		openFlags = os.O_RDWR
-
-		if flags&Create != 0 {
-			openFlags |= os.O_CREATE
-		}
-	}
-
-	// OSX does not have O_DIRECT, instead we need to use fcntl afterwards to support direct IO
-	if flags&DirectIO != 0 {
-		openFlags |= os.O_SYNC
-	}
-
-	file, err := os.OpenFile(path, openFlags, 0666)
-
-	if err != nil {
-		panic("Cannot open file " + path)
-	}
-
-	if flags&DirectIO != 0 {
-		_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, file.Fd(), syscall.F_NOCACHE, 1)
-
-		if errno != 0 {
-			panic("Could not enable direct IO for file " + path)
-		}
-	}
-
-	// Set lock on file.
-	if lockType != NoLock {
-		flock := syscall.Flock_t{
-			Type:   syscall.F_RDLCK,
-			Whence: io.SeekStart,
-			Start:  0,
-			Len:    0,
-		}
-
-		if lockType == WriteLock {
-			flock.Type = syscall.F_WRLCK
-		}
-
-		err := syscall.FcntlFlock(file.Fd(), syscall.F_SETLK, &flock)
-
-		if err != nil {
-			file.Close()
-			panic("Could not set lock on file " + path)
-		}
-	}
-
-	return NewFileHandle(fs, file, path)
-}
-
-// Read exactly nbytes from the specified offset in the file. Fails if nbytes could not be read.
-// This is equivalent to calling SetFilePointer(offset) followed by calling Read().
-func (fs *FileSystem) ReadFromOffset(handle FileHandle, buffer []byte, offset uint64) {
-	fs.SetFilePointer(handle, offset)
-	fs.Read(handle, buffer)
-}
-
-// TODO: consider syscall.Read
-func (fs *FileSystem) Read(handle FileHandle, buffer []byte) int64 {
-	unixHandle := handle.(*UnixFileHandle)
-	file := unixHandle.file
-	bytesRead, err := file.Read(buffer)
-
-	if err != nil {
-		panic("Could not read from file " + unixHandle.path)
-	}
-
-	return int64(bytesRead)
-}
-
-// Write nbyte from the buffer into the file, moving the file pointer forward by nbyte.
-func (fs *FileSystem) Write(handle FileHandle, buffer []byte) int64 {
-	unixHandle := handle.(*UnixFileHandle)
-	file := unixHandle.file
-	n, err := file.Write(buffer)
-
-	if err != nil {
-		panic("Could not write file " + unixHandle.path)
-	}
-
-	return int64(n)
-}
-
-func (fs *FileSystem) WriteFromOffset(handle FileHandle, buffer []byte, offset uint64) {
-	fs.SetFilePointer(handle, offset)
-	bytesWritten := fs.Write(handle, buffer)
-
-	if bytesWritten != int64(len(buffer)) {
-		panic("Could not write sufficient bytes from file " + handle.(*UnixFileHandle).path)
-	}
-}
-
-// Returns the file size of a file handle, returns -1 on error
-func (fs *FileSystem) GetFileSize(handle FileHandle) int64 {
-	unixHandle := handle.(*UnixFileHandle)
-	file := unixHandle.file
-	fileInfo, err := file.Stat()
-
-	if err != nil {
-		return -1
-	}
-
-	return fileInfo.Size()
-}
-
-// Check if a directory exists.
-func (fs *FileSystem) DirectoryExists(directory string) bool {
-	fileInfo, err := os.Stat(directory)
-
-	if err != nil {
-		// if os.IsNotExist(err) {
-		// 	return false
-		// }
-		return false
-	}
-
-	return fileInfo.IsDir()
-}
-
-// Create a directory if it does not exist.
-func (fs *FileSystem) CreateDirectory(directory string) {
-	if !fs.DirectoryExists(directory) {
-		err := os.Mkdir(directory, 0755)
-
-		if err != nil {
-			panic("Failed create directory!")
-		}
-	}
-}
-
-func (fs *FileSystem) RemoveDirectory(directory string) {
-	err := os.RemoveAll(directory)
-
-	if err != nil {
-		fmt.Println(err)
-	}
-}
-
-// List files in a directory, invoking the callback method for each one
-// TODO: do we need to callback directory?
-func (fs *FileSystem) ListFiles(directory string, callback func(string)) bool {
-	if !fs.DirectoryExists(directory) {
-		return false
-	}
-
-	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if !info.IsDir() {
-			callback(info.Name())
-		}
-
-		return nil
-	})
-
-	if err != nil {
-		panic(err)
-	}
-
-	return true
-}
-
-// Move a file from source path to the target, StorageManager relies on this being an atomic action for ACID
-// properties
-func (fs *FileSystem) MoveFile(source string, target string) {
-	// TODO: FIXME: rename does not guarantee atomicity or overwriting target file if it exists
-	err := os.Rename(source, target)
-
-	if err != nil {
-		panic(err)
-	}
-}
-
-func (fs *FileSystem) FileExists(filename string) bool {
-	_, err := os.Stat(filename)
-
-	if err == nil {
-		return true
-	}
-
-	if os.IsNotExist(err) {
-		return false
-	}
-
-	panic(err)
-}
-
-func (fs *FileSystem) RemoveFile(filename string) {
-	err := os.Remove(filename)
-
-	if err != nil {
-		panic(err)
-	}
-}
-
-// Path separator for the current file system.
-func (fs *FileSystem) PathSeparator() string {
-	return string(filepath.Separator)
-}
-
-// Join two paths together.
-func (fs *FileSystem) JoinPath(a string, b string) string {
-	return filepath.Join(a, b)
-}
-
-// Sync a file handle to disk.
-func (fs *FileSystem) FileSync(handle FileHandle) {
-	unixHandle := handle.(*UnixFileHandle)
-	file := unixHandle.file
-	file.Sync()
-}
-
-// Set the file pointer of a file handle to a specified offset.
-// Reads and writes will happen from this location
-func (fs *FileSystem) SetFilePointer(handle FileHandle, offset uint64) {
-	unixHandle := handle.(*UnixFileHandle)
-	file := unixHandle.file
-	_, err := file.Seek(int64(offset), os.SEEK_SET)
-
-	if err != nil {
-		panic(fmt.Sprintf("Could not seek to location %d for file %s", offset, unixHandle.path))
-	}
+// The FileSystem is an abstraction over the file system the database is stored on. The LocalFileSystem backs a
+// database with the local disk, but any implementation (virtual, instrumented, test, ...) can be plugged in through
+// the DBConfig. A FileSystem only has to understand the FileHandles that it created itself. Failing operations return
+// an *IOError (or a *LockConflictError when a lock cannot be acquired) wrapping the underlying error.
+type FileSystem interface {
+	// Open a file, creating it first if the Create flag is set and the file does not exist.
+	OpenFile(path string, flags FileFlags, lockType FileLockType) (FileHandle, error)
+	// Read exactly len(buffer) bytes from the specified offset in the file. Fails if len(buffer) could not be read.
+	// Positional reads do not use the file pointer and must be safe for concurrent use.
+	ReadFromOffset(handle FileHandle, buffer []byte, offset uint64) error
+	// Write exactly len(buffer) bytes to the specified offset in the file. Fails if len(buffer) could not be written.
+	// Positional writes do not use the file pointer and must be safe for concurrent use.
+	WriteFromOffset(handle FileHandle, buffer []byte, offset uint64) error
+	// Read at most len(buffer) bytes from the current file pointer, moving the file pointer forward. Returns 0 at the
+	// end of the file. Sequential reads share the file pointer of the handle and are not safe for concurrent use.
+	Read(handle FileHandle, buffer []byte) (int64, error)
+	// Write len(buffer) bytes to the current file pointer, moving the file pointer forward. Sequential writes share
+	// the file pointer of the handle and are not safe for concurrent use.
+	Write(handle FileHandle, buffer []byte) (int64, error)
+	// Returns the file size of a file handle.
+	GetFileSize(handle FileHandle) (int64, error)
+	// Truncate (or extend) a file to the given size.
+	Truncate(handle FileHandle, newSize int64) error
+	// Check if a directory exists.
+	DirectoryExists(directory string) bool
+	// Create a directory if it does not exist.
+	CreateDirectory(directory string) error
+	// Recursively remove a directory and all files in it.
+	RemoveDirectory(directory string) error
+	// List files in a directory, invoking the callback method for each one. Returns false if the directory does not exist.
+	ListFiles(directory string, callback func(string)) (bool, error)
+	// Move a file from source path to the target, StorageManager relies on this being an atomic action for ACID
+	// properties.
+	MoveFile(source string, target string) error
+	// Check if a file exists.
+	FileExists(filename string) (bool, error)
+	// Remove a file from disk.
+	RemoveFile(filename string) error
+	// Path separator for the current file system.
+	PathSeparator() string
+	// Join two paths together.
+	JoinPath(a string, b string) string
+	// Sync a file handle to disk.
+	FileSync(handle FileHandle) error
+	// Sync a directory to disk, which makes the files that were created, moved or removed in it durable.
+	SyncDirectory(directory string) error
+	// Set the file pointer of a file handle to a specified offset. Reads and writes will happen from this location.
+	SetFilePointer(handle FileHandle, offset uint64) error
 }
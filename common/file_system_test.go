@@ -1,6 +1,15 @@
 package common
 
-import "testing"
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"unsafe"
+)
 
 // func TestOpenFile(t *testing.T) {
 // 	fs := &FileSystem{}
@@ -73,7 +82,7 @@ import "testing"
 // }
 
 func TestFileSystem(t *testing.T) {
-	fs := &FileSystem{}
+	fs := NewLocalFileSystem()
 
 	if !fs.DirectoryExists("/tmp") {
 		t.Errorf("Expect /tmp directory exists.")
@@ -82,16 +91,30 @@ func TestFileSystem(t *testing.T) {
 	text := "Hello World!"
 	dir := "/tmp/goduckdb"
 
-	fs.CreateDirectory(dir)
-	handle := fs.OpenFile(dir+fs.PathSeparator()+"foo.txt", WriteOnly|Create, NoLock)
+	if err := fs.CreateDirectory(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	handle, err := fs.OpenFile(dir+fs.PathSeparator()+"foo.txt", WriteOnly|Create, NoLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	buffer := NewFileBuffer(4096)
 	for i := range text {
 		buffer.Buffer()[i] = text[i]
 	}
-	buffer.Write(handle, 0)
+
+	if err := buffer.Write(handle, 0, DefaultChecksumType); err != nil {
+		t.Fatal(err)
+	}
 
 	buffer.Clear()
-	buffer.Read(handle, 0)
+
+	if err := buffer.Read(handle, 0, DefaultChecksumType); err != nil {
+		t.Fatal(err)
+	}
 
 	for i := range text {
 		if b := buffer.Buffer()[i]; b != text[i] {
@@ -101,3 +124,149 @@ func TestFileSystem(t *testing.T) {
 
 	handle.Close()
 }
+
+func TestFileSystemErrors(t *testing.T) {
+	fs := NewLocalFileSystem()
+	dir := t.TempDir()
+
+	_, err := fs.OpenFile(fs.JoinPath(dir, "missing.db"), ReadOnly, NoLock)
+	var ioErr *IOError
+
+	if !errors.As(err, &ioErr) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expect an IOError wrapping os.ErrNotExist, got %v", err)
+	}
+
+	handle, err := fs.OpenFile(fs.JoinPath(dir, "corrupt.db"), WriteOnly|Create, NoLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	buffer := NewFileBuffer(4096)
+
+	if err := buffer.Write(handle, 0, DefaultChecksumType); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a byte of the content, the checksum no longer matches.
+	if err := fs.WriteFromOffset(handle, []byte{42}, 100); err != nil {
+		t.Fatal(err)
+	}
+
+	var corruptionErr *CorruptionError
+
+	if err := buffer.Read(handle, 0, DefaultChecksumType); !errors.As(err, &corruptionErr) {
+		t.Errorf("Expect a CorruptionError, got %v", err)
+	}
+
+	// Reading beyond the end of the file cannot read sufficient bytes.
+	if err := buffer.Read(handle, 4096, DefaultChecksumType); !errors.As(err, &ioErr) {
+		t.Errorf("Expect an IOError, got %v", err)
+	}
+}
+
+func TestDirectIO(t *testing.T) {
+	fs := NewLocalFileSystem()
+	dirs := []string{t.TempDir()}
+
+	// tmpfs rejects O_DIRECT, opening a file on it falls back to buffered IO.
+	if runtime.GOOS == "linux" && fs.DirectoryExists("/dev/shm") {
+		dir, err := os.MkdirTemp("/dev/shm", "goduckdb")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		dirs = append(dirs, dir)
+	}
+
+	for _, dir := range dirs {
+		handle, err := fs.OpenFile(fs.JoinPath(dir, "direct.db"), WriteOnly|Create|DirectIO, WriteLock)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buffer := NewFileBuffer(FileBufferBlockSize * 2)
+
+		if ptr := uintptr(unsafe.Pointer(&buffer.internalBuffer[0])); ptr%FileBufferBlockSize != 0 {
+			t.Errorf("Expect FileBuffer to be aligned to %d bytes, got address %x", FileBufferBlockSize, ptr)
+		}
+
+		copy(buffer.Buffer(), "direct")
+
+		if err := buffer.Write(handle, FileBufferBlockSize, DefaultChecksumType); err != nil {
+			t.Fatalf("Direct IO: %v, write: %v", handle.(*UnixFileHandle).DirectIO(), err)
+		}
+
+		buffer.Clear()
+
+		if err := buffer.Read(handle, FileBufferBlockSize, DefaultChecksumType); err != nil {
+			t.Fatalf("Direct IO: %v, read: %v", handle.(*UnixFileHandle).DirectIO(), err)
+		}
+
+		if got := string(buffer.Buffer()[:6]); got != "direct" {
+			t.Errorf("Expect %q, got %q", "direct", got)
+		}
+
+		handle.Close()
+	}
+}
+
+func TestConcurrentPositionalIO(t *testing.T) {
+	fs := NewLocalFileSystem()
+	handle, err := fs.OpenFile(fs.JoinPath(t.TempDir(), "positional.db"), WriteOnly|Create, NoLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	const chunkCount = 64
+	const chunkSize = 512
+	var wg sync.WaitGroup
+
+	for i := 0; i < chunkCount; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			chunk := bytes.Repeat([]byte{byte(i)}, chunkSize)
+
+			if err := handle.Write(chunk, uint64(i*chunkSize)); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i := 0; i < chunkCount; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			chunk := make([]byte, chunkSize)
+
+			if err := handle.Read(chunk, uint64(i*chunkSize)); err != nil {
+				t.Error(err)
+				return
+			}
+
+			if !bytes.Equal(chunk, bytes.Repeat([]byte{byte(i)}, chunkSize)) {
+				t.Errorf("Expect chunk %d to only contain %d", i, i)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	// A read that crosses the end of the file cannot be satisfied.
+	if err := handle.Read(make([]byte, chunkSize), uint64((chunkCount-1)*chunkSize+1)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expect io.ErrUnexpectedEOF, got %v", err)
+	}
+}
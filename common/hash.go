@@ -1,6 +1,12 @@
 package common
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+)
+
+// The hash of a NULL value.
+const NullHash uint64 = 0xbf58476d1ce4e5b9
 
 // efficient hash function that maximizes the avalanche effect and minimizes
 // bias
@@ -24,35 +30,104 @@ func murmurhash64(x uint64) uint64 {
 	return x
 }
 
-// TODO: fix me
+// Integers are sign-extended to 64 bits before hashing, so that equal values of different integer types (e.g. an
+// int32 join key and an int64 join key) have the same hash.
+type integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+func hashInteger[T integer](x T) uint64 {
+	return murmurhash64(uint64(x))
+}
+
+func hashBool(x bool) uint64 {
+	if x {
+		return murmurhash64(1)
+	}
+
+	return murmurhash64(0)
+}
+
+// Floats that compare equal must have the same hash: -0.0 is normalized to 0.0, and all NaNs (which are considered
+// equal to each other by joins and group-bys) to a single NaN. A float32 is widened to a float64, which is exact.
 func hashFloat32(x float32) uint64 {
-	panic("hashFloat32.")
+	return hashFloat64(float64(x))
 }
 
 func hashFloat64(x float64) uint64 {
-	panic("hashFloat32.")
+	if x == 0 {
+		x = 0
+	} else if math.IsNaN(x) {
+		x = math.NaN()
+	}
+
+	return murmurhash64(math.Float64bits(x))
 }
 
-func hashString(x string) uint64 {
-	var hash uint64 = 5381
+// Strings are hashed 8 bytes at a time, the remaining bytes are packed into a single (zero padded) word.
+func hashString[T string | []byte](x T) uint64 {
+	hash := murmurhash64(uint64(len(x)))
 
-	for i := range x {
-		hash = ((hash << 5) + hash) + uint64(x[i])
+	for ; len(x) >= 8; x = x[8:] {
+		hash = CombineHash(hash, murmurhash64(loadWord(x[:8])))
+	}
+
+	if len(x) > 0 {
+		hash = CombineHash(hash, murmurhash64(loadWord(x)))
 	}
 
 	return hash
 }
 
+// Load up to 8 bytes as a little-endian word.
+func loadWord[T string | []byte](x T) uint64 {
+	var word uint64
+
+	for i := len(x) - 1; i >= 0; i-- {
+		word = word<<8 | uint64(x[i])
+	}
+
+	return word
+}
+
 func hashBytes(x []byte) uint64 {
-	return hashString(string(x))
+	return hashString(x)
+}
+
+// Combine the hash of a key column with the hash of the preceding key columns of a multi-column key. The combination
+// is not commutative: the keys (a, b) and (b, a) have different hashes.
+func CombineHash(left uint64, right uint64) uint64 {
+	return (left * 0xbf58476d1ce4e5b9) ^ right
 }
 
+// Hash a single value. A nil value hashes to NullHash, and a []interface{} is a composite key whose hash combines the
+// hashes of its values.
 func Hash(val interface{}) uint64 {
 	switch v := val.(type) {
-	case uint64:
-		return murmurhash64(v)
+	case nil:
+		return NullHash
+	case bool:
+		return hashBool(v)
+	case int:
+		return hashInteger(v)
+	case int8:
+		return hashInteger(v)
+	case int16:
+		return hashInteger(v)
+	case int32:
+		return hashInteger(v)
 	case int64:
-		return murmurhash64(uint64(v))
+		return hashInteger(v)
+	case uint:
+		return hashInteger(v)
+	case uint8:
+		return hashInteger(v)
+	case uint16:
+		return hashInteger(v)
+	case uint32:
+		return hashInteger(v)
+	case uint64:
+		return hashInteger(v)
 	case float32:
 		return hashFloat32(v)
 	case float64:
@@ -61,6 +136,118 @@ func Hash(val interface{}) uint64 {
 		return hashString(v)
 	case []byte:
 		return hashBytes(v)
+	case []interface{}:
+		if len(v) == 0 {
+			return NullHash
+		}
+
+		hash := Hash(v[0])
+
+		for _, value := range v[1:] {
+			hash = CombineHash(hash, Hash(value))
+		}
+
+		return hash
+	default:
+		panic(fmt.Sprintf("Default: %T", v))
+	}
+}
+
+func hashSlice[T any](values []T, result []uint64, hash func(T) uint64) {
+	result = result[:len(values)]
+
+	for i, value := range values {
+		result[i] = hash(value)
+	}
+}
+
+func combineHashSlice[T any](values []T, hashes []uint64, hash func(T) uint64) {
+	hashes = hashes[:len(values)]
+
+	for i, value := range values {
+		hashes[i] = CombineHash(hashes[i], hash(value))
+	}
+}
+
+// Hash a column of values into the result vector, which must be at least as long as the column. The values are a
+// typed slice (e.g. []int32 or []string), so that the column is hashed without boxing each value in an interface; a
+// []interface{} column is hashed value by value, with nil values hashing to NullHash.
+func HashVector(values interface{}, result []uint64) {
+	switch v := values.(type) {
+	case []bool:
+		hashSlice(v, result, hashBool)
+	case []int:
+		hashSlice(v, result, hashInteger[int])
+	case []int8:
+		hashSlice(v, result, hashInteger[int8])
+	case []int16:
+		hashSlice(v, result, hashInteger[int16])
+	case []int32:
+		hashSlice(v, result, hashInteger[int32])
+	case []int64:
+		hashSlice(v, result, hashInteger[int64])
+	case []uint:
+		hashSlice(v, result, hashInteger[uint])
+	case []uint8:
+		hashSlice(v, result, hashInteger[uint8])
+	case []uint16:
+		hashSlice(v, result, hashInteger[uint16])
+	case []uint32:
+		hashSlice(v, result, hashInteger[uint32])
+	case []uint64:
+		hashSlice(v, result, hashInteger[uint64])
+	case []float32:
+		hashSlice(v, result, hashFloat32)
+	case []float64:
+		hashSlice(v, result, hashFloat64)
+	case []string:
+		hashSlice(v, result, hashString[string])
+	case [][]byte:
+		hashSlice(v, result, hashBytes)
+	case []interface{}:
+		hashSlice(v, result, Hash)
+	default:
+		panic(fmt.Sprintf("Default: %T", v))
+	}
+}
+
+// Combine the hashes of the preceding key columns of a multi-column key with the hashes of the next key column. For a
+// key (a, b), HashVector(a, hashes) followed by CombineHashVector(b, hashes) gives the same hashes as Hash on each
+// []interface{}{a[i], b[i]}.
+func CombineHashVector(values interface{}, hashes []uint64) {
+	switch v := values.(type) {
+	case []bool:
+		combineHashSlice(v, hashes, hashBool)
+	case []int:
+		combineHashSlice(v, hashes, hashInteger[int])
+	case []int8:
+		combineHashSlice(v, hashes, hashInteger[int8])
+	case []int16:
+		combineHashSlice(v, hashes, hashInteger[int16])
+	case []int32:
+		combineHashSlice(v, hashes, hashInteger[int32])
+	case []int64:
+		combineHashSlice(v, hashes, hashInteger[int64])
+	case []uint:
+		combineHashSlice(v, hashes, hashInteger[uint])
+	case []uint8:
+		combineHashSlice(v, hashes, hashInteger[uint8])
+	case []uint16:
+		combineHashSlice(v, hashes, hashInteger[uint16])
+	case []uint32:
+		combineHashSlice(v, hashes, hashInteger[uint32])
+	case []uint64:
+		combineHashSlice(v, hashes, hashInteger[uint64])
+	case []float32:
+		combineHashSlice(v, hashes, hashFloat32)
+	case []float64:
+		combineHashSlice(v, hashes, hashFloat64)
+	case []string:
+		combineHashSlice(v, hashes, hashString[string])
+	case [][]byte:
+		combineHashSlice(v, hashes, hashBytes)
+	case []interface{}:
+		combineHashSlice(v, hashes, Hash)
 	default:
 		panic(fmt.Sprintf("Default: %T", v))
 	}
@@ -0,0 +1,143 @@
+package common
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestHashFloats(t *testing.T) {
+	negativeZero := math.Copysign(0, -1)
+
+	if Hash(negativeZero) != Hash(0.0) {
+		t.Errorf("Expect -0.0 and 0.0 to have the same hash")
+	}
+
+	if Hash(float32(negativeZero)) != Hash(float32(0)) {
+		t.Errorf("Expect float32 -0.0 and 0.0 to have the same hash")
+	}
+
+	otherNaN := math.Float64frombits(math.Float64bits(math.NaN()) | 1)
+
+	if Hash(math.NaN()) != Hash(otherNaN) || Hash(math.NaN()) != Hash(float32(math.NaN())) {
+		t.Errorf("Expect all NaNs to have the same hash")
+	}
+
+	if Hash(float32(1.5)) != Hash(1.5) {
+		t.Errorf("Expect float32 and float64 1.5 to have the same hash")
+	}
+
+	if Hash(1.5) == Hash(2.5) {
+		t.Errorf("Expect 1.5 and 2.5 to have different hashes")
+	}
+}
+
+func TestHashTypes(t *testing.T) {
+	if Hash(int8(-1)) != Hash(int64(-1)) || Hash(int32(7)) != Hash(uint16(7)) {
+		t.Errorf("Expect equal integers of different types to have the same hash")
+	}
+
+	if Hash(true) == Hash(false) {
+		t.Errorf("Expect true and false to have different hashes")
+	}
+
+	if Hash(nil) != NullHash {
+		t.Errorf("Expect nil to hash to NullHash")
+	}
+
+	if Hash("duckdb") != Hash([]byte("duckdb")) {
+		t.Errorf("Expect a string and its bytes to have the same hash")
+	}
+
+	// Strings that only differ in their length or in a single byte of their tail.
+	strings := []string{"", "a", "a\x00", "abcdefgh", "abcdefgh\x00", "abcdefghi", "abcdefghj"}
+	seen := make(map[uint64]string)
+
+	for _, value := range strings {
+		if other, ok := seen[Hash(value)]; ok {
+			t.Errorf("Expect %q and %q to have different hashes", value, other)
+		}
+
+		seen[Hash(value)] = value
+	}
+
+	if Hash([]interface{}{int64(1), "a"}) != CombineHash(Hash(int64(1)), Hash("a")) {
+		t.Errorf("Expect a composite key to combine the hashes of its values")
+	}
+
+	if Hash([]interface{}{int64(1), int64(2)}) == Hash([]interface{}{int64(2), int64(1)}) {
+		t.Errorf("Expect (1, 2) and (2, 1) to have different hashes")
+	}
+}
+
+func TestHashVector(t *testing.T) {
+	columns := []interface{}{
+		[]bool{true, false, true},
+		[]int8{-1, 0, 1},
+		[]int16{-1, 0, 1},
+		[]int32{-1, 0, 1},
+		[]int64{-1, 0, 1},
+		[]uint32{1, 2, 3},
+		[]uint64{1, 2, 3},
+		[]float32{-0.0, 1.5, float32(math.NaN())},
+		[]float64{-0.0, 1.5, math.NaN()},
+		[]string{"", "a", "abcdefghijkl"},
+		[][]byte{nil, []byte("a"), []byte("abcdefghijkl")},
+		[]interface{}{nil, int64(1), "a"},
+	}
+
+	for _, column := range columns {
+		values := toInterfaces(column)
+		hashes := make([]uint64, len(values))
+		HashVector(column, hashes)
+
+		for i, value := range values {
+			if hashes[i] != Hash(value) {
+				t.Errorf("%T: expect hash of %v to be %d, got %d", column, value, Hash(value), hashes[i])
+			}
+		}
+
+		// The vector hashes of a two-column key match the hashes of the composite keys.
+		CombineHashVector([]int64{10, 20, 30}, hashes)
+
+		for i, value := range values {
+			if expect := Hash([]interface{}{value, int64((i + 1) * 10)}); hashes[i] != expect {
+				t.Errorf("%T: expect combined hash %d, got %d", column, expect, hashes[i])
+			}
+		}
+	}
+}
+
+func toInterfaces(column interface{}) []interface{} {
+	slice := reflect.ValueOf(column)
+	values := make([]interface{}, slice.Len())
+
+	for i := range values {
+		values[i] = slice.Index(i).Interface()
+	}
+
+	return values
+}
+
+func BenchmarkHashVector(b *testing.B) {
+	values := make([]int64, 2048)
+	hashes := make([]uint64, len(values))
+
+	for i := range values {
+		values[i] = int64(i)
+	}
+
+	b.Run("vector", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			HashVector(values, hashes)
+		}
+	})
+
+	b.Run("boxed", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j, value := range values {
+				hashes[j] = Hash(value)
+			}
+		}
+	})
+}
@@ -0,0 +1,334 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// LocalFileSystem is the FileSystem implementation backed by the local disk.
+type LocalFileSystem struct{}
+
+var _ FileSystem = (*LocalFileSystem)(nil)
+
+func NewLocalFileSystem() *LocalFileSystem {
+	return &LocalFileSystem{}
+}
+
+func (fs *LocalFileSystem) OpenFile(path string, flags FileFlags, lockType FileLockType) (FileHandle, error) {
+	var openFlags int
+
+	if flags&ReadOnly != 0 {
+		openFlags = os.O_RDONLY
+	} else {
+		// TODO: seems no O_CLOEXEC
+		// since we don't need to fork, just ignore it temporarily
+		openFlags = os.O_RDWR
+
+		if flags&Create != 0 {
+			openFlags |= os.O_CREATE
+		}
+	}
+
+	directIO := flags&DirectIO != 0
+
+	if directIO {
+		openFlags |= directIOFlag
+	}
+
+	file, err := os.OpenFile(path, openFlags, 0666)
+
+	if err != nil && directIO && errors.Is(err, syscall.EINVAL) {
+		// The file system (e.g. tmpfs) does not support direct IO, fall back to buffered IO.
+		directIO = false
+		file, err = os.OpenFile(path, openFlags&^directIOFlag, 0666)
+	}
+
+	if err != nil {
+		return nil, NewIOError("open file", path, err)
+	}
+
+	if directIO {
+		if err := enableDirectIO(file); err != nil {
+			file.Close()
+			return nil, NewIOError("enable direct IO for file", path, err)
+		}
+	}
+
+	// Set lock on file.
+	if lockType != NoLock {
+		flock := syscall.Flock_t{
+			Type:   syscall.F_RDLCK,
+			Whence: io.SeekStart,
+			Start:  0,
+			Len:    0,
+		}
+
+		if lockType == WriteLock {
+			flock.Type = syscall.F_WRLCK
+		}
+
+		err := syscall.FcntlFlock(file.Fd(), syscall.F_SETLK, &flock)
+
+		if err != nil {
+			file.Close()
+
+			if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EACCES) {
+				return nil, NewLockConflictError(path, err)
+			}
+
+			return nil, NewIOError("set lock on file", path, err)
+		}
+	}
+
+	return NewFileHandle(fs, file, path, directIO), nil
+}
+
+// Read exactly len(buffer) bytes from the specified offset in the file, continuing after short reads. Fails if
+// len(buffer) could not be read. The read is positional (pread) and does not move the file pointer, so it is safe to
+// call concurrently on the same handle.
+func (fs *LocalFileSystem) ReadFromOffset(handle FileHandle, buffer []byte, offset uint64) error {
+	unixHandle := handle.(*UnixFileHandle)
+
+	for bytesRead := 0; bytesRead < len(buffer); {
+		n, err := unixHandle.file.ReadAt(buffer[bytesRead:], int64(offset)+int64(bytesRead))
+		bytesRead += n
+
+		if err == io.EOF || (err == nil && n == 0) {
+			return NewIOError("read sufficient bytes from file", unixHandle.path, io.ErrUnexpectedEOF)
+		}
+
+		if err != nil {
+			return NewIOError("read from file", unixHandle.path, err)
+		}
+	}
+
+	return nil
+}
+
+// TODO: consider syscall.Read
+func (fs *LocalFileSystem) Read(handle FileHandle, buffer []byte) (int64, error) {
+	unixHandle := handle.(*UnixFileHandle)
+	file := unixHandle.file
+	bytesRead, err := file.Read(buffer)
+
+	if err != nil && err != io.EOF {
+		return int64(bytesRead), NewIOError("read from file", unixHandle.path, err)
+	}
+
+	return int64(bytesRead), nil
+}
+
+// Write nbyte from the buffer into the file, moving the file pointer forward by nbyte.
+func (fs *LocalFileSystem) Write(handle FileHandle, buffer []byte) (int64, error) {
+	unixHandle := handle.(*UnixFileHandle)
+	file := unixHandle.file
+	n, err := file.Write(buffer)
+
+	if err != nil {
+		return int64(n), NewIOError("write file", unixHandle.path, err)
+	}
+
+	return int64(n), nil
+}
+
+// Write exactly len(buffer) bytes to the specified offset in the file, continuing after short writes. Fails if
+// len(buffer) could not be written. The write is positional (pwrite) and does not move the file pointer, so it is safe
+// to call concurrently on the same handle.
+func (fs *LocalFileSystem) WriteFromOffset(handle FileHandle, buffer []byte, offset uint64) error {
+	unixHandle := handle.(*UnixFileHandle)
+
+	for bytesWritten := 0; bytesWritten < len(buffer); {
+		n, err := unixHandle.file.WriteAt(buffer[bytesWritten:], int64(offset)+int64(bytesWritten))
+		bytesWritten += n
+
+		if err != nil {
+			return NewIOError("write file", unixHandle.path, err)
+		}
+
+		if n == 0 {
+			return NewIOError("write sufficient bytes to file", unixHandle.path, io.ErrShortWrite)
+		}
+	}
+
+	return nil
+}
+
+// Returns the file size of a file handle.
+func (fs *LocalFileSystem) GetFileSize(handle FileHandle) (int64, error) {
+	unixHandle := handle.(*UnixFileHandle)
+	file := unixHandle.file
+	fileInfo, err := file.Stat()
+
+	if err != nil {
+		return -1, NewIOError("get size of file", unixHandle.path, err)
+	}
+
+	return fileInfo.Size(), nil
+}
+
+// Truncate (or extend) a file to the given size.
+func (fs *LocalFileSystem) Truncate(handle FileHandle, newSize int64) error {
+	unixHandle := handle.(*UnixFileHandle)
+
+	if err := unixHandle.file.Truncate(newSize); err != nil {
+		return NewIOError(fmt.Sprintf("truncate file to %d bytes", newSize), unixHandle.path, err)
+	}
+
+	return nil
+}
+
+// Check if a directory exists.
+func (fs *LocalFileSystem) DirectoryExists(directory string) bool {
+	fileInfo, err := os.Stat(directory)
+
+	if err != nil {
+		// if os.IsNotExist(err) {
+		// 	return false
+		// }
+		return false
+	}
+
+	return fileInfo.IsDir()
+}
+
+// Create a directory if it does not exist.
+func (fs *LocalFileSystem) CreateDirectory(directory string) error {
+	if !fs.DirectoryExists(directory) {
+		err := os.Mkdir(directory, 0755)
+
+		if err != nil {
+			return NewIOError("create directory", directory, err)
+		}
+	}
+
+	return nil
+}
+
+func (fs *LocalFileSystem) RemoveDirectory(directory string) error {
+	err := os.RemoveAll(directory)
+
+	if err != nil {
+		return NewIOError("remove directory", directory, err)
+	}
+
+	return nil
+}
+
+// List files in a directory, invoking the callback method for each one
+// TODO: do we need to callback directory?
+func (fs *LocalFileSystem) ListFiles(directory string, callback func(string)) (bool, error) {
+	if !fs.DirectoryExists(directory) {
+		return false, nil
+	}
+
+	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			callback(info.Name())
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return false, NewIOError("list files in directory", directory, err)
+	}
+
+	return true, nil
+}
+
+// Move a file from source path to the target, StorageManager relies on this being an atomic action for ACID
+// properties
+func (fs *LocalFileSystem) MoveFile(source string, target string) error {
+	// TODO: FIXME: rename does not guarantee atomicity or overwriting target file if it exists
+	err := os.Rename(source, target)
+
+	if err != nil {
+		return NewIOError(fmt.Sprintf("move file to %q", target), source, err)
+	}
+
+	return nil
+}
+
+func (fs *LocalFileSystem) FileExists(filename string) (bool, error) {
+	_, err := os.Stat(filename)
+
+	if err == nil {
+		return true, nil
+	}
+
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return false, NewIOError("stat file", filename, err)
+}
+
+func (fs *LocalFileSystem) RemoveFile(filename string) error {
+	err := os.Remove(filename)
+
+	if err != nil {
+		return NewIOError("remove file", filename, err)
+	}
+
+	return nil
+}
+
+// Path separator for the current file system.
+func (fs *LocalFileSystem) PathSeparator() string {
+	return string(filepath.Separator)
+}
+
+// Join two paths together.
+func (fs *LocalFileSystem) JoinPath(a string, b string) string {
+	return filepath.Join(a, b)
+}
+
+// Sync a file handle to disk.
+func (fs *LocalFileSystem) FileSync(handle FileHandle) error {
+	unixHandle := handle.(*UnixFileHandle)
+	file := unixHandle.file
+
+	if err := file.Sync(); err != nil {
+		return NewIOError("sync file", unixHandle.path, err)
+	}
+
+	return nil
+}
+
+// Sync a directory to disk: renaming a file is only durable once the directory that holds it has been synced.
+func (fs *LocalFileSystem) SyncDirectory(directory string) error {
+	dir, err := os.Open(directory)
+
+	if err != nil {
+		return NewIOError("open directory", directory, err)
+	}
+	defer dir.Close()
+
+	if err := dir.Sync(); err != nil {
+		return NewIOError("sync directory", directory, err)
+	}
+
+	return nil
+}
+
+// Set the file pointer of a file handle to a specified offset.
+// Reads and writes will happen from this location
+func (fs *LocalFileSystem) SetFilePointer(handle FileHandle, offset uint64) error {
+	unixHandle := handle.(*UnixFileHandle)
+	file := unixHandle.file
+	_, err := file.Seek(int64(offset), io.SeekStart)
+
+	if err != nil {
+		return NewIOError(fmt.Sprintf("seek to location %d in file", offset), unixHandle.path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package common
+
+import (
+	"os"
+	"syscall"
+)
+
+// OSX does not have O_DIRECT, instead we open the file with O_SYNC and use fcntl(F_NOCACHE) afterwards to support
+// direct IO.
+const directIOFlag = os.O_SYNC
+
+func enableDirectIO(file *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, file.Fd(), syscall.F_NOCACHE, 1)
+
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
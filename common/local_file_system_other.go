@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package common
+
+import "os"
+
+// Direct IO is not supported on this platform, files opened with the DirectIO flag use buffered IO instead.
+const directIOFlag = 0
+
+func enableDirectIO(file *os.File) error {
+	return nil
+}
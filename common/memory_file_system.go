@@ -0,0 +1,363 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MemoryFileSystem is a FileSystem that keeps all files in memory. It is used to back databases that should never touch
+// the disk, e.g. ":memory:" databases and unit tests. Locks are only tracked between handles of the same
+// MemoryFileSystem.
+type MemoryFileSystem struct {
+	lock        sync.Mutex
+	files       map[string]*memoryFile
+	directories map[string]struct{}
+}
+
+var _ FileSystem = (*MemoryFileSystem)(nil)
+
+type memoryFile struct {
+	lock      sync.RWMutex
+	data      []byte
+	readLocks int  // The number of handles holding a read lock on the file.
+	writeLock bool // Whether a handle holds the write lock on the file.
+}
+
+type MemoryFileHandle struct {
+	fs       *MemoryFileSystem
+	file     *memoryFile
+	path     string
+	lockType FileLockType
+	readOnly bool
+	position uint64
+	closed   bool
+}
+
+func NewMemoryFileSystem() *MemoryFileSystem {
+	return &MemoryFileSystem{
+		files:       make(map[string]*memoryFile),
+		directories: map[string]struct{}{"/": {}, ".": {}},
+	}
+}
+
+func (fs *MemoryFileSystem) OpenFile(filePath string, flags FileFlags, lockType FileLockType) (FileHandle, error) {
+	filePath = path.Clean(filePath)
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	file, ok := fs.files[filePath]
+
+	if !ok {
+		if flags&ReadOnly != 0 || flags&Create == 0 {
+			return nil, NewIOError("open file", filePath, os.ErrNotExist)
+		}
+
+		file = &memoryFile{}
+		fs.files[filePath] = file
+	}
+
+	switch lockType {
+	case ReadLock:
+		if file.writeLock {
+			return nil, NewLockConflictError(filePath, fmt.Errorf("file is locked for writing"))
+		}
+
+		file.readLocks++
+	case WriteLock:
+		if file.writeLock || file.readLocks > 0 {
+			return nil, NewLockConflictError(filePath, fmt.Errorf("file is already locked"))
+		}
+
+		file.writeLock = true
+	}
+
+	return &MemoryFileHandle{
+		fs:       fs,
+		file:     file,
+		path:     filePath,
+		lockType: lockType,
+		readOnly: flags&ReadOnly != 0,
+	}, nil
+}
+
+// Read exactly len(buffer) bytes from the specified offset in the file.
+func (fs *MemoryFileSystem) ReadFromOffset(handle FileHandle, buffer []byte, offset uint64) error {
+	memoryHandle := handle.(*MemoryFileHandle)
+	file := memoryHandle.file
+	file.lock.RLock()
+	defer file.lock.RUnlock()
+
+	if offset+uint64(len(buffer)) > uint64(len(file.data)) {
+		return NewIOError("read sufficient bytes from file", memoryHandle.path, io.ErrUnexpectedEOF)
+	}
+
+	copy(buffer, file.data[offset:])
+
+	return nil
+}
+
+// Write exactly len(buffer) bytes to the specified offset in the file, growing the file if required.
+func (fs *MemoryFileSystem) WriteFromOffset(handle FileHandle, buffer []byte, offset uint64) error {
+	memoryHandle := handle.(*MemoryFileHandle)
+
+	if memoryHandle.readOnly {
+		return NewIOError("write file", memoryHandle.path, os.ErrPermission)
+	}
+
+	file := memoryHandle.file
+	file.lock.Lock()
+	defer file.lock.Unlock()
+
+	if end := offset + uint64(len(buffer)); end > uint64(len(file.data)) {
+		if end > uint64(cap(file.data)) {
+			data := make([]byte, end, end*2)
+			copy(data, file.data)
+			file.data = data
+		} else {
+			file.data = file.data[:end]
+		}
+	}
+
+	copy(file.data[offset:], buffer)
+
+	return nil
+}
+
+// Read at most len(buffer) bytes from the current file pointer, moving the file pointer forward.
+func (fs *MemoryFileSystem) Read(handle FileHandle, buffer []byte) (int64, error) {
+	memoryHandle := handle.(*MemoryFileHandle)
+	file := memoryHandle.file
+	file.lock.RLock()
+	defer file.lock.RUnlock()
+
+	if memoryHandle.position >= uint64(len(file.data)) {
+		return 0, nil
+	}
+
+	n := copy(buffer, file.data[memoryHandle.position:])
+	memoryHandle.position += uint64(n)
+
+	return int64(n), nil
+}
+
+// Write len(buffer) bytes to the current file pointer, moving the file pointer forward.
+func (fs *MemoryFileSystem) Write(handle FileHandle, buffer []byte) (int64, error) {
+	memoryHandle := handle.(*MemoryFileHandle)
+
+	if err := fs.WriteFromOffset(handle, buffer, memoryHandle.position); err != nil {
+		return 0, err
+	}
+
+	memoryHandle.position += uint64(len(buffer))
+
+	return int64(len(buffer)), nil
+}
+
+func (fs *MemoryFileSystem) GetFileSize(handle FileHandle) (int64, error) {
+	file := handle.(*MemoryFileHandle).file
+	file.lock.RLock()
+	defer file.lock.RUnlock()
+
+	return int64(len(file.data)), nil
+}
+
+func (fs *MemoryFileSystem) Truncate(handle FileHandle, newSize int64) error {
+	memoryHandle := handle.(*MemoryFileHandle)
+
+	if memoryHandle.readOnly {
+		return NewIOError(fmt.Sprintf("truncate file to %d bytes", newSize), memoryHandle.path, os.ErrPermission)
+	}
+
+	file := memoryHandle.file
+	file.lock.Lock()
+	defer file.lock.Unlock()
+
+	if newSize <= int64(len(file.data)) {
+		// Clear the truncated part, growing the file again must not bring it back.
+		bzero(file.data[newSize:])
+		file.data = file.data[:newSize]
+	} else {
+		data := make([]byte, newSize)
+		copy(data, file.data)
+		file.data = data
+	}
+
+	return nil
+}
+
+func (fs *MemoryFileSystem) DirectoryExists(directory string) bool {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	_, ok := fs.directories[path.Clean(directory)]
+
+	return ok
+}
+
+func (fs *MemoryFileSystem) CreateDirectory(directory string) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	fs.directories[path.Clean(directory)] = struct{}{}
+
+	return nil
+}
+
+func (fs *MemoryFileSystem) RemoveDirectory(directory string) error {
+	directory = path.Clean(directory)
+	prefix := strings.TrimSuffix(directory, "/") + "/"
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	delete(fs.directories, directory)
+
+	for dir := range fs.directories {
+		if strings.HasPrefix(dir, prefix) {
+			delete(fs.directories, dir)
+		}
+	}
+
+	for file := range fs.files {
+		if strings.HasPrefix(file, prefix) {
+			delete(fs.files, file)
+		}
+	}
+
+	return nil
+}
+
+// List files in a directory (and its sub directories), invoking the callback method for each one in lexical order.
+func (fs *MemoryFileSystem) ListFiles(directory string, callback func(string)) (bool, error) {
+	directory = path.Clean(directory)
+	prefix := strings.TrimSuffix(directory, "/") + "/"
+	fs.lock.Lock()
+
+	if _, ok := fs.directories[directory]; !ok {
+		fs.lock.Unlock()
+		return false, nil
+	}
+
+	var files []string
+
+	for file := range fs.files {
+		if strings.HasPrefix(file, prefix) {
+			files = append(files, file)
+		}
+	}
+
+	fs.lock.Unlock()
+	sort.Strings(files)
+
+	for _, file := range files {
+		callback(path.Base(file))
+	}
+
+	return true, nil
+}
+
+func (fs *MemoryFileSystem) MoveFile(source string, target string) error {
+	source = path.Clean(source)
+	target = path.Clean(target)
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	file, ok := fs.files[source]
+
+	if !ok {
+		return NewIOError(fmt.Sprintf("move file to %q", target), source, os.ErrNotExist)
+	}
+
+	delete(fs.files, source)
+	fs.files[target] = file
+
+	return nil
+}
+
+func (fs *MemoryFileSystem) FileExists(filename string) (bool, error) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	_, ok := fs.files[path.Clean(filename)]
+
+	return ok, nil
+}
+
+func (fs *MemoryFileSystem) RemoveFile(filename string) error {
+	filename = path.Clean(filename)
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	if _, ok := fs.files[filename]; !ok {
+		return NewIOError("remove file", filename, os.ErrNotExist)
+	}
+
+	delete(fs.files, filename)
+
+	return nil
+}
+
+func (fs *MemoryFileSystem) PathSeparator() string {
+	return "/"
+}
+
+func (fs *MemoryFileSystem) JoinPath(a string, b string) string {
+	return path.Join(a, b)
+}
+
+// Sync is a no-op: the content of a memory file is visible to all handles as soon as it is written.
+func (fs *MemoryFileSystem) FileSync(handle FileHandle) error {
+	return nil
+}
+
+// SyncDirectory is a no-op, like FileSync.
+func (fs *MemoryFileSystem) SyncDirectory(directory string) error {
+	return nil
+}
+
+func (fs *MemoryFileSystem) SetFilePointer(handle FileHandle, offset uint64) error {
+	handle.(*MemoryFileHandle).position = offset
+
+	return nil
+}
+
+func (handle *MemoryFileHandle) Read(buffer []byte, offset uint64) error {
+	return handle.fs.ReadFromOffset(handle, buffer, offset)
+}
+
+func (handle *MemoryFileHandle) Write(buffer []byte, offset uint64) error {
+	return handle.fs.WriteFromOffset(handle, buffer, offset)
+}
+
+func (handle *MemoryFileHandle) Sync() error {
+	return handle.fs.FileSync(handle)
+}
+
+// Close the handle, releasing any lock it holds on the file. The content of the file is kept until it is removed.
+func (handle *MemoryFileHandle) Close() error {
+	handle.fs.lock.Lock()
+	defer handle.fs.lock.Unlock()
+
+	if handle.closed {
+		return nil
+	}
+
+	handle.closed = true
+
+	switch handle.lockType {
+	case ReadLock:
+		handle.file.readLocks--
+	case WriteLock:
+		handle.file.writeLock = false
+	}
+
+	return nil
+}
+
+func (handle *MemoryFileHandle) Path() string {
+	return handle.path
+}
@@ -0,0 +1,104 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestMemoryFileSystem(t *testing.T) {
+	fs := NewMemoryFileSystem()
+	text := "Hello World!"
+	dir := "/goduckdb"
+
+	if err := fs.CreateDirectory(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if !fs.DirectoryExists(dir) {
+		t.Errorf("Expect directory %s exists.", dir)
+	}
+
+	path := fs.JoinPath(dir, "foo.txt")
+	handle, err := fs.OpenFile(path, WriteOnly|Create, NoLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := NewFileBuffer(4096)
+	copy(buffer.Buffer(), text)
+
+	if err := buffer.Write(handle, 4096, DefaultChecksumType); err != nil {
+		t.Fatal(err)
+	}
+
+	if size, _ := fs.GetFileSize(handle); size != 8192 {
+		t.Errorf("Expect file size 8192, got %d", size)
+	}
+
+	buffer.Clear()
+
+	if err := buffer.Read(handle, 4096, DefaultChecksumType); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(buffer.Buffer()[:len(text)]); got != text {
+		t.Errorf("Expect %q, got %q", text, got)
+	}
+
+	handle.Close()
+
+	if err := fs.MoveFile(path, fs.JoinPath(dir, "bar.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	if ok, err := fs.ListFiles(dir, func(name string) { files = append(files, name) }); !ok || err != nil {
+		t.Fatalf("Expect directory %s to be listed, got %v", dir, err)
+	}
+
+	if len(files) != 1 || files[0] != "bar.txt" {
+		t.Errorf("Expect [bar.txt], got %v", files)
+	}
+
+	if _, err := fs.OpenFile(path, ReadOnly, NoLock); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expect os.ErrNotExist, got %v", err)
+	}
+
+	if err := fs.RemoveDirectory(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, _ := fs.FileExists(fs.JoinPath(dir, "bar.txt")); exists || fs.DirectoryExists(dir) {
+		t.Errorf("Expect directory %s to be removed", dir)
+	}
+}
+
+func TestMemoryFileSystemLocks(t *testing.T) {
+	fs := NewMemoryFileSystem()
+	writer, err := fs.OpenFile("foo.db", WriteOnly|Create, WriteLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lockErr *LockConflictError
+
+	if _, err := fs.OpenFile("foo.db", ReadOnly, ReadLock); !errors.As(err, &lockErr) {
+		t.Errorf("Expect a LockConflictError, got %v", err)
+	}
+
+	writer.Close()
+
+	reader, err := fs.OpenFile("foo.db", ReadOnly, ReadLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	if err := reader.Write([]byte{1}, 0); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("Expect os.ErrPermission, got %v", err)
+	}
+}
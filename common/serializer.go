@@ -1,6 +1,199 @@
 package common
 
+import (
+	"encoding/binary"
+	"math"
+)
+
+// A DataWriter is the sink a BinarySerializer writes its encoded values to, e.g. a byte buffer or a chain of meta blocks.
+type DataWriter interface {
+	WriteData(buffer []byte) error
+}
+
+// A Serializer writes values in the binary serialization format that is shared by everything goduckdb persists (the
+// catalog, the WAL and statistics). Fixed-width values are written in little endian, lengths and varints as (zig-zag)
+// varints.
 type Serializer interface {
-	WriteData(buffer []byte)
-	Write(v interface{})
+	DataWriter
+	WriteBool(v bool) error
+	WriteUint8(v uint8) error
+	WriteInt8(v int8) error
+	WriteUint16(v uint16) error
+	WriteInt16(v int16) error
+	WriteUint32(v uint32) error
+	WriteInt32(v int32) error
+	WriteUint64(v uint64) error
+	WriteInt64(v int64) error
+	WriteFloat32(v float32) error
+	WriteFloat64(v float64) error
+	WriteVarint(v uint64) error
+	WriteSignedVarint(v int64) error
+	WriteString(v string) error
+	WriteBytes(v []byte) error
+	// Write a list of count elements, writeElement is called to write the element at each index.
+	WriteList(count int, writeElement func(index int) error) error
+	// Write an optional value, writeValue is only called if the value is present.
+	WriteOptional(present bool, writeValue func() error) error
+	// Write a nested object. The object is length-prefixed, so that a reader can skip it.
+	WriteObject(object Serializable) error
+}
+
+// A Serializable is an object that can be written with a Serializer.
+type Serializable interface {
+	Serialize(serializer Serializer) error
+}
+
+// The BinarySerializer implements the Serializer on top of a DataWriter.
+type BinarySerializer struct {
+	writer  DataWriter
+	scratch [binary.MaxVarintLen64]byte // Reused to encode a single value without allocating.
+}
+
+func NewBinarySerializer(writer DataWriter) *BinarySerializer {
+	return &BinarySerializer{writer: writer}
+}
+
+func (serializer *BinarySerializer) WriteData(buffer []byte) error {
+	return serializer.writer.WriteData(buffer)
+}
+
+func (serializer *BinarySerializer) WriteBool(v bool) error {
+	if v {
+		return serializer.WriteUint8(1)
+	}
+
+	return serializer.WriteUint8(0)
+}
+
+func (serializer *BinarySerializer) WriteUint8(v uint8) error {
+	serializer.scratch[0] = v
+
+	return serializer.writer.WriteData(serializer.scratch[:1])
+}
+
+func (serializer *BinarySerializer) WriteInt8(v int8) error {
+	return serializer.WriteUint8(uint8(v))
+}
+
+func (serializer *BinarySerializer) WriteUint16(v uint16) error {
+	binary.LittleEndian.PutUint16(serializer.scratch[:], v)
+
+	return serializer.writer.WriteData(serializer.scratch[:2])
+}
+
+func (serializer *BinarySerializer) WriteInt16(v int16) error {
+	return serializer.WriteUint16(uint16(v))
+}
+
+func (serializer *BinarySerializer) WriteUint32(v uint32) error {
+	binary.LittleEndian.PutUint32(serializer.scratch[:], v)
+
+	return serializer.writer.WriteData(serializer.scratch[:4])
+}
+
+func (serializer *BinarySerializer) WriteInt32(v int32) error {
+	return serializer.WriteUint32(uint32(v))
+}
+
+func (serializer *BinarySerializer) WriteUint64(v uint64) error {
+	binary.LittleEndian.PutUint64(serializer.scratch[:], v)
+
+	return serializer.writer.WriteData(serializer.scratch[:8])
+}
+
+func (serializer *BinarySerializer) WriteInt64(v int64) error {
+	return serializer.WriteUint64(uint64(v))
+}
+
+func (serializer *BinarySerializer) WriteFloat32(v float32) error {
+	return serializer.WriteUint32(math.Float32bits(v))
+}
+
+func (serializer *BinarySerializer) WriteFloat64(v float64) error {
+	return serializer.WriteUint64(math.Float64bits(v))
+}
+
+func (serializer *BinarySerializer) WriteVarint(v uint64) error {
+	n := binary.PutUvarint(serializer.scratch[:], v)
+
+	return serializer.writer.WriteData(serializer.scratch[:n])
+}
+
+func (serializer *BinarySerializer) WriteSignedVarint(v int64) error {
+	n := binary.PutVarint(serializer.scratch[:], v)
+
+	return serializer.writer.WriteData(serializer.scratch[:n])
+}
+
+func (serializer *BinarySerializer) WriteString(v string) error {
+	return serializer.WriteBytes([]byte(v))
+}
+
+func (serializer *BinarySerializer) WriteBytes(v []byte) error {
+	if err := serializer.WriteVarint(uint64(len(v))); err != nil {
+		return err
+	}
+
+	return serializer.writer.WriteData(v)
+}
+
+func (serializer *BinarySerializer) WriteList(count int, writeElement func(index int) error) error {
+	if err := serializer.WriteVarint(uint64(count)); err != nil {
+		return err
+	}
+
+	for i := 0; i < count; i++ {
+		if err := writeElement(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (serializer *BinarySerializer) WriteOptional(present bool, writeValue func() error) error {
+	if err := serializer.WriteBool(present); err != nil {
+		return err
+	}
+
+	if !present {
+		return nil
+	}
+
+	return writeValue()
+}
+
+func (serializer *BinarySerializer) WriteObject(object Serializable) error {
+	// The object is serialized into a separate buffer first, as its length has to be written before it.
+	buffered := NewBufferedSerializer()
+
+	if err := object.Serialize(buffered); err != nil {
+		return err
+	}
+
+	return serializer.WriteBytes(buffered.Data())
+}
+
+// The BufferedSerializer is a Serializer that writes into an in-memory byte buffer.
+type BufferedSerializer struct {
+	*BinarySerializer
+	buffer []byte
+}
+
+func NewBufferedSerializer() *BufferedSerializer {
+	serializer := &BufferedSerializer{}
+	serializer.BinarySerializer = NewBinarySerializer(serializer)
+
+	return serializer
+}
+
+func (serializer *BufferedSerializer) WriteData(buffer []byte) error {
+	serializer.buffer = append(serializer.buffer, buffer...)
+
+	return nil
+}
+
+// The data that has been serialized so far.
+func (serializer *BufferedSerializer) Data() []byte {
+	return serializer.buffer
 }
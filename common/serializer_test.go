@@ -0,0 +1,244 @@
+package common
+
+import (
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+type testColumn struct {
+	Name     string
+	Nullable bool
+	Default  *int64
+}
+
+func (column *testColumn) Serialize(serializer Serializer) error {
+	if err := serializer.WriteString(column.Name); err != nil {
+		return err
+	}
+
+	if err := serializer.WriteBool(column.Nullable); err != nil {
+		return err
+	}
+
+	return serializer.WriteOptional(column.Default != nil, func() error {
+		return serializer.WriteSignedVarint(*column.Default)
+	})
+}
+
+func (column *testColumn) Deserialize(deserializer Deserializer) error {
+	var err error
+
+	if column.Name, err = deserializer.ReadString(); err != nil {
+		return err
+	}
+
+	if column.Nullable, err = deserializer.ReadBool(); err != nil {
+		return err
+	}
+
+	_, err = deserializer.ReadOptional(func() error {
+		value, err := deserializer.ReadSignedVarint()
+		column.Default = &value
+
+		return err
+	})
+
+	return err
+}
+
+type testTable struct {
+	Name    string
+	Columns []testColumn
+}
+
+func (table *testTable) Serialize(serializer Serializer) error {
+	if err := serializer.WriteString(table.Name); err != nil {
+		return err
+	}
+
+	return serializer.WriteList(len(table.Columns), func(index int) error {
+		return serializer.WriteObject(&table.Columns[index])
+	})
+}
+
+func (table *testTable) Deserialize(deserializer Deserializer) error {
+	var err error
+
+	if table.Name, err = deserializer.ReadString(); err != nil {
+		return err
+	}
+
+	return deserializer.ReadList(func(index int) error {
+		var column testColumn
+
+		if err := deserializer.ReadObject(&column); err != nil {
+			return err
+		}
+
+		table.Columns = append(table.Columns, column)
+
+		return nil
+	})
+}
+
+func TestSerializerValues(t *testing.T) {
+	serializer := NewBufferedSerializer()
+	serializer.WriteBool(true)
+	serializer.WriteUint8(math.MaxUint8)
+	serializer.WriteInt8(math.MinInt8)
+	serializer.WriteUint16(math.MaxUint16)
+	serializer.WriteInt16(math.MinInt16)
+	serializer.WriteUint32(math.MaxUint32)
+	serializer.WriteInt32(math.MinInt32)
+	serializer.WriteUint64(math.MaxUint64)
+	serializer.WriteInt64(math.MinInt64)
+	serializer.WriteFloat32(1.5)
+	serializer.WriteFloat64(math.Inf(-1))
+	serializer.WriteVarint(300)
+	serializer.WriteSignedVarint(-300)
+	serializer.WriteString("duckdb")
+	serializer.WriteBytes([]byte{0, 1, 2})
+
+	deserializer := NewBufferedDeserializer(serializer.Data())
+	expected := []interface{}{true, uint8(math.MaxUint8), int8(math.MinInt8), uint16(math.MaxUint16),
+		int16(math.MinInt16), uint32(math.MaxUint32), int32(math.MinInt32), uint64(math.MaxUint64),
+		int64(math.MinInt64), float32(1.5), math.Inf(-1), uint64(300), int64(-300), "duckdb", []byte{0, 1, 2}}
+	var actual []interface{}
+
+	for _, read := range []func() (interface{}, error){
+		func() (interface{}, error) { return deserializer.ReadBool() },
+		func() (interface{}, error) { return deserializer.ReadUint8() },
+		func() (interface{}, error) { return deserializer.ReadInt8() },
+		func() (interface{}, error) { return deserializer.ReadUint16() },
+		func() (interface{}, error) { return deserializer.ReadInt16() },
+		func() (interface{}, error) { return deserializer.ReadUint32() },
+		func() (interface{}, error) { return deserializer.ReadInt32() },
+		func() (interface{}, error) { return deserializer.ReadUint64() },
+		func() (interface{}, error) { return deserializer.ReadInt64() },
+		func() (interface{}, error) { return deserializer.ReadFloat32() },
+		func() (interface{}, error) { return deserializer.ReadFloat64() },
+		func() (interface{}, error) { return deserializer.ReadVarint() },
+		func() (interface{}, error) { return deserializer.ReadSignedVarint() },
+		func() (interface{}, error) { return deserializer.ReadString() },
+		func() (interface{}, error) { return deserializer.ReadBytes() },
+	} {
+		value, err := read()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual = append(actual, value)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expect %v, got %v", expected, actual)
+	}
+
+	if deserializer.Remaining() != 0 {
+		t.Errorf("Expect all data to be read, %d bytes remaining", deserializer.Remaining())
+	}
+}
+
+func TestSerializerObjects(t *testing.T) {
+	defaultValue := int64(-42)
+	table := testTable{
+		Name: "lineitem",
+		Columns: []testColumn{
+			{Name: "l_orderkey"},
+			{Name: "l_comment", Nullable: true, Default: &defaultValue},
+		},
+	}
+	serializer := NewBufferedSerializer()
+
+	if err := serializer.WriteObject(&table); err != nil {
+		t.Fatal(err)
+	}
+
+	var result testTable
+
+	if err := NewBufferedDeserializer(serializer.Data()).ReadObject(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(result, table) {
+		t.Errorf("Expect %+v, got %+v", table, result)
+	}
+}
+
+// A testReader is a DataReader that does not know the size of the remaining data.
+type testReader struct {
+	data []byte
+}
+
+func (reader *testReader) ReadData(buffer []byte) error {
+	if len(buffer) > len(reader.data) {
+		return io.ErrUnexpectedEOF
+	}
+
+	reader.data = reader.data[copy(buffer, reader.data):]
+
+	return nil
+}
+
+func TestDeserializerErrors(t *testing.T) {
+	serializer := NewBufferedSerializer()
+	serializer.WriteString("duckdb")
+	data := serializer.Data()
+
+	// Truncated data.
+	if _, err := NewBufferedDeserializer(data[:3]).ReadString(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Expect io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	var serializationErr *SerializationError
+
+	// A byte that is not a bool.
+	if _, err := NewBufferedDeserializer([]byte{2}).ReadBool(); !errors.As(err, &serializationErr) {
+		t.Errorf("Expect a SerializationError, got %v", err)
+	}
+
+	// A corrupt length must not allocate a huge buffer.
+	lengthSerializer := NewBufferedSerializer()
+	lengthSerializer.WriteVarint(math.MaxUint64)
+
+	if _, err := NewBufferedDeserializer(lengthSerializer.Data()).ReadBytes(); !errors.As(err, &serializationErr) {
+		t.Errorf("Expect a SerializationError, got %v", err)
+	}
+
+	// A corrupt length below the maximum is checked against the remaining data before a buffer is allocated, or the data
+	// is read in chunks if the size of the remaining data is unknown.
+	lengthSerializer = NewBufferedSerializer()
+	lengthSerializer.WriteVarint(MaxSerializedLength)
+	lengthSerializer.WriteString("duckdb")
+	readers := []DataReader{NewBufferedDeserializer(lengthSerializer.Data()), &testReader{data: lengthSerializer.Data()}}
+
+	for _, reader := range readers {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+
+		if _, err := NewBinaryDeserializer(reader).ReadBytes(); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Expect io.ErrUnexpectedEOF, got %v", err)
+		}
+
+		runtime.ReadMemStats(&after)
+
+		if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 4*readChunkSize {
+			t.Errorf("Expect a corrupt length not to allocate a huge buffer, got %d bytes", allocated)
+		}
+	}
+
+	// An object that does not consume all of its data.
+	columnSerializer := NewBufferedSerializer()
+	(&testColumn{Name: "l_orderkey"}).Serialize(columnSerializer)
+	objectSerializer := NewBufferedSerializer()
+	objectSerializer.WriteBytes(append(columnSerializer.Data(), 0))
+
+	if err := NewBufferedDeserializer(objectSerializer.Data()).ReadObject(&testColumn{}); !errors.As(err, &serializationErr) {
+		t.Errorf("Expect a SerializationError, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A TypeID is the logical type of a column. Type ids are persisted in the table metadata, so the values of existing
+// types must never change.
+type TypeID uint8
+
+const (
+	InvalidType TypeID = iota
+	Boolean
+	TinyInt
+	SmallInt
+	Integer
+	BigInt
+	Float
+	Double
+	Timestamp // Microseconds since 1970-01-01 00:00:00 UTC.
+	Varchar
+	Blob
+)
+
+var typeNames = [...]string{
+	InvalidType: "INVALID",
+	Boolean:     "BOOLEAN",
+	TinyInt:     "TINYINT",
+	SmallInt:    "SMALLINT",
+	Integer:     "INTEGER",
+	BigInt:      "BIGINT",
+	Float:       "FLOAT",
+	Double:      "DOUBLE",
+	Timestamp:   "TIMESTAMP",
+	Varchar:     "VARCHAR",
+	Blob:        "BLOB",
+}
+
+// The Go types the values of every type are stored as in a Vector.
+var typeValues = [...]reflect.Type{
+	Boolean:   reflect.TypeOf(false),
+	TinyInt:   reflect.TypeOf(int8(0)),
+	SmallInt:  reflect.TypeOf(int16(0)),
+	Integer:   reflect.TypeOf(int32(0)),
+	BigInt:    reflect.TypeOf(int64(0)),
+	Float:     reflect.TypeOf(float32(0)),
+	Double:    reflect.TypeOf(float64(0)),
+	Timestamp: reflect.TypeOf(int64(0)),
+	Varchar:   reflect.TypeOf(""),
+	Blob:      reflect.TypeOf([]byte(nil)),
+}
+
+// Whether the type is a known type other than InvalidType.
+func (t TypeID) Valid() bool {
+	return t > InvalidType && t <= Blob
+}
+
+func (t TypeID) String() string {
+	if int(t) < len(typeNames) {
+		return typeNames[t]
+	}
+
+	return fmt.Sprintf("TypeID(%d)", uint8(t))
+}
+
+// The size in bytes of a value of the type, or 0 for the variable-size types VARCHAR and BLOB.
+func (t TypeID) Size() uint64 {
+	switch t {
+	case Boolean, TinyInt:
+		return 1
+	case SmallInt:
+		return 2
+	case Integer, Float:
+		return 4
+	case BigInt, Double, Timestamp:
+		return 8
+	default:
+		return 0
+	}
+}
+
+// Whether the values of the type have a variable size.
+func (t TypeID) IsVariableSize() bool {
+	return t == Varchar || t == Blob
+}
+
+// Whether the value is of the Go type the values of the type are stored as, e.g. int32 for INTEGER.
+func (t TypeID) IsValue(value interface{}) bool {
+	return t.Valid() && reflect.TypeOf(value) == typeValues[t]
+}
+
+// The Go slice type the values of the type are stored in.
+func (t TypeID) sliceType() reflect.Type {
+	if !t.Valid() {
+		panic(fmt.Sprintf("Invalid type %s", t))
+	}
+
+	return reflect.SliceOf(typeValues[t])
+}
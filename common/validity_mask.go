@@ -0,0 +1,85 @@
+package common
+
+import "math/bits"
+
+// A ValidityMask marks which values of a vector are NULL. The mask stores a bit for every NULL value; values past the
+// end of the mask are valid, so the zero value is a mask in which every value is valid, and a vector without NULL
+// values does not allocate a mask.
+type ValidityMask struct {
+	nulls []uint64 // Bit i is set if value i is NULL.
+}
+
+// Whether the value at the given index is valid, i.e. not NULL.
+func (mask *ValidityMask) IsValid(index int) bool {
+	entry := index / 64
+
+	return entry >= len(mask.nulls) || mask.nulls[entry]&(1<<(index%64)) == 0
+}
+
+// Mark the value at the given index as valid or NULL.
+func (mask *ValidityMask) Set(index int, valid bool) {
+	entry := index / 64
+
+	if valid {
+		if entry < len(mask.nulls) {
+			mask.nulls[entry] &^= 1 << (index % 64)
+		}
+
+		return
+	}
+
+	for entry >= len(mask.nulls) {
+		mask.nulls = append(mask.nulls, 0)
+	}
+
+	mask.nulls[entry] |= 1 << (index % 64)
+}
+
+// Whether all values are valid.
+func (mask *ValidityMask) AllValid() bool {
+	for _, entry := range mask.nulls {
+		if entry != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// The number of NULL values among the first count values.
+func (mask *ValidityMask) NullCount(count int) int {
+	nulls := 0
+
+	for entry, value := range mask.nulls {
+		if remaining := count - 64*entry; remaining <= 0 {
+			break
+		} else if remaining < 64 {
+			value &= 1<<remaining - 1
+		}
+
+		nulls += bits.OnesCount64(value)
+	}
+
+	return nulls
+}
+
+// Mark all values as valid.
+func (mask *ValidityMask) Reset() {
+	mask.nulls = mask.nulls[:0]
+}
+
+// Set the validity of the values [offset, offset+end-start) to the validity of the values [start, end) of other.
+func (mask *ValidityMask) copyFrom(other *ValidityMask, start int, end int, offset int) {
+	if other.AllValid() {
+		// Only the bits that are covered by the mask have to be cleared.
+		for i := offset; i < offset+end-start && i < 64*len(mask.nulls); i++ {
+			mask.Set(i, true)
+		}
+
+		return
+	}
+
+	for i := start; i < end; i++ {
+		mask.Set(offset+i-start, other.IsValid(i))
+	}
+}
@@ -0,0 +1,246 @@
+package common
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// The number of rows that are processed at once: scans produce DataChunks of at most this many rows.
+const StandardVectorSize = 2048
+
+// A Vector holds the values of a single column for a range of rows. The values are stored in a Go slice of the type
+// of the column (e.g. []int32 for INTEGER, []string for VARCHAR), which can be accessed directly through Data. NULL
+// values are marked in the validity mask of the vector, and hold the zero value of the Go type in the slice.
+type Vector struct {
+	typ      TypeID
+	data     interface{} // The values, a slice of the Go type of typ.
+	validity ValidityMask
+}
+
+// Create an empty vector of the given type with room for capacity values.
+func NewVector(typ TypeID, capacity int) *Vector {
+	return &Vector{typ: typ, data: reflect.MakeSlice(typ.sliceType(), 0, capacity).Interface()}
+}
+
+// Create a vector that holds the values of the given slice, which must be of the Go type of typ. The slice is not
+// copied.
+func NewVectorFromSlice(typ TypeID, data interface{}) *Vector {
+	if reflect.TypeOf(data) != typ.sliceType() {
+		panic(fmt.Sprintf("Cannot create a %s vector from %T", typ, data))
+	}
+
+	return &Vector{typ: typ, data: data}
+}
+
+func (v *Vector) Type() TypeID {
+	return v.typ
+}
+
+// The values of the vector, a slice of the Go type of the type of the vector.
+func (v *Vector) Data() interface{} {
+	return v.data
+}
+
+// The validity mask of the vector, which marks the NULL values.
+func (v *Vector) Validity() *ValidityMask {
+	return &v.validity
+}
+
+// Whether the value at the given index is NULL.
+func (v *Vector) IsNull(index int) bool {
+	return !v.validity.IsValid(index)
+}
+
+// Mark the value at the given index as NULL, and replace it with the zero value.
+func (v *Vector) SetNull(index int) {
+	element := reflect.ValueOf(v.data).Index(index)
+	element.Set(reflect.Zero(element.Type()))
+	v.validity.Set(index, false)
+}
+
+// Replace the values of the vector, the slice must be of the Go type of the type of the vector. The validity mask is
+// kept, so values that are appended this way are valid unless they are marked as NULL.
+func (v *Vector) SetData(data interface{}) {
+	if reflect.TypeOf(data) != v.typ.sliceType() {
+		panic(fmt.Sprintf("Cannot set %T as the data of a %s vector", data, v.typ))
+	}
+
+	v.data = data
+}
+
+// The number of values in the vector.
+func (v *Vector) Len() int {
+	return reflect.ValueOf(v.data).Len()
+}
+
+// The value at the given index, or nil if it is NULL.
+func (v *Vector) Value(index int) interface{} {
+	if v.IsNull(index) {
+		return nil
+	}
+
+	return reflect.ValueOf(v.data).Index(index).Interface()
+}
+
+// Replace the value at the given index, value must be of the Go type of the type of the vector, or nil for NULL.
+func (v *Vector) Set(index int, value interface{}) {
+	if value == nil {
+		v.SetNull(index)
+		return
+	}
+
+	element := reflect.ValueOf(v.data).Index(index)
+
+	if reflect.TypeOf(value) != element.Type() {
+		panic(fmt.Sprintf("Cannot set %T in a %s vector", value, v.typ))
+	}
+
+	element.Set(reflect.ValueOf(value))
+	v.validity.Set(index, true)
+}
+
+// Append a single value, which must be of the Go type of the type of the vector, or nil for a NULL value.
+func (v *Vector) Append(value interface{}) {
+	data := reflect.ValueOf(v.data)
+
+	if value == nil {
+		v.data = reflect.Append(data, reflect.Zero(data.Type().Elem())).Interface()
+		v.validity.Set(data.Len(), false)
+
+		return
+	}
+
+	element := reflect.ValueOf(value)
+
+	if element.Type() != data.Type().Elem() {
+		panic(fmt.Sprintf("Cannot append %T to a %s vector", value, v.typ))
+	}
+
+	v.data = reflect.Append(data, element).Interface()
+	v.validity.Set(data.Len(), true)
+}
+
+// Append the values of other in the range [start, end).
+func (v *Vector) AppendVector(other *Vector, start int, end int) {
+	if other.typ != v.typ {
+		panic(fmt.Sprintf("Cannot append a %s vector to a %s vector", other.typ, v.typ))
+	}
+
+	offset := v.Len()
+	v.data = reflect.AppendSlice(reflect.ValueOf(v.data), reflect.ValueOf(other.data).Slice(start, end)).Interface()
+	v.validity.copyFrom(&other.validity, start, end, offset)
+}
+
+// A vector with the values in the range [start, end), which shares the values with this vector. The validity mask is
+// copied.
+func (v *Vector) Slice(start int, end int) *Vector {
+	result := &Vector{typ: v.typ, data: reflect.ValueOf(v.data).Slice(start, end).Interface()}
+	result.validity.copyFrom(&v.validity, start, end, 0)
+
+	return result
+}
+
+// Keep only the values for which selection is true, in order. The selection must have an entry for every value.
+func (v *Vector) Filter(selection []bool) {
+	data := reflect.ValueOf(v.data)
+	allValid := v.validity.AllValid()
+	count := 0
+
+	for i := 0; i < data.Len(); i++ {
+		if selection[i] {
+			data.Index(count).Set(data.Index(i))
+
+			if !allValid {
+				v.validity.Set(count, v.validity.IsValid(i))
+			}
+
+			count++
+		}
+	}
+
+	v.data = data.Slice(0, count).Interface()
+
+	if !allValid {
+		for i := count; i < data.Len(); i++ {
+			v.validity.Set(i, true)
+		}
+	}
+}
+
+// Remove all values, keeping the allocated capacity.
+func (v *Vector) Reset() {
+	v.data = reflect.ValueOf(v.data).Slice(0, 0).Interface()
+	v.validity.Reset()
+}
+
+// A DataChunk is a set of vectors of equal length: the values of a range of rows for a set of columns.
+type DataChunk struct {
+	Columns []*Vector
+}
+
+// Create an empty DataChunk with a vector of every type, with room for capacity values.
+func NewDataChunk(types []TypeID, capacity int) *DataChunk {
+	chunk := &DataChunk{Columns: make([]*Vector, len(types))}
+
+	for i, typ := range types {
+		chunk.Columns[i] = NewVector(typ, capacity)
+	}
+
+	return chunk
+}
+
+// The number of rows in the chunk.
+func (chunk *DataChunk) Len() int {
+	if len(chunk.Columns) == 0 {
+		return 0
+	}
+
+	return chunk.Columns[0].Len()
+}
+
+// The types of the columns of the chunk.
+func (chunk *DataChunk) Types() []TypeID {
+	types := make([]TypeID, len(chunk.Columns))
+
+	for i, column := range chunk.Columns {
+		types[i] = column.Type()
+	}
+
+	return types
+}
+
+// A chunk with the rows in the range [start, end), which shares the values with this chunk.
+func (chunk *DataChunk) Slice(start int, end int) *DataChunk {
+	result := &DataChunk{Columns: make([]*Vector, len(chunk.Columns))}
+
+	for i, column := range chunk.Columns {
+		result.Columns[i] = column.Slice(start, end)
+	}
+
+	return result
+}
+
+// Keep only the rows for which selection is true, in order.
+func (chunk *DataChunk) Filter(selection []bool) {
+	for _, column := range chunk.Columns {
+		column.Filter(selection)
+	}
+}
+
+// Remove all rows, keeping the allocated capacity.
+func (chunk *DataChunk) Reset() {
+	for _, column := range chunk.Columns {
+		column.Reset()
+	}
+}
+
+// Verify that all columns have the same length.
+func (chunk *DataChunk) Verify() error {
+	for i, column := range chunk.Columns {
+		if column.Len() != chunk.Len() {
+			return fmt.Errorf("column %d has %d rows, expected %d", i, column.Len(), chunk.Len())
+		}
+	}
+
+	return nil
+}
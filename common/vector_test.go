@@ -0,0 +1,129 @@
+package common
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestVector(t *testing.T) {
+	vector := NewVector(Varchar, 0)
+
+	for _, value := range []string{"a", "b", "c", "d"} {
+		vector.Append(value)
+	}
+
+	if vector.Len() != 4 || vector.Value(2) != "c" {
+		t.Errorf("Expect 4 values, got %v", vector.Data())
+	}
+
+	other := NewVector(Varchar, 0)
+	other.AppendVector(vector, 1, 3)
+
+	if !reflect.DeepEqual(other.Data(), []string{"b", "c"}) {
+		t.Errorf("Expect [b c], got %v", other.Data())
+	}
+
+	if slice := vector.Slice(2, 4); !reflect.DeepEqual(slice.Data(), []string{"c", "d"}) {
+		t.Errorf("Expect [c d], got %v", slice.Data())
+	}
+
+	vector.Reset()
+
+	if vector.Len() != 0 {
+		t.Errorf("Expect an empty vector after a reset")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expect appending a value of the wrong type to panic")
+		}
+	}()
+
+	vector.Append(int32(1))
+}
+
+func TestDataChunk(t *testing.T) {
+	chunk := NewDataChunk([]TypeID{Integer, Double}, StandardVectorSize)
+	chunk.Columns[0].SetData([]int32{1, 2, 3})
+	chunk.Columns[1].SetData([]float64{1.5, 2.5})
+
+	if err := chunk.Verify(); err == nil {
+		t.Errorf("Expect columns of different lengths to fail verification")
+	}
+
+	chunk.Columns[1].Append(3.5)
+
+	if err := chunk.Verify(); err != nil || chunk.Len() != 3 {
+		t.Errorf("Expect a chunk of 3 rows, got %d: %v", chunk.Len(), err)
+	}
+
+	if !reflect.DeepEqual(chunk.Types(), []TypeID{Integer, Double}) {
+		t.Errorf("Expect types [INTEGER DOUBLE], got %v", chunk.Types())
+	}
+
+	chunk.Filter([]bool{true, false, true})
+
+	if !reflect.DeepEqual(chunk.Columns[0].Data(), []int32{1, 3}) ||
+		!reflect.DeepEqual(chunk.Columns[1].Data(), []float64{1.5, 3.5}) {
+		t.Errorf("Expect the rows 0 and 2 to remain after a filter, got %v and %v", chunk.Columns[0].Data(),
+			chunk.Columns[1].Data())
+	}
+
+	if !Integer.IsValue(int32(1)) || Integer.IsValue(int64(1)) || !Timestamp.IsValue(int64(1)) || InvalidType.IsValue(nil) {
+		t.Errorf("Expect values to match the Go type of their type")
+	}
+}
+
+func TestVectorValidity(t *testing.T) {
+	vector := NewVector(Varchar, 0)
+
+	for i := 0; i < 100; i++ {
+		if i%7 == 0 {
+			vector.Append(nil)
+		} else {
+			vector.Append(fmt.Sprint(i))
+		}
+	}
+
+	if vector.Len() != 100 || vector.Value(0) != nil || vector.Value(1) != "1" || vector.Data().([]string)[7] != "" {
+		t.Errorf("Expect NULL values to be stored as empty strings")
+	}
+
+	if nulls := vector.Validity().NullCount(vector.Len()); nulls != 15 {
+		t.Errorf("Expect 15 NULL values, got %d", nulls)
+	}
+
+	// The validity is kept by the operations on vectors.
+	other := NewVector(Varchar, 0)
+	other.Append("a")
+	other.AppendVector(vector, 69, 72)
+
+	if !reflect.DeepEqual([]interface{}{other.Value(0), other.Value(1), other.Value(2), other.Value(3)},
+		[]interface{}{"a", "69", nil, "71"}) {
+		t.Errorf("Expect [a 69 NULL 71], got %v", other.Data())
+	}
+
+	if slice := vector.Slice(63, 66); !slice.IsNull(0) || slice.IsNull(1) || slice.Validity().NullCount(3) != 1 {
+		t.Errorf("Expect only the first value of the slice to be NULL")
+	}
+
+	other.Filter([]bool{false, false, true, true})
+
+	if other.Len() != 2 || !other.IsNull(0) || other.IsNull(1) {
+		t.Errorf("Expect [NULL 71] after a filter, got %v", other.Data())
+	}
+
+	other.SetNull(1)
+
+	if other.Value(1) != nil || other.Data().([]string)[1] != "" {
+		t.Errorf("Expect a value that is set to NULL to be cleared")
+	}
+
+	other.Reset()
+	other.Append("b")
+
+	if !other.Validity().AllValid() || other.Value(0) != "b" {
+		t.Errorf("Expect all values to be valid after a reset")
+	}
+}
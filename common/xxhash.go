@@ -0,0 +1,84 @@
+package common
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+// 64-bit xxHash, see: https://github.com/Cyan4973/xxHash/blob/dev/doc/xxhash_spec.md
+const (
+	xxPrime64_1 uint64 = 11400714785074694791
+	xxPrime64_2 uint64 = 14029467366897019727
+	xxPrime64_3 uint64 = 1609587929392839161
+	xxPrime64_4 uint64 = 9650029242287828579
+	xxPrime64_5 uint64 = 2870177450012600261
+)
+
+func xxRound(acc uint64, input uint64) uint64 {
+	acc += input * xxPrime64_2
+	acc = bits.RotateLeft64(acc, 31)
+
+	return acc * xxPrime64_1
+}
+
+func xxMergeRound(acc uint64, val uint64) uint64 {
+	acc ^= xxRound(0, val)
+
+	return acc*xxPrime64_1 + xxPrime64_4
+}
+
+func xxHash64(buffer []byte, seed uint64) uint64 {
+	length := uint64(len(buffer))
+	var hash uint64
+
+	if len(buffer) >= 32 {
+		v1 := seed + xxPrime64_1 + xxPrime64_2
+		v2 := seed + xxPrime64_2
+		v3 := seed
+		v4 := seed - xxPrime64_1
+
+		// Process the input in stripes of 32 bytes.
+		for ; len(buffer) >= 32; buffer = buffer[32:] {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(buffer[0:8]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(buffer[8:16]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(buffer[16:24]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(buffer[24:32]))
+		}
+
+		hash = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		hash = xxMergeRound(hash, v1)
+		hash = xxMergeRound(hash, v2)
+		hash = xxMergeRound(hash, v3)
+		hash = xxMergeRound(hash, v4)
+	} else {
+		hash = seed + xxPrime64_5
+	}
+
+	hash += length
+
+	// Consume the remaining input.
+	for ; len(buffer) >= 8; buffer = buffer[8:] {
+		hash ^= xxRound(0, binary.LittleEndian.Uint64(buffer))
+		hash = bits.RotateLeft64(hash, 27)*xxPrime64_1 + xxPrime64_4
+	}
+
+	if len(buffer) >= 4 {
+		hash ^= uint64(binary.LittleEndian.Uint32(buffer)) * xxPrime64_1
+		hash = bits.RotateLeft64(hash, 23)*xxPrime64_2 + xxPrime64_3
+		buffer = buffer[4:]
+	}
+
+	for _, b := range buffer {
+		hash ^= uint64(b) * xxPrime64_5
+		hash = bits.RotateLeft64(hash, 11) * xxPrime64_1
+	}
+
+	// Final avalanche.
+	hash ^= hash >> 33
+	hash *= xxPrime64_2
+	hash ^= hash >> 29
+	hash *= xxPrime64_3
+	hash ^= hash >> 32
+
+	return hash
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+
 	"github.com/goduckdb/common"
 	"github.com/goduckdb/storage"
 )
@@ -14,13 +16,127 @@ const (
 )
 
 type DBConfig struct {
-	accessMode AccessMode
-	fileSystem *common.FileSystem
+	accessMode   AccessMode
+	fileSystem   common.FileSystem   // The FileSystem to use, can be overwritten to plug in virtual, instrumented or test file systems.
+	checksumType common.ChecksumType // The checksum algorithm of the blocks of newly created database files.
+	memoryLimit  uint64              // The maximum amount of memory used for blocks, 0 uses storage.DefaultMemoryLimit.
+	// The directory blocks are spilled to when the memory limit is reached, if tempDirectorySet is false the default
+	// directory of the database is used, and an in-memory database does not spill.
+	tempDirectory    string
+	tempDirectorySet bool
+	// The size of the write-ahead log after which a commit triggers a checkpoint, 0 disables automatic checkpoints.
+	checkpointThreshold uint64
+}
+
+// Returns the default configuration: a read-write database on the local file system.
+func NewDBConfig() *DBConfig {
+	return &DBConfig{
+		accessMode:          ReadWrite,
+		checksumType:        common.DefaultChecksumType,
+		memoryLimit:         storage.DefaultMemoryLimit,
+		checkpointThreshold: storage.DefaultCheckpointThreshold,
+	}
+}
+
+// Set the FileSystem the database is stored on, e.g. a MemoryFileSystem or a FaultInjectionFileSystem. A nil
+// FileSystem uses the local file system.
+func (config *DBConfig) SetFileSystem(fs common.FileSystem) {
+	config.fileSystem = fs
+}
+
+// Set the checksum algorithm used for the blocks of newly created database files. Existing files keep the algorithm
+// they were created with.
+func (config *DBConfig) SetChecksumType(checksumType common.ChecksumType) {
+	config.checksumType = checksumType
+}
+
+// Set the maximum amount of memory (in bytes) the database keeps blocks in. Unpinned blocks are evicted when the limit
+// is reached.
+func (config *DBConfig) SetMemoryLimit(memoryLimit uint64) {
+	config.memoryLimit = memoryLimit
+}
+
+// Set the directory blocks are spilled to when the memory limit is reached. An empty directory disables spilling.
+func (config *DBConfig) SetTempDirectory(directory string) {
+	config.tempDirectory = directory
+	config.tempDirectorySet = true
+}
+
+// Set the size of the write-ahead log (in bytes) after which a commit triggers a checkpoint (checkpoint_threshold). A
+// threshold of 0 disables automatic checkpoints, the log is then only truncated by Checkpoint and ForceCheckpoint.
+func (config *DBConfig) SetCheckpointThreshold(threshold uint64) {
+	config.checkpointThreshold = threshold
+}
+
+// Returns the configured FileSystem, falling back to the local file system if none was set.
+func (config *DBConfig) FileSystem() common.FileSystem {
+	if config.fileSystem == nil {
+		return common.NewLocalFileSystem()
+	}
+
+	return config.fileSystem
 }
 
 // The database object. This object holds the catalog and all the
 // database-specific meta information.
 type DuckDB struct {
-	fileSystem *common.FileSystem
+	fileSystem common.FileSystem
 	storage    *storage.StorageManager
 }
+
+// Open the database at the given path, creating it if it does not exist. A database opened at ":memory:" (or at an
+// empty path) is kept in memory and never touches the disk.
+func NewDuckDB(path string, config *DBConfig) (*DuckDB, error) {
+	if config == nil {
+		config = NewDBConfig()
+	}
+
+	if !config.checksumType.Valid() {
+		return nil, fmt.Errorf("invalid checksum type %d", config.checksumType)
+	}
+
+	options := storage.DefaultOptions()
+	options.ReadOnly = config.accessMode == ReadOnly
+	options.ChecksumType = config.checksumType
+	options.CheckpointThreshold = config.checkpointThreshold
+
+	if config.memoryLimit != 0 {
+		options.MemoryLimit = config.memoryLimit
+	}
+
+	if config.tempDirectorySet {
+		options.TempDirectory = config.tempDirectory
+	} else {
+		options.TempDirectory = storage.DefaultTempDirectory(path)
+	}
+
+	db := &DuckDB{fileSystem: config.FileSystem()}
+	db.storage = storage.NewStorageManager(db.fileSystem, path, options)
+
+	if err := db.storage.Initialize(); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Persist all changes in the database file and truncate the write-ahead log (CHECKPOINT). Waits for the running
+// transactions to finish.
+func (db *DuckDB) Checkpoint() error {
+	return db.storage.Checkpoint()
+}
+
+// Checkpoint like Checkpoint, but abort the running transactions instead of waiting for them (FORCE CHECKPOINT).
+func (db *DuckDB) ForceCheckpoint() error {
+	return db.storage.ForceCheckpoint()
+}
+
+// Shrink the database file (VACUUM): the blocks of the tables are moved to the front of the file, and the free blocks
+// at its end are truncated. Waits for the running transactions to finish.
+func (db *DuckDB) Vacuum() error {
+	return db.storage.Vacuum()
+}
+
+func (db *DuckDB) Close() error {
+	return db.storage.Close()
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/goduckdb/common"
+	"github.com/goduckdb/storage"
+)
+
+func TestOpenInMemoryDatabase(t *testing.T) {
+	db, err := NewDuckDB(storage.InMemoryPath, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, ok := db.storage.BlockManager().(*storage.InMemoryBlockManager); !ok {
+		t.Errorf("Expect an InMemoryBlockManager, got %T", db.storage.BlockManager())
+	}
+
+	if _, err := NewDuckDB(storage.InMemoryPath, &DBConfig{accessMode: ReadOnly}); err == nil {
+		t.Errorf("Expect an in-memory database cannot be opened in read-only mode")
+	}
+}
+
+func TestOpenDatabaseFile(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	config := &DBConfig{fileSystem: fs}
+	path := filepath.Join("/", "test.db")
+
+	if _, err := NewDuckDB(path, &DBConfig{fileSystem: fs, accessMode: ReadOnly}); err == nil {
+		t.Errorf("Expect a database that does not exist cannot be opened in read-only mode")
+	}
+
+	db, err := NewDuckDB(path, config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := db.storage.BlockManager().(*storage.SingleFileBlockManager); !ok {
+		t.Errorf("Expect a SingleFileBlockManager, got %T", db.storage.BlockManager())
+	}
+
+	if exists, _ := fs.FileExists(path); !exists {
+		t.Errorf("Expect database file %s to be created", path)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatabaseMemoryLimit(t *testing.T) {
+	config := NewDBConfig()
+	config.SetMemoryLimit(16 * storage.BlockSize)
+	db, err := NewDuckDB(storage.InMemoryPath, config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if limit := db.storage.BufferManager().Metrics().MemoryLimit; limit != 16*storage.BlockSize {
+		t.Errorf("Expect memory limit %d, got %d", 16*storage.BlockSize, limit)
+	}
+}
+
+func TestDatabaseCheckpointThreshold(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	config := NewDBConfig()
+	config.fileSystem = fs
+	config.SetCheckpointThreshold(1)
+	db, err := NewDuckDB("/threshold.db", config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	info := storage.TableInfo{Name: "t", Columns: []storage.ColumnDefinition{{Name: "id", Type: common.Integer}}}
+	table, err := db.storage.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metaBlock := db.storage.BlockManager().GetMetaBlock()
+	chunk := &common.DataChunk{Columns: []*common.Vector{common.NewVectorFromSlice(common.Integer, []int32{1, 2, 3})}}
+
+	if err := table.Append(chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every commit exceeds the threshold, so it is followed by a checkpoint.
+	if db.storage.BlockManager().GetMetaBlock() == metaBlock {
+		t.Errorf("Expect the append to trigger a checkpoint")
+	}
+
+	if err := db.ForceCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatabaseDisableAutomaticCheckpoints(t *testing.T) {
+	if threshold := NewDBConfig().checkpointThreshold; threshold != storage.DefaultCheckpointThreshold {
+		t.Errorf("Expect the default checkpoint threshold %d, got %d", storage.DefaultCheckpointThreshold, threshold)
+	}
+
+	fs := common.NewMemoryFileSystem()
+	config := NewDBConfig()
+	config.SetFileSystem(fs)
+	config.SetCheckpointThreshold(0)
+	db, err := NewDuckDB("/disabled.db", config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	info := storage.TableInfo{Name: "t", Columns: []storage.ColumnDefinition{{Name: "id", Type: common.Integer}}}
+	table, err := db.storage.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	metaBlock := db.storage.BlockManager().GetMetaBlock()
+	ids := make([]int32, 100000)
+
+	for i := range ids {
+		ids[i] = int32(i)
+	}
+
+	// Without automatic checkpoints, the log grows beyond the default threshold until an explicit checkpoint.
+	for databaseFileSize(t, fs, "/disabled.db.wal") < storage.DefaultCheckpointThreshold {
+		chunk := &common.DataChunk{Columns: []*common.Vector{common.NewVectorFromSlice(common.Integer, ids)}}
+
+		if err := table.Append(chunk); err != nil {
+			t.Fatal(err)
+		}
+
+		if db.storage.BlockManager().GetMetaBlock() != metaBlock {
+			t.Fatalf("Expect no automatic checkpoint with a threshold of 0")
+		}
+	}
+
+	if err := db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	if db.storage.BlockManager().GetMetaBlock() == metaBlock {
+		t.Errorf("Expect an explicit checkpoint to write a new header")
+	}
+}
+
+func TestDatabaseFileSystem(t *testing.T) {
+	fs := common.NewFaultInjectionFileSystem(common.NewMemoryFileSystem())
+	config := NewDBConfig()
+	config.SetFileSystem(fs)
+	db, err := NewDuckDB("/plugged.db", config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.FileSystem() != fs {
+		t.Errorf("Expect the configured FileSystem to be used")
+	}
+
+	if exists, _ := fs.FileExists("/plugged.db"); !exists {
+		t.Errorf("Expect the database file to be created in the configured FileSystem")
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDatabaseVacuum(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	config := NewDBConfig()
+	config.SetFileSystem(fs)
+	db, err := NewDuckDB("/vacuum.db", config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ids := make([]int32, 100000)
+
+	for i := range ids {
+		ids[i] = int32(i)
+	}
+
+	for _, name := range []string{"a", "b"} {
+		info := storage.TableInfo{Name: name, Columns: []storage.ColumnDefinition{{Name: "id", Type: common.Integer}}}
+		table, err := db.storage.CreateTable(&info)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chunk := &common.DataChunk{Columns: []*common.Vector{common.NewVectorFromSlice(common.Integer, ids)}}
+
+		if err := table.Append(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dropping the table that was written first leaves free blocks in front of the blocks of the remaining table, which
+	// a checkpoint cannot truncate.
+	if err := db.storage.DropTable("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	sizeBefore := databaseFileSize(t, fs, "/vacuum.db")
+
+	if err := db.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sizeAfter := databaseFileSize(t, fs, "/vacuum.db"); sizeAfter >= sizeBefore {
+		t.Errorf("Expect the file to shrink after a vacuum, got %d bytes before and %d after", sizeBefore, sizeAfter)
+	}
+
+	if count := db.storage.GetTable("b").Count(); count != uint64(len(ids)) {
+		t.Errorf("Expect %d rows after a vacuum, got %d", len(ids), count)
+	}
+}
+
+func databaseFileSize(t *testing.T, fs common.FileSystem, path string) int64 {
+	handle, err := fs.OpenFile(path, common.ReadOnly, common.NoLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	size, err := fs.GetFileSize(handle)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return size
+}
@@ -5,12 +5,21 @@ type BlockManager interface {
 	CreateBlock() *Block
 	// Return the next free block id.
 	GetFreeBlockID() BlockID
+	// Mark a block as free right away; it must not be referenced by the active header.
+	MarkBlockAsFree(blockID BlockID)
+	// Mark a block that is referenced by the active header as modified; it is free once the next header is written.
+	MarkBlockAsModified(blockID BlockID)
+	// Move the given live blocks to lower free blocks, so that the file can be truncated by the next checkpoint. Returns
+	// the new id of every moved block.
+	RelocateBlocks(blocks []BlockID) (map[BlockID]BlockID, error)
 	// Get the first meta block id.
 	GetMetaBlock() BlockID
 	// Read the content of the block from disk.
-	Read(block *Block)
+	Read(block *Block) error
 	// Writes the block to disk.
-	Write(block *Block)
+	Write(block *Block) error
 	// Write the header; should be the final step of a checkpoint.
-	WriteHeader(header DatabaseHeader)
+	WriteHeader(header DatabaseHeader) error
+	// Release the resources held by the block manager.
+	Close() error
 }
@@ -0,0 +1,378 @@
+package storage
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// The default memory limit of the BufferManager: 1GB.
+const DefaultMemoryLimit = 1 << 30
+
+// The first BlockID of the temporary blocks that are allocated by the BufferManager. Temporary blocks hold intermediate
+// data (e.g. sort runs or hash tables); they are never written to the database file, so their ids cannot collide with
+// the ids of persistent blocks.
+const TemporaryBlockStart BlockID = 1 << 62
+
+// The metrics of a BufferManager.
+type BufferManagerMetrics struct {
+	Hits        uint64 // The number of pins of blocks that were already loaded.
+	Misses      uint64 // The number of pins of blocks that had to be loaded.
+	Evictions   uint64 // The number of blocks that were evicted to stay within the memory limit.
+	Spills      uint64 // The number of evicted temporary blocks that were written to the temporary file.
+	UsedMemory  uint64 // The memory currently used by loaded blocks.
+	MemoryLimit uint64 // The memory limit.
+}
+
+// A blockEntry is a block that is managed by the BufferManager, which may or may not be loaded in memory.
+type blockEntry struct {
+	id        BlockID
+	block     *Block        // The buffer of the block, nil if the block is not loaded and no memory is reserved for it.
+	loaded    bool          // Whether the content of the block has been loaded into the buffer.
+	pins      int           // The number of BufferHandles that pin the block.
+	element   *list.Element // The position of the block in the LRU list, nil while the block is pinned or not loaded.
+	loadLock  sync.Mutex    // Held while the block is loaded, so that concurrent pins load the block only once.
+	temporary bool          // Whether the block is a temporary block.
+	// Whether the block was unregistered while it was pinned: it is no longer in the BufferManager, and its memory is
+	// released when it is unpinned.
+	unregistered bool
+}
+
+// The BufferManager caches the blocks of a BlockManager in memory and keeps the memory they use below a memory limit.
+// A block has to be pinned to be used: while it is pinned it stays in memory, once it is unpinned it can be evicted.
+// Unpinned blocks are evicted in least recently used order; evicted temporary blocks are spilled to the temporary file,
+// and read back when they are pinned again. Blocks are read concurrently by many scan threads, so all methods are safe
+// for concurrent use.
+type BufferManager struct {
+	lock           sync.Mutex
+	blockManager   BlockManager
+	temporaryFiles *TemporaryFileManager // The TemporaryFileManager evicted temporary blocks are spilled to, nil if spilling is disabled.
+	memoryLimit    uint64
+	usedMemory     uint64
+	blocks         map[BlockID]*blockEntry
+	lru            *list.List // The unpinned, loaded blocks; the least recently used block is at the back.
+	nextTemporary  BlockID    // The id of the next temporary block.
+	reusable       *Block     // The buffer of the block that was evicted last, reused for the next block that is loaded.
+	metrics        BufferManagerMetrics
+}
+
+// Create a BufferManager for the blocks of the BlockManager. If temporaryFiles is nil, temporary blocks cannot be
+// evicted.
+func NewBufferManager(blockManager BlockManager, memoryLimit uint64, temporaryFiles *TemporaryFileManager) *BufferManager {
+	return &BufferManager{
+		blockManager:   blockManager,
+		temporaryFiles: temporaryFiles,
+		memoryLimit:    memoryLimit,
+		blocks:         make(map[BlockID]*blockEntry),
+		lru:            list.New(),
+		nextTemporary:  TemporaryBlockStart,
+	}
+}
+
+// A BufferHandle is a pinned block. The block stays in memory until the handle is unpinned.
+type BufferHandle struct {
+	manager *BufferManager
+	entry   *blockEntry
+	pinned  bool
+}
+
+func (handle *BufferHandle) ID() BlockID {
+	return handle.entry.id
+}
+
+// The pinned block. It must not be used after the handle has been unpinned.
+func (handle *BufferHandle) Block() *Block {
+	return handle.entry.block
+}
+
+// Unpin the block, after which it can be evicted. Unpinning a handle more than once has no effect.
+func (handle *BufferHandle) Unpin() {
+	if handle.pinned {
+		handle.pinned = false
+		handle.manager.unpin(handle.entry)
+	}
+}
+
+// Pin the block with the given id, reading it through the BlockManager if it is not loaded.
+func (manager *BufferManager) Pin(blockID BlockID) (*BufferHandle, error) {
+	manager.lock.Lock()
+	entry, ok := manager.blocks[blockID]
+
+	if !ok {
+		if blockID >= TemporaryBlockStart {
+			manager.lock.Unlock()
+			return nil, fmt.Errorf("cannot pin temporary block %d: the block does not exist", blockID)
+		}
+
+		entry = &blockEntry{id: blockID}
+		manager.blocks[blockID] = entry
+	}
+
+	entry.pins++
+
+	if entry.element != nil {
+		manager.lru.Remove(entry.element)
+		entry.element = nil
+	}
+
+	if entry.block == nil {
+		manager.metrics.Misses++
+		block, err := manager.reserve(blockID)
+
+		if err != nil {
+			entry.pins--
+			manager.release(entry)
+			manager.lock.Unlock()
+			return nil, err
+		}
+
+		entry.block = block
+	} else {
+		manager.metrics.Hits++
+	}
+
+	manager.lock.Unlock()
+
+	if err := manager.load(entry); err != nil {
+		manager.unpin(entry)
+		return nil, err
+	}
+
+	return &BufferHandle{manager: manager, entry: entry, pinned: true}, nil
+}
+
+// Allocate a new temporary block, which is returned pinned. Temporary blocks are not part of the database file; they
+// must be destroyed with Destroy once they are no longer needed.
+func (manager *BufferManager) Allocate() (*BufferHandle, error) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	blockID := manager.nextTemporary
+	block, err := manager.reserve(blockID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	manager.nextTemporary++
+	entry := &blockEntry{id: blockID, block: block, loaded: true, pins: 1, temporary: true}
+	manager.blocks[blockID] = entry
+
+	return &BufferHandle{manager: manager, entry: entry, pinned: true}, nil
+}
+
+// Destroy a temporary block, releasing its memory. The block must not be pinned.
+func (manager *BufferManager) Destroy(blockID BlockID) error {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	entry, ok := manager.blocks[blockID]
+
+	if !ok || !entry.temporary {
+		return fmt.Errorf("cannot destroy block %d: the block is not a temporary block", blockID)
+	}
+
+	if entry.pins > 0 {
+		return fmt.Errorf("cannot destroy block %d: the block is pinned", blockID)
+	}
+
+	manager.drop(entry)
+
+	if manager.temporaryFiles != nil {
+		manager.temporaryFiles.DeleteTemporaryBlock(blockID)
+	}
+
+	return nil
+}
+
+// Remove a persistent block from the cache, e.g. because it has been freed and its id may be reused for a block with
+// different content. A pinned block keeps its buffer until it is unpinned, but later pins read the block again.
+func (manager *BufferManager) UnregisterBlock(blockID BlockID) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	entry, ok := manager.blocks[blockID]
+
+	if !ok {
+		return
+	}
+
+	if entry.pins == 0 {
+		manager.drop(entry)
+	} else {
+		entry.unregistered = true
+		delete(manager.blocks, blockID)
+	}
+}
+
+// Set a new memory limit, evicting blocks until the used memory is within the limit.
+func (manager *BufferManager) SetMemoryLimit(memoryLimit uint64) error {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	oldLimit := manager.memoryLimit
+	manager.memoryLimit = memoryLimit
+
+	err := manager.evict(0)
+	manager.reusable = nil
+
+	if err != nil {
+		manager.memoryLimit = oldLimit
+	}
+
+	return err
+}
+
+func (manager *BufferManager) Metrics() BufferManagerMetrics {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	metrics := manager.metrics
+	metrics.UsedMemory = manager.usedMemory
+	metrics.MemoryLimit = manager.memoryLimit
+
+	return metrics
+}
+
+// Load the content of the block, if it has not been loaded yet.
+func (manager *BufferManager) load(entry *blockEntry) error {
+	entry.loadLock.Lock()
+	defer entry.loadLock.Unlock()
+
+	if entry.loaded {
+		return nil
+	}
+
+	var err error
+
+	if entry.temporary {
+		err = manager.temporaryFiles.ReadTemporaryBlock(entry.block)
+	} else {
+		err = manager.blockManager.Read(entry.block)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	entry.loaded = true
+
+	return nil
+}
+
+func (manager *BufferManager) unpin(entry *blockEntry) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	entry.pins--
+	manager.release(entry)
+}
+
+// Called with the lock held after the pin count of the block dropped: an unpinned block becomes eligible for eviction,
+// or gives up its memory right away if it could not be loaded or has been unregistered.
+func (manager *BufferManager) release(entry *blockEntry) {
+	if entry.pins > 0 {
+		return
+	}
+
+	if entry.unregistered {
+		manager.unload(entry)
+	} else if entry.loaded {
+		if entry.temporary && manager.temporaryFiles == nil {
+			// Without a temporary file, temporary blocks cannot be evicted: their content only exists in memory.
+			return
+		}
+
+		entry.element = manager.lru.PushFront(entry)
+	} else if entry.temporary {
+		// The temporary block could not be read back, it stays in the temporary file.
+		manager.unload(entry)
+	} else {
+		manager.drop(entry)
+	}
+}
+
+// Release the memory of the block, but keep the block in the BufferManager. Called with the lock held.
+func (manager *BufferManager) unload(entry *blockEntry) {
+	if entry.element != nil {
+		manager.lru.Remove(entry.element)
+		entry.element = nil
+	}
+
+	if entry.block != nil {
+		manager.usedMemory -= BlockSize
+		entry.block = nil
+	}
+
+	entry.loaded = false
+}
+
+// Remove the block from the BufferManager, releasing its memory. Called with the lock held.
+func (manager *BufferManager) drop(entry *blockEntry) {
+	manager.unload(entry)
+	delete(manager.blocks, entry.id)
+}
+
+// Reserve the memory for a block, evicting unpinned blocks if that would exceed the memory limit. The buffer of an
+// evicted block is reused for the new block. Called with the lock held.
+func (manager *BufferManager) reserve(blockID BlockID) (*Block, error) {
+	if err := manager.evict(BlockSize); err != nil {
+		return nil, err
+	}
+
+	manager.usedMemory += BlockSize
+
+	if manager.reusable != nil {
+		block := manager.reusable
+		manager.reusable = nil
+		block.ID = blockID
+
+		return block, nil
+	}
+
+	return NewBlock(blockID), nil
+}
+
+// Evict unpinned blocks until the given amount of memory can be used without exceeding the memory limit. Called with
+// the lock held.
+func (manager *BufferManager) evict(size uint64) error {
+	for manager.usedMemory+size > manager.memoryLimit {
+		element := manager.lru.Back()
+
+		if element == nil {
+			return &OutOfMemoryError{Requested: size, Used: manager.usedMemory, Limit: manager.memoryLimit}
+		}
+
+		entry := element.Value.(*blockEntry)
+		manager.reusable = entry.block
+
+		if entry.temporary {
+			// The content of a temporary block only exists in memory, so it has to be spilled before it is evicted.
+			if err := manager.temporaryFiles.WriteTemporaryBlock(entry.block); err != nil {
+				manager.reusable = nil
+				return err
+			}
+
+			manager.unload(entry)
+			manager.metrics.Spills++
+		} else {
+			manager.drop(entry)
+		}
+
+		manager.metrics.Evictions++
+	}
+
+	return nil
+}
+
+// Close the BufferManager, removing the temporary file.
+func (manager *BufferManager) Close() error {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	if manager.temporaryFiles == nil {
+		return nil
+	}
+
+	return manager.temporaryFiles.Close()
+}
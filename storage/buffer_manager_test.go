@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// Create an in-memory BlockManager with count blocks, the first 8 bytes of every block hold its id.
+func newTestBlocks(t *testing.T, count int) BlockManager {
+	manager, err := NewInMemoryBlockManager()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < count; i++ {
+		block := manager.CreateBlock()
+		binary.LittleEndian.PutUint64(block.Buffer(), uint64(block.ID))
+
+		if err := manager.Write(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return manager
+}
+
+func pinBlock(t *testing.T, bufferManager *BufferManager, blockID BlockID) *BufferHandle {
+	handle, err := bufferManager.Pin(blockID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value := binary.LittleEndian.Uint64(handle.Block().Buffer()); value != uint64(blockID) {
+		t.Fatalf("Expect block %d to contain %d, got %d", blockID, blockID, value)
+	}
+
+	return handle
+}
+
+func TestBufferManagerEviction(t *testing.T) {
+	blockManager := newTestBlocks(t, 4)
+	defer blockManager.Close()
+	bufferManager := NewBufferManager(blockManager, 2*BlockSize, nil)
+
+	pinBlock(t, bufferManager, 0).Unpin()
+	pinBlock(t, bufferManager, 1).Unpin()
+	pinBlock(t, bufferManager, 0).Unpin() // Block 0 is now more recently used than block 1.
+	pinBlock(t, bufferManager, 2).Unpin() // Evicts block 1.
+
+	metrics := bufferManager.Metrics()
+
+	if metrics.Hits != 1 || metrics.Misses != 3 || metrics.Evictions != 1 {
+		t.Errorf("Expect 1 hit, 3 misses and 1 eviction, got %+v", metrics)
+	}
+
+	pinBlock(t, bufferManager, 0).Unpin() // Still cached.
+	pinBlock(t, bufferManager, 1).Unpin() // Evicted, has to be read again.
+
+	if metrics = bufferManager.Metrics(); metrics.Hits != 2 || metrics.Misses != 4 {
+		t.Errorf("Expect 2 hits and 4 misses, got %+v", metrics)
+	}
+
+	if metrics.UsedMemory > metrics.MemoryLimit {
+		t.Errorf("Expect the used memory %d to be within the limit %d", metrics.UsedMemory, metrics.MemoryLimit)
+	}
+}
+
+func TestBufferManagerPinnedBlocks(t *testing.T) {
+	blockManager := newTestBlocks(t, 3)
+	defer blockManager.Close()
+	bufferManager := NewBufferManager(blockManager, 2*BlockSize, nil)
+
+	handle0 := pinBlock(t, bufferManager, 0)
+	handle1 := pinBlock(t, bufferManager, 1)
+
+	// All blocks in memory are pinned, so there is no room for another block.
+	var oomErr *OutOfMemoryError
+
+	if _, err := bufferManager.Pin(2); !errors.As(err, &oomErr) {
+		t.Fatalf("Expect an OutOfMemoryError, got %v", err)
+	}
+
+	// Pinning a block twice does not use more memory.
+	pinBlock(t, bufferManager, 0).Unpin()
+	handle1.Unpin()
+	handle1.Unpin()
+	pinBlock(t, bufferManager, 2).Unpin()
+
+	// The pinned block was never evicted.
+	if value := binary.LittleEndian.Uint64(handle0.Block().Buffer()); value != 0 {
+		t.Errorf("Expect pinned block 0 to be intact, got %d", value)
+	}
+
+	handle0.Unpin()
+
+	if err := bufferManager.SetMemoryLimit(BlockSize); err != nil {
+		t.Fatal(err)
+	}
+
+	if metrics := bufferManager.Metrics(); metrics.UsedMemory != BlockSize {
+		t.Errorf("Expect blocks to be evicted down to the new limit, %d bytes used", metrics.UsedMemory)
+	}
+}
+
+func TestBufferManagerTemporaryBlocks(t *testing.T) {
+	blockManager := newTestBlocks(t, 1)
+	defer blockManager.Close()
+	bufferManager := NewBufferManager(blockManager, 2*BlockSize, nil)
+
+	handle, err := bufferManager.Allocate()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blockID := handle.ID()
+	copy(handle.Block().Buffer(), "intermediate")
+	handle.Unpin()
+
+	// Temporary blocks are never evicted, persistent blocks make room instead.
+	pinBlock(t, bufferManager, 0).Unpin()
+
+	if handle, err = bufferManager.Pin(blockID); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(handle.Block().Buffer()[:12]) != "intermediate" {
+		t.Errorf("Expect the temporary block to be intact")
+	}
+
+	if err := bufferManager.Destroy(blockID); err == nil {
+		t.Errorf("Expect a pinned block cannot be destroyed")
+	}
+
+	handle.Unpin()
+
+	if err := bufferManager.Destroy(blockID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := bufferManager.Pin(blockID); err == nil {
+		t.Errorf("Expect a destroyed block cannot be pinned")
+	}
+}
+
+func TestBufferManagerConcurrentPins(t *testing.T) {
+	const blockCount = 8
+	blockManager := newTestBlocks(t, blockCount)
+	defer blockManager.Close()
+	bufferManager := NewBufferManager(blockManager, 4*BlockSize, nil)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+
+		go func(worker int) {
+			defer wg.Done()
+
+			for i := 0; i < 100; i++ {
+				blockID := BlockID((worker + i) % blockCount)
+				handle, err := bufferManager.Pin(blockID)
+
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if value := binary.LittleEndian.Uint64(handle.Block().Buffer()); value != uint64(blockID) {
+					errs <- errors.New("pinned block has the wrong content")
+					return
+				}
+
+				handle.Unpin()
+			}
+		}(worker)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if metrics := bufferManager.Metrics(); metrics.Hits+metrics.Misses != 400 || metrics.UsedMemory > 4*BlockSize {
+		t.Errorf("Expect 400 pins within the memory limit, got %+v", metrics)
+	}
+}
+
+func TestBufferManagerUnregisterPinnedBlock(t *testing.T) {
+	blockManager := newTestBlocks(t, 2)
+	defer blockManager.Close()
+	bufferManager := NewBufferManager(blockManager, 4*BlockSize, nil)
+	handle := pinBlock(t, bufferManager, 0)
+
+	// The block is freed and reused while it is pinned: the pinned buffer stays valid, but is not cached any longer.
+	bufferManager.UnregisterBlock(0)
+	block := NewBlock(0)
+	binary.LittleEndian.PutUint64(block.Buffer(), 42)
+
+	if err := blockManager.Write(block); err != nil {
+		t.Fatal(err)
+	}
+
+	if value := binary.LittleEndian.Uint64(handle.Block().Buffer()); value != 0 {
+		t.Errorf("Expect the pinned buffer to keep its content, got %d", value)
+	}
+
+	reused, err := bufferManager.Pin(0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value := binary.LittleEndian.Uint64(reused.Block().Buffer()); value != 42 {
+		t.Errorf("Expect the reused block to be read again, got %d", value)
+	}
+
+	// The final unpin of the unregistered block releases its memory, and does not affect the new entry.
+	handle.Unpin()
+
+	if metrics := bufferManager.Metrics(); metrics.UsedMemory != BlockSize {
+		t.Errorf("Expect only the reused block to use memory, got %d bytes", metrics.UsedMemory)
+	}
+
+	reused.Unpin()
+	pinBlock(t, bufferManager, 1).Unpin()
+
+	if handle := pinBlockValue(t, bufferManager, 0); handle != 42 {
+		t.Errorf("Expect the reused block to stay cached, got %d", handle)
+	}
+}
+
+func pinBlockValue(t *testing.T, bufferManager *BufferManager, blockID BlockID) uint64 {
+	handle, err := bufferManager.Pin(blockID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Unpin()
+
+	return binary.LittleEndian.Uint64(handle.Block().Buffer())
+}
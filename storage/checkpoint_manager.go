@@ -0,0 +1,465 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/goduckdb/common"
+)
+
+// The PersistentTableData is the metadata of a table that is written by a checkpoint: the definition of the table and
+// the pointers to its row groups.
+type PersistentTableData struct {
+	Info      TableInfo
+	RowGroups []RowGroupPointer
+}
+
+func (data *PersistentTableData) Serialize(serializer common.Serializer) error {
+	writer := common.NewFieldWriter(serializer)
+
+	if err := writer.WriteField(1, func(s common.Serializer) error { return s.WriteObject(&data.Info) }); err != nil {
+		return err
+	}
+
+	err := writer.WriteField(2, func(s common.Serializer) error {
+		return s.WriteList(len(data.RowGroups), func(i int) error { return s.WriteObject(&data.RowGroups[i]) })
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return writer.Finalize()
+}
+
+func (data *PersistentTableData) Deserialize(deserializer common.Deserializer) error {
+	reader := common.NewFieldReader(deserializer)
+
+	if err := reader.ReadField(1, func(d common.Deserializer) error { return d.ReadObject(&data.Info) }); err != nil {
+		return err
+	}
+
+	err := reader.ReadField(2, func(d common.Deserializer) error {
+		data.RowGroups = nil
+
+		return d.ReadList(func(int) error {
+			data.RowGroups = append(data.RowGroups, RowGroupPointer{})
+			return d.ReadObject(&data.RowGroups[len(data.RowGroups)-1])
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return reader.Finalize()
+}
+
+// The checkpointManager writes the tables of the database to the BlockManager, and loads them back at startup. A
+// checkpoint writes the row groups that have rows in memory to new column segments, followed by the metadata of all
+// tables (their PersistentTableData) to a chain of meta blocks that the DatabaseHeader points to.
+type checkpointManager struct {
+	blockManager  BlockManager
+	bufferManager *BufferManager
+	block         *Block // The buffer column segments are written from, reused for every segment.
+}
+
+func newCheckpointManager(blockManager BlockManager, bufferManager *BufferManager) *checkpointManager {
+	return &checkpointManager{blockManager: blockManager, bufferManager: bufferManager}
+}
+
+// Write the tables to the BlockManager and commit them by writing a new DatabaseHeader. The blocks of the previous
+// metadata and of replaced segments are freed once the header is written. Before the header is written, a checkpoint
+// entry is written to the write-ahead log, so that its entries are not replayed again if the database crashes before
+// the log is truncated. Returns the blocks of the new metadata. Called with the locks of the tables held.
+func (manager *checkpointManager) createCheckpoint(tables []*DataTable, metadataBlocks []BlockID,
+	wal *WriteAheadLog) ([]BlockID, error) {
+	tableData := make([]PersistentTableData, len(tables))
+
+	for i, table := range tables {
+		rowGroups, err := manager.checkpointTable(table)
+
+		if err != nil {
+			return nil, err
+		}
+
+		tableData[i] = PersistentTableData{Info: *table.info, RowGroups: rowGroups}
+	}
+
+	writer := NewMetaBlockWriter(manager.blockManager)
+
+	if err := writer.WriteList(len(tableData), func(i int) error { return writer.WriteObject(&tableData[i]) }); err != nil {
+		return nil, err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	if err := wal.writeCheckpoint(writer.Blocks()[0]); err != nil {
+		return nil, err
+	}
+
+	for _, blockID := range metadataBlocks {
+		manager.blockManager.MarkBlockAsModified(blockID)
+	}
+
+	if err := manager.blockManager.WriteHeader(DatabaseHeader{MetaBlock: writer.Blocks()[0]}); err != nil {
+		return nil, err
+	}
+
+	return writer.Blocks(), nil
+}
+
+// Persist the dirty row groups of the table, and return the pointers to all its row groups. Called with the lock of the
+// table held.
+func (manager *checkpointManager) checkpointTable(table *DataTable) ([]RowGroupPointer, error) {
+	pointers := make([]RowGroupPointer, len(table.rowGroups))
+
+	for i, rowGroup := range table.rowGroups {
+		if rowGroup.dirty() {
+			if err := manager.checkpointRowGroup(rowGroup); err != nil {
+				return nil, err
+			}
+		}
+
+		pointers[i] = rowGroup.pointer()
+	}
+
+	return pointers, nil
+}
+
+// Rewrite all columns of the row group to new segments, and free the segments they replace. The values of deleted rows
+// are not kept, large VARCHAR and BLOB values are written to overflow blocks, and the metadata of the segments of every
+// column to a chain of meta blocks.
+func (manager *checkpointManager) checkpointRowGroup(rowGroup *RowGroup) error {
+	if manager.block == nil {
+		manager.block = NewBlock(InvalidBlock)
+	}
+
+	writer := &segmentWriter{blockManager: manager.blockManager, block: manager.block}
+	pointers := make([][]DataPointer, len(rowGroup.columns))
+	overflowBlocks := make([][]BlockID, len(rowGroup.columns))
+	metadataBlocks := make([][]BlockID, len(rowGroup.columns))
+	var selection []bool
+
+	if rowGroup.DeletedCount() > 0 {
+		selection = make([]bool, rowGroup.Count())
+		rowGroup.selectRows(0, rowGroup.Count(), selection)
+	}
+
+	for i, column := range rowGroup.columns {
+		vector := common.NewVector(column.Type(), int(rowGroup.Count()))
+
+		if err := column.scan(manager.bufferManager, 0, rowGroup.Count(), vector); err != nil {
+			return err
+		}
+
+		clearDeletedValues(vector, selection)
+		stored := vector
+		overflow := hasOverflowValues(vector)
+
+		if overflow {
+			overflowWriter := newOverflowWriter(manager.blockManager)
+			tagged, err := overflowWriter.writeVector(vector)
+
+			if err != nil {
+				return err
+			}
+
+			if err := overflowWriter.flush(); err != nil {
+				return err
+			}
+
+			stored = tagged
+			overflowBlocks[i] = overflowWriter.blocks
+		}
+
+		columnPointers, err := writer.writeColumn(stored)
+
+		if err != nil {
+			return err
+		}
+
+		// The statistics describe the values of the rows that have not been deleted.
+		for j := range columnPointers {
+			pointer := &columnPointers[j]
+			pointer.Statistics = selectedStatistics(vector, selection, pointer.RowStart, pointer.RowStart+pointer.TupleCount)
+			pointer.Overflow = overflow
+
+			if pointer.Validity, err = writer.writeValidity(vector, pointer.RowStart,
+				pointer.RowStart+pointer.TupleCount); err != nil {
+				return err
+			}
+		}
+
+		pointers[i] = columnPointers
+
+		if metadataBlocks[i], err = writer.flushMetadata(); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.flush(); err != nil {
+		return err
+	}
+
+	manager.freeBlocks(rowGroup.blocks())
+
+	for i, column := range rowGroup.columns {
+		column.setSegments(pointers[i], overflowBlocks[i], metadataBlocks[i])
+	}
+
+	rowGroup.deletesModified = false
+
+	return nil
+}
+
+// Replace the VARCHAR and BLOB values of the rows that are not selected by empty values, so that the values of deleted
+// rows are not written. The values of other types are kept, they do not take more space than an empty value.
+func clearDeletedValues(vector *common.Vector, selection []bool) {
+	if selection == nil {
+		return
+	}
+
+	switch values := vector.Data().(type) {
+	case []string:
+		for i, selected := range selection {
+			if !selected {
+				values[i] = ""
+			}
+		}
+	case [][]byte:
+		for i, selected := range selection {
+			if !selected {
+				values[i] = []byte{}
+			}
+		}
+	}
+}
+
+// The statistics of the selected values in the range [start, end) of the vector.
+func selectedStatistics(vector *common.Vector, selection []bool, start uint64, end uint64) *BaseStatistics {
+	values := vector.Slice(int(start), int(end))
+
+	if selection != nil {
+		values = common.NewVector(vector.Type(), int(end-start))
+		values.AppendVector(vector, int(start), int(end))
+		values.Filter(selection[start:end])
+	}
+
+	return newVectorStatistics(values)
+}
+
+// Free blocks that are used by the active header once the next header is written, and drop them from the
+// BufferManager, as their ids may be reused for blocks with different content.
+func (manager *checkpointManager) freeBlocks(blocks []BlockID) {
+	for _, blockID := range blocks {
+		manager.blockManager.MarkBlockAsModified(blockID)
+		manager.bufferManager.UnregisterBlock(blockID)
+	}
+}
+
+// Load the tables from the metadata the active DatabaseHeader points to. Returns the loaded tables and the blocks the
+// metadata is stored in.
+func (manager *checkpointManager) loadFromStorage(readOnly bool) ([]*DataTable, []BlockID, error) {
+	metaBlock := manager.blockManager.GetMetaBlock()
+
+	if metaBlock == InvalidBlock {
+		return nil, nil, nil
+	}
+
+	reader, err := NewMetaBlockReader(manager.blockManager, metaBlock)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tables []*DataTable
+
+	err = reader.ReadList(func(int) error {
+		var data PersistentTableData
+
+		if err := reader.ReadObject(&data); err != nil {
+			return err
+		}
+
+		table, err := newPersistentDataTable(&data.Info, data.RowGroups, manager.bufferManager, readOnly)
+
+		if err != nil {
+			return err
+		}
+
+		tables = append(tables, table)
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tables, reader.Blocks(), nil
+}
+
+// The segmentWriter writes the column segments of a row group. Segments are packed into blocks: a segment is written
+// to the current block if it fits in the remaining space, otherwise a new block is started.
+type segmentWriter struct {
+	blockManager BlockManager
+	block        *Block
+	offset       uint64 // The offset of the free space in the current block.
+	active       bool   // Whether segments are being written to the block.
+	// The chain of meta blocks the metadata of the segments of the column is written to, nil if no segment of the
+	// column has metadata.
+	metadata *MetaBlockWriter
+}
+
+// The alignment of segments in a block.
+const segmentAlignment = 8
+
+// Compress the values of the vector into new column segments, and return the pointers to them. Every segment holds
+// as many rows as fit in a block with the compression that is chosen for them.
+func (writer *segmentWriter) writeColumn(vector *common.Vector) ([]DataPointer, error) {
+	var pointers []DataPointer
+	values := newSegmentValues(vector)
+
+	for start := 0; start < values.count(); {
+		count := values.count() - start
+		segmentValues := values.slice(start, start+count)
+		compression, function, size := chooseCompression(segmentValues)
+
+		// Shrink the segment until it fits in a block, estimating the number of rows that fit from the size.
+		for size > SegmentSize {
+			if count == 1 {
+				return nil, fmt.Errorf("%s value of %d bytes exceeds the maximum size of a column segment",
+					vector.Type(), size)
+			}
+
+			next := int(uint64(count) * SegmentSize / size)
+
+			if next >= count {
+				next = count - 1
+			} else if next < 1 {
+				next = 1
+			}
+
+			count = next
+			segmentValues = values.slice(start, start+count)
+			compression, function, size = chooseCompression(segmentValues)
+		}
+
+		blockID, offset, buffer, err := writer.reserve(size)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if metadataFunction, ok := function.(metadataCompressionFunction); ok {
+			if function, err = writer.writeMetadata(metadataFunction, segmentValues, buffer); err != nil {
+				return nil, err
+			}
+
+			buffer = buffer[metadataPointerSize:]
+		}
+
+		function.compress(segmentValues, buffer)
+		pointers = append(pointers, DataPointer{
+			RowStart:    uint64(start),
+			TupleCount:  uint64(count),
+			BlockID:     blockID,
+			Offset:      uint32(offset),
+			Compression: compression,
+		})
+		start += count
+	}
+
+	return pointers, nil
+}
+
+// Write the metadata of a segment to the chain of meta blocks of the column, and the pointer to it to the start of the
+// buffer of the segment. Returns the function that compresses the segment with the metadata.
+func (writer *segmentWriter) writeMetadata(function metadataCompressionFunction, values *segmentValues,
+	buffer []byte) (compressionFunction, error) {
+	if writer.metadata == nil {
+		writer.metadata = NewMetaBlockWriter(writer.blockManager)
+	}
+
+	binary.LittleEndian.PutUint32(buffer, uint32(len(writer.metadata.Blocks())-1))
+	binary.LittleEndian.PutUint32(buffer[4:], uint32(writer.metadata.offset))
+
+	return function.writeMetadata(values, writer.metadata)
+}
+
+// Write the current block of the chain of meta blocks of the column, and return the chain, nil if no segment of the
+// column has metadata. The next column starts a new chain.
+func (writer *segmentWriter) flushMetadata() ([]BlockID, error) {
+	if writer.metadata == nil {
+		return nil, nil
+	}
+
+	metadata := writer.metadata
+	writer.metadata = nil
+
+	return metadata.Blocks(), metadata.Flush()
+}
+
+// Write the validity of the rows in the range [start, end) of the vector to a BOOLEAN segment, and return the pointer
+// to it, or nil if none of the rows is NULL.
+func (writer *segmentWriter) writeValidity(vector *common.Vector, start uint64, end uint64) (*DataPointer, error) {
+	validity := vector.Validity()
+	values := make([]bool, end-start)
+	allValid := true
+
+	for i := range values {
+		values[i] = validity.IsValid(int(start) + i)
+		allValid = allValid && values[i]
+	}
+
+	if allValid {
+		return nil, nil
+	}
+
+	// A segment holds at most a row group, of which a BOOLEAN segment always fits in a block.
+	pointers, err := writer.writeColumn(common.NewVectorFromSlice(common.Boolean, values))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &pointers[0], nil
+}
+
+// Reserve space for a segment of the given size, starting a new block if it does not fit in the current one. Returns
+// the block and offset of the segment, and the buffer to write it to.
+func (writer *segmentWriter) reserve(size uint64) (BlockID, uint64, []byte, error) {
+	offset := (writer.offset + segmentAlignment - 1) / segmentAlignment * segmentAlignment
+
+	if writer.active && offset+size > SegmentSize {
+		if err := writer.flush(); err != nil {
+			return InvalidBlock, 0, nil, err
+		}
+	}
+
+	if !writer.active {
+		writer.block.ID = writer.blockManager.GetFreeBlockID()
+		writer.block.Clear()
+		writer.active = true
+		offset = 0
+	}
+
+	writer.offset = offset + size
+
+	return writer.block.ID, offset, writer.block.Buffer()[offset : offset+size], nil
+}
+
+// Write the current block, if segments have been written to it.
+func (writer *segmentWriter) flush() error {
+	if !writer.active {
+		return nil
+	}
+
+	writer.active = false
+	writer.offset = 0
+
+	return writer.blockManager.Write(writer.block)
+}
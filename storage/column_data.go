@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/goduckdb/common"
+)
+
+// ColumnData holds the rows of a single column of a row group: the persisted column segments, followed by the rows
+// that were appended since the last checkpoint, which are kept in memory until the next checkpoint. Updates of persisted
+// rows are kept in memory as well, and are applied to the rows when they are scanned.
+type ColumnData struct {
+	typ             common.TypeID
+	segments        []*ColumnSegment // The persisted segments, in order of their rows.
+	persistentCount uint64           // The number of rows in the persisted segments.
+	transient       *common.Vector   // The rows that were appended after the persisted segments.
+	statistics      *BaseStatistics  // The statistics of all rows, nil if they are not known.
+	overflowBlocks  []BlockID        // The chain of overflow blocks of the persisted segments.
+	metadataBlocks  []BlockID        // The chain of meta blocks that holds the metadata of the persisted segments.
+	// The values of the persisted rows that have been updated since the last checkpoint, nil for NULL.
+	updates map[uint64]interface{}
+}
+
+func newColumnData(typ common.TypeID) *ColumnData {
+	return &ColumnData{typ: typ, transient: common.NewVector(typ, 0), statistics: NewBaseStatistics(typ)}
+}
+
+// Create the ColumnData of a persisted column from the pointers to its segments, its chains of overflow blocks and meta
+// blocks, and the statistics of the column, which are computed from the statistics of the segments if they are nil.
+func newPersistentColumnData(typ common.TypeID, pointers []DataPointer, overflowBlocks []BlockID,
+	metadataBlocks []BlockID, statistics *BaseStatistics) *ColumnData {
+	column := newColumnData(typ)
+	column.setSegments(pointers, overflowBlocks, metadataBlocks)
+
+	if statistics != nil {
+		column.statistics = statistics
+	}
+
+	return column
+}
+
+func (column *ColumnData) Type() common.TypeID {
+	return column.typ
+}
+
+// The number of rows in the column.
+func (column *ColumnData) Count() uint64 {
+	return column.persistentCount + uint64(column.transient.Len())
+}
+
+// The persisted segments of the column, in order of their rows.
+func (column *ColumnData) Segments() []*ColumnSegment {
+	return column.segments
+}
+
+// The statistics of the rows of the column, or nil if they are not known. The statistics must not be modified.
+func (column *ColumnData) Statistics() *BaseStatistics {
+	return column.statistics
+}
+
+// Whether rows have been appended or updated since the column was last persisted.
+func (column *ColumnData) dirty() bool {
+	return column.transient.Len() > 0 || len(column.updates) > 0
+}
+
+// Append the values in the range [start, end) of the vector.
+func (column *ColumnData) append(vector *common.Vector, start int, end int) {
+	column.transient.AppendVector(vector, start, end)
+
+	if column.statistics != nil {
+		column.statistics.Update(vector.Slice(start, end))
+	}
+}
+
+// Replace the value of a row, value must be of the Go type of the column, or nil for NULL. The statistics of the column
+// are not known until the next checkpoint, as the replaced value may have been its minimum or maximum.
+func (column *ColumnData) update(row uint64, value interface{}) {
+	if row >= column.persistentCount {
+		column.transient.Set(int(row-column.persistentCount), value)
+	} else {
+		if column.updates == nil {
+			column.updates = make(map[uint64]interface{})
+		}
+
+		column.updates[row] = value
+	}
+
+	column.statistics = nil
+}
+
+// Append the rows in the range [start, end) of the column to the vector.
+func (column *ColumnData) scan(bufferManager *BufferManager, start uint64, end uint64, out *common.Vector) error {
+	offset := out.Len()
+	transientStart, err := column.forEachSegment(start, end, func(segment *ColumnSegment, segmentStart uint64,
+		segmentEnd uint64) error {
+		return segment.Scan(bufferManager, segmentStart, segmentEnd, out)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if transientStart < end {
+		out.AppendVector(column.transient, int(transientStart-column.persistentCount), int(end-column.persistentCount))
+	}
+
+	if len(column.updates) > 0 {
+		for row := start; row < end && row < column.persistentCount; row++ {
+			if value, ok := column.updates[row]; ok {
+				out.Set(offset+int(row-start), value)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Evaluate the filter for the rows in the range [start, end) of the column, clearing the selection (which has an entry
+// for every row of the range) of the rows that do not match.
+func (column *ColumnData) filter(bufferManager *BufferManager, start uint64, end uint64, filter *TableFilter,
+	selection []bool) error {
+	// The segments and their statistics do not reflect the updated rows, so the rows are scanned instead.
+	if len(column.updates) > 0 {
+		vector := common.NewVector(column.typ, int(end-start))
+
+		if err := column.scan(bufferManager, start, end, vector); err != nil {
+			return err
+		}
+
+		filter.evaluate(vector, selection)
+
+		return nil
+	}
+
+	transientStart, err := column.forEachSegment(start, end, func(segment *ColumnSegment, segmentStart uint64,
+		segmentEnd uint64) error {
+		offset := segment.Start() + segmentStart - start
+
+		// Skip the segment if its statistics prove that none of its values match.
+		if stats := segment.Statistics(); stats != nil && !stats.MayMatch(filter) {
+			for i := offset; i < offset+segmentEnd-segmentStart; i++ {
+				selection[i] = false
+			}
+
+			return nil
+		}
+
+		return segment.Filter(bufferManager, segmentStart, segmentEnd, filter, selection[offset:])
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if transientStart < end {
+		transient := column.transient.Slice(int(transientStart-column.persistentCount), int(end-column.persistentCount))
+		filter.evaluate(transient, selection[transientStart-start:])
+	}
+
+	return nil
+}
+
+// Call fn for every persisted segment that holds rows in the range [start, end) of the column, with the range of those
+// rows relative to the start of the segment. Returns the first row of the range that is not persisted.
+func (column *ColumnData) forEachSegment(start uint64, end uint64,
+	fn func(segment *ColumnSegment, segmentStart uint64, segmentEnd uint64) error) (uint64, error) {
+	// Find the first segment that ends after start.
+	index := sort.Search(len(column.segments), func(i int) bool {
+		segment := column.segments[i]
+		return segment.Start()+segment.Count() > start
+	})
+
+	for ; index < len(column.segments) && start < end; index++ {
+		segment := column.segments[index]
+		segmentEnd := segment.Start() + segment.Count()
+		scanEnd := end
+
+		if scanEnd > segmentEnd {
+			scanEnd = segmentEnd
+		}
+
+		if err := fn(segment, start-segment.Start(), scanEnd-segment.Start()); err != nil {
+			return 0, err
+		}
+
+		start = scanEnd
+	}
+
+	return start, nil
+}
+
+// Replace the segments of the column with the persisted segments the pointers point to and their chains of overflow
+// blocks and meta blocks, and clear the transient rows and the updates. The statistics of the column are merged from
+// the statistics of the segments.
+func (column *ColumnData) setSegments(pointers []DataPointer, overflowBlocks []BlockID, metadataBlocks []BlockID) {
+	column.segments = make([]*ColumnSegment, len(pointers))
+	column.persistentCount = 0
+	column.statistics = NewBaseStatistics(column.typ)
+	column.overflowBlocks = overflowBlocks
+	column.metadataBlocks = metadataBlocks
+
+	for i, pointer := range pointers {
+		column.segments[i] = newColumnSegment(column.typ, pointer, overflowBlocks, metadataBlocks)
+		column.persistentCount += pointer.TupleCount
+
+		if column.statistics != nil && pointer.Statistics != nil {
+			column.statistics.Merge(pointer.Statistics)
+		} else {
+			column.statistics = nil
+		}
+	}
+
+	column.transient = common.NewVector(column.typ, 0)
+	column.updates = nil
+}
+
+// The pointers to the persisted segments of the column.
+func (column *ColumnData) dataPointers() []DataPointer {
+	pointers := make([]DataPointer, len(column.segments))
+
+	for i, segment := range column.segments {
+		pointers[i] = segment.DataPointer()
+	}
+
+	return pointers
+}
+
+// The chain of overflow blocks of the persisted segments of the column.
+func (column *ColumnData) OverflowBlocks() []BlockID {
+	return column.overflowBlocks
+}
+
+// The chain of meta blocks that holds the metadata of the persisted segments of the column.
+func (column *ColumnData) MetadataBlocks() []BlockID {
+	return column.metadataBlocks
+}
+
+// The blocks the persisted segments of the column and their validity segments are stored in, in order of their first
+// segment, followed by the overflow blocks and the meta blocks.
+func (column *ColumnData) blocks() []BlockID {
+	var blocks []BlockID
+	seen := make(map[BlockID]bool)
+
+	for _, segment := range column.segments {
+		for _, blockID := range segment.blocks() {
+			if !seen[blockID] {
+				seen[blockID] = true
+				blocks = append(blocks, blockID)
+			}
+		}
+	}
+
+	blocks = append(blocks, column.overflowBlocks...)
+
+	return append(blocks, column.metadataBlocks...)
+}
+
+// Replace the blocks of the segments that have been moved to a different block.
+func (column *ColumnData) relocateBlocks(relocated map[BlockID]BlockID) {
+	for _, segment := range column.segments {
+		if blockID, ok := relocated[segment.pointer.BlockID]; ok {
+			segment.pointer.BlockID = blockID
+		}
+
+		if validity := segment.pointer.Validity; validity != nil {
+			if blockID, ok := relocated[validity.BlockID]; ok {
+				validity.BlockID = blockID
+			}
+		}
+	}
+
+	// The segments share the chains, so they are updated in place.
+	for _, chain := range [][]BlockID{column.overflowBlocks, column.metadataBlocks} {
+		for i, blockID := range chain {
+			if relocatedID, ok := relocated[blockID]; ok {
+				chain[i] = relocatedID
+			}
+		}
+	}
+}
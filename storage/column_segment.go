@@ -0,0 +1,419 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/goduckdb/common"
+)
+
+// The number of bytes of a block that can hold the data of column segments.
+const SegmentSize = BlockSize - common.FileBufferHeaderSize
+
+// A ColumnSegment is a range of rows of a column that is persisted in a block, encoded with the compression that was
+// chosen when the segment was written. The segments of a row group are packed into shared blocks; a block is only read
+// when one of its segments is scanned, through the BufferManager.
+//
+// Uncompressed fixed-size values are stored back to back in little endian. Uncompressed VARCHAR and BLOB values are
+// stored as TupleCount+1 uint32 offsets (relative to the end of the offsets), followed by the concatenated values.
+//
+// If some values of the column are stored in overflow blocks, the values of the segment are tagged and compressed as
+// such; the overflow values are read from the chain of overflow blocks of the column when their rows are scanned.
+//
+// The metadata of a segment whose compression stores it in the chain of meta blocks of the column is read when the
+// segment is first scanned, and kept with the segment.
+//
+// NULL values are stored as the zero value of the type. If any row of the segment is NULL, the validity of its rows is
+// stored in a separate BOOLEAN segment, which is compressed like any other segment.
+type ColumnSegment struct {
+	typ            common.TypeID
+	pointer        DataPointer
+	overflowBlocks []BlockID // The chain of overflow blocks of the column, shared with the ColumnData.
+	metadataBlocks []BlockID // The chain of meta blocks of the column, shared with the ColumnData.
+	functionLock   sync.Mutex
+	function       compressionFunction // The compression function with the metadata of the segment, once it is read.
+}
+
+func newColumnSegment(typ common.TypeID, pointer DataPointer, overflowBlocks []BlockID,
+	metadataBlocks []BlockID) *ColumnSegment {
+	return &ColumnSegment{typ: typ, pointer: pointer, overflowBlocks: overflowBlocks, metadataBlocks: metadataBlocks}
+}
+
+// The first row of the segment, relative to the start of the row group.
+func (segment *ColumnSegment) Start() uint64 {
+	return segment.pointer.RowStart
+}
+
+// The number of rows in the segment.
+func (segment *ColumnSegment) Count() uint64 {
+	return segment.pointer.TupleCount
+}
+
+func (segment *ColumnSegment) BlockID() BlockID {
+	return segment.pointer.BlockID
+}
+
+func (segment *ColumnSegment) DataPointer() DataPointer {
+	return segment.pointer
+}
+
+func (segment *ColumnSegment) Compression() CompressionType {
+	return segment.pointer.Compression
+}
+
+// The blocks the segment and its validity segment are stored in.
+func (segment *ColumnSegment) blocks() []BlockID {
+	if segment.pointer.Validity == nil || segment.pointer.Validity.BlockID == segment.pointer.BlockID {
+		return []BlockID{segment.pointer.BlockID}
+	}
+
+	return []BlockID{segment.pointer.BlockID, segment.pointer.Validity.BlockID}
+}
+
+// The statistics of the values of the segment, or nil if they are not known.
+func (segment *ColumnSegment) Statistics() *BaseStatistics {
+	return segment.pointer.Statistics
+}
+
+// Append the rows in the range [start, end) of the segment (relative to the start of the segment) to the vector.
+func (segment *ColumnSegment) Scan(bufferManager *BufferManager, start uint64, end uint64, out *common.Vector) error {
+	offset := out.Len()
+
+	if !segment.pointer.Overflow {
+		err := segment.pin(bufferManager, func(function compressionFunction, data []byte) error {
+			return function.scan(data, segment.pointer.TupleCount, start, end, out)
+		})
+
+		if err != nil {
+			return err
+		}
+	} else {
+		tagged := common.NewVector(segment.typ, int(end-start))
+		err := segment.pin(bufferManager, func(function compressionFunction, data []byte) error {
+			return function.scan(data, segment.pointer.TupleCount, start, end, tagged)
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if err := resolveOverflowValues(bufferManager, segment.overflowBlocks, tagged, out); err != nil {
+			return err
+		}
+	}
+
+	return segment.scanValidity(bufferManager, start, end, out, offset)
+}
+
+// Mark the NULL rows in the range [start, end) of the segment as NULL in the vector, in which the rows start at the
+// given offset.
+func (segment *ColumnSegment) scanValidity(bufferManager *BufferManager, start uint64, end uint64, out *common.Vector,
+	offset int) error {
+	if segment.pointer.Validity == nil {
+		return nil
+	}
+
+	if segment.pointer.Validity.TupleCount != segment.pointer.TupleCount {
+		return common.NewSerializationError(fmt.Sprintf("validity segment of %d rows for a segment of %d rows",
+			segment.pointer.Validity.TupleCount, segment.pointer.TupleCount))
+	}
+
+	validity := common.NewVector(common.Boolean, int(end-start))
+
+	if err := newColumnSegment(common.Boolean, *segment.pointer.Validity, nil, nil).Scan(bufferManager, start, end,
+		validity); err != nil {
+		return err
+	}
+
+	for i, valid := range validity.Data().([]bool) {
+		if !valid {
+			out.Validity().Set(offset+i, false)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate the filter for the rows in the range [start, end) of the segment (relative to the start of the segment),
+// clearing the selection of the rows that do not match. Filters are evaluated on the compressed data if the compression
+// supports it, otherwise the rows are decompressed first.
+func (segment *ColumnSegment) Filter(bufferManager *BufferManager, start uint64, end uint64, filter *TableFilter,
+	selection []bool) error {
+	// The compressed values of a segment with overflow values are tagged, so they cannot be compared to the constant,
+	// and the compressed values of NULL rows would be compared as if they were the zero value.
+	if !segment.pointer.Overflow && segment.pointer.Validity == nil {
+		evaluated := false
+		err := segment.pin(bufferManager, func(function compressionFunction, data []byte) (err error) {
+			if filterFunction, ok := function.(compressedFilterFunction); ok {
+				evaluated, err = filterFunction.filter(data, segment.pointer.TupleCount, start, end, filter, selection)
+			}
+
+			return err
+		})
+
+		if err != nil || evaluated {
+			return err
+		}
+	}
+
+	vector := common.NewVector(segment.typ, int(end-start))
+
+	if err := segment.Scan(bufferManager, start, end, vector); err != nil {
+		return err
+	}
+
+	filter.evaluate(vector, selection)
+
+	return nil
+}
+
+// Pin the block of the segment, and call fn with the compression function and the data of the segment.
+func (segment *ColumnSegment) pin(bufferManager *BufferManager,
+	fn func(function compressionFunction, data []byte) error) error {
+	function, err := getCompressionFunction(segment.pointer.Compression)
+
+	if err != nil {
+		return err
+	}
+
+	handle, err := bufferManager.Pin(segment.pointer.BlockID)
+
+	if err != nil {
+		return err
+	}
+	defer handle.Unpin()
+
+	buffer := handle.Block().Buffer()
+
+	if uint64(segment.pointer.Offset) > uint64(len(buffer)) {
+		return common.NewSerializationError(fmt.Sprintf("segment offset %d exceeds its block", segment.pointer.Offset))
+	}
+
+	data := buffer[segment.pointer.Offset:]
+
+	if metadataFunction, ok := function.(metadataCompressionFunction); ok {
+		if function, err = segment.readMetadata(bufferManager.blockManager, metadataFunction, data); err != nil {
+			return err
+		}
+
+		data = data[metadataPointerSize:]
+	}
+
+	return fn(function, data)
+}
+
+// Read the metadata of the segment from the chain of meta blocks of the column, and return the compression function
+// with the metadata. The metadata is read once, data is the data of the segment, which starts with the pointer to it.
+func (segment *ColumnSegment) readMetadata(blockManager BlockManager, function metadataCompressionFunction,
+	data []byte) (compressionFunction, error) {
+	segment.functionLock.Lock()
+	defer segment.functionLock.Unlock()
+
+	if segment.function != nil {
+		return segment.function, nil
+	}
+
+	if err := checkSegmentSize(data, metadataPointerSize, segment.pointer.Compression); err != nil {
+		return nil, err
+	}
+
+	index := uint64(binary.LittleEndian.Uint32(data))
+	offset := uint64(binary.LittleEndian.Uint32(data[4:]))
+
+	if index >= uint64(len(segment.metadataBlocks)) {
+		return nil, common.NewSerializationError(fmt.Sprintf("segment metadata exceeds its chain of %d meta blocks",
+			len(segment.metadataBlocks)))
+	}
+
+	reader, err := newMetaBlockReaderForBlocks(blockManager, segment.metadataBlocks[index:], offset)
+
+	if err != nil {
+		return nil, err
+	}
+
+	withMetadata, err := function.readMetadata(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	segment.function = withMetadata
+
+	return withMetadata, nil
+}
+
+// Encode the values of the vector into the buffer, which must be large enough to hold them. Returns the number of bytes
+// that were written.
+func encodeSegment(vector *common.Vector, buffer []byte) uint64 {
+	switch values := vector.Data().(type) {
+	case []bool:
+		for i, v := range values {
+			buffer[i] = 0
+
+			if v {
+				buffer[i] = 1
+			}
+		}
+
+		return uint64(len(values))
+	case []int8:
+		for i, v := range values {
+			buffer[i] = byte(v)
+		}
+
+		return uint64(len(values))
+	case []int16:
+		for i, v := range values {
+			binary.LittleEndian.PutUint16(buffer[2*i:], uint16(v))
+		}
+
+		return uint64(2 * len(values))
+	case []int32:
+		for i, v := range values {
+			binary.LittleEndian.PutUint32(buffer[4*i:], uint32(v))
+		}
+
+		return uint64(4 * len(values))
+	case []int64:
+		for i, v := range values {
+			binary.LittleEndian.PutUint64(buffer[8*i:], uint64(v))
+		}
+
+		return uint64(8 * len(values))
+	case []float32:
+		for i, v := range values {
+			binary.LittleEndian.PutUint32(buffer[4*i:], math.Float32bits(v))
+		}
+
+		return uint64(4 * len(values))
+	case []float64:
+		for i, v := range values {
+			binary.LittleEndian.PutUint64(buffer[8*i:], math.Float64bits(v))
+		}
+
+		return uint64(8 * len(values))
+	case []string:
+		return encodeVariableSize(len(values), buffer, func(i int, heap []byte) int { return copy(heap, values[i]) })
+	case [][]byte:
+		return encodeVariableSize(len(values), buffer, func(i int, heap []byte) int { return copy(heap, values[i]) })
+	default:
+		panic(fmt.Sprintf("Cannot encode %T", values))
+	}
+}
+
+func encodeVariableSize(count int, buffer []byte, copyValue func(index int, heap []byte) int) uint64 {
+	heap := buffer[4*(count+1):]
+	offset := 0
+
+	for i := 0; i < count; i++ {
+		binary.LittleEndian.PutUint32(buffer[4*i:], uint32(offset))
+		offset += copyValue(i, heap[offset:])
+	}
+
+	binary.LittleEndian.PutUint32(buffer[4*count:], uint32(offset))
+
+	return uint64(4*(count+1) + offset)
+}
+
+// Decode the rows in the range [start, end) of a segment of count rows, appending them to the vector.
+func decodeSegment(typ common.TypeID, data []byte, count uint64, start uint64, end uint64, out *common.Vector) error {
+	if start > end || end > count {
+		return fmt.Errorf("cannot scan rows [%d, %d) of a segment of %d rows", start, end, count)
+	}
+
+	if size := typ.Size(); size > 0 && count*size > uint64(len(data)) {
+		return common.NewSerializationError(fmt.Sprintf("segment of %d %s values exceeds its block", count, typ))
+	}
+
+	switch values := out.Data().(type) {
+	case []bool:
+		for i := start; i < end; i++ {
+			values = append(values, data[i] != 0)
+		}
+
+		out.SetData(values)
+	case []int8:
+		for i := start; i < end; i++ {
+			values = append(values, int8(data[i]))
+		}
+
+		out.SetData(values)
+	case []int16:
+		for i := start; i < end; i++ {
+			values = append(values, int16(binary.LittleEndian.Uint16(data[2*i:])))
+		}
+
+		out.SetData(values)
+	case []int32:
+		for i := start; i < end; i++ {
+			values = append(values, int32(binary.LittleEndian.Uint32(data[4*i:])))
+		}
+
+		out.SetData(values)
+	case []int64:
+		for i := start; i < end; i++ {
+			values = append(values, int64(binary.LittleEndian.Uint64(data[8*i:])))
+		}
+
+		out.SetData(values)
+	case []float32:
+		for i := start; i < end; i++ {
+			values = append(values, math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:])))
+		}
+
+		out.SetData(values)
+	case []float64:
+		for i := start; i < end; i++ {
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(data[8*i:])))
+		}
+
+		out.SetData(values)
+	case []string:
+		err := decodeVariableSize(data, count, start, end, func(value []byte) { values = append(values, string(value)) })
+		out.SetData(values)
+
+		return err
+	case [][]byte:
+		err := decodeVariableSize(data, count, start, end, func(value []byte) {
+			values = append(values, append([]byte(nil), value...))
+		})
+		out.SetData(values)
+
+		return err
+	default:
+		panic(fmt.Sprintf("Cannot decode into %T", values))
+	}
+
+	return nil
+}
+
+func decodeVariableSize(data []byte, count uint64, start uint64, end uint64, appendValue func(value []byte)) error {
+	if 4*(count+1) > uint64(len(data)) {
+		return common.NewSerializationError(fmt.Sprintf("offsets of a segment of %d values exceed its block", count))
+	}
+
+	heap := data[4*(count+1):]
+
+	for i := start; i < end; i++ {
+		valueStart := binary.LittleEndian.Uint32(data[4*i:])
+		valueEnd := binary.LittleEndian.Uint32(data[4*(i+1):])
+
+		if valueStart > valueEnd || uint64(valueEnd) > uint64(len(heap)) {
+			return common.NewSerializationError(fmt.Sprintf("invalid offsets [%d, %d) of value %d", valueStart, valueEnd, i))
+		}
+
+		appendValue(heap[valueStart:valueEnd])
+	}
+
+	return nil
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
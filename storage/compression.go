@@ -0,0 +1,415 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/goduckdb/common"
+)
+
+// The CompressionType is the encoding of a column segment. Compression types are persisted in the DataPointers, so the
+// values of existing compression types must never change.
+type CompressionType uint8
+
+const (
+	CompressionUncompressed CompressionType = iota // The values are stored as they are.
+	CompressionConstant                            // All values are equal, the value is stored once.
+	CompressionRLE                                 // Runs of equal values are stored as the value and the run length.
+	CompressionBitPacking                          // Non-negative integers are stored with the bits of the largest value.
+	CompressionFOR                                 // Integers are stored as bit-packed offsets from their minimum.
+	CompressionDictionary                          // Strings are stored once, and referenced by bit-packed indexes.
+	CompressionChimp                               // Floating-point values are stored as the XOR with the previous value.
+	CompressionALP                                 // Floating-point values are stored as integers scaled by powers of 10.
+	CompressionFSST                                // Strings are stored as codes that refer to a table of common substrings.
+)
+
+var compressionNames = [...]string{
+	CompressionUncompressed: "Uncompressed",
+	CompressionConstant:     "Constant",
+	CompressionRLE:          "RLE",
+	CompressionBitPacking:   "BitPacking",
+	CompressionFOR:          "FOR",
+	CompressionDictionary:   "Dictionary",
+	CompressionChimp:        "Chimp",
+	CompressionALP:          "ALP",
+	CompressionFSST:         "FSST",
+}
+
+func (compression CompressionType) String() string {
+	if int(compression) < len(compressionNames) {
+		return compressionNames[compression]
+	}
+
+	return fmt.Sprintf("CompressionType(%d)", uint8(compression))
+}
+
+// A compressionFunction implements the encoding of a CompressionType. At checkpoint, every compression function
+// analyzes the values of a segment, and the values are compressed with the function that produces the smallest
+// segment. Scans decompress the rows they need directly into vectors.
+type compressionFunction interface {
+	// Returns the size the values compress to, or false if the function cannot compress the values.
+	analyze(values *segmentValues) (uint64, bool)
+	// Compress the values into the buffer, which holds at least the number of bytes returned by analyze.
+	compress(values *segmentValues, buffer []byte)
+	// Decompress the rows in the range [start, end) of a segment of count rows, appending them to the vector.
+	scan(data []byte, count uint64, start uint64, end uint64, out *common.Vector) error
+}
+
+// A compressedFilterFunction is a compressionFunction that can evaluate some filters on the compressed data, without
+// decompressing the values.
+type compressedFilterFunction interface {
+	// Evaluate the filter for the rows in the range [start, end) of a segment of count rows, clearing the selection of
+	// the rows that do not match. Returns false if the filter cannot be evaluated on the compressed data.
+	filter(data []byte, count uint64, start uint64, end uint64, filter *TableFilter, selection []bool) (bool, error)
+}
+
+// A metadataCompressionFunction is a compressionFunction that stores part of its segments, such as a symbol table, in
+// the chain of meta blocks of their column rather than in the segments. A segment starts with a pointer to its metadata:
+// the uint32 index of the block of the chain the metadata starts in and the uint32 offset in that block. It is followed
+// by the data the function compresses the values to, of the size returned by analyze.
+type metadataCompressionFunction interface {
+	// Write the metadata of the values to the writer, and return the function that compresses the values with it.
+	writeMetadata(values *segmentValues, writer *MetaBlockWriter) (compressionFunction, error)
+	// Read the metadata of a segment from the reader, and return the function that scans the segment with it.
+	readMetadata(reader *MetaBlockReader) (compressionFunction, error)
+}
+
+const metadataPointerSize = 8
+
+// The compression functions, in order of preference when several of them compress the values to the same size.
+var compressionFunctions = []struct {
+	compression CompressionType
+	function    compressionFunction
+}{
+	{CompressionUncompressed, uncompressedFunction{}},
+	{CompressionConstant, constantFunction{}},
+	{CompressionRLE, rleFunction{}},
+	{CompressionBitPacking, bitPackingFunction{}},
+	{CompressionFOR, forFunction{}},
+	{CompressionDictionary, dictionaryFunction{}},
+	{CompressionChimp, chimpFunction{}},
+	{CompressionALP, alpFunction{}},
+	{CompressionFSST, fsstFunction{}},
+}
+
+func getCompressionFunction(compression CompressionType) (compressionFunction, error) {
+	for _, entry := range compressionFunctions {
+		if entry.compression == compression {
+			return entry.function, nil
+		}
+	}
+
+	return nil, common.NewSerializationError(fmt.Sprintf("unknown compression type %d", compression))
+}
+
+// Analyze the values with every compression function, and return the compression that results in the smallest segment
+// together with its size, which includes the pointer to the metadata of the segment.
+func chooseCompression(values *segmentValues) (CompressionType, compressionFunction, uint64) {
+	var best compressionFunction
+	bestCompression := CompressionUncompressed
+	bestSize := uint64(math.MaxUint64)
+
+	for _, entry := range compressionFunctions {
+		size, ok := entry.function.analyze(values)
+
+		if _, metadata := entry.function.(metadataCompressionFunction); metadata {
+			size += metadataPointerSize
+		}
+
+		if ok && size < bestSize {
+			best, bestCompression, bestSize = entry.function, entry.compression, size
+		}
+	}
+
+	return bestCompression, best, bestSize
+}
+
+// The segmentValues are the values of a column that are being compressed, in the representation the compression
+// functions analyze: fixed-size values as their bit patterns (sign-extended for integers), variable-size values as
+// strings.
+type segmentValues struct {
+	vector  *common.Vector
+	bits    []uint64 // The values of a fixed-size type.
+	strings []string // The values of a variable-size type.
+}
+
+func newSegmentValues(vector *common.Vector) *segmentValues {
+	values := &segmentValues{vector: vector}
+
+	switch data := vector.Data().(type) {
+	case []bool:
+		values.bits = make([]uint64, len(data))
+
+		for i, v := range data {
+			if v {
+				values.bits[i] = 1
+			}
+		}
+	case []int8:
+		values.bits = integerBits(data)
+	case []int16:
+		values.bits = integerBits(data)
+	case []int32:
+		values.bits = integerBits(data)
+	case []int64:
+		values.bits = integerBits(data)
+	case []float32:
+		values.bits = make([]uint64, len(data))
+
+		for i, v := range data {
+			values.bits[i] = uint64(math.Float32bits(v))
+		}
+	case []float64:
+		values.bits = make([]uint64, len(data))
+
+		for i, v := range data {
+			values.bits[i] = math.Float64bits(v)
+		}
+	case []string:
+		values.strings = data
+	case [][]byte:
+		values.strings = make([]string, len(data))
+
+		for i, v := range data {
+			values.strings[i] = string(v)
+		}
+	}
+
+	return values
+}
+
+func integerBits[T int8 | int16 | int32 | int64](data []T) []uint64 {
+	result := make([]uint64, len(data))
+
+	for i, v := range data {
+		result[i] = uint64(int64(v))
+	}
+
+	return result
+}
+
+func (values *segmentValues) typ() common.TypeID {
+	return values.vector.Type()
+}
+
+func (values *segmentValues) count() int {
+	return values.vector.Len()
+}
+
+// The values in the range [start, end).
+func (values *segmentValues) slice(start int, end int) *segmentValues {
+	result := &segmentValues{vector: values.vector.Slice(start, end)}
+
+	if values.bits != nil {
+		result.bits = values.bits[start:end]
+	}
+
+	if values.strings != nil {
+		result.strings = values.strings[start:end]
+	}
+
+	return result
+}
+
+// Whether the values are integers that can be bit-packed: booleans and the integer types.
+func isIntegerType(typ common.TypeID) bool {
+	switch typ {
+	case common.Boolean, common.TinyInt, common.SmallInt, common.Integer, common.BigInt, common.Timestamp:
+		return true
+	default:
+		return false
+	}
+}
+
+// Append count fixed-size values to the vector, value returns the bit pattern of the value at an index.
+func appendFixedBits(out *common.Vector, count int, value func(index int) uint64) {
+	switch data := out.Data().(type) {
+	case []bool:
+		for i := 0; i < count; i++ {
+			data = append(data, value(i) != 0)
+		}
+
+		out.SetData(data)
+	case []int8:
+		for i := 0; i < count; i++ {
+			data = append(data, int8(value(i)))
+		}
+
+		out.SetData(data)
+	case []int16:
+		for i := 0; i < count; i++ {
+			data = append(data, int16(value(i)))
+		}
+
+		out.SetData(data)
+	case []int32:
+		for i := 0; i < count; i++ {
+			data = append(data, int32(value(i)))
+		}
+
+		out.SetData(data)
+	case []int64:
+		for i := 0; i < count; i++ {
+			data = append(data, int64(value(i)))
+		}
+
+		out.SetData(data)
+	case []float32:
+		for i := 0; i < count; i++ {
+			data = append(data, math.Float32frombits(uint32(value(i))))
+		}
+
+		out.SetData(data)
+	case []float64:
+		for i := 0; i < count; i++ {
+			data = append(data, math.Float64frombits(value(i)))
+		}
+
+		out.SetData(data)
+	default:
+		panic(fmt.Sprintf("Cannot append fixed-size values to %T", data))
+	}
+}
+
+// Append a variable-size value to the vector.
+func appendVariableSize(out *common.Vector, value []byte) {
+	switch data := out.Data().(type) {
+	case []string:
+		out.SetData(append(data, string(value)))
+	case [][]byte:
+		out.SetData(append(data, append([]byte(nil), value...)))
+	default:
+		panic(fmt.Sprintf("Cannot append variable-size values to %T", data))
+	}
+}
+
+// Store the bit pattern of a fixed-size value in typ.Size() bytes.
+func putFixedBits(buffer []byte, typ common.TypeID, value uint64) {
+	for i := uint64(0); i < typ.Size(); i++ {
+		buffer[i] = byte(value >> (8 * i))
+	}
+}
+
+// Load the bit pattern of a fixed-size value that was stored by putFixedBits, sign-extending integers.
+func getFixedBits(buffer []byte, typ common.TypeID) uint64 {
+	size := typ.Size()
+	var value uint64
+
+	for i := uint64(0); i < size; i++ {
+		value |= uint64(buffer[i]) << (8 * i)
+	}
+
+	if isIntegerType(typ) && typ != common.Boolean && size < 8 {
+		shift := 64 - 8*size
+		value = uint64(int64(value<<shift) >> shift)
+	}
+
+	return value
+}
+
+// The number of bits that are needed to store the value.
+func bitWidth(value uint64) uint8 {
+	return uint8(bits.Len64(value))
+}
+
+// The number of bytes that count bit-packed values of the given width take.
+func bitPackedSize(count int, width uint8) uint64 {
+	return (uint64(count)*uint64(width) + 7) / 8
+}
+
+// Pack the values, of at most width bits each, into the buffer.
+func packBits(buffer []byte, width uint8, count int, value func(index int) uint64) {
+	size := bitPackedSize(count, width)
+
+	for i := uint64(0); i < size; i++ {
+		buffer[i] = 0
+	}
+
+	bit := uint64(0)
+
+	for i := 0; i < count; i++ {
+		v := value(i)
+
+		for remaining := uint64(width); remaining > 0; {
+			shift := bit % 8
+			n := 8 - shift
+
+			if n > remaining {
+				n = remaining
+			}
+
+			buffer[bit/8] |= byte((v & (1<<n - 1)) << shift)
+			v >>= n
+			bit += n
+			remaining -= n
+		}
+	}
+}
+
+// Unpack the value at the given index of bit-packed values of the given width.
+func unpackBits(buffer []byte, width uint8, index uint64) uint64 {
+	return readBits(buffer, index*uint64(width), width)
+}
+
+// Read a value of the given width that starts at the given bit of the buffer.
+func readBits(buffer []byte, bit uint64, width uint8) uint64 {
+	var value uint64
+
+	for read := uint64(0); read < uint64(width); {
+		shift := bit % 8
+		n := 8 - shift
+
+		if n > uint64(width)-read {
+			n = uint64(width) - read
+		}
+
+		value |= uint64((buffer[bit/8]>>shift)&(1<<n-1)) << read
+		bit += n
+		read += n
+	}
+
+	return value
+}
+
+// Check that the data holds at least size bytes.
+func checkSegmentSize(data []byte, size uint64, compression CompressionType) error {
+	if size > uint64(len(data)) {
+		return common.NewSerializationError(fmt.Sprintf("%s segment of %d bytes exceeds its block", compression, size))
+	}
+
+	return nil
+}
+
+func checkScanRange(count uint64, start uint64, end uint64) error {
+	if start > end || end > count {
+		return fmt.Errorf("cannot scan rows [%d, %d) of a segment of %d rows", start, end, count)
+	}
+
+	return nil
+}
+
+// The uncompressedFunction stores the values as they are, it can compress any values.
+type uncompressedFunction struct{}
+
+func (uncompressedFunction) analyze(values *segmentValues) (uint64, bool) {
+	if size := values.typ().Size(); size > 0 {
+		return uint64(values.count()) * size, true
+	}
+
+	size := uint64(4 * (values.count() + 1))
+
+	for _, v := range values.strings {
+		size += uint64(len(v))
+	}
+
+	return size, true
+}
+
+func (uncompressedFunction) compress(values *segmentValues, buffer []byte) {
+	encodeSegment(values.vector, buffer)
+}
+
+func (uncompressedFunction) scan(data []byte, count uint64, start uint64, end uint64, out *common.Vector) error {
+	return decodeSegment(out.Type(), data, count, start, end, out)
+}
@@ -0,0 +1,254 @@
+package storage
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/goduckdb/common"
+)
+
+// The alpFunction compresses FLOAT and DOUBLE values with ALP (Afroozeh et al., 2023). Most real-world floating-point
+// values were decimals with few digits before they were converted to binary, e.g. sensor readings or prices. ALP finds
+// an exponent e and a factor f for which such values v can be stored as the integer n = round(v * 10^e * 10^-f), and
+// restored exactly as n * 10^f / 10^e. The division by the exact power of ten is correctly rounded, so a decimal is
+// restored to the floating-point value it was converted to. The integers are stored with frame of reference and
+// bit-packing; values that cannot be restored exactly (e.g. NaN, infinities, -0.0 or values with too many digits) are
+// stored as exceptions.
+//
+// The segment holds the uint8 exponent and factor, the int64 reference, the uint8 bit width, the uint32 number of
+// exceptions, the bit-packed integers, and finally the uint32 row and the bit pattern of every exception.
+type alpFunction struct{}
+
+const alpHeaderSize = 15
+
+// The maximum exponent for DOUBLE and FLOAT values.
+const (
+	alpMaxDoubleExponent = 18
+	alpMaxFloatExponent  = 10
+)
+
+// The number of values that are sampled to find the best exponent and factor.
+const alpSampleSize = 256
+
+var alpPowersOfTen, alpNegativePowersOfTen = func() ([alpMaxDoubleExponent + 1]float64, [alpMaxDoubleExponent + 1]float64) {
+	var powers, negativePowers [alpMaxDoubleExponent + 1]float64
+
+	for i := range powers {
+		powers[i] = math.Pow10(i)
+		negativePowers[i] = math.Pow10(-i)
+	}
+
+	return powers, negativePowers
+}()
+
+// The largest integer that is encoded, larger integers cannot be converted back to floating point exactly.
+const alpMaxInteger = 1 << 52
+
+// Encode a value with the given exponent and factor. Returns false if the value cannot be restored exactly, in which
+// case it has to be stored as an exception.
+func alpEncode(typ common.TypeID, value uint64, exponent uint8, factor uint8) (int64, bool) {
+	var scaled float64
+
+	if typ == common.Float {
+		v := math.Float32frombits(uint32(value))
+		scaled = float64(float32(float32(v*float32(alpPowersOfTen[exponent])) * float32(alpNegativePowersOfTen[factor])))
+	} else {
+		v := math.Float64frombits(value)
+		scaled = float64(v*alpPowersOfTen[exponent]) * alpNegativePowersOfTen[factor]
+	}
+
+	// This also rejects NaN and the infinities.
+	if !(scaled > -alpMaxInteger && scaled < alpMaxInteger) {
+		return 0, false
+	}
+
+	encoded := int64(math.Round(scaled))
+
+	if alpDecode(typ, encoded, exponent, factor) != value {
+		return 0, false
+	}
+
+	return encoded, true
+}
+
+// Decode a value that was encoded with the given exponent and factor, returning its bit pattern.
+func alpDecode(typ common.TypeID, encoded int64, exponent uint8, factor uint8) uint64 {
+	if typ == common.Float {
+		v := float32(float32(encoded)*float32(alpPowersOfTen[factor])) / float32(alpPowersOfTen[exponent])
+		return uint64(math.Float32bits(v))
+	}
+
+	v := float64(float64(encoded)*alpPowersOfTen[factor]) / alpPowersOfTen[exponent]
+
+	return math.Float64bits(v)
+}
+
+// The result of encoding the values with an exponent and factor.
+type alpEncoding struct {
+	exponent   uint8
+	factor     uint8
+	encoded    []int64  // The encoded values, exceptions are replaced by the reference.
+	exceptions []uint32 // The rows of the exceptions, in ascending order.
+	reference  int64    // The minimum of the encoded values.
+	width      uint8    // The bit width of the offsets from the reference.
+}
+
+func (encoding *alpEncoding) size(typ common.TypeID) uint64 {
+	return alpHeaderSize + bitPackedSize(len(encoding.encoded), encoding.width) +
+		uint64(len(encoding.exceptions))*(4+typ.Size())
+}
+
+func newALPEncoding(typ common.TypeID, values []uint64, exponent uint8, factor uint8) *alpEncoding {
+	encoding := &alpEncoding{exponent: exponent, factor: factor, encoded: make([]int64, len(values))}
+	min, max := int64(math.MaxInt64), int64(math.MinInt64)
+
+	for i, value := range values {
+		encoded, ok := alpEncode(typ, value, exponent, factor)
+
+		if !ok {
+			encoding.exceptions = append(encoding.exceptions, uint32(i))
+			continue
+		}
+
+		encoding.encoded[i] = encoded
+
+		if encoded < min {
+			min = encoded
+		}
+
+		if encoded > max {
+			max = encoded
+		}
+	}
+
+	if len(encoding.exceptions) == len(values) {
+		min, max = 0, 0
+	}
+
+	for _, row := range encoding.exceptions {
+		encoding.encoded[row] = min
+	}
+
+	encoding.reference = min
+	encoding.width = bitWidth(uint64(max) - uint64(min))
+
+	return encoding
+}
+
+// Find the exponent and factor that result in the smallest segment for a sample of the values.
+func alpChooseExponent(typ common.TypeID, values []uint64) (uint8, uint8) {
+	sample := values
+
+	if len(values) > alpSampleSize {
+		sample = make([]uint64, 0, alpSampleSize)
+
+		for i := 0; i < alpSampleSize; i++ {
+			sample = append(sample, values[i*len(values)/alpSampleSize])
+		}
+	}
+
+	maxExponent := uint8(alpMaxDoubleExponent)
+
+	if typ == common.Float {
+		maxExponent = alpMaxFloatExponent
+	}
+
+	var bestExponent, bestFactor uint8
+	bestSize := uint64(math.MaxUint64)
+
+	for exponent := uint8(0); exponent <= maxExponent; exponent++ {
+		for factor := uint8(0); factor <= exponent; factor++ {
+			if size := newALPEncoding(typ, sample, exponent, factor).size(typ); size < bestSize {
+				bestExponent, bestFactor, bestSize = exponent, factor, size
+			}
+		}
+	}
+
+	return bestExponent, bestFactor
+}
+
+func (alpFunction) encode(values *segmentValues) *alpEncoding {
+	exponent, factor := alpChooseExponent(values.typ(), values.bits)
+
+	return newALPEncoding(values.typ(), values.bits, exponent, factor)
+}
+
+func (function alpFunction) analyze(values *segmentValues) (uint64, bool) {
+	if typ := values.typ(); typ != common.Float && typ != common.Double {
+		return 0, false
+	}
+
+	return function.encode(values).size(values.typ()), true
+}
+
+func (function alpFunction) compress(values *segmentValues, buffer []byte) {
+	typ := values.typ()
+	encoding := function.encode(values)
+	buffer[0] = encoding.exponent
+	buffer[1] = encoding.factor
+	binary.LittleEndian.PutUint64(buffer[2:], uint64(encoding.reference))
+	buffer[10] = encoding.width
+	binary.LittleEndian.PutUint32(buffer[11:], uint32(len(encoding.exceptions)))
+	packBits(buffer[alpHeaderSize:], encoding.width, len(encoding.encoded), func(i int) uint64 {
+		return uint64(encoding.encoded[i]) - uint64(encoding.reference)
+	})
+
+	exceptions := buffer[alpHeaderSize+bitPackedSize(len(encoding.encoded), encoding.width):]
+	size := typ.Size()
+
+	for i, row := range encoding.exceptions {
+		binary.LittleEndian.PutUint32(exceptions[4*i:], row)
+		putFixedBits(exceptions[4*uint64(len(encoding.exceptions))+uint64(i)*size:], typ, values.bits[row])
+	}
+}
+
+func (alpFunction) scan(data []byte, count uint64, start uint64, end uint64, out *common.Vector) error {
+	if err := checkScanRange(count, start, end); err != nil {
+		return err
+	}
+
+	if err := checkSegmentSize(data, alpHeaderSize, CompressionALP); err != nil {
+		return err
+	}
+
+	typ := out.Type()
+	size := typ.Size()
+	exponent, factor := data[0], data[1]
+	reference := binary.LittleEndian.Uint64(data[2:])
+	width := data[10]
+	exceptionCount := uint64(binary.LittleEndian.Uint32(data[11:]))
+	packedSize := bitPackedSize(int(count), width)
+
+	if exponent > alpMaxDoubleExponent || factor > exponent {
+		return common.NewSerializationError("invalid ALP exponent and factor")
+	}
+
+	if err := checkSegmentSize(data, alpHeaderSize+packedSize+exceptionCount*(4+size), CompressionALP); err != nil {
+		return err
+	}
+
+	packed := data[alpHeaderSize:]
+	exceptionRows := data[alpHeaderSize+packedSize:]
+	exceptionValues := exceptionRows[4*exceptionCount:]
+	exceptionRow := func(i int) uint64 { return uint64(binary.LittleEndian.Uint32(exceptionRows[4*i:])) }
+	// The first exception in the scanned range.
+	exception := sort.Search(int(exceptionCount), func(i int) bool { return exceptionRow(i) >= start })
+
+	appendFixedBits(out, int(end-start), func(i int) uint64 {
+		row := start + uint64(i)
+
+		if exception < int(exceptionCount) && exceptionRow(exception) == row {
+			value := getFixedBits(exceptionValues[uint64(exception)*size:], typ)
+			exception++
+
+			return value
+		}
+
+		encoded := int64(reference + unpackBits(packed, width, row))
+
+		return alpDecode(typ, encoded, exponent, factor)
+	})
+
+	return nil
+}
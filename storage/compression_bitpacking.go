@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"encoding/binary"
+
+	"github.com/goduckdb/common"
+)
+
+// The bitPackingFunction stores non-negative integers with the number of bits of the largest value: a uint8 bit width,
+// followed by the bit-packed values.
+type bitPackingFunction struct{}
+
+func (bitPackingFunction) analyze(values *segmentValues) (uint64, bool) {
+	if !isIntegerType(values.typ()) {
+		return 0, false
+	}
+
+	var max uint64
+
+	for _, v := range values.bits {
+		if int64(v) < 0 {
+			return 0, false
+		}
+
+		if v > max {
+			max = v
+		}
+	}
+
+	return 1 + bitPackedSize(values.count(), bitWidth(max)), true
+}
+
+func (bitPackingFunction) compress(values *segmentValues, buffer []byte) {
+	var max uint64
+
+	for _, v := range values.bits {
+		if v > max {
+			max = v
+		}
+	}
+
+	width := bitWidth(max)
+	buffer[0] = width
+	packBits(buffer[1:], width, values.count(), func(i int) uint64 { return values.bits[i] })
+}
+
+func (bitPackingFunction) scan(data []byte, count uint64, start uint64, end uint64, out *common.Vector) error {
+	if err := checkScanRange(count, start, end); err != nil {
+		return err
+	}
+
+	if err := checkSegmentSize(data, 1, CompressionBitPacking); err != nil {
+		return err
+	}
+
+	width := data[0]
+
+	if err := checkSegmentSize(data, 1+bitPackedSize(int(count), width), CompressionBitPacking); err != nil {
+		return err
+	}
+
+	packed := data[1:]
+	appendFixedBits(out, int(end-start), func(i int) uint64 { return unpackBits(packed, width, start+uint64(i)) })
+
+	return nil
+}
+
+// The forFunction (frame of reference) stores integers as the offsets from their minimum: the int64 minimum and a
+// uint8 bit width, followed by the bit-packed offsets. This compresses values that lie close together, but far from
+// zero (e.g. timestamps or ids).
+type forFunction struct{}
+
+// The minimum and maximum of the integers.
+func integerRange(values []uint64) (int64, int64) {
+	min, max := int64(values[0]), int64(values[0])
+
+	for _, v := range values[1:] {
+		if int64(v) < min {
+			min = int64(v)
+		}
+
+		if int64(v) > max {
+			max = int64(v)
+		}
+	}
+
+	return min, max
+}
+
+func (forFunction) analyze(values *segmentValues) (uint64, bool) {
+	if !isIntegerType(values.typ()) || values.typ() == common.Boolean || values.count() == 0 {
+		return 0, false
+	}
+
+	min, max := integerRange(values.bits)
+
+	return 9 + bitPackedSize(values.count(), bitWidth(uint64(max)-uint64(min))), true
+}
+
+func (forFunction) compress(values *segmentValues, buffer []byte) {
+	min, max := integerRange(values.bits)
+	width := bitWidth(uint64(max) - uint64(min))
+	binary.LittleEndian.PutUint64(buffer, uint64(min))
+	buffer[8] = width
+	packBits(buffer[9:], width, values.count(), func(i int) uint64 { return values.bits[i] - uint64(min) })
+}
+
+func (forFunction) scan(data []byte, count uint64, start uint64, end uint64, out *common.Vector) error {
+	if err := checkScanRange(count, start, end); err != nil {
+		return err
+	}
+
+	if err := checkSegmentSize(data, 9, CompressionFOR); err != nil {
+		return err
+	}
+
+	min := binary.LittleEndian.Uint64(data)
+	width := data[8]
+
+	if err := checkSegmentSize(data, 9+bitPackedSize(int(count), width), CompressionFOR); err != nil {
+		return err
+	}
+
+	packed := data[9:]
+	appendFixedBits(out, int(end-start), func(i int) uint64 { return min + unpackBits(packed, width, start+uint64(i)) })
+
+	return nil
+}
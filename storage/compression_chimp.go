@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"fmt"
+	"math/bits"
+
+	"github.com/goduckdb/common"
+)
+
+// The bitWriter writes values of arbitrary bit widths to a byte buffer, least significant bit first. A bitWriter
+// without a buffer only counts the bits, which is used to analyze the size of an encoding.
+type bitWriter struct {
+	buffer []byte
+	bit    uint64 // The number of bits that have been written.
+}
+
+func (writer *bitWriter) write(value uint64, width uint8) {
+	if writer.buffer == nil {
+		writer.bit += uint64(width)
+		return
+	}
+
+	for remaining := uint64(width); remaining > 0; {
+		shift := writer.bit % 8
+		n := 8 - shift
+
+		if n > remaining {
+			n = remaining
+		}
+
+		if shift == 0 {
+			writer.buffer[writer.bit/8] = 0
+		}
+
+		writer.buffer[writer.bit/8] |= byte((value & (1<<n - 1)) << shift)
+		value >>= n
+		writer.bit += n
+		remaining -= n
+	}
+}
+
+// The number of bytes that have been written.
+func (writer *bitWriter) size() uint64 {
+	return (writer.bit + 7) / 8
+}
+
+// The bitReader reads values that were written by a bitWriter.
+type bitReader struct {
+	data []byte
+	bit  uint64
+	err  error // Set once the reader reads past the end of the data.
+}
+
+func (reader *bitReader) read(width uint8) uint64 {
+	if reader.bit+uint64(width) > 8*uint64(len(reader.data)) {
+		if reader.err == nil {
+			reader.err = common.NewSerializationError("read past the end of a bit-packed segment")
+		}
+
+		return 0
+	}
+
+	value := readBits(reader.data, reader.bit, width)
+	reader.bit += uint64(width)
+
+	return value
+}
+
+// The chimpFunction compresses FLOAT and DOUBLE values with Chimp (Liakos et al., 2022): every value is XORed with the
+// previous value, which leaves few significant bits for slowly changing time series. The XOR is stored with a 2-bit
+// flag:
+//
+//	00: the value equals the previous value.
+//	01: the XOR has more than chimpTrailingThreshold trailing zeros: the rounded number of leading zeros (3 bits), the
+//	    number of significant bits, and the significant bits are stored.
+//	10: the XOR has the same rounded number of leading zeros as the previous XOR: the bits after the leading zeros are
+//	    stored.
+//	11: the rounded number of leading zeros (3 bits) and the bits after the leading zeros are stored.
+//
+// The first value is stored as it is. Chimp streams are decoded from the start, so scans decode the rows before the
+// range they need as well.
+type chimpFunction struct{}
+
+const chimpTrailingThreshold = 6
+
+// The numbers of leading zeros that can be represented, every number of leading zeros is rounded down to one of them.
+var chimpLeadingZeros = [8]uint8{0, 8, 12, 16, 18, 20, 22, 24}
+
+// The index in chimpLeadingZeros of the rounded number of leading zeros.
+func chimpLeadingCode(leadingZeros int) uint64 {
+	code := uint64(0)
+
+	for i, representation := range chimpLeadingZeros {
+		if int(representation) <= leadingZeros {
+			code = uint64(i)
+		}
+	}
+
+	return code
+}
+
+// The width of the values of the type in bits, and the number of bits that are needed to store a number of
+// significant bits.
+func chimpWidths(typ common.TypeID) (uint8, uint8) {
+	if typ == common.Float {
+		return 32, 5
+	}
+
+	return 64, 6
+}
+
+func chimpEncode(writer *bitWriter, typ common.TypeID, values []uint64) {
+	width, significantWidth := chimpWidths(typ)
+	storedLeadingZeros := -1
+
+	for i, value := range values {
+		if i == 0 {
+			writer.write(value, width)
+			continue
+		}
+
+		xor := value ^ values[i-1]
+
+		if xor == 0 {
+			writer.write(0b00, 2)
+			storedLeadingZeros = -1
+
+			continue
+		}
+
+		code := chimpLeadingCode(bits.LeadingZeros64(xor) - (64 - int(width)))
+		leadingZeros := int(chimpLeadingZeros[code])
+
+		if trailingZeros := bits.TrailingZeros64(xor); trailingZeros > chimpTrailingThreshold {
+			significantBits := int(width) - leadingZeros - trailingZeros
+			writer.write(0b01, 2)
+			writer.write(code, 3)
+			writer.write(uint64(significantBits), significantWidth)
+			writer.write(xor>>trailingZeros, uint8(significantBits))
+			storedLeadingZeros = -1
+		} else if leadingZeros == storedLeadingZeros {
+			writer.write(0b10, 2)
+			writer.write(xor, width-uint8(leadingZeros))
+		} else {
+			writer.write(0b11, 2)
+			writer.write(code, 3)
+			writer.write(xor, width-uint8(leadingZeros))
+			storedLeadingZeros = leadingZeros
+		}
+	}
+}
+
+func (chimpFunction) analyze(values *segmentValues) (uint64, bool) {
+	if typ := values.typ(); typ != common.Float && typ != common.Double {
+		return 0, false
+	}
+
+	writer := &bitWriter{}
+	chimpEncode(writer, values.typ(), values.bits)
+
+	return writer.size(), true
+}
+
+func (chimpFunction) compress(values *segmentValues, buffer []byte) {
+	chimpEncode(&bitWriter{buffer: buffer}, values.typ(), values.bits)
+}
+
+func (chimpFunction) scan(data []byte, count uint64, start uint64, end uint64, out *common.Vector) error {
+	if err := checkScanRange(count, start, end); err != nil {
+		return err
+	}
+
+	width, significantWidth := chimpWidths(out.Type())
+	reader := &bitReader{data: data}
+	result := make([]uint64, 0, end-start)
+	var value uint64
+	storedLeadingZeros := -1
+
+	for i := uint64(0); i < end && reader.err == nil; i++ {
+		if i == 0 {
+			value = reader.read(width)
+		} else {
+			switch reader.read(2) {
+			case 0b00:
+				storedLeadingZeros = -1
+			case 0b01:
+				leadingZeros := int(chimpLeadingZeros[reader.read(3)])
+				significantBits := int(reader.read(significantWidth))
+				trailingZeros := int(width) - leadingZeros - significantBits
+
+				if trailingZeros < 0 || significantBits == 0 {
+					return common.NewSerializationError(fmt.Sprintf("invalid Chimp value %d", i))
+				}
+
+				value ^= reader.read(uint8(significantBits)) << trailingZeros
+				storedLeadingZeros = -1
+			case 0b10:
+				if storedLeadingZeros < 0 {
+					return common.NewSerializationError(fmt.Sprintf("invalid Chimp value %d", i))
+				}
+
+				value ^= reader.read(width - uint8(storedLeadingZeros))
+			case 0b11:
+				storedLeadingZeros = int(chimpLeadingZeros[reader.read(3)])
+				value ^= reader.read(width - uint8(storedLeadingZeros))
+			}
+		}
+
+		if i >= start {
+			result = append(result, value)
+		}
+	}
+
+	if reader.err != nil {
+		return reader.err
+	}
+
+	appendFixedBits(out, len(result), func(i int) uint64 { return result[i] })
+
+	return nil
+}
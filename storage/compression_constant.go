@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"encoding/binary"
+
+	"github.com/goduckdb/common"
+)
+
+// The constantFunction stores a segment in which all values are equal as a single value: a fixed-size value as its
+// bit pattern, a variable-size value as a uint32 length followed by its bytes.
+type constantFunction struct{}
+
+func (constantFunction) analyze(values *segmentValues) (uint64, bool) {
+	if values.count() == 0 {
+		return 0, false
+	}
+
+	if values.bits != nil {
+		for _, v := range values.bits[1:] {
+			if v != values.bits[0] {
+				return 0, false
+			}
+		}
+
+		return values.typ().Size(), true
+	}
+
+	for _, v := range values.strings[1:] {
+		if v != values.strings[0] {
+			return 0, false
+		}
+	}
+
+	return 4 + uint64(len(values.strings[0])), true
+}
+
+func (constantFunction) compress(values *segmentValues, buffer []byte) {
+	if values.bits != nil {
+		putFixedBits(buffer, values.typ(), values.bits[0])
+		return
+	}
+
+	binary.LittleEndian.PutUint32(buffer, uint32(len(values.strings[0])))
+	copy(buffer[4:], values.strings[0])
+}
+
+func (constantFunction) scan(data []byte, count uint64, start uint64, end uint64, out *common.Vector) error {
+	if err := checkScanRange(count, start, end); err != nil {
+		return err
+	}
+
+	typ := out.Type()
+
+	if size := typ.Size(); size > 0 {
+		if err := checkSegmentSize(data, size, CompressionConstant); err != nil {
+			return err
+		}
+
+		value := getFixedBits(data, typ)
+		appendFixedBits(out, int(end-start), func(int) uint64 { return value })
+
+		return nil
+	}
+
+	if err := checkSegmentSize(data, 4, CompressionConstant); err != nil {
+		return err
+	}
+
+	length := uint64(binary.LittleEndian.Uint32(data))
+
+	if err := checkSegmentSize(data, 4+length, CompressionConstant); err != nil {
+		return err
+	}
+
+	for i := start; i < end; i++ {
+		appendVariableSize(out, data[4:4+length])
+	}
+
+	return nil
+}
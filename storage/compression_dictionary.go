@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/goduckdb/common"
+)
+
+// The dictionaryFunction stores every distinct string of a segment once: a uint32 dictionary size and a uint8 bit
+// width, followed by the dictionary (as uint32 offsets and the concatenated strings, like an uncompressed segment) and
+// the bit-packed dictionary index of every value.
+type dictionaryFunction struct{}
+
+// Build the dictionary of the strings: the distinct strings in order of their first occurrence, and the index of every
+// string in the dictionary.
+func buildDictionary(values []string) ([]string, []uint64) {
+	indexes := make(map[string]uint64)
+	dictionary := []string{}
+	result := make([]uint64, len(values))
+
+	for i, v := range values {
+		index, ok := indexes[v]
+
+		if !ok {
+			index = uint64(len(dictionary))
+			indexes[v] = index
+			dictionary = append(dictionary, v)
+		}
+
+		result[i] = index
+	}
+
+	return dictionary, result
+}
+
+func dictionarySize(dictionary []string, count int) uint64 {
+	size := 5 + 4*uint64(len(dictionary)+1) + bitPackedSize(count, dictionaryWidth(dictionary))
+
+	for _, v := range dictionary {
+		size += uint64(len(v))
+	}
+
+	return size
+}
+
+func dictionaryWidth(dictionary []string) uint8 {
+	if len(dictionary) == 0 {
+		return 0
+	}
+
+	return bitWidth(uint64(len(dictionary) - 1))
+}
+
+func (dictionaryFunction) analyze(values *segmentValues) (uint64, bool) {
+	if values.strings == nil {
+		return 0, false
+	}
+
+	dictionary, _ := buildDictionary(values.strings)
+
+	return dictionarySize(dictionary, values.count()), true
+}
+
+func (dictionaryFunction) compress(values *segmentValues, buffer []byte) {
+	dictionary, indexes := buildDictionary(values.strings)
+	width := dictionaryWidth(dictionary)
+	binary.LittleEndian.PutUint32(buffer, uint32(len(dictionary)))
+	buffer[4] = width
+	size := encodeVariableSize(len(dictionary), buffer[5:], func(i int, heap []byte) int {
+		return copy(heap, dictionary[i])
+	})
+	packBits(buffer[5+size:], width, len(indexes), func(i int) uint64 { return indexes[i] })
+}
+
+func (dictionaryFunction) scan(data []byte, count uint64, start uint64, end uint64, out *common.Vector) error {
+	if err := checkScanRange(count, start, end); err != nil {
+		return err
+	}
+
+	if err := checkSegmentSize(data, 5, CompressionDictionary); err != nil {
+		return err
+	}
+
+	dictionaryCount := uint64(binary.LittleEndian.Uint32(data))
+	width := data[4]
+	dictionary := data[5:]
+
+	if err := checkSegmentSize(dictionary, 4*(dictionaryCount+1), CompressionDictionary); err != nil {
+		return err
+	}
+
+	offsets := dictionary[:4*(dictionaryCount+1)]
+	heap := dictionary[4*(dictionaryCount+1):]
+	heapSize := uint64(binary.LittleEndian.Uint32(offsets[4*dictionaryCount:]))
+
+	if err := checkSegmentSize(heap, heapSize+bitPackedSize(int(count), width), CompressionDictionary); err != nil {
+		return err
+	}
+
+	packed := heap[heapSize:]
+
+	for i := start; i < end; i++ {
+		index := unpackBits(packed, width, i)
+
+		if index >= dictionaryCount {
+			return common.NewSerializationError(fmt.Sprintf("dictionary index %d exceeds the dictionary of %d strings",
+				index, dictionaryCount))
+		}
+
+		valueStart := binary.LittleEndian.Uint32(offsets[4*index:])
+		valueEnd := binary.LittleEndian.Uint32(offsets[4*(index+1):])
+
+		if valueStart > valueEnd || uint64(valueEnd) > heapSize {
+			return common.NewSerializationError(fmt.Sprintf("invalid offsets [%d, %d) of dictionary string %d",
+				valueStart, valueEnd, index))
+		}
+
+		appendVariableSize(out, heap[valueStart:valueEnd])
+	}
+
+	return nil
+}
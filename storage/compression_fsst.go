@@ -0,0 +1,449 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/goduckdb/common"
+)
+
+// The fsstFunction compresses VARCHAR and BLOB values with FSST (Boncz et al., 2020). A symbol table of up to 255
+// symbols of 1 to 8 bytes is built from a sample of the values, and every value is encoded as a sequence of one-byte
+// codes that refer to the symbols; bytes that are not covered by a symbol are escaped. Every value is encoded
+// separately, so a single value can be decoded without decoding the values before it, and equal values have equal
+// encodings, so equality filters can compare against the encoded constant without decoding the values.
+//
+// The symbol table of a segment is written to the chain of meta blocks of its column, see metadataCompressionFunction,
+// as the uint8 number of symbols followed by the uint8 length and the bytes of every symbol. The segment header points
+// to the symbol table, and is followed by the uint8 bit width and the count+1 bit-packed offsets of the encoded values,
+// and finally the concatenated encoded values. The symbol table is read once per segment, when it is first scanned.
+type fsstFunction struct {
+	table *fsstSymbolTable // The symbol table of the segment, built from the values if nil.
+}
+
+const (
+	fsstMaxSymbols      = 255
+	fsstMaxSymbolLength = 8
+	fsstEscape          = 255 // The code that is followed by a byte that is not covered by a symbol.
+)
+
+// The number of times the symbol table is refined, and the maximum number of bytes that are sampled to build it.
+const (
+	fsstGenerations = 5
+	fsstSampleSize  = 16384
+)
+
+// The fsstSymbolTable maps codes to symbols, and finds the longest symbol a string starts with.
+type fsstSymbolTable struct {
+	symbols []string
+	byByte  [256][]uint8 // The codes of the symbols that start with a byte, longest symbols first.
+}
+
+func newFSSTSymbolTable(symbols []string) *fsstSymbolTable {
+	table := &fsstSymbolTable{symbols: symbols}
+
+	for code, symbol := range symbols {
+		table.byByte[symbol[0]] = append(table.byByte[symbol[0]], uint8(code))
+	}
+
+	for i := range table.byByte {
+		codes := table.byByte[i]
+		sort.SliceStable(codes, func(a, b int) bool { return len(symbols[codes[a]]) > len(symbols[codes[b]]) })
+	}
+
+	return table
+}
+
+// The code of the longest symbol the value starts with, or false if no symbol matches.
+func (table *fsstSymbolTable) match(value string) (uint8, bool) {
+	for _, code := range table.byByte[value[0]] {
+		if strings.HasPrefix(value, table.symbols[code]) {
+			return code, true
+		}
+	}
+
+	return 0, false
+}
+
+// Append the encoding of the value to dst.
+func (table *fsstSymbolTable) encode(dst []byte, value string) []byte {
+	for len(value) > 0 {
+		if code, ok := table.match(value); ok {
+			dst = append(dst, code)
+			value = value[len(table.symbols[code]):]
+		} else {
+			dst = append(dst, fsstEscape, value[0])
+			value = value[1:]
+		}
+	}
+
+	return dst
+}
+
+// The size of the encoding of the value.
+func (table *fsstSymbolTable) encodedSize(value string) uint64 {
+	size := uint64(0)
+
+	for len(value) > 0 {
+		if code, ok := table.match(value); ok {
+			size++
+			value = value[len(table.symbols[code]):]
+		} else {
+			size += 2
+			value = value[1:]
+		}
+	}
+
+	return size
+}
+
+// Append the decoding of an encoded value to dst.
+func (table *fsstSymbolTable) decode(dst []byte, encoded []byte) ([]byte, error) {
+	for i := 0; i < len(encoded); i++ {
+		code := encoded[i]
+
+		if code == fsstEscape {
+			if i++; i == len(encoded) {
+				return nil, common.NewSerializationError("FSST value ends with an escape")
+			}
+
+			dst = append(dst, encoded[i])
+		} else if int(code) < len(table.symbols) {
+			dst = append(dst, table.symbols[code]...)
+		} else {
+			return nil, common.NewSerializationError(fmt.Sprintf("FSST code %d exceeds the symbol table of %d symbols",
+				code, len(table.symbols)))
+		}
+	}
+
+	return dst, nil
+}
+
+// Write the symbol table to the serializer.
+func (table *fsstSymbolTable) serialize(serializer common.Serializer) error {
+	if err := serializer.WriteUint8(uint8(len(table.symbols))); err != nil {
+		return err
+	}
+
+	for _, symbol := range table.symbols {
+		if err := serializer.WriteUint8(uint8(len(symbol))); err != nil {
+			return err
+		}
+
+		if err := serializer.WriteData([]byte(symbol)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Read a symbol table that was written by serialize.
+func deserializeFSSTSymbolTable(deserializer common.Deserializer) (*fsstSymbolTable, error) {
+	count, err := deserializer.ReadUint8()
+
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := make([]string, count)
+
+	for i := range symbols {
+		length, err := deserializer.ReadUint8()
+
+		if err != nil {
+			return nil, err
+		}
+
+		if length == 0 || length > fsstMaxSymbolLength {
+			return nil, common.NewSerializationError(fmt.Sprintf("invalid length %d of FSST symbol %d", length, i))
+		}
+
+		symbol := make([]byte, length)
+
+		if err := deserializer.ReadData(symbol); err != nil {
+			return nil, err
+		}
+
+		symbols[i] = string(symbol)
+	}
+
+	return newFSSTSymbolTable(symbols), nil
+}
+
+// Build the symbol table for the values. Starting from an empty table, a sample of the values is encoded with the
+// table of the previous generation; the symbols that were used and the concatenations of adjacent symbols are
+// candidates for the next generation, which keeps the candidates that save the most bytes.
+func buildFSSTSymbolTable(values []string) *fsstSymbolTable {
+	sample := fsstSample(values)
+	table := newFSSTSymbolTable(nil)
+
+	for generation := 0; generation < fsstGenerations; generation++ {
+		counts := make(map[string]int)
+
+		for _, value := range sample {
+			previous := ""
+
+			for len(value) > 0 {
+				// A byte that is not covered by a symbol is a candidate for a symbol of its own.
+				symbol := value[:1]
+
+				if code, ok := table.match(value); ok {
+					symbol = table.symbols[code]
+				}
+
+				counts[symbol]++
+
+				if previous != "" && len(previous)+len(symbol) <= fsstMaxSymbolLength {
+					counts[previous+symbol]++
+				}
+
+				previous = symbol
+				value = value[len(symbol):]
+			}
+		}
+
+		table = newFSSTSymbolTable(fsstBestSymbols(counts))
+	}
+
+	return table
+}
+
+// A sample of the values of at most fsstSampleSize bytes, taken evenly from the values.
+func fsstSample(values []string) []string {
+	total := 0
+
+	for _, value := range values {
+		total += len(value)
+	}
+
+	if total <= fsstSampleSize {
+		return values
+	}
+
+	var sample []string
+	size := 0
+	step := (total + fsstSampleSize - 1) / fsstSampleSize
+
+	for i := 0; i < len(values) && size < fsstSampleSize; i += step {
+		sample = append(sample, values[i])
+		size += len(values[i])
+	}
+
+	return sample
+}
+
+// The candidates that save the most bytes: a symbol of n bytes that is used c times saves about n*c bytes. Ties are
+// broken by the symbol, so the table does not depend on the order of the map.
+func fsstBestSymbols(counts map[string]int) []string {
+	candidates := make([]string, 0, len(counts))
+
+	for symbol := range counts {
+		candidates = append(candidates, symbol)
+	}
+
+	gain := func(symbol string) int { return len(symbol) * counts[symbol] }
+	sort.Slice(candidates, func(a, b int) bool {
+		if gainA, gainB := gain(candidates[a]), gain(candidates[b]); gainA != gainB {
+			return gainA > gainB
+		}
+
+		return candidates[a] < candidates[b]
+	})
+
+	if len(candidates) > fsstMaxSymbols {
+		candidates = candidates[:fsstMaxSymbols]
+	}
+
+	return candidates
+}
+
+// The encoding of the values of a segment.
+type fsstEncoding struct {
+	table    *fsstSymbolTable
+	heapSize uint64
+	width    uint8 // The bit width of the offsets.
+}
+
+func (function fsstFunction) encode(values *segmentValues) *fsstEncoding {
+	encoding := &fsstEncoding{table: function.table}
+
+	if encoding.table == nil {
+		encoding.table = buildFSSTSymbolTable(values.strings)
+	}
+
+	for _, value := range values.strings {
+		encoding.heapSize += encoding.table.encodedSize(value)
+	}
+
+	encoding.width = bitWidth(encoding.heapSize)
+
+	return encoding
+}
+
+func (encoding *fsstEncoding) size(count int) uint64 {
+	return 1 + bitPackedSize(count+1, encoding.width) + encoding.heapSize
+}
+
+func (function fsstFunction) analyze(values *segmentValues) (uint64, bool) {
+	if values.strings == nil {
+		return 0, false
+	}
+
+	return function.encode(values).size(values.count()), true
+}
+
+func (function fsstFunction) writeMetadata(values *segmentValues, writer *MetaBlockWriter) (compressionFunction, error) {
+	table := buildFSSTSymbolTable(values.strings)
+
+	return fsstFunction{table: table}, table.serialize(writer)
+}
+
+func (fsstFunction) readMetadata(reader *MetaBlockReader) (compressionFunction, error) {
+	table, err := deserializeFSSTSymbolTable(reader)
+
+	return fsstFunction{table: table}, err
+}
+
+func (function fsstFunction) compress(values *segmentValues, buffer []byte) {
+	encoding := function.encode(values)
+	buffer[0] = encoding.width
+	packed := buffer[1:]
+	heap := packed[bitPackedSize(values.count()+1, encoding.width):][:0]
+	offsets := make([]uint64, 0, values.count()+1)
+
+	for _, value := range values.strings {
+		offsets = append(offsets, uint64(len(heap)))
+		heap = encoding.table.encode(heap, value)
+	}
+
+	offsets = append(offsets, uint64(len(heap)))
+	packBits(packed, encoding.width, len(offsets), func(i int) uint64 { return offsets[i] })
+}
+
+// An fsstSegment is the decoded header of an FSST segment.
+type fsstSegment struct {
+	table  *fsstSymbolTable
+	width  uint8
+	packed []byte // The bit-packed offsets.
+	heap   []byte // The encoded values.
+	count  uint64
+}
+
+// Read the header of a segment that was compressed with the symbol table of the function.
+func (function fsstFunction) readSegment(data []byte, count uint64) (*fsstSegment, error) {
+	if function.table == nil {
+		return nil, common.NewSerializationError("FSST segment without its symbol table")
+	}
+
+	if err := checkSegmentSize(data, 1, CompressionFSST); err != nil {
+		return nil, err
+	}
+
+	segment := &fsstSegment{table: function.table, width: data[0], count: count}
+	packedSize := bitPackedSize(int(count+1), segment.width)
+
+	if err := checkSegmentSize(data, 1+packedSize, CompressionFSST); err != nil {
+		return nil, err
+	}
+
+	segment.packed = data[1 : 1+packedSize]
+	segment.heap = data[1+packedSize:]
+
+	if err := checkSegmentSize(segment.heap, unpackBits(segment.packed, segment.width, count), CompressionFSST); err != nil {
+		return nil, err
+	}
+
+	return segment, nil
+}
+
+// The encoded value of a row.
+func (segment *fsstSegment) encoded(row uint64) ([]byte, error) {
+	start := unpackBits(segment.packed, segment.width, row)
+	end := unpackBits(segment.packed, segment.width, row+1)
+
+	if start > end || end > uint64(len(segment.heap)) {
+		return nil, common.NewSerializationError(fmt.Sprintf("invalid offsets [%d, %d) of FSST value %d", start, end, row))
+	}
+
+	return segment.heap[start:end], nil
+}
+
+func (function fsstFunction) scan(data []byte, count uint64, start uint64, end uint64, out *common.Vector) error {
+	if err := checkScanRange(count, start, end); err != nil {
+		return err
+	}
+
+	segment, err := function.readSegment(data, count)
+
+	if err != nil {
+		return err
+	}
+
+	var value []byte
+
+	for row := start; row < end; row++ {
+		encoded, err := segment.encoded(row)
+
+		if err != nil {
+			return err
+		}
+
+		if value, err = segment.table.decode(value[:0], encoded); err != nil {
+			return err
+		}
+
+		appendVariableSize(out, value)
+	}
+
+	return nil
+}
+
+// Equality filters are evaluated on the encoded values: the constant is encoded with the symbol table of the segment,
+// and compared to the encoded values.
+func (function fsstFunction) filter(data []byte, count uint64, start uint64, end uint64, filter *TableFilter,
+	selection []bool) (bool, error) {
+	if filter.Comparison != CompareEqual && filter.Comparison != CompareNotEqual {
+		return false, nil
+	}
+
+	if err := checkScanRange(count, start, end); err != nil {
+		return false, err
+	}
+
+	segment, err := function.readSegment(data, count)
+
+	if err != nil {
+		return false, err
+	}
+
+	var constant []byte
+
+	switch value := filter.Constant.(type) {
+	case string:
+		constant = segment.table.encode(nil, value)
+	case []byte:
+		constant = segment.table.encode(nil, string(value))
+	default:
+		return false, fmt.Errorf("cannot compare %T to an FSST segment", value)
+	}
+
+	for row := start; row < end; row++ {
+		if !selection[row-start] {
+			continue
+		}
+
+		encoded, err := segment.encoded(row)
+
+		if err != nil {
+			return false, err
+		}
+
+		if (string(encoded) == string(constant)) != (filter.Comparison == CompareEqual) {
+			selection[row-start] = false
+		}
+	}
+
+	return true, nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/goduckdb/common"
+)
+
+// The rleFunction stores runs of equal fixed-size values: a uint32 run count, followed by the value of every run and
+// the uint16 length of every run. Runs that are longer than the maximum uint16 are split.
+type rleFunction struct{}
+
+// Call run with the start and length of every run of the values.
+func forEachRun(values []uint64, run func(start int, length int)) {
+	for start := 0; start < len(values); {
+		end := start + 1
+
+		for end < len(values) && values[end] == values[start] && end-start < math.MaxUint16 {
+			end++
+		}
+
+		run(start, end-start)
+		start = end
+	}
+}
+
+func (rleFunction) analyze(values *segmentValues) (uint64, bool) {
+	if values.bits == nil {
+		return 0, false
+	}
+
+	runs := uint64(0)
+	forEachRun(values.bits, func(int, int) { runs++ })
+
+	return 4 + runs*(values.typ().Size()+2), true
+}
+
+func (rleFunction) compress(values *segmentValues, buffer []byte) {
+	size := values.typ().Size()
+	var starts, lengths []int
+	forEachRun(values.bits, func(start int, length int) {
+		starts = append(starts, start)
+		lengths = append(lengths, length)
+	})
+
+	binary.LittleEndian.PutUint32(buffer, uint32(len(starts)))
+	valueOffset := uint64(4)
+	lengthOffset := valueOffset + uint64(len(starts))*size
+
+	for i, start := range starts {
+		putFixedBits(buffer[valueOffset+uint64(i)*size:], values.typ(), values.bits[start])
+		binary.LittleEndian.PutUint16(buffer[lengthOffset+uint64(2*i):], uint16(lengths[i]))
+	}
+}
+
+func (rleFunction) scan(data []byte, count uint64, start uint64, end uint64, out *common.Vector) error {
+	if err := checkScanRange(count, start, end); err != nil {
+		return err
+	}
+
+	if err := checkSegmentSize(data, 4, CompressionRLE); err != nil {
+		return err
+	}
+
+	typ := out.Type()
+	size := typ.Size()
+	runs := uint64(binary.LittleEndian.Uint32(data))
+	valueOffset := uint64(4)
+	lengthOffset := valueOffset + runs*size
+
+	if err := checkSegmentSize(data, lengthOffset+2*runs, CompressionRLE); err != nil {
+		return err
+	}
+
+	row := uint64(0)
+
+	for i := uint64(0); i < runs && row < end; i++ {
+		runEnd := row + uint64(binary.LittleEndian.Uint16(data[lengthOffset+2*i:]))
+
+		if runEnd > start {
+			from, to := row, runEnd
+
+			if from < start {
+				from = start
+			}
+
+			if to > end {
+				to = end
+			}
+
+			value := getFixedBits(data[valueOffset+i*size:], typ)
+			appendFixedBits(out, int(to-from), func(int) uint64 { return value })
+		}
+
+		row = runEnd
+	}
+
+	if row < end {
+		return common.NewSerializationError(fmt.Sprintf("RLE segment holds %d rows, expected %d", row, count))
+	}
+
+	return nil
+}
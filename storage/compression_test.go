@@ -0,0 +1,493 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/goduckdb/common"
+)
+
+// Compress the values with the given compression, and verify that every range of rows decompresses to the original
+// values.
+func verifyCompressionRoundTrip(t *testing.T, compression CompressionType, vector *common.Vector) {
+	t.Helper()
+
+	function, err := getCompressionFunction(compression)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := newSegmentValues(vector)
+	size, ok := function.analyze(values)
+
+	if !ok {
+		t.Fatalf("Expect %s to compress %s values", compression, vector.Type())
+	}
+
+	function, buffer := compressSegment(t, function, values, size)
+	count := uint64(vector.Len())
+
+	for _, scanRange := range [][2]uint64{{0, count}, {0, count / 2}, {count / 3, count}, {count / 2, count / 2}} {
+		out := common.NewVector(vector.Type(), 0)
+
+		if err := function.scan(buffer, count, scanRange[0], scanRange[1], out); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := vector.Slice(int(scanRange[0]), int(scanRange[1]))
+
+		if !equalValues(out, expected) {
+			t.Errorf("Expect %s to round trip rows %v of %v, got %v", compression, scanRange, expected.Data(), out.Data())
+		}
+	}
+}
+
+// Compress the values into a buffer of the given size, and return the function that scans the buffer. The metadata of a
+// metadataCompressionFunction is written to a chain of meta blocks, and read back.
+func compressSegment(t *testing.T, function compressionFunction, values *segmentValues,
+	size uint64) (compressionFunction, []byte) {
+	t.Helper()
+
+	buffer := make([]byte, size)
+	metadataFunction, ok := function.(metadataCompressionFunction)
+
+	if !ok {
+		function.compress(values, buffer)
+		return function, buffer
+	}
+
+	manager, err := NewInMemoryBlockManager()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	writer := NewMetaBlockWriter(manager)
+	offset := writer.offset
+
+	if function, err = metadataFunction.writeMetadata(values, writer); err != nil {
+		t.Fatal(err)
+	}
+
+	function.compress(values, buffer)
+
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := newMetaBlockReaderForBlocks(manager, writer.Blocks(), offset)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if function, err = metadataFunction.readMetadata(reader); err != nil {
+		t.Fatal(err)
+	}
+
+	return function, buffer
+}
+
+// Whether the vectors hold the same values, comparing floating-point values by their bit patterns.
+func equalValues(a *common.Vector, b *common.Vector) bool {
+	valuesA, valuesB := newSegmentValues(a), newSegmentValues(b)
+
+	return a.Type() == b.Type() && reflect.DeepEqual(valuesA.bits, valuesB.bits) &&
+		reflect.DeepEqual(valuesA.strings, valuesB.strings)
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	verifyCompressionRoundTrip(t, CompressionUncompressed, common.NewVectorFromSlice(common.Varchar, []string{"a", "", "bc"}))
+	verifyCompressionRoundTrip(t, CompressionConstant, common.NewVectorFromSlice(common.Integer, []int32{-7, -7, -7}))
+	verifyCompressionRoundTrip(t, CompressionConstant, common.NewVectorFromSlice(common.Blob, [][]byte{{1, 2}, {1, 2}}))
+	verifyCompressionRoundTrip(t, CompressionRLE, common.NewVectorFromSlice(common.SmallInt,
+		[]int16{-1, -1, -1, 5, 5, math.MinInt16, math.MaxInt16, math.MaxInt16}))
+	verifyCompressionRoundTrip(t, CompressionRLE, common.NewVectorFromSlice(common.Double,
+		[]float64{math.NaN(), math.NaN(), math.Copysign(0, -1), 0, math.Inf(1)}))
+	verifyCompressionRoundTrip(t, CompressionBitPacking, common.NewVectorFromSlice(common.Boolean,
+		[]bool{true, false, false, true, true, true, false, true, true}))
+	verifyCompressionRoundTrip(t, CompressionBitPacking, common.NewVectorFromSlice(common.TinyInt, []int8{0, 127, 3, 64}))
+	verifyCompressionRoundTrip(t, CompressionFOR, common.NewVectorFromSlice(common.BigInt,
+		[]int64{math.MinInt64, math.MaxInt64, 0, -1}))
+	verifyCompressionRoundTrip(t, CompressionFOR, common.NewVectorFromSlice(common.Timestamp,
+		[]int64{1767225600000000, 1767225600000001, 1767225600999999}))
+	verifyCompressionRoundTrip(t, CompressionDictionary, common.NewVectorFromSlice(common.Varchar,
+		[]string{"NL", "DE", "NL", "", "FR", "DE"}))
+}
+
+func TestChooseCompression(t *testing.T) {
+	lowCardinality := make([]string, 10000)
+	narrow := make([]int32, 10000)
+	timestamps := make([]int64, 10000)
+	runs := make([]float64, 10000)
+	constant := make([]int64, 10000)
+
+	for i := range lowCardinality {
+		lowCardinality[i] = fmt.Sprintf("https://example.com/category/%d", i%10)
+		narrow[i] = int32(i % 100)
+		timestamps[i] = 1767225600000000 + int64(i)*1000
+		runs[i] = float64(i / 1000)
+		constant[i] = 1234567
+	}
+
+	for _, test := range []struct {
+		vector   *common.Vector
+		expected CompressionType
+	}{
+		{common.NewVectorFromSlice(common.Varchar, lowCardinality), CompressionDictionary},
+		{common.NewVectorFromSlice(common.Integer, narrow), CompressionBitPacking},
+		{common.NewVectorFromSlice(common.Timestamp, timestamps), CompressionFOR},
+		{common.NewVectorFromSlice(common.Double, runs), CompressionRLE},
+		{common.NewVectorFromSlice(common.BigInt, constant), CompressionConstant},
+		{common.NewVectorFromSlice(common.Double, []float64{0.1, 0.2, 0.3}), CompressionALP},
+		{common.NewVectorFromSlice(common.Double, []float64{math.Pi, math.E, math.Sqrt2}), CompressionUncompressed},
+	} {
+		compression, _, size := chooseCompression(newSegmentValues(test.vector))
+
+		if compression != test.expected {
+			t.Errorf("Expect %s values to be compressed with %s, got %s", test.vector.Type(), test.expected, compression)
+		}
+
+		if uncompressed, _ := (uncompressedFunction{}).analyze(newSegmentValues(test.vector)); size > uncompressed {
+			t.Errorf("Expect %s to be no larger than the uncompressed size %d, got %d", compression, uncompressed, size)
+		}
+	}
+}
+
+func TestCompressedCheckpoint(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/compressed.db"
+	storageManager := openTestStorage(t, fs, path)
+	info := TableInfo{Name: "events", Columns: []ColumnDefinition{
+		{Name: "country", Type: common.Varchar},
+		{Name: "status", Type: common.SmallInt},
+	}}
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 2 * RowGroupSize
+	chunk := common.NewDataChunk(info.Types(), count)
+
+	for i := 0; i < count; i++ {
+		chunk.Columns[0].Append([]string{"NL", "DE", "FR", "BE"}[i%4])
+		chunk.Columns[1].Append(int16(200 + i%5))
+	}
+
+	if err := table.Append(chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every row group compresses so well that all its segments share a single block.
+	manager, err := NewSingleFileBlockManager(fs, path, true, false, common.DefaultChecksumType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if blocks := fileBlockCount(t, fs, manager); blocks > 4 {
+		t.Errorf("Expect the compressed table to take at most 4 blocks, got %d", blocks)
+	}
+
+	manager.Close()
+
+	storageManager = openTestStorage(t, fs, path)
+	defer storageManager.Close()
+
+	table = storageManager.GetTable("events")
+	column := table.RowGroups()[0].Column(0)
+
+	if segments := column.Segments(); len(segments) != 1 || segments[0].Compression() != CompressionDictionary {
+		t.Errorf("Expect the country column to be stored in a single dictionary segment")
+	}
+
+	row := 0
+	err = table.Scan([]int{0, 1}, func(chunk *common.DataChunk) error {
+		for i := 0; i < chunk.Len(); i++ {
+			if chunk.Columns[0].Value(i) != []string{"NL", "DE", "FR", "BE"}[(row+i)%4] ||
+				chunk.Columns[1].Value(i) != int16(200+(row+i)%5) {
+				return fmt.Errorf("unexpected values at row %d", row+i)
+			}
+		}
+
+		row += chunk.Len()
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if row != count {
+		t.Errorf("Expect to scan %d rows, got %d", count, row)
+	}
+}
+
+// Floating-point values that have to round trip byte-exactly: NaNs with different payloads and signs, the infinities,
+// -0.0, subnormals and the extremes.
+func specialFloat64s() []float64 {
+	return []float64{
+		0, math.Copysign(0, -1), 1, -1, 0.1, -273.15,
+		math.NaN(), -math.NaN(), math.Float64frombits(0x7FF0000000000001), math.Float64frombits(0xFFF8DEADBEEF0001),
+		math.Inf(1), math.Inf(-1),
+		math.SmallestNonzeroFloat64, -math.SmallestNonzeroFloat64, math.Float64frombits(0x000FFFFFFFFFFFFF),
+		math.MaxFloat64, -math.MaxFloat64, 1e300, 1e-300, 123456789.123456789,
+	}
+}
+
+func specialFloat32s() []float32 {
+	return []float32{
+		0, float32(math.Copysign(0, -1)), 1, -1, 0.1, -273.15,
+		float32(math.NaN()), math.Float32frombits(0xFFC00000), math.Float32frombits(0x7F800001),
+		math.Float32frombits(0xFFBADBAD),
+		float32(math.Inf(1)), float32(math.Inf(-1)),
+		math.SmallestNonzeroFloat32, -math.SmallestNonzeroFloat32, math.Float32frombits(0x007FFFFF),
+		math.MaxFloat32, -math.MaxFloat32, 1e30, 1e-30, 12345.678,
+	}
+}
+
+func TestFloatCompressionSpecialValues(t *testing.T) {
+	doubles := specialFloat64s()
+	floats := specialFloat32s()
+
+	for _, compression := range []CompressionType{CompressionChimp, CompressionALP} {
+		verifyCompressionRoundTrip(t, compression, common.NewVectorFromSlice(common.Double, doubles))
+		verifyCompressionRoundTrip(t, compression, common.NewVectorFromSlice(common.Float, floats))
+
+		// Every special value repeated, and next to ordinary values, exercises all Chimp flags and ALP exceptions.
+		var mixedDoubles []float64
+		var mixedFloats []float32
+
+		for i := 0; i < 3; i++ {
+			for j := range doubles {
+				mixedDoubles = append(mixedDoubles, doubles[j], doubles[j], float64(i*j)/10)
+				mixedFloats = append(mixedFloats, floats[j], floats[j], float32(i*j)/10)
+			}
+		}
+
+		verifyCompressionRoundTrip(t, compression, common.NewVectorFromSlice(common.Double, mixedDoubles))
+		verifyCompressionRoundTrip(t, compression, common.NewVectorFromSlice(common.Float, mixedFloats))
+	}
+}
+
+func TestFloatCompressionTimeSeries(t *testing.T) {
+	// A temperature sensor with two decimals, and a slowly drifting measurement with full precision.
+	temperatures := make([]float64, 10000)
+	drift := make([]float64, 10000)
+	pressures := make([]float32, 10000)
+
+	for i := range temperatures {
+		temperatures[i] = math.Round((20+5*math.Sin(float64(i)/500))*100) / 100
+		drift[i] = 1000 + float64(i)*math.Pi/1e6
+		pressures[i] = float32(math.Round(1013.25*10+float64(i%50)) / 10)
+	}
+
+	for _, test := range []struct {
+		vector   *common.Vector
+		expected CompressionType
+	}{
+		{common.NewVectorFromSlice(common.Double, temperatures), CompressionALP},
+		{common.NewVectorFromSlice(common.Double, drift), CompressionChimp},
+		{common.NewVectorFromSlice(common.Float, pressures), CompressionALP},
+	} {
+		values := newSegmentValues(test.vector)
+		compression, _, size := chooseCompression(values)
+		uncompressed, _ := (uncompressedFunction{}).analyze(values)
+
+		if compression != test.expected {
+			t.Errorf("Expect %s to be chosen, got %s", test.expected, compression)
+		}
+
+		if size >= uncompressed {
+			t.Errorf("Expect %s to be smaller than the uncompressed size %d, got %d", compression, uncompressed, size)
+		}
+
+		verifyCompressionRoundTrip(t, compression, test.vector)
+	}
+}
+
+func TestFSSTCompression(t *testing.T) {
+	urls := make([]string, 10000)
+	messages := make([][]byte, 1000)
+
+	for i := range urls {
+		urls[i] = fmt.Sprintf("https://example.com/products/%d?utm_source=newsletter&utm_medium=email", i*7919%100000)
+	}
+
+	for i := range messages {
+		messages[i] = []byte(fmt.Sprintf("2026-01-01 12:%02d:%02d INFO request handled in %d ms\xff\x00", i/60%60, i%60, i%250))
+	}
+
+	verifyCompressionRoundTrip(t, CompressionFSST, common.NewVectorFromSlice(common.Varchar, urls))
+	verifyCompressionRoundTrip(t, CompressionFSST, common.NewVectorFromSlice(common.Blob, messages))
+	verifyCompressionRoundTrip(t, CompressionFSST, common.NewVectorFromSlice(common.Varchar, []string{"", "a", "", "\xff\xff"}))
+	verifyCompressionRoundTrip(t, CompressionFSST, common.NewVectorFromSlice(common.Varchar, []string{}))
+
+	values := newSegmentValues(common.NewVectorFromSlice(common.Varchar, urls))
+	compression, function, size := chooseCompression(values)
+
+	if compression != CompressionFSST {
+		t.Fatalf("Expect URLs to be compressed with FSST, got %s", compression)
+	}
+
+	if uncompressed, _ := (uncompressedFunction{}).analyze(values); size > uncompressed/2 {
+		t.Errorf("Expect FSST to compress URLs to at most half of %d bytes, got %d", uncompressed, size)
+	}
+
+	// The pointer to the symbol table is written by the segmentWriter.
+	function, buffer := compressSegment(t, function, values, size-metadataPointerSize)
+
+	// Equality filters are evaluated on the compressed values, and agree with filters on the decompressed values.
+	for _, filter := range []TableFilter{
+		{Comparison: CompareEqual, Constant: urls[1234]},
+		{Comparison: CompareNotEqual, Constant: urls[1234]},
+		{Comparison: CompareEqual, Constant: "https://example.com/"},
+		{Comparison: CompareGreaterThan, Constant: urls[1234]},
+	} {
+		selection := make([]bool, len(urls)-100)
+		expected := make([]bool, len(urls)-100)
+
+		for i := range selection {
+			selection[i], expected[i] = i%2 == 0, i%2 == 0
+		}
+
+		filter.evaluate(common.NewVectorFromSlice(common.Varchar, urls[100:]), expected)
+		ok, err := function.(compressedFilterFunction).filter(buffer, uint64(len(urls)), 100, uint64(len(urls)),
+			&filter, selection)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok != (filter.Comparison == CompareEqual || filter.Comparison == CompareNotEqual) {
+			t.Errorf("Expect only equality filters on FSST segments to be evaluated on the compressed values")
+		}
+
+		if ok && !reflect.DeepEqual(selection, expected) {
+			t.Errorf("Expect the filter %s %q to select the same rows on the compressed values", filter.Comparison,
+				filter.Constant)
+		}
+	}
+}
+
+func TestFSSTCheckpoint(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/fsst.db"
+	storageManager := openTestStorage(t, fs, path)
+	filler, err := storageManager.CreateTable(&testTableInfo)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := filler.Append(testChunk(0, 300000)); err != nil {
+		t.Fatal(err)
+	}
+
+	info := TableInfo{Name: "urls", Columns: []ColumnDefinition{{Name: "url", Type: common.Varchar}}}
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls := make([]string, 2*RowGroupSize)
+	chunk := common.NewDataChunk(info.Types(), len(urls))
+
+	for i := range urls {
+		urls[i] = fmt.Sprintf("https://example.com/products/%d?utm_source=newsletter&utm_medium=email", i*7919%100000)
+		chunk.Columns[0].Append(urls[i])
+	}
+
+	if err := table.Append(chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Scans decode the values with the symbol tables, and equality filters compare the encoded values.
+	verify := func(table *DataTable) {
+		t.Helper()
+
+		row := 0
+		err := table.Scan([]int{0}, func(chunk *common.DataChunk) error {
+			for i := 0; i < chunk.Len(); i++ {
+				if chunk.Columns[0].Value(i) != urls[row+i] {
+					return fmt.Errorf("unexpected value %v at row %d", chunk.Columns[0].Value(i), row+i)
+				}
+			}
+
+			row += chunk.Len()
+
+			return nil
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		matches := 0
+		filters := []TableFilter{{ColumnID: 0, Comparison: CompareEqual, Constant: urls[1234]}}
+		err = table.ScanWithFilters([]int{0}, filters, func(chunk *common.DataChunk) error {
+			matches += chunk.Len()
+			return nil
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if row != len(urls) || matches != 3 {
+			t.Errorf("Expect to scan %d rows of which 3 match, got %d rows of which %d match", len(urls), row, matches)
+		}
+	}
+
+	column := table.RowGroups()[1].Column(0)
+
+	if column.Segments()[0].Compression() != CompressionFSST || len(column.MetadataBlocks()) == 0 {
+		t.Fatalf("Expect the URLs to be stored in FSST segments with their symbol tables in meta blocks")
+	}
+
+	verify(table)
+
+	// Vacuum moves the blocks of the last row group, including its meta blocks, to the blocks of the dropped table.
+	if err := storageManager.DropTable(testTableInfo.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	metadataBlocks := append([]BlockID(nil), column.MetadataBlocks()...)
+
+	if err := storageManager.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+
+	if reflect.DeepEqual(column.MetadataBlocks(), metadataBlocks) {
+		t.Errorf("Expect the meta blocks %v to be relocated by the vacuum", metadataBlocks)
+	}
+
+	if err := storageManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	storageManager = openTestStorage(t, fs, path)
+	defer storageManager.Close()
+
+	verify(storageManager.GetTable("urls"))
+}
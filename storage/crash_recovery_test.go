@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+
+	"github.com/goduckdb/common"
+)
+
+const crashTestPath = "/crash.db"
+
+// Perform a checkpoint in a new session: write the value to a new block and commit a header that points to it. The block
+// of the previous checkpoint is freed by the checkpoint, so that blocks are reused across checkpoints.
+func writeCheckpoint(fs common.FileSystem, value uint64) error {
+	manager, err := NewSingleFileBlockManager(fs, crashTestPath, false, false, common.DefaultChecksumType)
+
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	if metaBlock := manager.GetMetaBlock(); metaBlock != InvalidBlock {
+		manager.MarkBlockAsModified(metaBlock)
+	}
+
+	block := manager.CreateBlock()
+	binary.LittleEndian.PutUint64(block.Buffer(), value)
+
+	if err := manager.Write(block); err != nil {
+		return err
+	}
+
+	return manager.WriteHeader(DatabaseHeader{MetaBlock: block.ID})
+}
+
+// Open the database and read the value of the last committed checkpoint, 0 if there is none.
+func readCheckpoint(fs common.FileSystem) (uint64, error) {
+	manager, err := NewSingleFileBlockManager(fs, crashTestPath, true, false, common.DefaultChecksumType)
+
+	if err != nil {
+		return 0, err
+	}
+	defer manager.Close()
+
+	if manager.GetMetaBlock() == InvalidBlock {
+		return 0, nil
+	}
+
+	block := NewBlock(manager.GetMetaBlock())
+
+	if err := manager.Read(block); err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint64(block.Buffer()), nil
+}
+
+// Run checkpoints until the injected fault fails one of them, then simulate a crash and verify that the database opens
+// to the last committed checkpoint. Returns whether the fault was triggered.
+func runCrashScenario(t *testing.T, faultType common.FaultType, at int) bool {
+	fs := common.NewFaultInjectionFileSystem(common.NewMemoryFileSystem())
+	manager, err := NewSingleFileBlockManager(fs, crashTestPath, false, true, common.DefaultChecksumType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager.Close()
+	fs.SetFault(faultType, at)
+
+	var committed uint64
+	var checkpointErr error
+
+	for value := uint64(1); value <= 5; value++ {
+		if checkpointErr = writeCheckpoint(fs, value); checkpointErr != nil {
+			break
+		}
+
+		committed = value
+	}
+
+	triggered := fs.Triggered()
+
+	if !triggered && checkpointErr != nil {
+		t.Fatalf("%v at %d: checkpoint failed without injected fault: %v", faultType, at, checkpointErr)
+	}
+
+	if faultType == common.NoSpace && triggered && !errors.Is(checkpointErr, syscall.ENOSPC) {
+		t.Errorf("%v at %d: expect checkpoint to fail with ENOSPC, got %v", faultType, at, checkpointErr)
+	}
+
+	if err := fs.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := readCheckpoint(fs)
+
+	if err != nil {
+		t.Fatalf("%v at %d: cannot open database after crash: %v", faultType, at, err)
+	}
+
+	// The commit point of a checkpoint is its header reaching the disk: if the header write of the checkpoint in flight
+	// was torn after the header itself was written, that checkpoint is durable as well.
+	inFlight := faultType == common.TornWrite && checkpointErr != nil && value == committed+1
+
+	if value != committed && !inFlight {
+		t.Errorf("%v at %d: expect database to open to checkpoint %d, got %d", faultType, at, committed, value)
+	}
+
+	// The recovered database can be checkpointed again.
+	if err := writeCheckpoint(fs, committed+100); err != nil {
+		t.Fatalf("%v at %d: cannot checkpoint after recovery: %v", faultType, at, err)
+	}
+
+	if value, err := readCheckpoint(fs); err != nil || value != committed+100 {
+		t.Errorf("%v at %d: expect checkpoint %d after recovery, got %d (%v)", faultType, at, committed+100, value, err)
+	}
+
+	return triggered
+}
+
+func TestCrashRecovery(t *testing.T) {
+	for _, faultType := range []common.FaultType{common.PowerLoss, common.TornWrite, common.FailedSync, common.NoSpace} {
+		at := 1
+
+		for runCrashScenario(t, faultType, at) {
+			at++
+		}
+
+		if at == 1 {
+			t.Errorf("%v: the fault was never injected", faultType)
+		}
+	}
+}
+
+func TestShortReads(t *testing.T) {
+	for at := 1; ; at++ {
+		fs := common.NewFaultInjectionFileSystem(common.NewMemoryFileSystem())
+		manager, err := NewSingleFileBlockManager(fs, crashTestPath, false, true, common.DefaultChecksumType)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		manager.Close()
+
+		if err := writeCheckpoint(fs, 42); err != nil {
+			t.Fatal(err)
+		}
+
+		fs.SetFault(common.ShortRead, at)
+		value, err := readCheckpoint(fs)
+
+		if !fs.Triggered() {
+			if err != nil || value != 42 {
+				t.Errorf("Expect checkpoint 42, got %d (%v)", value, err)
+			}
+
+			break
+		}
+
+		// A short read must surface as an error instead of returning garbage.
+		if !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Short read at %d: expect io.ErrUnexpectedEOF, got %d (%v)", at, value, err)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package storage
+
+import (
+	"github.com/goduckdb/common"
+)
+
+// A DataPointer points to a persisted column segment.
+type DataPointer struct {
+	RowStart   uint64  // The first row of the segment, relative to the start of the row group.
+	TupleCount uint64  // The number of rows in the segment.
+	BlockID    BlockID // The block the segment is stored in.
+	Offset     uint32  // The offset of the segment in the block.
+	// The encoding of the segment. Segments that were written before compression was added are uncompressed.
+	Compression CompressionType
+	// The statistics of the values of the segment, nil for segments that were written before statistics were added.
+	Statistics *BaseStatistics
+	// Whether the values of the segment are tagged, because some values of its column are stored in overflow blocks.
+	Overflow bool
+	// The validity segment of the segment: a BOOLEAN segment that is true for the valid rows, nil if no row is NULL.
+	Validity *DataPointer
+}
+
+func (pointer *DataPointer) Serialize(serializer common.Serializer) error {
+	writer := common.NewFieldWriter(serializer)
+
+	if err := writer.WriteField(1, func(s common.Serializer) error { return s.WriteVarint(pointer.RowStart) }); err != nil {
+		return err
+	}
+
+	if err := writer.WriteField(2, func(s common.Serializer) error { return s.WriteVarint(pointer.TupleCount) }); err != nil {
+		return err
+	}
+
+	if err := writer.WriteField(3, func(s common.Serializer) error { return s.WriteInt64(int64(pointer.BlockID)) }); err != nil {
+		return err
+	}
+
+	err := writer.WriteFieldWithDefault(4, pointer.Offset == 0, func(s common.Serializer) error {
+		return s.WriteUint32(pointer.Offset)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteFieldWithDefault(5, pointer.Compression == CompressionUncompressed, func(s common.Serializer) error {
+		return s.WriteUint8(uint8(pointer.Compression))
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteFieldWithDefault(6, pointer.Statistics == nil, func(s common.Serializer) error {
+		return s.WriteObject(pointer.Statistics)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteFieldWithDefault(7, !pointer.Overflow, func(s common.Serializer) error {
+		return s.WriteBool(pointer.Overflow)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteFieldWithDefault(8, pointer.Validity == nil, func(s common.Serializer) error {
+		return s.WriteObject(pointer.Validity)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return writer.Finalize()
+}
+
+func (pointer *DataPointer) Deserialize(deserializer common.Deserializer) error {
+	reader := common.NewFieldReader(deserializer)
+
+	if err := reader.ReadField(1, func(d common.Deserializer) (err error) {
+		pointer.RowStart, err = d.ReadVarint()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := reader.ReadField(2, func(d common.Deserializer) (err error) {
+		pointer.TupleCount, err = d.ReadVarint()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := reader.ReadField(3, func(d common.Deserializer) error {
+		blockID, err := d.ReadInt64()
+		pointer.BlockID = BlockID(blockID)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if _, err := reader.ReadFieldWithDefault(4, func(d common.Deserializer) (err error) {
+		pointer.Offset, err = d.ReadUint32()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if _, err := reader.ReadFieldWithDefault(5, func(d common.Deserializer) error {
+		compression, err := d.ReadUint8()
+		pointer.Compression = CompressionType(compression)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if _, err := reader.ReadFieldWithDefault(6, func(d common.Deserializer) error {
+		pointer.Statistics = &BaseStatistics{}
+		return d.ReadObject(pointer.Statistics)
+	}); err != nil {
+		return err
+	}
+
+	if _, err := reader.ReadFieldWithDefault(7, func(d common.Deserializer) (err error) {
+		pointer.Overflow, err = d.ReadBool()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if _, err := reader.ReadFieldWithDefault(8, func(d common.Deserializer) error {
+		pointer.Validity = &DataPointer{}
+		return d.ReadObject(pointer.Validity)
+	}); err != nil {
+		return err
+	}
+
+	return reader.Finalize()
+}
+
+// A RowGroupPointer points to the persisted segments of the columns of a row group.
+type RowGroupPointer struct {
+	RowStart   uint64          // The first row of the row group in the table.
+	TupleCount uint64          // The number of rows in the row group.
+	Columns    [][]DataPointer // The segments of every column, in order of their rows.
+	// The statistics of every column, nil for row groups that were written before statistics were added.
+	Statistics []*BaseStatistics
+	// The chain of overflow blocks of every column, nil if no column has overflow values.
+	OverflowBlocks [][]BlockID
+	// The deleted rows, relative to the start of the row group, in ascending order.
+	Deleted []uint64
+	// The chain of meta blocks that holds the metadata of the segments of every column, such as the symbol tables of
+	// FSST segments, nil if no segment has metadata.
+	MetadataBlocks [][]BlockID
+}
+
+func (pointer *RowGroupPointer) Serialize(serializer common.Serializer) error {
+	writer := common.NewFieldWriter(serializer)
+
+	if err := writer.WriteField(1, func(s common.Serializer) error { return s.WriteVarint(pointer.RowStart) }); err != nil {
+		return err
+	}
+
+	if err := writer.WriteField(2, func(s common.Serializer) error { return s.WriteVarint(pointer.TupleCount) }); err != nil {
+		return err
+	}
+
+	err := writer.WriteField(3, func(s common.Serializer) error {
+		return s.WriteList(len(pointer.Columns), func(i int) error {
+			segments := pointer.Columns[i]
+
+			return s.WriteList(len(segments), func(j int) error { return s.WriteObject(&segments[j]) })
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteFieldWithDefault(4, pointer.Statistics == nil, func(s common.Serializer) error {
+		return s.WriteList(len(pointer.Statistics), func(i int) error { return s.WriteObject(pointer.Statistics[i]) })
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteFieldWithDefault(5, pointer.OverflowBlocks == nil, func(s common.Serializer) error {
+		return s.WriteList(len(pointer.OverflowBlocks), func(i int) error {
+			blocks := pointer.OverflowBlocks[i]
+
+			return s.WriteList(len(blocks), func(j int) error { return s.WriteInt64(int64(blocks[j])) })
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteFieldWithDefault(6, len(pointer.Deleted) == 0, func(s common.Serializer) error {
+		return s.WriteList(len(pointer.Deleted), func(i int) error { return s.WriteVarint(pointer.Deleted[i]) })
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteFieldWithDefault(7, pointer.MetadataBlocks == nil, func(s common.Serializer) error {
+		return s.WriteList(len(pointer.MetadataBlocks), func(i int) error {
+			blocks := pointer.MetadataBlocks[i]
+
+			return s.WriteList(len(blocks), func(j int) error { return s.WriteInt64(int64(blocks[j])) })
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return writer.Finalize()
+}
+
+func (pointer *RowGroupPointer) Deserialize(deserializer common.Deserializer) error {
+	reader := common.NewFieldReader(deserializer)
+
+	if err := reader.ReadField(1, func(d common.Deserializer) (err error) {
+		pointer.RowStart, err = d.ReadVarint()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := reader.ReadField(2, func(d common.Deserializer) (err error) {
+		pointer.TupleCount, err = d.ReadVarint()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	err := reader.ReadField(3, func(d common.Deserializer) error {
+		pointer.Columns = nil
+
+		return d.ReadList(func(int) error {
+			var segments []DataPointer
+
+			err := d.ReadList(func(int) error {
+				segments = append(segments, DataPointer{})
+				return d.ReadObject(&segments[len(segments)-1])
+			})
+
+			pointer.Columns = append(pointer.Columns, segments)
+
+			return err
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = reader.ReadFieldWithDefault(4, func(d common.Deserializer) error {
+		pointer.Statistics = nil
+
+		return d.ReadList(func(int) error {
+			stats := &BaseStatistics{}
+			pointer.Statistics = append(pointer.Statistics, stats)
+
+			return d.ReadObject(stats)
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = reader.ReadFieldWithDefault(5, func(d common.Deserializer) error {
+		pointer.OverflowBlocks = nil
+
+		return d.ReadList(func(int) error {
+			var blocks []BlockID
+
+			err := d.ReadList(func(int) error {
+				blockID, err := d.ReadInt64()
+				blocks = append(blocks, BlockID(blockID))
+
+				return err
+			})
+
+			pointer.OverflowBlocks = append(pointer.OverflowBlocks, blocks)
+
+			return err
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = reader.ReadFieldWithDefault(6, func(d common.Deserializer) error {
+		pointer.Deleted = nil
+
+		return d.ReadList(func(int) error {
+			row, err := d.ReadVarint()
+			pointer.Deleted = append(pointer.Deleted, row)
+
+			return err
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = reader.ReadFieldWithDefault(7, func(d common.Deserializer) error {
+		pointer.MetadataBlocks = nil
+
+		return d.ReadList(func(int) error {
+			var blocks []BlockID
+
+			err := d.ReadList(func(int) error {
+				blockID, err := d.ReadInt64()
+				blocks = append(blocks, BlockID(blockID))
+
+				return err
+			})
+
+			pointer.MetadataBlocks = append(pointer.MetadataBlocks, blocks)
+
+			return err
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return reader.Finalize()
+}
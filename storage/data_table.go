@@ -0,0 +1,527 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/goduckdb/common"
+)
+
+// The DataTable holds the data of a table as a list of row groups. Rows are appended to the last row group until it
+// holds RowGroupSize rows; appended rows are kept in memory until they are persisted by the next checkpoint. Changes
+// are written to the write-ahead log before they are applied, so that they are not lost if the database crashes before
+// the next checkpoint.
+type DataTable struct {
+	lock          sync.RWMutex // Held for reading by scans, and for writing by changes and checkpoints.
+	info          *TableInfo
+	bufferManager *BufferManager
+	transactions  *transactionManager // The manager of the transactions that change the table.
+	readOnly      bool
+	dropped       bool // Whether the table has been dropped, after which it cannot be read or changed.
+	rowGroups     []*RowGroup
+	count         uint64 // The number of rows in the table, including deleted rows.
+	deletedCount  uint64 // The number of deleted rows.
+}
+
+func newDataTable(info *TableInfo, bufferManager *BufferManager, readOnly bool) *DataTable {
+	return &DataTable{info: info, bufferManager: bufferManager, readOnly: readOnly}
+}
+
+// Create a DataTable from the pointers to its persisted row groups.
+func newPersistentDataTable(info *TableInfo, pointers []RowGroupPointer, bufferManager *BufferManager,
+	readOnly bool) (*DataTable, error) {
+	table := newDataTable(info, bufferManager, readOnly)
+	types := info.Types()
+
+	for _, pointer := range pointers {
+		if pointer.RowStart != table.count || pointer.TupleCount == 0 || pointer.TupleCount > RowGroupSize {
+			return nil, common.NewSerializationError(fmt.Sprintf("table %q has an invalid row group of %d rows at row %d",
+				info.Name, pointer.TupleCount, pointer.RowStart))
+		}
+
+		rowGroup, err := newPersistentRowGroup(pointer, types)
+
+		if err != nil {
+			return nil, err
+		}
+
+		table.rowGroups = append(table.rowGroups, rowGroup)
+		table.count += rowGroup.Count()
+		table.deletedCount += rowGroup.DeletedCount()
+	}
+
+	return table, nil
+}
+
+func (table *DataTable) Info() *TableInfo {
+	return table.info
+}
+
+// The number of rows in the table that have not been deleted.
+func (table *DataTable) Count() uint64 {
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+
+	return table.count - table.deletedCount
+}
+
+// Append the rows of the chunk, which must have a column of the matching type for every column of the table.
+func (table *DataTable) Append(chunk *common.DataChunk) error {
+	if table.readOnly {
+		return errors.New("cannot append to a table of a read-only database")
+	}
+
+	_, err := table.commit(&walInsert{table: table.info.Name, chunk: chunk})
+
+	return err
+}
+
+// Delete the rows with the given row numbers. Row numbers are not reused: the rows that follow keep their row numbers,
+// and appended rows get new row numbers. Returns the number of rows that were deleted, which excludes rows that had
+// already been deleted.
+func (table *DataTable) Delete(rows []uint64) (uint64, error) {
+	if table.readOnly {
+		return 0, errors.New("cannot delete from a table of a read-only database")
+	}
+
+	return table.commit(&walDelete{table: table.info.Name, rows: rows})
+}
+
+// Replace the values of the given columns of the rows with the given row numbers. The chunk has a column for every
+// updated column, and a row for every updated row. The rows must not have been deleted.
+func (table *DataTable) Update(columnIDs []int, rows []uint64, chunk *common.DataChunk) error {
+	if table.readOnly {
+		return errors.New("cannot update a table of a read-only database")
+	}
+
+	_, err := table.commit(&walUpdate{table: table.info.Name, columnIDs: columnIDs, rows: rows, chunk: chunk})
+
+	return err
+}
+
+// Commit the change in a transaction of its own. Returns the number of rows that were changed.
+func (table *DataTable) commit(record walRecord) (uint64, error) {
+	tx := table.transactions.begin()
+
+	if err := tx.add(table, record); err != nil {
+		return 0, err
+	}
+
+	counts, err := tx.commit()
+
+	if err != nil {
+		return 0, err
+	}
+
+	return counts[0], nil
+}
+
+// The changes of a transaction to a table that have been verified, but have not been applied yet.
+type pendingChanges struct {
+	appended uint64              // The number of appended rows.
+	deleted  map[uint64]struct{} // The deleted rows.
+}
+
+// Verify that the change can be applied to the table after the pending changes, and add it to them. Called with the
+// lock held.
+func (table *DataTable) verifyChange(record walRecord, pending *pendingChanges) error {
+	switch record := record.(type) {
+	case *walInsert:
+		if err := table.verifyChunk(record.chunk); err != nil {
+			return err
+		}
+
+		pending.appended += uint64(record.chunk.Len())
+
+		return nil
+	case *walDelete:
+		if err := table.verifyRows(record.rows, false, pending); err != nil {
+			return err
+		}
+
+		if pending.deleted == nil {
+			pending.deleted = make(map[uint64]struct{})
+		}
+
+		for _, row := range record.rows {
+			pending.deleted[row] = struct{}{}
+		}
+
+		return nil
+	case *walUpdate:
+		types, err := table.columnTypes(record.columnIDs)
+
+		if err != nil {
+			return err
+		}
+
+		if len(record.chunk.Columns) != len(types) || record.chunk.Len() != len(record.rows) {
+			return fmt.Errorf("cannot update %d columns of %d rows of table %q with %d columns of %d values",
+				len(types), len(record.rows), table.info.Name, len(record.chunk.Columns), record.chunk.Len())
+		}
+
+		for i, typ := range types {
+			if record.chunk.Columns[i].Type() != typ {
+				return fmt.Errorf("column %q of table %q has type %s, but a %s value was supplied",
+					table.info.Columns[record.columnIDs[i]].Name, table.info.Name, typ, record.chunk.Columns[i].Type())
+			}
+		}
+
+		if err := record.chunk.Verify(); err != nil {
+			return err
+		}
+
+		return table.verifyRows(record.rows, true, pending)
+	default:
+		panic(fmt.Sprintf("Cannot apply a %s change to a table", record.walType()))
+	}
+}
+
+// Verify that the table has rows with the given row numbers after the pending changes, which must not have been
+// deleted if live is set. Called with the lock held.
+func (table *DataTable) verifyRows(rows []uint64, live bool, pending *pendingChanges) error {
+	for _, row := range rows {
+		if row >= table.count+pending.appended {
+			return fmt.Errorf("table %q does not have a row %d", table.info.Name, row)
+		}
+
+		if !live {
+			continue
+		}
+
+		_, deleted := pending.deleted[row]
+
+		if row < table.count {
+			rowGroup := table.findRowGroup(row)
+			deleted = deleted || rowGroup.IsDeleted(row-rowGroup.Start())
+		}
+
+		if deleted {
+			return fmt.Errorf("row %d of table %q has been deleted", row, table.info.Name)
+		}
+	}
+
+	return nil
+}
+
+// Apply a verified change, and return the number of rows that were changed. Called with the lock held.
+func (table *DataTable) applyChange(record walRecord) uint64 {
+	switch record := record.(type) {
+	case *walInsert:
+		table.append(record.chunk)
+		return uint64(record.chunk.Len())
+	case *walDelete:
+		return table.delete(record.rows)
+	case *walUpdate:
+		for i, row := range record.rows {
+			rowGroup := table.findRowGroup(row)
+
+			for j, columnID := range record.columnIDs {
+				rowGroup.columns[columnID].update(row-rowGroup.Start(), record.chunk.Columns[j].Value(i))
+			}
+		}
+
+		return uint64(len(record.rows))
+	default:
+		panic(fmt.Sprintf("Cannot apply a %s change to a table", record.walType()))
+	}
+}
+
+func (table *DataTable) append(chunk *common.DataChunk) {
+	types := table.info.Types()
+
+	for offset := 0; offset < chunk.Len(); {
+		if len(table.rowGroups) == 0 || table.rowGroups[len(table.rowGroups)-1].Count() == RowGroupSize {
+			table.rowGroups = append(table.rowGroups, newRowGroup(table.count, types))
+		}
+
+		rowGroup := table.rowGroups[len(table.rowGroups)-1]
+		end := minInt(chunk.Len(), offset+int(RowGroupSize-rowGroup.Count()))
+		rowGroup.append(chunk, offset, end)
+		table.count += uint64(end - offset)
+		offset = end
+	}
+}
+
+func (table *DataTable) delete(rows []uint64) uint64 {
+	deleted := uint64(0)
+
+	for _, row := range rows {
+		rowGroup := table.findRowGroup(row)
+
+		if rowGroup.delete(row - rowGroup.Start()) {
+			deleted++
+		}
+	}
+
+	table.deletedCount += deleted
+
+	return deleted
+}
+
+// The row group that holds the row, which must exist.
+func (table *DataTable) findRowGroup(row uint64) *RowGroup {
+	index := sort.Search(len(table.rowGroups), func(i int) bool {
+		return table.rowGroups[i].Start()+table.rowGroups[i].Count() > row
+	})
+
+	return table.rowGroups[index]
+}
+
+func (table *DataTable) verifyChunk(chunk *common.DataChunk) error {
+	if len(chunk.Columns) != len(table.info.Columns) {
+		return fmt.Errorf("table %q has %d columns, but %d values were supplied", table.info.Name,
+			len(table.info.Columns), len(chunk.Columns))
+	}
+
+	for i, column := range table.info.Columns {
+		if chunk.Columns[i].Type() != column.Type {
+			return fmt.Errorf("column %q of table %q has type %s, but a %s value was supplied", column.Name,
+				table.info.Name, column.Type, chunk.Columns[i].Type())
+		}
+	}
+
+	return chunk.Verify()
+}
+
+// Scan the given columns of the table: callback is called with chunks of at most common.StandardVectorSize rows, in
+// order of the rows. The chunk is reused for the next call, so it must not be retained by the callback. The table is
+// locked for reading during the scan, so the callback must not modify the table.
+func (table *DataTable) Scan(columnIDs []int, callback func(chunk *common.DataChunk) error) error {
+	return table.ScanWithFilters(columnIDs, nil, callback)
+}
+
+// Scan the given columns of the rows that match all filters, like Scan. Deleted rows are skipped. Row groups and
+// segments whose statistics prove that none of their rows match are skipped without reading them; the filters are
+// evaluated for the remaining rows before the columns are scanned, and chunks without matching rows are skipped.
+func (table *DataTable) ScanWithFilters(columnIDs []int, filters []TableFilter,
+	callback func(chunk *common.DataChunk) error) error {
+	types, err := table.columnTypes(columnIDs)
+
+	if err != nil {
+		return err
+	}
+
+	for i := range filters {
+		if err := filters[i].verify(table.info); err != nil {
+			return err
+		}
+	}
+
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+
+	// The blocks of a dropped table have been freed, and may have been reused.
+	if table.dropped {
+		return fmt.Errorf("table %q has been dropped", table.info.Name)
+	}
+
+	chunk := common.NewDataChunk(types, common.StandardVectorSize)
+	selection := make([]bool, common.StandardVectorSize)
+
+	for _, rowGroup := range table.rowGroups {
+		if !rowGroup.mayMatch(filters) {
+			continue
+		}
+
+		for start := uint64(0); start < rowGroup.Count(); start += common.StandardVectorSize {
+			end := start + common.StandardVectorSize
+
+			if end > rowGroup.Count() {
+				end = rowGroup.Count()
+			}
+
+			selected := int(end - start)
+
+			if len(filters) > 0 || rowGroup.DeletedCount() > 0 {
+				selection = selection[:end-start]
+				rowGroup.selectRows(start, end, selection)
+
+				if err := rowGroup.filter(table.bufferManager, filters, start, end, selection); err != nil {
+					return err
+				}
+
+				if selected = selectionCount(selection); selected == 0 {
+					continue
+				}
+			}
+
+			chunk.Reset()
+
+			if err := rowGroup.scan(table.bufferManager, columnIDs, start, end, chunk); err != nil {
+				return err
+			}
+
+			if selected < int(end-start) {
+				chunk.Filter(selection)
+			}
+
+			if err := callback(chunk); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Fetch the given columns of the rows with the given row numbers, in the order of the rows. Only the segments that
+// hold the rows are decompressed, so fetching a few rows is much cheaper than a scan. The rows must not have been
+// deleted.
+func (table *DataTable) Fetch(columnIDs []int, rows []uint64) (*common.DataChunk, error) {
+	types, err := table.columnTypes(columnIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+
+	if table.dropped {
+		return nil, fmt.Errorf("table %q has been dropped", table.info.Name)
+	}
+
+	chunk := common.NewDataChunk(types, len(rows))
+
+	for _, row := range rows {
+		if row >= table.count {
+			return nil, fmt.Errorf("table %q does not have a row %d", table.info.Name, row)
+		}
+
+		rowGroup := table.findRowGroup(row)
+		offset := row - rowGroup.Start()
+
+		if rowGroup.IsDeleted(offset) {
+			return nil, fmt.Errorf("row %d of table %q has been deleted", row, table.info.Name)
+		}
+
+		if err := rowGroup.scan(table.bufferManager, columnIDs, offset, offset+1, chunk); err != nil {
+			return nil, err
+		}
+	}
+
+	return chunk, nil
+}
+
+// The statistics of a column of the table, or nil if they are not known (for tables that were persisted before
+// statistics were added, and after rows have been updated, until they are checkpointed).
+func (table *DataTable) Statistics(columnID int) (*BaseStatistics, error) {
+	if _, err := table.columnTypes([]int{columnID}); err != nil {
+		return nil, err
+	}
+
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+
+	result := NewBaseStatistics(table.info.Columns[columnID].Type)
+
+	for _, rowGroup := range table.rowGroups {
+		stats := rowGroup.Column(columnID).Statistics()
+
+		if stats == nil {
+			return nil, nil
+		}
+
+		result.Merge(stats)
+	}
+
+	return result, nil
+}
+
+// Estimate the number of rows that match all filters from the statistics of the row groups, assuming that the filters
+// are independent.
+func (table *DataTable) EstimateCardinality(filters []TableFilter) (uint64, error) {
+	for i := range filters {
+		if err := filters[i].verify(table.info); err != nil {
+			return 0, err
+		}
+	}
+
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+
+	estimate := 0.0
+
+	for _, rowGroup := range table.rowGroups {
+		rows := float64(rowGroup.Count() - rowGroup.DeletedCount())
+
+		for i := range filters {
+			if stats := rowGroup.Column(filters[i].ColumnID).Statistics(); stats != nil {
+				rows *= stats.Selectivity(&filters[i])
+			} else {
+				rows *= defaultSelectivity
+			}
+		}
+
+		estimate += rows
+	}
+
+	return uint64(math.Round(estimate)), nil
+}
+
+// The types of the given columns.
+func (table *DataTable) columnTypes(columnIDs []int) ([]common.TypeID, error) {
+	types := make([]common.TypeID, len(columnIDs))
+
+	for i, columnID := range columnIDs {
+		if columnID < 0 || columnID >= len(table.info.Columns) {
+			return nil, fmt.Errorf("table %q does not have a column %d", table.info.Name, columnID)
+		}
+
+		types[i] = table.info.Columns[columnID].Type
+	}
+
+	return types, nil
+}
+
+// The row groups of the table.
+func (table *DataTable) RowGroups() []*RowGroup {
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+
+	return table.rowGroups
+}
+
+// Whether rows have been appended, updated or deleted since the table was last persisted.
+func (table *DataTable) dirty() bool {
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+
+	for _, rowGroup := range table.rowGroups {
+		if rowGroup.dirty() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The blocks the persisted segments of the table are stored in.
+func (table *DataTable) blocks() []BlockID {
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+
+	var blocks []BlockID
+
+	for _, rowGroup := range table.rowGroups {
+		blocks = append(blocks, rowGroup.blocks()...)
+	}
+
+	return blocks
+}
+
+// Replace the blocks of the segments that have been moved to a different block.
+func (table *DataTable) relocateBlocks(relocated map[BlockID]BlockID) {
+	table.lock.Lock()
+	defer table.lock.Unlock()
+
+	for _, rowGroup := range table.rowGroups {
+		for _, column := range rowGroup.columns {
+			column.relocateBlocks(relocated)
+		}
+	}
+}
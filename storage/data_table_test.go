@@ -0,0 +1,732 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/goduckdb/common"
+)
+
+var testTableInfo = TableInfo{
+	Name: "measurements",
+	Columns: []ColumnDefinition{
+		{Name: "id", Type: common.BigInt},
+		{Name: "valid", Type: common.Boolean},
+		{Name: "small", Type: common.SmallInt},
+		{Name: "value", Type: common.Double},
+		{Name: "name", Type: common.Varchar},
+		{Name: "payload", Type: common.Blob},
+	},
+}
+
+// Create a chunk with the rows [start, end) of the test table.
+func testChunk(start int, end int) *common.DataChunk {
+	chunk := common.NewDataChunk(testTableInfo.Types(), end-start)
+
+	for i := start; i < end; i++ {
+		chunk.Columns[0].Append(int64(i))
+		chunk.Columns[1].Append(i%3 == 0)
+		chunk.Columns[2].Append(int16(i % 1000))
+		chunk.Columns[3].Append(float64(i) / 4)
+		chunk.Columns[4].Append(fmt.Sprintf("name-%d", i%100))
+		chunk.Columns[5].Append([]byte{byte(i), byte(i >> 8)})
+	}
+
+	return chunk
+}
+
+func openTestStorage(t *testing.T, fs common.FileSystem, path string) *StorageManager {
+	storageManager := NewStorageManager(fs, path, DefaultOptions())
+
+	if err := storageManager.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	return storageManager
+}
+
+// Verify that the table holds exactly the rows [0, count) of the test table.
+func verifyTestTable(t *testing.T, table *DataTable, count int) {
+	t.Helper()
+
+	if table.Count() != uint64(count) {
+		t.Fatalf("Expect %d rows, got %d", count, table.Count())
+	}
+
+	row := 0
+	err := table.Scan([]int{0, 1, 2, 3, 4, 5}, func(chunk *common.DataChunk) error {
+		expected := testChunk(row, row+chunk.Len())
+
+		for i := range chunk.Columns {
+			if !reflect.DeepEqual(chunk.Columns[i].Data(), expected.Columns[i].Data()) {
+				return fmt.Errorf("column %d of rows [%d, %d) differs", i, row, row+chunk.Len())
+			}
+		}
+
+		row += chunk.Len()
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if row != count {
+		t.Fatalf("Expect to scan %d rows, got %d", count, row)
+	}
+}
+
+func TestDataTableAppendAndScan(t *testing.T) {
+	storageManager := openTestStorage(t, common.NewMemoryFileSystem(), InMemoryPath)
+	defer storageManager.Close()
+
+	info := testTableInfo
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := RowGroupSize + 1000
+
+	for start := 0; start < count; start += 5000 {
+		if err := table.Append(testChunk(start, minInt(start+5000, count))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if rowGroups := table.RowGroups(); len(rowGroups) != 2 || rowGroups[1].Start() != RowGroupSize {
+		t.Errorf("Expect 2 row groups, the second starting at row %d", RowGroupSize)
+	}
+
+	verifyTestTable(t, table, count)
+
+	// Only the scanned columns are returned, in the requested order.
+	var names []string
+	err = table.Scan([]int{4, 0}, func(chunk *common.DataChunk) error {
+		if len(chunk.Columns) != 2 || chunk.Columns[1].Type() != common.BigInt {
+			return fmt.Errorf("unexpected columns %v", chunk.Types())
+		}
+
+		names = append(names, chunk.Columns[0].Data().([]string)...)
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(names) != count || names[123] != "name-23" {
+		t.Errorf("Expect %d names, got %d", count, len(names))
+	}
+
+	if err := table.Append(common.NewDataChunk([]common.TypeID{common.BigInt}, 0)); err == nil {
+		t.Errorf("Expect a chunk with the wrong columns to be rejected")
+	}
+
+	if _, err := storageManager.CreateTable(&info); err == nil {
+		t.Errorf("Expect a table with a duplicate name to be rejected")
+	}
+}
+
+func TestDataTableScanWithFilters(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	storageManager := openTestStorage(t, fs, "/filters.db")
+	defer storageManager.Close()
+
+	info := testTableInfo
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The filters are evaluated on both persisted segments and transient rows.
+	if err := table.Append(testChunk(0, 10000)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.Append(testChunk(10000, 12000)); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int64
+	filters := []TableFilter{
+		{ColumnID: 4, Comparison: CompareEqual, Constant: "name-42"},
+		{ColumnID: 0, Comparison: CompareGreaterThanOrEqual, Constant: int64(5000)},
+		{ColumnID: 3, Comparison: CompareLessThan, Constant: float64(2900)},
+	}
+	err = table.ScanWithFilters([]int{0, 4}, filters, func(chunk *common.DataChunk) error {
+		ids = append(ids, chunk.Columns[0].Data().([]int64)...)
+
+		for _, name := range chunk.Columns[1].Data().([]string) {
+			if name != "name-42" {
+				return fmt.Errorf("unexpected name %q", name)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected []int64
+
+	for i := int64(5042); i < 11600; i += 100 {
+		expected = append(expected, i)
+	}
+
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Expect the rows %v, got %v", expected, ids)
+	}
+
+	chunk, err := table.Fetch([]int{4, 0}, []uint64{11999, 3, 10000})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(chunk.Columns[0].Data(), []string{"name-99", "name-3", "name-0"}) ||
+		!reflect.DeepEqual(chunk.Columns[1].Data(), []int64{11999, 3, 10000}) {
+		t.Errorf("Expect the fetched rows in order, got %v and %v", chunk.Columns[0].Data(), chunk.Columns[1].Data())
+	}
+
+	if _, err := table.Fetch([]int{0}, []uint64{12000}); err == nil {
+		t.Errorf("Expect fetching a row past the end of the table to fail")
+	}
+
+	if err := table.ScanWithFilters([]int{0}, []TableFilter{{ColumnID: 0, Constant: int32(1)}},
+		func(*common.DataChunk) error { return nil }); err == nil {
+		t.Errorf("Expect a filter with a constant of the wrong type to be rejected")
+	}
+}
+
+func TestDataTableDelete(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/delete.db"
+	storageManager := openTestStorage(t, fs, path)
+	info := testTableInfo
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.Append(testChunk(0, RowGroupSize+100)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Delete a persisted row, a row of the second row group, and a row twice.
+	if deleted, err := table.Delete([]uint64{7, RowGroupSize + 5, 7}); err != nil || deleted != 2 {
+		t.Fatalf("Expect 2 rows to be deleted, got %d: %v", deleted, err)
+	}
+
+	if _, err := table.Delete([]uint64{RowGroupSize + 100}); err == nil {
+		t.Errorf("Expect deleting a row past the end of the table to fail")
+	}
+
+	if _, err := table.Fetch([]int{0}, []uint64{7}); err == nil {
+		t.Errorf("Expect fetching a deleted row to fail")
+	}
+
+	// The deletes are persisted, the rows that follow keep their row numbers.
+	if err := storageManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	storageManager = openTestStorage(t, fs, path)
+	defer storageManager.Close()
+
+	table = storageManager.GetTable(info.Name)
+
+	if table.Count() != RowGroupSize+98 {
+		t.Errorf("Expect %d rows, got %d", RowGroupSize+98, table.Count())
+	}
+
+	var ids []int64
+	err = table.ScanWithFilters([]int{0}, []TableFilter{{ColumnID: 0, Comparison: CompareLessThan, Constant: int64(10)}},
+		func(chunk *common.DataChunk) error {
+			ids = append(ids, chunk.Columns[0].Data().([]int64)...)
+			return nil
+		})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(ids, []int64{0, 1, 2, 3, 4, 5, 6, 8, 9}) {
+		t.Errorf("Expect the deleted row to be skipped, got %v", ids)
+	}
+
+	chunk, err := table.Fetch([]int{0}, []uint64{8, RowGroupSize + 6})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(chunk.Columns[0].Data(), []int64{8, RowGroupSize + 6}) {
+		t.Errorf("Expect the rows after the deleted rows to keep their row numbers, got %v", chunk.Columns[0].Data())
+	}
+}
+
+func TestDataTableUpdate(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/update.db"
+	storageManager := openTestStorage(t, fs, path)
+	info := testTableInfo
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.Append(testChunk(0, 1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.Append(testChunk(1000, 1100)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Update a persisted row and a row that is kept in memory, one of them to NULL.
+	values := common.NewDataChunk([]common.TypeID{common.Double, common.Varchar}, 2)
+	values.Columns[0].Append(-1.0)
+	values.Columns[0].Append(nil)
+	values.Columns[1].Append("updated")
+	values.Columns[1].Append("updated")
+
+	if err := table.Update([]int{3, 4}, []uint64{10, 1050}, values); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := table.Delete([]uint64{20}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.Update([]int{3, 4}, []uint64{20, 30}, values); err == nil {
+		t.Errorf("Expect updating a deleted row to fail")
+	}
+
+	if err := table.Update([]int{4, 3}, []uint64{30, 40}, values); err == nil {
+		t.Errorf("Expect updating a column with values of another type to fail")
+	}
+
+	verify := func() {
+		t.Helper()
+
+		chunk, err := table.Fetch([]int{0, 3, 4}, []uint64{10, 11, 1050})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if chunk.Columns[1].Value(0) != -1.0 || chunk.Columns[2].Value(0) != "updated" ||
+			chunk.Columns[1].Value(1) != 11.0/4 || chunk.Columns[2].Value(1) != "name-11" ||
+			chunk.Columns[1].Value(2) != nil || chunk.Columns[2].Value(2) != "updated" {
+			t.Errorf("Expect the updated values, got %v and %v", chunk.Columns[1].Data(), chunk.Columns[2].Data())
+		}
+
+		var ids []int64
+		filter := TableFilter{ColumnID: 4, Comparison: CompareEqual, Constant: "updated"}
+		err = table.ScanWithFilters([]int{0}, []TableFilter{filter}, func(chunk *common.DataChunk) error {
+			ids = append(ids, chunk.Columns[0].Data().([]int64)...)
+			return nil
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(ids, []int64{10, 1050}) {
+			t.Errorf("Expect the updated rows to match the filter, got %v", ids)
+		}
+	}
+
+	verify()
+
+	// The updates are persisted by the next checkpoint, which computes the statistics again.
+	if stats, err := table.Statistics(3); err != nil || stats != nil {
+		t.Errorf("Expect the statistics of an updated column to be unknown, got %v: %v", stats, err)
+	}
+
+	if err := storageManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	storageManager = openTestStorage(t, fs, path)
+	defer storageManager.Close()
+	table = storageManager.GetTable(info.Name)
+	verify()
+
+	if stats, err := table.Statistics(3); err != nil || stats.Min != -1.0 || stats.NullCount != 1 {
+		t.Errorf("Expect the statistics to include the updated values, got %+v: %v", stats, err)
+	}
+}
+
+var testNullTableInfo = TableInfo{Name: "nulls", Columns: []ColumnDefinition{
+	{Name: "id", Type: common.BigInt},
+	{Name: "flag", Type: common.Boolean},
+	{Name: "tiny", Type: common.TinyInt},
+	{Name: "small", Type: common.SmallInt},
+	{Name: "integer", Type: common.Integer},
+	{Name: "float", Type: common.Float},
+	{Name: "double", Type: common.Double},
+	{Name: "ts", Type: common.Timestamp},
+	{Name: "name", Type: common.Varchar},
+	{Name: "payload", Type: common.Blob},
+	{Name: "missing", Type: common.Integer},
+}}
+
+// The value of column j of row i of the NULL test table, nil if it is NULL. The id is never NULL, the last column is
+// always NULL, and the value of column j is NULL for every (j+1)th row.
+func testNullValue(j int, i int) interface{} {
+	if j == len(testNullTableInfo.Columns)-1 || (j > 0 && i%(j+1) == 0) {
+		return nil
+	}
+
+	switch testNullTableInfo.Columns[j].Type {
+	case common.Boolean:
+		return i%3 == 0
+	case common.TinyInt:
+		return int8(i)
+	case common.SmallInt:
+		return int16(i)
+	case common.Integer:
+		return int32(i)
+	case common.Float:
+		return float32(i) / 2
+	case common.Double:
+		return float64(i) / 4
+	case common.Varchar:
+		return fmt.Sprintf("name-%d", i%50)
+	case common.Blob:
+		return []byte{byte(i)}
+	default:
+		return int64(i)
+	}
+}
+
+func TestDataTableNullValues(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/nulls.db"
+	storageManager := openTestStorage(t, fs, path)
+	info := testNullTableInfo
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 10000
+	chunk := common.NewDataChunk(info.Types(), count)
+
+	for i := 0; i < count; i++ {
+		for j := range chunk.Columns {
+			chunk.Columns[j].Append(testNullValue(j, i))
+		}
+	}
+
+	if err := table.Append(chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	storageManager = openTestStorage(t, fs, path)
+	defer storageManager.Close()
+	table = storageManager.GetTable(info.Name)
+	columnIDs := make([]int, len(info.Columns))
+
+	for j := range columnIDs {
+		columnIDs[j] = j
+	}
+
+	row := 0
+	err = table.Scan(columnIDs, func(chunk *common.DataChunk) error {
+		for i := 0; i < chunk.Len(); i++ {
+			for j, column := range chunk.Columns {
+				if expected := testNullValue(j, row); !reflect.DeepEqual(column.Value(i), expected) {
+					return fmt.Errorf("expect %v in column %d of row %d, got %v", expected, j, row, column.Value(i))
+				}
+			}
+
+			row++
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if row != count {
+		t.Fatalf("Expect to scan %d rows, got %d", count, row)
+	}
+
+	// A column without NULL values has no validity segments, and the statistics count the NULL values.
+	rowGroup := table.RowGroups()[0]
+
+	for _, segment := range rowGroup.Column(0).Segments() {
+		if segment.DataPointer().Validity != nil {
+			t.Errorf("Expect no validity segment for a column without NULL values")
+		}
+	}
+
+	for j := range info.Columns {
+		stats, err := table.Statistics(j)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := 0
+
+		for i := 0; i < count; i++ {
+			if testNullValue(j, i) == nil {
+				expected++
+			}
+		}
+
+		if stats.NullCount != uint64(expected) {
+			t.Errorf("Expect %d NULL values in column %d, got %d", expected, j, stats.NullCount)
+		}
+	}
+
+	// NULL values do not match any filter, not even one for the value they are stored as.
+	for _, test := range []struct {
+		filter   TableFilter
+		expected int
+	}{
+		{TableFilter{ColumnID: 4, Comparison: CompareLessThan, Constant: int32(10)}, 8},
+		{TableFilter{ColumnID: 8, Comparison: CompareEqual, Constant: ""}, 0},
+		{TableFilter{ColumnID: 8, Comparison: CompareNotEqual, Constant: "name-1"}, 8710},
+		{TableFilter{ColumnID: 10, Comparison: CompareEqual, Constant: int32(0)}, 0},
+	} {
+		rows := 0
+		err := table.ScanWithFilters([]int{0}, []TableFilter{test.filter}, func(chunk *common.DataChunk) error {
+			rows += chunk.Len()
+			return nil
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rows != test.expected {
+			t.Errorf("Expect %d rows to match %v, got %d", test.expected, test.filter, rows)
+		}
+	}
+}
+
+func TestDataTableCheckpoint(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/table.db"
+	storageManager := openTestStorage(t, fs, path)
+	info := testTableInfo
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.Append(testChunk(0, 10000)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments := table.RowGroups()[0].Column(0).Segments()
+
+	if len(segments) != 1 || segments[0].Count() != 10000 {
+		t.Fatalf("Expect the rows to be persisted in a single segment")
+	}
+
+	// Rows that are appended to a persisted row group are persisted by the next checkpoint, on close.
+	if err := table.Append(testChunk(10000, RowGroupSize+10)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	storageManager = openTestStorage(t, fs, path)
+	table = storageManager.GetTable(info.Name)
+
+	if table == nil {
+		t.Fatalf("Expect table %q to be loaded", info.Name)
+	}
+
+	if !reflect.DeepEqual(*table.Info(), testTableInfo) {
+		t.Errorf("Expect the table definition to be loaded, got %+v", table.Info())
+	}
+
+	verifyTestTable(t, table, RowGroupSize+10)
+
+	if segments := table.RowGroups()[0].Column(5).Segments(); len(segments) < 2 {
+		t.Errorf("Expect a full row group of BLOB values to span multiple segments")
+	}
+
+	if err := storageManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDropTableFreesBlocks(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/drop.db"
+	storageManager := openTestStorage(t, fs, path)
+	defer storageManager.Close()
+
+	for _, name := range []string{"a", "b"} {
+		info := testTableInfo
+		info.Name = name
+		table, err := storageManager.CreateTable(&info)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := table.Append(testChunk(0, 100000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := storageManager.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	blocksBefore := fileBlockCount(t, fs, storageManager.BlockManager())
+
+	dropped := storageManager.GetTable("b")
+
+	if err := storageManager.DropTable("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The blocks of the dropped table can be reused, so it cannot be read any longer.
+	if err := dropped.Scan([]int{0}, func(*common.DataChunk) error { return nil }); err == nil {
+		t.Errorf("Expect scanning a dropped table to fail")
+	}
+
+	if _, err := dropped.Fetch([]int{0}, []uint64{0}); err == nil {
+		t.Errorf("Expect fetching from a dropped table to fail")
+	}
+
+	if err := storageManager.DropTable("b"); err == nil {
+		t.Errorf("Expect dropping a table that does not exist to fail")
+	}
+
+	// The blocks of the dropped table are free after the first checkpoint, and truncated by the second.
+	for i := 0; i < 2; i++ {
+		if err := storageManager.Checkpoint(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if blocksAfter := fileBlockCount(t, fs, storageManager.BlockManager()); blocksAfter >= blocksBefore {
+		t.Errorf("Expect the file to shrink after dropping a table, got %d blocks before and %d after",
+			blocksBefore, blocksAfter)
+	}
+
+	verifyTestTable(t, storageManager.GetTable("a"), 100000)
+}
+
+func TestVacuumTables(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/vacuum.db"
+	storageManager := openTestStorage(t, fs, path)
+	defer storageManager.Close()
+
+	for _, name := range []string{"a", "b"} {
+		info := testTableInfo
+		info.Name = name
+		table, err := storageManager.CreateTable(&info)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := table.Append(testChunk(0, 100000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := storageManager.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Dropping the table that was written first leaves free blocks in front of the blocks of the remaining table.
+	if err := storageManager.DropTable("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	blocksBefore := fileBlockCount(t, fs, storageManager.BlockManager())
+
+	if err := storageManager.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+
+	if blocksAfter := fileBlockCount(t, fs, storageManager.BlockManager()); blocksAfter >= blocksBefore {
+		t.Errorf("Expect the file to shrink after a vacuum, got %d blocks before and %d after", blocksBefore, blocksAfter)
+	}
+
+	verifyTestTable(t, storageManager.GetTable("b"), 100000)
+}
+
+func TestPersistentTableDataRoundTrip(t *testing.T) {
+	data := PersistentTableData{
+		Info: testTableInfo,
+		RowGroups: []RowGroupPointer{{
+			RowStart:   0,
+			TupleCount: 3,
+			Columns:    make([][]DataPointer, len(testTableInfo.Columns)),
+		}},
+	}
+
+	for i := range data.RowGroups[0].Columns {
+		data.RowGroups[0].Columns[i] = []DataPointer{{TupleCount: 3, BlockID: BlockID(i), Offset: uint32(i * 8)}}
+	}
+
+	serializer := common.NewBufferedSerializer()
+
+	if err := serializer.WriteObject(&data); err != nil {
+		t.Fatal(err)
+	}
+
+	var result PersistentTableData
+
+	if err := common.NewBufferedDeserializer(serializer.Data()).ReadObject(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(result, data) {
+		t.Errorf("Expect %+v, got %+v", data, result)
+	}
+}
@@ -0,0 +1,43 @@
+package storage
+
+import "fmt"
+
+// A VersionMismatchError is returned when a database file was written with a storage version that this version of
+// goduckdb cannot read.
+type VersionMismatchError struct {
+	Path     string // The path of the database file.
+	Version  uint64 // The version number stored in the MainHeader of the file.
+	Expected uint64 // The version number that can be read.
+}
+
+func (e *VersionMismatchError) Error() string {
+	if GetStorageCapability(e.Version) == StorageReadOnly {
+		return fmt.Sprintf("Database file %q has version number %d, which can only be opened in read-only mode: migrate "+
+			"it to version %d with MigrateDatabase to write it", e.Path, e.Version, e.Expected)
+	}
+
+	return fmt.Sprintf("Trying to read database file %q with version number %d, but we can only read version %d",
+		e.Path, e.Version, e.Expected)
+}
+
+// A NotDatabaseError is returned when a file that is opened as a database file is not a database file: it is too
+// small to hold the headers, or its MainHeader does not start with the MagicBytes.
+type NotDatabaseError struct {
+	Path string // The path of the file.
+}
+
+func (e *NotDatabaseError) Error() string {
+	return fmt.Sprintf("The file %q is not a valid database file", e.Path)
+}
+
+// An OutOfMemoryError is returned when a block cannot be loaded or allocated, because that would exceed the memory
+// limit and all blocks in memory are pinned.
+type OutOfMemoryError struct {
+	Requested uint64 // The amount of memory that was requested.
+	Used      uint64 // The amount of memory in use.
+	Limit     uint64 // The memory limit.
+}
+
+func (e *OutOfMemoryError) Error() string {
+	return fmt.Sprintf("Out of Memory Error: could not allocate block of %d bytes (%d/%d used)", e.Requested, e.Used, e.Limit)
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/goduckdb/common"
+)
+
+// InMemoryBlockManager is an implementation for a BlockManager which keeps all blocks in memory. It backs databases that
+// are opened at ":memory:". Blocks are stored in a file of an in-memory file system, so they are checksummed and
+// verified exactly like the blocks of a SingleFileBlockManager; the DatabaseHeader is kept in memory only.
+type InMemoryBlockManager struct {
+	handle         common.FileHandle    // The handle of the in-memory file the blocks are stored in.
+	blockLock      sync.Mutex           // Protects the free list, the modified blocks and maxBlock.
+	freeList       []BlockID            // The list of free blocks that can be written to currently, in ascending order.
+	modifiedBlocks map[BlockID]struct{} // The blocks that are used by the active header, but are free after the next checkpoint.
+	metaBlock      BlockID              // The current meta block id.
+	maxBlock       BlockID              // The current maximum block id, this id will be given away first after the free_list runs out.
+	iterationCount uint64               // The current header iteration count.
+}
+
+func NewInMemoryBlockManager() (BlockManager, error) {
+	fs := common.NewMemoryFileSystem()
+	handle, err := fs.OpenFile(InMemoryPath, common.WriteOnly|common.Create, common.WriteLock)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &InMemoryBlockManager{
+		handle:         handle,
+		modifiedBlocks: make(map[BlockID]struct{}),
+		metaBlock:      InvalidBlock,
+	}, nil
+}
+
+func (manager *InMemoryBlockManager) CreateBlock() *Block {
+	return NewBlock(manager.GetFreeBlockID())
+}
+
+// Return the id of a block that can be written to: the lowest free block, or a new block, like the
+// SingleFileBlockManager.
+func (manager *InMemoryBlockManager) GetFreeBlockID() BlockID {
+	manager.blockLock.Lock()
+	defer manager.blockLock.Unlock()
+
+	var blockID BlockID
+
+	if len(manager.freeList) > 0 {
+		blockID = manager.freeList[0]
+		manager.freeList = manager.freeList[1:]
+	} else {
+		blockID = manager.maxBlock
+		manager.maxBlock++
+	}
+
+	return blockID
+}
+
+// Mark a block as free right away, it must not be referenced by the active header. Panics on the misuse the
+// SingleFileBlockManager panics on, so that it is also caught by in-memory databases.
+func (manager *InMemoryBlockManager) MarkBlockAsFree(blockID BlockID) {
+	manager.blockLock.Lock()
+	defer manager.blockLock.Unlock()
+
+	if _, ok := manager.modifiedBlocks[blockID]; ok {
+		panic(fmt.Sprintf("Block %d is freed after it has been marked as modified", blockID))
+	}
+
+	manager.freeList = insertBlock(manager.freeList, blockID)
+}
+
+// Mark a block that is referenced by the active header as modified, it is free once the next header is written.
+func (manager *InMemoryBlockManager) MarkBlockAsModified(blockID BlockID) {
+	manager.blockLock.Lock()
+	defer manager.blockLock.Unlock()
+
+	if index := searchBlock(manager.freeList, blockID); index < len(manager.freeList) && manager.freeList[index] == blockID {
+		panic(fmt.Sprintf("Block %d is marked as modified while it is free", blockID))
+	}
+
+	manager.modifiedBlocks[blockID] = struct{}{}
+}
+
+// RelocateBlocks does not move any blocks: the in-memory file is never truncated.
+func (manager *InMemoryBlockManager) RelocateBlocks(blocks []BlockID) (map[BlockID]BlockID, error) {
+	return map[BlockID]BlockID{}, nil
+}
+
+func (manager *InMemoryBlockManager) GetMetaBlock() BlockID {
+	return manager.metaBlock
+}
+
+func (manager *InMemoryBlockManager) Read(block *Block) error {
+	return block.Read(manager.handle, uint64(block.ID*BlockSize), common.DefaultChecksumType)
+}
+
+func (manager *InMemoryBlockManager) Write(block *Block) error {
+	return block.Write(manager.handle, uint64(block.ID*BlockSize), common.DefaultChecksumType)
+}
+
+// WriteHeader only has to remember the new meta block and free the modified blocks: an in-memory database does not
+// survive a restart, so there is no header to persist.
+func (manager *InMemoryBlockManager) WriteHeader(header DatabaseHeader) error {
+	manager.blockLock.Lock()
+	defer manager.blockLock.Unlock()
+
+	manager.iterationCount++
+	manager.metaBlock = header.MetaBlock
+
+	for blockID := range manager.modifiedBlocks {
+		manager.freeList = insertBlock(manager.freeList, blockID)
+	}
+
+	manager.modifiedBlocks = make(map[BlockID]struct{})
+
+	return nil
+}
+
+func (manager *InMemoryBlockManager) Close() error {
+	return manager.handle.Close()
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestInMemoryBlockManager(t *testing.T) {
+	manager, err := NewInMemoryBlockManager()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	blocks := []*Block{manager.CreateBlock(), manager.CreateBlock()}
+
+	for i, block := range blocks {
+		block.Buffer()[0] = byte(i + 1)
+
+		if err := manager.Write(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := manager.WriteHeader(DatabaseHeader{MetaBlock: blocks[1].ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if metaBlock := manager.GetMetaBlock(); metaBlock != blocks[1].ID {
+		t.Errorf("Expect meta block %d, got %d", blocks[1].ID, metaBlock)
+	}
+
+	for i, block := range blocks {
+		result := NewBlock(block.ID)
+
+		if err := manager.Read(result); err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Buffer()[0] != byte(i+1) {
+			t.Errorf("Expect block %d to contain %d, got %d", block.ID, i+1, result.Buffer()[0])
+		}
+	}
+}
+
+func TestInMemoryBlockManagerFreeList(t *testing.T) {
+	manager, err := NewInMemoryBlockManager()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	var blocks []BlockID
+
+	for i := 0; i < 6; i++ {
+		blocks = append(blocks, writeBlock(t, manager, uint64(i)))
+	}
+
+	if err := manager.WriteHeader(DatabaseHeader{MetaBlock: blocks[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Modified blocks are only free after the next header, and the lowest free blocks are reused first.
+	for _, i := range []int{4, 1, 3} {
+		manager.MarkBlockAsModified(blocks[i])
+	}
+
+	if blockID := manager.GetFreeBlockID(); blockID != blocks[5]+1 {
+		t.Errorf("Expect a new block before the next header, got %d", blockID)
+	}
+
+	if err := manager.WriteHeader(DatabaseHeader{MetaBlock: blocks[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range []int{1, 3, 4} {
+		if blockID := manager.GetFreeBlockID(); blockID != blocks[i] {
+			t.Errorf("Expect free block %d to be reused, got %d", blocks[i], blockID)
+		}
+	}
+
+	// Misuse panics like it does for a SingleFileBlockManager.
+	manager.MarkBlockAsFree(blocks[1])
+
+	for name, misuse := range map[string]func(){
+		"freeing a block twice":                      func() { manager.MarkBlockAsFree(blocks[1]) },
+		"marking a free block as modified":           func() { manager.MarkBlockAsModified(blocks[1]) },
+		"freeing a block that is marked as modified": func() { manager.MarkBlockAsModified(blocks[2]); manager.MarkBlockAsFree(blocks[2]) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expect %s to panic", name)
+				}
+			}()
+
+			misuse()
+		}()
+	}
+}
+
+func TestInMemoryBlockManagerConcurrentBlocks(t *testing.T) {
+	manager, err := NewInMemoryBlockManager()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	// Blocks are handed out and freed by many goroutines, e.g. by the BufferManager and a checkpoint.
+	var wg sync.WaitGroup
+	results := make([][]BlockID, 4)
+
+	for i := range results {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				manager.MarkBlockAsFree(manager.GetFreeBlockID())
+				results[i] = append(results[i], manager.GetFreeBlockID())
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	used := make(map[BlockID]bool)
+
+	for i := range results {
+		for _, blockID := range results[i] {
+			if used[blockID] {
+				t.Fatalf("Expect block %d to be handed out once", blockID)
+			}
+
+			used[blockID] = true
+		}
+	}
+}
@@ -4,30 +4,72 @@ import (
 	"encoding/binary"
 	"fmt"
 	"unsafe"
+
+	"github.com/goduckdb/common"
 )
 
+// This struct is responsible for reading metadata that was written by a MetaBlockWriter.
 type MetaBlockReader struct {
+	*common.BinaryDeserializer
 	manager   BlockManager
 	block     *Block
 	offset    uint64
 	nextBlock BlockID
+	blocks    []BlockID // The ids of the blocks of the chain that have been read so far.
+	// The blocks of the chain that have not been read yet, if the chain is read from a given list of blocks rather than
+	// by following the ids that are stored in the blocks.
+	remaining []BlockID
+	listed    bool
 }
 
-func NewMetaBlockReader(manager BlockManager, blockID BlockID) *MetaBlockReader {
+func NewMetaBlockReader(manager BlockManager, blockID BlockID) (*MetaBlockReader, error) {
 	reader := &MetaBlockReader{
 		manager:   manager,
 		block:     NewBlock(-1),
 		offset:    0,
 		nextBlock: -1,
 	}
+	reader.BinaryDeserializer = common.NewBinaryDeserializer(reader)
+
+	if err := reader.readNewBlock(blockID); err != nil {
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// Create a MetaBlockReader that reads the given chain of blocks, starting at the given offset in the first block. The
+// blocks are read in the given order and the ids stored in the blocks are ignored, so that the blocks of the chain can be
+// relocated by a vacuum without rewriting them.
+func newMetaBlockReaderForBlocks(manager BlockManager, blocks []BlockID, offset uint64) (*MetaBlockReader, error) {
+	if len(blocks) == 0 {
+		return nil, common.NewSerializationError("read from an empty meta block chain")
+	}
+
+	reader := &MetaBlockReader{
+		manager:   manager,
+		block:     NewBlock(-1),
+		nextBlock: -1,
+		remaining: blocks[1:],
+		listed:    true,
+	}
+	reader.BinaryDeserializer = common.NewBinaryDeserializer(reader)
+
+	if err := reader.readNewBlock(blocks[0]); err != nil {
+		return nil, err
+	}
+
+	if offset < reader.offset || offset > reader.block.Size() {
+		return nil, common.NewSerializationError(fmt.Sprintf("offset %d exceeds meta block %d", offset, blocks[0]))
+	}
 
-	reader.readNewBlock(blockID)
+	reader.offset = offset
 
-	return reader
+	return reader, nil
 }
 
 // Read content of size read_size into the buffer.
-func (reader *MetaBlockReader) ReadData(outBuffer []byte) {
+func (reader *MetaBlockReader) ReadData(outBuffer []byte) error {
 	inBuffer := reader.block.Buffer()
 
 	for reader.offset+uint64(len(outBuffer)) > reader.block.Size() {
@@ -39,44 +81,47 @@ func (reader *MetaBlockReader) ReadData(outBuffer []byte) {
 		}
 
 		// Then move to the next block.
-		reader.readNewBlock(reader.nextBlock)
+		if reader.nextBlock == InvalidBlock {
+			return common.NewSerializationError("read past the end of the meta block chain")
+		}
+
+		if err := reader.readNewBlock(reader.nextBlock); err != nil {
+			return err
+		}
 	}
 
 	// We have enough left in this block to read from the buffer.
 	copy(outBuffer, inBuffer[reader.offset:])
 	reader.offset += uint64(len(outBuffer))
+
+	return nil
 }
 
-func (reader *MetaBlockReader) readNewBlock(blockID BlockID) {
+// The ids of the blocks of the chain that have been read so far, in order.
+func (reader *MetaBlockReader) Blocks() []BlockID {
+	return reader.blocks
+}
+
+func (reader *MetaBlockReader) readNewBlock(blockID BlockID) error {
 	reader.block.ID = blockID
-	reader.manager.Read(reader.block)
+	reader.blocks = append(reader.blocks, blockID)
+
+	if err := reader.manager.Read(reader.block); err != nil {
+		return err
+	}
+
 	reader.nextBlock = BlockID(binary.LittleEndian.Uint64(reader.block.Buffer()))
-	reader.offset = uint64(unsafe.Sizeof(BlockID(0)))
-}
 
-func (reader *MetaBlockReader) Read(v interface{}) interface{} {
-	buffer := make([]byte, unsafe.Sizeof(v))
-	reader.ReadData(buffer)
-
-	switch v.(type) {
-	case uint8:
-		return buffer[0]
-	case uint16:
-		return binary.LittleEndian.Uint16(buffer)
-	case uint32:
-		return binary.LittleEndian.Uint32(buffer)
-	case uint64:
-		return binary.LittleEndian.Uint64(buffer)
-	case int8:
-		return int8(buffer[0])
-	case int16:
-		return int16(binary.LittleEndian.Uint16(buffer))
-	case int32:
-		return int32(binary.LittleEndian.Uint32(buffer))
-	case int64:
-		return int64(binary.LittleEndian.Uint64(buffer))
-
-	default:
-		panic(fmt.Sprintf("Unknown type: %T", v))
+	if reader.listed {
+		reader.nextBlock = InvalidBlock
+
+		if len(reader.remaining) > 0 {
+			reader.nextBlock = reader.remaining[0]
+			reader.remaining = reader.remaining[1:]
+		}
 	}
+
+	reader.offset = uint64(unsafe.Sizeof(BlockID(0)))
+
+	return nil
 }
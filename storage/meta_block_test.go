@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestMetaBlockRoundTrip(t *testing.T) {
+	manager, err := NewInMemoryBlockManager()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	// Write enough data to span several blocks, so that values are split across block boundaries.
+	const count = 50000
+	writer := NewMetaBlockWriter(manager)
+	firstBlock := writer.BlockID()
+
+	for i := 0; i < count; i++ {
+		if err := writer.WriteString(fmt.Sprintf("value-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := writer.WriteInt64(int64(-i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if writer.BlockID() == firstBlock {
+		t.Fatalf("Expect the metadata to span several blocks")
+	}
+
+	reader, err := NewMetaBlockReader(manager, firstBlock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < count; i++ {
+		value, err := reader.ReadString()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		number, err := reader.ReadInt64()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value != fmt.Sprintf("value-%d", i) || number != int64(-i) {
+			t.Fatalf("Expect value-%d and %d, got %s and %d", i, -i, value, number)
+		}
+	}
+
+	// The chain ends after the last block.
+	if err := reader.ReadData(make([]byte, BlockSize)); err == nil {
+		t.Errorf("Expect reading past the end of the chain to fail")
+	}
+}
+
+func TestMetaBlockReaderForBlocks(t *testing.T) {
+	manager, err := NewInMemoryBlockManager()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	writer := NewMetaBlockWriter(manager)
+
+	if err := writer.WriteString("skipped"); err != nil {
+		t.Fatal(err)
+	}
+
+	offset := writer.offset
+
+	for i := 0; i < 50000; i++ {
+		if err := writer.WriteString(fmt.Sprintf("value-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Copy the blocks of the chain to new blocks, as a vacuum does: the ids stored in the copies are not updated.
+	var relocated []BlockID
+	block := NewBlock(InvalidBlock)
+
+	for _, blockID := range writer.Blocks() {
+		block.ID = blockID
+
+		if err := manager.Read(block); err != nil {
+			t.Fatal(err)
+		}
+
+		block.ID = manager.GetFreeBlockID()
+		relocated = append(relocated, block.ID)
+
+		if err := manager.Write(block); err != nil {
+			t.Fatal(err)
+		}
+
+		manager.MarkBlockAsModified(blockID)
+	}
+
+	if err := manager.WriteHeader(DatabaseHeader{}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := newMetaBlockReaderForBlocks(manager, relocated, offset)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 50000; i++ {
+		if value, err := reader.ReadString(); err != nil || value != fmt.Sprintf("value-%d", i) {
+			t.Fatalf("Expect value-%d, got %q (%v)", i, value, err)
+		}
+	}
+
+	if !reflect.DeepEqual(reader.Blocks(), relocated) {
+		t.Errorf("Expect to read the blocks %v, got %v", relocated, reader.Blocks())
+	}
+
+	if _, err := newMetaBlockReaderForBlocks(manager, relocated, BlockSize+1); err == nil {
+		t.Errorf("Expect an offset past the end of the block to fail")
+	}
+}
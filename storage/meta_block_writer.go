@@ -2,30 +2,79 @@ package storage
 
 import (
 	"encoding/binary"
-	"fmt"
 	"unsafe"
+
+	"github.com/goduckdb/common"
 )
 
-// This struct is responsible for writing metadata to disk.
+// This struct is responsible for writing metadata to disk. The metadata is written to a chain of blocks: the first 8
+// bytes of every block hold the id of the next block in the chain, or InvalidBlock for the last block.
 type MetaBlockWriter struct {
-	manager BlockManager
-	block   *Block
-	offset  uint64
+	*common.BinarySerializer
+	manager   BlockManager
+	block     *Block
+	offset    uint64
+	blocks    []BlockID      // The ids of the blocks of the chain.
+	nextBlock func() BlockID // Returns the id of the next block of the chain.
 }
 
 func NewMetaBlockWriter(manager BlockManager) *MetaBlockWriter {
-	return &MetaBlockWriter{manager: manager, block: manager.CreateBlock(), offset: uint64(unsafe.Sizeof(BlockID(0)))}
+	return newMetaBlockWriter(manager, manager.GetFreeBlockID)
+}
+
+// Create a MetaBlockWriter that writes to the given blocks, which must be large enough to hold the data.
+func newMetaBlockWriterForBlocks(manager BlockManager, blocks []BlockID) *MetaBlockWriter {
+	return newMetaBlockWriter(manager, func() BlockID {
+		if len(blocks) == 0 {
+			panic("MetaBlockWriter ran out of reserved blocks")
+		}
+
+		blockID := blocks[0]
+		blocks = blocks[1:]
+
+		return blockID
+	})
+}
+
+func newMetaBlockWriter(manager BlockManager, nextBlock func() BlockID) *MetaBlockWriter {
+	blockID := nextBlock()
+	writer := &MetaBlockWriter{
+		manager:   manager,
+		block:     NewBlock(blockID),
+		offset:    uint64(unsafe.Sizeof(BlockID(0))),
+		blocks:    []BlockID{blockID},
+		nextBlock: nextBlock,
+	}
+	writer.BinarySerializer = common.NewBinarySerializer(writer)
+	writer.setNextBlock(InvalidBlock)
+
+	return writer
 }
 
-func (writer *MetaBlockWriter) Flush() {
+// The ids of the blocks of the chain that have been written so far, in order.
+func (writer *MetaBlockWriter) Blocks() []BlockID {
+	return writer.blocks
+}
+
+// The id of the first block of the chain as long as nothing has been flushed, the id of the current block afterwards.
+func (writer *MetaBlockWriter) BlockID() BlockID {
+	return writer.block.ID
+}
+
+func (writer *MetaBlockWriter) Flush() error {
 	if writer.offset > uint64(unsafe.Sizeof(BlockID(0))) {
-		writer.manager.Write(writer.block)
+		if err := writer.manager.Write(writer.block); err != nil {
+			return err
+		}
+
 		writer.offset = uint64(unsafe.Sizeof(BlockID(0)))
 	}
+
+	return nil
 }
 
 // Note: offset is updated in `Flush` method.
-func (writer *MetaBlockWriter) WriteData(buffer []byte) {
+func (writer *MetaBlockWriter) WriteData(buffer []byte) error {
 	for writer.offset+uint64(len(buffer)) > writer.block.Size() {
 		// We need to make a new block.
 		// First copy what we can.
@@ -36,79 +85,25 @@ func (writer *MetaBlockWriter) WriteData(buffer []byte) {
 		}
 
 		// Now we need to get a new block id.
-		newBlockID := writer.manager.GetFreeBlockID()
+		newBlockID := writer.nextBlock()
+		writer.blocks = append(writer.blocks, newBlockID)
 		// Write the block id of the new block to the start of current block.
-		binary.LittleEndian.PutUint64(writer.block.Buffer(), uint64(newBlockID))
+		writer.setNextBlock(newBlockID)
 		// First flush the old block.
-		writer.Flush()
+		if err := writer.Flush(); err != nil {
+			return err
+		}
 		// Now update the block id of the block.
 		writer.block.ID = newBlockID
+		writer.setNextBlock(InvalidBlock)
 	}
 
-	copy(writer.block.Buffer(), buffer)
+	copy(writer.block.Buffer()[writer.offset:], buffer)
 	writer.offset += uint64(len(buffer))
-}
-
-func (writer *MetaBlockWriter) Write(v interface{}) {
-	switch v.(type) {
-	case uint64:
-		writer.writeUint64(v.(uint64))
-	case int64:
-		writer.writeInt64(v.(int64))
-	case uint32:
-		writer.writeUint32(v.(uint32))
-	case int32:
-		writer.writeInt32(v.(int32))
-	case uint16:
-		writer.writeUint16(v.(uint16))
-	case int16:
-		writer.writeInt16(v.(int16))
-	case uint8:
-		writer.writeUint8(v.(uint8))
-	case int8:
-		writer.writeInt8(v.(int8))
-	default:
-		panic(fmt.Sprintf("Unknown type: %T", v))
-	}
-}
-
-func (writer *MetaBlockWriter) writeUint64(v uint64) {
-	buffer := make([]byte, unsafe.Sizeof(v))
-	binary.LittleEndian.PutUint64(buffer, v)
-
-	writer.WriteData(buffer)
-}
-
-func (writer *MetaBlockWriter) writeInt64(v int64) {
-	writer.writeUint64(uint64(v))
-}
-
-func (writer *MetaBlockWriter) writeUint32(v uint32) {
-	buffer := make([]byte, unsafe.Sizeof(v))
-	binary.LittleEndian.PutUint32(buffer, v)
-
-	writer.WriteData(buffer)
-}
-
-func (writer *MetaBlockWriter) writeInt32(v int32) {
-	writer.writeUint32(uint32(v))
-}
-
-func (writer *MetaBlockWriter) writeUint16(v uint16) {
-	buffer := make([]byte, unsafe.Sizeof(v))
-	binary.LittleEndian.PutUint16(buffer, v)
-
-	writer.WriteData(buffer)
-}
-
-func (writer *MetaBlockWriter) writeInt16(v int16) {
-	writer.writeUint16(uint16(v))
-}
 
-func (writer *MetaBlockWriter) writeUint8(v uint8) {
-	writer.WriteData([]byte{v})
+	return nil
 }
 
-func (writer *MetaBlockWriter) writeInt8(v int8) {
-	writer.writeUint8(uint8(v))
+func (writer *MetaBlockWriter) setNextBlock(blockID BlockID) {
+	binary.LittleEndian.PutUint64(writer.block.Buffer(), uint64(blockID))
 }
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"strings"
+
+	"github.com/goduckdb/common"
+)
+
+// The suffix of the copy a database file is migrated in.
+const migrationSuffix = ".migrate"
+
+// Migrate the database file at the given path to the current storage version, so that it can be opened in read-write
+// mode. The file is migrated in a copy, which replaces the file once it has been synced: if the migration is
+// interrupted, the file keeps its old version. Files of the current version are left unchanged.
+//
+// The supported versions only differ in the MainHeader, so the copy only rewrites the MainHeader: the blocks are copied
+// as they are, and the write-ahead log of the database stays valid.
+func MigrateDatabase(fs common.FileSystem, path string) error {
+	// The write lock keeps the database from being opened during the migration.
+	handle, err := fs.OpenFile(path, common.WriteOnly, common.WriteLock)
+
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+
+	headerBuffer := common.NewFileBuffer(HeaderSize)
+	mainHeader, err := readMainHeader(fs, handle, headerBuffer, path, true)
+
+	if err != nil || mainHeader.VersionNo == VersionNo {
+		return err
+	}
+
+	copyPath := path + migrationSuffix
+
+	if exists, err := fs.FileExists(copyPath); err != nil {
+		return err
+	} else if exists {
+		// A copy that was left behind by an interrupted migration.
+		if err := fs.RemoveFile(copyPath); err != nil {
+			return err
+		}
+	}
+
+	if err := copyMigratedFile(fs, handle, copyPath, mainHeader); err != nil {
+		fs.RemoveFile(copyPath)
+		return err
+	}
+
+	if err := fs.MoveFile(copyPath, path); err != nil {
+		return err
+	}
+
+	// The rename is only durable once the directory has been synced: until then, a crash can bring back the old file.
+	return fs.SyncDirectory(parentDirectory(fs, path))
+}
+
+// The directory that holds the file at the given path.
+func parentDirectory(fs common.FileSystem, path string) string {
+	separator := fs.PathSeparator()
+	index := strings.LastIndex(path, separator)
+
+	switch {
+	case index < 0:
+		return "."
+	case index == 0:
+		return separator
+	default:
+		return path[:index]
+	}
+}
+
+// Copy the database file to the given path, with the MainHeader in the layout of the current version.
+func copyMigratedFile(fs common.FileSystem, handle common.FileHandle, path string, mainHeader MainHeader) error {
+	size, err := fs.GetFileSize(handle)
+
+	if err != nil {
+		return err
+	}
+
+	target, err := fs.OpenFile(path, common.WriteOnly|common.Create, common.WriteLock)
+
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	buffer := make([]byte, BlockSize)
+
+	for offset := int64(HeaderSize); offset < size; offset += BlockSize {
+		data := buffer[:minInt(BlockSize, int(size-offset))]
+
+		if err := handle.Read(data, uint64(offset)); err != nil {
+			return err
+		}
+
+		if err := target.Write(data, uint64(offset)); err != nil {
+			return err
+		}
+	}
+
+	mainHeader.MagicBytes = MagicBytes
+	mainHeader.VersionNo = VersionNo
+	headerBuffer := common.NewFileBuffer(HeaderSize)
+	headerBuffer.Clear()
+	copy(headerBuffer.Buffer(), MainHeaderToBytes(mainHeader))
+
+	if err := headerBuffer.Write(target, 0, mainHeader.ChecksumType()); err != nil {
+		return err
+	}
+
+	return target.Sync()
+}
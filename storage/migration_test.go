@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/goduckdb/common"
+)
+
+// Rewrite the MainHeader of the database file in the layout of version 1, which has no MagicBytes.
+func writeVersion1Header(t *testing.T, fs common.FileSystem, path string) {
+	t.Helper()
+	handle, err := fs.OpenFile(path, common.WriteOnly, common.NoLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	headerBuffer := common.NewFileBuffer(HeaderSize)
+	mainHeader, err := readMainHeader(fs, handle, headerBuffer, path, false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerBuffer.Clear()
+	binary.LittleEndian.PutUint64(headerBuffer.Buffer(), 1)
+
+	for i, flag := range mainHeader.Flags {
+		binary.LittleEndian.PutUint64(headerBuffer.Buffer()[8*(i+1):], flag)
+	}
+
+	if err := headerBuffer.Write(handle, 0, mainHeader.ChecksumType()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateDatabase(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/migrate.db"
+	storageManager := openTestStorage(t, fs, path)
+	info := testTableInfo
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.Append(testChunk(0, 3000)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeVersion1Header(t, fs, path)
+
+	// A file of version 1 can be read, but not written before it has been migrated.
+	options := DefaultOptions()
+	options.ReadOnly = true
+	storageManager = NewStorageManager(fs, path, options)
+
+	if err := storageManager.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	verifyTestTable(t, storageManager.GetTable(info.Name), 3000)
+	storageManager.Close()
+
+	storageManager = NewStorageManager(fs, path, DefaultOptions())
+	var versionErr *VersionMismatchError
+
+	if err := storageManager.Initialize(); !errors.As(err, &versionErr) || !strings.Contains(err.Error(), "MigrateDatabase") {
+		t.Fatalf("Expect a VersionMismatchError that suggests a migration, got %v", err)
+	}
+
+	// A copy that was left behind by an interrupted migration is replaced.
+	writeTestFile(t, fs, path+migrationSuffix, []byte(strings.Repeat("x", 2*BlockSize)))
+
+	if err := MigrateDatabase(fs, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, _ := fs.FileExists(path + migrationSuffix); exists {
+		t.Errorf("Expect the copy to replace the database file")
+	}
+
+	storageManager = openTestStorage(t, fs, path)
+	table = storageManager.GetTable(info.Name)
+	verifyTestTable(t, table, 3000)
+
+	if err := table.Append(testChunk(3000, 4000)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Migrating a file of the current version does not change it.
+	before := readTestFile(t, fs, path)
+
+	if err := MigrateDatabase(fs, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if after := readTestFile(t, fs, path); string(before) != string(after) {
+		t.Errorf("Expect a file of the current version to be left unchanged")
+	}
+
+	storageManager = openTestStorage(t, fs, path)
+	defer storageManager.Close()
+
+	verifyTestTable(t, storageManager.GetTable(info.Name), 4000)
+
+	// Files that are not database files are not migrated.
+	writeTestFile(t, fs, "/text.db", []byte(strings.Repeat("not a database\n", 1000)))
+	var notDatabaseErr *NotDatabaseError
+
+	if err := MigrateDatabase(fs, "/text.db"); !errors.As(err, &notDatabaseErr) {
+		t.Errorf("Expect a NotDatabaseError, got %v", err)
+	}
+}
+
+func TestMigrateDatabaseSyncsDirectory(t *testing.T) {
+	// The copy is synced first, then the directory it was moved in.
+	fs := common.NewFaultInjectionFileSystem(common.NewMemoryFileSystem())
+	writeVersion1Database(t, fs, "/migrate.db")
+	fs.SetFault(common.FailedSync, 2)
+
+	if err := MigrateDatabase(fs, "/migrate.db"); !errors.Is(err, common.ErrInjectedFault) ||
+		!strings.Contains(err.Error(), "sync directory") {
+		t.Fatalf("Expect the directory sync to fail, got %v", err)
+	}
+
+	// The directory of a database file on the local file system.
+	local := common.NewLocalFileSystem()
+	path := local.JoinPath(t.TempDir(), "migrate.db")
+	writeVersion1Database(t, local, path)
+
+	if err := MigrateDatabase(local, path); err != nil {
+		t.Fatal(err)
+	}
+
+	storageManager := openTestStorage(t, local, path)
+
+	if err := storageManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, expected := range map[string]string{"/a/b.db": "/a", "/b.db": "/", "b.db": "."} {
+		if directory := parentDirectory(fs, path); directory != expected {
+			t.Errorf("Expect the directory of %q to be %q, got %q", path, expected, directory)
+		}
+	}
+}
+
+// Create an empty database file of version 1.
+func writeVersion1Database(t *testing.T, fs common.FileSystem, path string) {
+	t.Helper()
+
+	if err := openTestStorage(t, fs, path).Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeVersion1Header(t, fs, path)
+}
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/goduckdb/common"
+)
+
+// VARCHAR and BLOB values larger than overflowThreshold bytes are not stored in their column segment, but in overflow
+// blocks. The overflow blocks of a column of a row group form a chain: values are written back to back, and a value
+// that does not fit in the remaining space of a block continues at the start of the next block of the chain. The chain
+// is stored in the RowGroupPointer rather than in the blocks, so that blocks can be relocated by a vacuum.
+//
+// The values of the segments of a column with overflow values are tagged: an inline value is stored as the byte
+// overflowInline followed by the value, an overflow value as the byte overflowPointer followed by the uint32 index of
+// its first block in the chain, the uint32 offset in that block and the uint64 length. Overflow values are read only
+// when their rows are scanned.
+const overflowThreshold = 4096
+
+const (
+	overflowInline  = 0
+	overflowPointer = 1
+)
+
+const overflowPointerSize = 17
+
+// Whether any of the values is stored in overflow blocks.
+func hasOverflowValues(vector *common.Vector) bool {
+	values := newSegmentValues(vector)
+
+	for _, value := range values.strings {
+		if len(value) > overflowThreshold {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The overflowWriter writes the overflow values of a column to a chain of new blocks.
+type overflowWriter struct {
+	blockManager BlockManager
+	block        *Block
+	blocks       []BlockID // The chain of blocks that have been written to.
+	offset       uint64    // The offset of the free space in the current block.
+}
+
+func newOverflowWriter(blockManager BlockManager) *overflowWriter {
+	return &overflowWriter{blockManager: blockManager, block: NewBlock(InvalidBlock)}
+}
+
+// Write the values of the vector that are larger than overflowThreshold to overflow blocks, and return a vector of
+// the same type with the tagged values.
+func (writer *overflowWriter) writeVector(vector *common.Vector) (*common.Vector, error) {
+	values := newSegmentValues(vector)
+	tagged := common.NewVector(vector.Type(), len(values.strings))
+
+	for _, value := range values.strings {
+		var encoded []byte
+
+		if len(value) <= overflowThreshold {
+			encoded = append(make([]byte, 0, 1+len(value)), overflowInline)
+			encoded = append(encoded, value...)
+		} else {
+			pointer, err := writer.write(value)
+
+			if err != nil {
+				return nil, err
+			}
+
+			encoded = pointer
+		}
+
+		appendVariableSize(tagged, encoded)
+	}
+
+	return tagged, nil
+}
+
+// Write a value to the chain, and return the tagged pointer to it.
+func (writer *overflowWriter) write(value string) ([]byte, error) {
+	if len(writer.blocks) == 0 || writer.offset == SegmentSize {
+		if err := writer.next(); err != nil {
+			return nil, err
+		}
+	}
+
+	pointer := make([]byte, overflowPointerSize)
+	pointer[0] = overflowPointer
+	binary.LittleEndian.PutUint32(pointer[1:], uint32(len(writer.blocks)-1))
+	binary.LittleEndian.PutUint32(pointer[5:], uint32(writer.offset))
+	binary.LittleEndian.PutUint64(pointer[9:], uint64(len(value)))
+
+	for len(value) > 0 {
+		if writer.offset == SegmentSize {
+			if err := writer.next(); err != nil {
+				return nil, err
+			}
+		}
+
+		n := copy(writer.block.Buffer()[writer.offset:SegmentSize], value)
+		writer.offset += uint64(n)
+		value = value[n:]
+	}
+
+	return pointer, nil
+}
+
+// Write the current block, and continue the chain in a new block.
+func (writer *overflowWriter) next() error {
+	if err := writer.flush(); err != nil {
+		return err
+	}
+
+	writer.block.ID = writer.blockManager.GetFreeBlockID()
+	writer.block.Clear()
+	writer.blocks = append(writer.blocks, writer.block.ID)
+	writer.offset = 0
+
+	return nil
+}
+
+// Write the current block, if values have been written to it.
+func (writer *overflowWriter) flush() error {
+	if len(writer.blocks) == 0 || writer.block.ID == InvalidBlock {
+		return nil
+	}
+
+	err := writer.blockManager.Write(writer.block)
+	writer.block.ID = InvalidBlock
+
+	return err
+}
+
+// Resolve the tagged values of the vector, reading the overflow values from the chain of blocks, and append the values
+// to out.
+func resolveOverflowValues(bufferManager *BufferManager, blocks []BlockID, tagged *common.Vector,
+	out *common.Vector) error {
+	values := newSegmentValues(tagged)
+	var value []byte
+
+	for _, encoded := range values.strings {
+		if len(encoded) == 0 {
+			return common.NewSerializationError("missing tag of an overflow column value")
+		}
+
+		switch encoded[0] {
+		case overflowInline:
+			appendVariableSize(out, []byte(encoded[1:]))
+		case overflowPointer:
+			var err error
+
+			if value, err = readOverflowValue(bufferManager, blocks, []byte(encoded), value[:0]); err != nil {
+				return err
+			}
+
+			appendVariableSize(out, value)
+		default:
+			return common.NewSerializationError(fmt.Sprintf("invalid tag %d of an overflow column value", encoded[0]))
+		}
+	}
+
+	return nil
+}
+
+// Read the overflow value a tagged pointer points to, appending it to dst.
+func readOverflowValue(bufferManager *BufferManager, blocks []BlockID, pointer []byte, dst []byte) ([]byte, error) {
+	if len(pointer) != overflowPointerSize {
+		return nil, common.NewSerializationError(fmt.Sprintf("invalid overflow pointer of %d bytes", len(pointer)))
+	}
+
+	index := uint64(binary.LittleEndian.Uint32(pointer[1:]))
+	offset := uint64(binary.LittleEndian.Uint32(pointer[5:]))
+	remaining := binary.LittleEndian.Uint64(pointer[9:])
+
+	for remaining > 0 {
+		if index >= uint64(len(blocks)) || offset >= SegmentSize {
+			return nil, common.NewSerializationError(fmt.Sprintf("overflow value exceeds its chain of %d blocks",
+				len(blocks)))
+		}
+
+		handle, err := bufferManager.Pin(blocks[index])
+
+		if err != nil {
+			return nil, err
+		}
+
+		n := SegmentSize - offset
+
+		if n > remaining {
+			n = remaining
+		}
+
+		dst = append(dst, handle.Block().Buffer()[offset:offset+n]...)
+		handle.Unpin()
+		remaining -= n
+		index++
+		offset = 0
+	}
+
+	return dst, nil
+}
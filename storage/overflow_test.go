@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/goduckdb/common"
+)
+
+var testDocumentInfo = TableInfo{Name: "documents", Columns: []ColumnDefinition{
+	{Name: "id", Type: common.BigInt},
+	{Name: "body", Type: common.Varchar},
+	{Name: "image", Type: common.Blob},
+}}
+
+// The body and image of a document, every 100th document is larger than a block.
+func testDocument(i int) (string, []byte) {
+	if i%100 != 0 {
+		return fmt.Sprintf("document %d", i), []byte{byte(i)}
+	}
+
+	return fmt.Sprintf("{\"id\": %d, \"text\": \"%s\"}", i, strings.Repeat("lorem ipsum ", 30000)),
+		bytes.Repeat([]byte{byte(i), 0xFF}, 3*BlockSize/4)
+}
+
+func verifyTestDocuments(t *testing.T, table *DataTable, count int, deleted func(i int) bool) {
+	t.Helper()
+
+	var ids []int64
+	err := table.Scan([]int{0, 1, 2}, func(chunk *common.DataChunk) error {
+		for i := 0; i < chunk.Len(); i++ {
+			id := chunk.Columns[0].Value(i).(int64)
+			body, image := testDocument(int(id))
+
+			if chunk.Columns[1].Value(i) != body || !bytes.Equal(chunk.Columns[2].Value(i).([]byte), image) {
+				return fmt.Errorf("document %d differs", id)
+			}
+
+			ids = append(ids, id)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := 0
+
+	for i := 0; i < count; i++ {
+		if !deleted(i) {
+			if expected >= len(ids) || ids[expected] != int64(i) {
+				t.Fatalf("Expect document %d to be scanned", i)
+			}
+
+			expected++
+		}
+	}
+
+	if expected != len(ids) {
+		t.Fatalf("Expect %d documents, got %d", expected, len(ids))
+	}
+}
+
+func TestOverflowValues(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/documents.db"
+	storageManager := openTestStorage(t, fs, path)
+
+	// The table that is written first is dropped, so that the vacuum moves the overflow blocks of the documents.
+	for _, name := range []string{"a", "documents"} {
+		info := testDocumentInfo
+		info.Name = name
+		table, err := storageManager.CreateTable(&info)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chunk := common.NewDataChunk(info.Types(), 1000)
+
+		for i := 0; i < 1000; i++ {
+			body, image := testDocument(i)
+			chunk.Columns[0].Append(int64(i))
+			chunk.Columns[1].Append(body)
+			chunk.Columns[2].Append(image)
+		}
+
+		if err := table.Append(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := storageManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	storageManager = openTestStorage(t, fs, path)
+	defer storageManager.Close()
+
+	table := storageManager.GetTable("documents")
+	column := table.RowGroups()[0].Column(1)
+
+	if len(column.OverflowBlocks()) < 10 || !column.Segments()[0].DataPointer().Overflow {
+		t.Fatalf("Expect the large documents to be stored in overflow blocks, got %d blocks", len(column.OverflowBlocks()))
+	}
+
+	// Scanning the ids does not read the overflow blocks, and fetching a document only reads its own blocks.
+	misses := storageManager.BufferManager().Metrics().Misses
+
+	if err := table.Scan([]int{0}, func(*common.DataChunk) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	chunk, err := table.Fetch([]int{1}, []uint64{500})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body, _ := testDocument(500); chunk.Columns[0].Value(0) != body {
+		t.Errorf("Expect the fetched document to match")
+	}
+
+	if misses = storageManager.BufferManager().Metrics().Misses - misses; misses > 5 {
+		t.Errorf("Expect the overflow blocks of other documents not to be read, got %d blocks", misses)
+	}
+
+	verifyTestDocuments(t, table, 1000, func(int) bool { return false })
+
+	// The overflow blocks are relocated by a vacuum.
+	if err := storageManager.DropTable("a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Vacuum(); err != nil {
+		t.Fatal(err)
+	}
+
+	verifyTestDocuments(t, table, 1000, func(int) bool { return false })
+
+	// The overflow blocks of deleted documents are freed by the checkpoint after the delete, and truncated by the next.
+	blocksBefore := fileBlockCount(t, fs, storageManager.BlockManager())
+	var rows []uint64
+
+	for i := 0; i < 1000; i += 100 {
+		rows = append(rows, uint64(i))
+	}
+
+	if deleted, err := table.Delete(rows); err != nil || deleted != uint64(len(rows)) {
+		t.Fatalf("Expect %d rows to be deleted, got %d: %v", len(rows), deleted, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := storageManager.Checkpoint(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if blocks := table.RowGroups()[0].Column(1).OverflowBlocks(); len(blocks) != 0 {
+		t.Errorf("Expect no overflow blocks after deleting the large documents, got %d", len(blocks))
+	}
+
+	if blocksAfter := fileBlockCount(t, fs, storageManager.BlockManager()); blocksAfter >= blocksBefore/2 {
+		t.Errorf("Expect the file to shrink after deleting the large documents, got %d blocks before and %d after",
+			blocksBefore, blocksAfter)
+	}
+
+	verifyTestDocuments(t, table, 1000, func(i int) bool { return i%100 == 0 })
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/goduckdb/common"
+)
+
+// The maximum number of rows in a row group.
+const RowGroupSize = 122880
+
+// A RowGroup is a horizontal partition of a table of at most RowGroupSize rows. Every column of the row group is
+// stored separately as a ColumnData, so that a scan only reads the columns it needs.
+//
+// Deleted rows keep their position in the row group, so that the rows that follow keep their row numbers; they are
+// skipped by scans. A checkpoint rewrites a row group with new deletes, which drops the values of the deleted rows.
+type RowGroup struct {
+	start           uint64 // The first row of the row group in the table.
+	count           uint64 // The number of rows in the row group, including deleted rows.
+	columns         []*ColumnData
+	deleted         []bool // Whether every row has been deleted, nil if no row has been deleted.
+	deletedCount    uint64
+	deletesModified bool // Whether rows have been deleted since the row group was last persisted.
+}
+
+func newRowGroup(start uint64, types []common.TypeID) *RowGroup {
+	rowGroup := &RowGroup{start: start, columns: make([]*ColumnData, len(types))}
+
+	for i, typ := range types {
+		rowGroup.columns[i] = newColumnData(typ)
+	}
+
+	return rowGroup
+}
+
+// Create a RowGroup from the pointers to its persisted segments.
+func newPersistentRowGroup(pointer RowGroupPointer, types []common.TypeID) (*RowGroup, error) {
+	if len(pointer.Columns) != len(types) || (pointer.Statistics != nil && len(pointer.Statistics) != len(types)) ||
+		(pointer.OverflowBlocks != nil && len(pointer.OverflowBlocks) != len(types)) ||
+		(pointer.MetadataBlocks != nil && len(pointer.MetadataBlocks) != len(types)) {
+		return nil, common.NewSerializationError(fmt.Sprintf("row group at row %d has %d columns, expected %d",
+			pointer.RowStart, len(pointer.Columns), len(types)))
+	}
+
+	rowGroup := &RowGroup{start: pointer.RowStart, count: pointer.TupleCount, columns: make([]*ColumnData, len(types))}
+
+	for i, typ := range types {
+		var statistics *BaseStatistics
+
+		if pointer.Statistics != nil {
+			statistics = pointer.Statistics[i]
+
+			if statistics.Type != typ {
+				return nil, common.NewSerializationError(fmt.Sprintf("column %d of row group at row %d has %s statistics",
+					i, pointer.RowStart, statistics.Type))
+			}
+		}
+
+		var overflowBlocks []BlockID
+
+		if pointer.OverflowBlocks != nil {
+			overflowBlocks = pointer.OverflowBlocks[i]
+		}
+
+		var metadataBlocks []BlockID
+
+		if pointer.MetadataBlocks != nil {
+			metadataBlocks = pointer.MetadataBlocks[i]
+		}
+
+		column := newPersistentColumnData(typ, pointer.Columns[i], overflowBlocks, metadataBlocks, statistics)
+
+		if column.Count() != pointer.TupleCount {
+			return nil, common.NewSerializationError(fmt.Sprintf("column %d of row group at row %d has %d rows, expected %d",
+				i, pointer.RowStart, column.Count(), pointer.TupleCount))
+		}
+
+		rowGroup.columns[i] = column
+	}
+
+	for i, row := range pointer.Deleted {
+		if row >= pointer.TupleCount || (i > 0 && row <= pointer.Deleted[i-1]) {
+			return nil, common.NewSerializationError(fmt.Sprintf("row group at row %d has an invalid deleted row %d",
+				pointer.RowStart, row))
+		}
+
+		rowGroup.delete(row)
+	}
+
+	rowGroup.deletesModified = false
+
+	return rowGroup, nil
+}
+
+// The first row of the row group in the table.
+func (rowGroup *RowGroup) Start() uint64 {
+	return rowGroup.start
+}
+
+// The number of rows in the row group, including deleted rows.
+func (rowGroup *RowGroup) Count() uint64 {
+	return rowGroup.count
+}
+
+// The number of deleted rows in the row group.
+func (rowGroup *RowGroup) DeletedCount() uint64 {
+	return rowGroup.deletedCount
+}
+
+// Whether the row (relative to the start of the row group) has been deleted.
+func (rowGroup *RowGroup) IsDeleted(row uint64) bool {
+	return rowGroup.deleted != nil && rowGroup.deleted[row]
+}
+
+// Delete the row (relative to the start of the row group). Returns false if the row was already deleted.
+func (rowGroup *RowGroup) delete(row uint64) bool {
+	if rowGroup.deleted == nil {
+		rowGroup.deleted = make([]bool, RowGroupSize)
+	}
+
+	if rowGroup.deleted[row] {
+		return false
+	}
+
+	rowGroup.deleted[row] = true
+	rowGroup.deletedCount++
+	rowGroup.deletesModified = true
+
+	return true
+}
+
+// Set the selection of the rows in the range [start, end) of the row group to whether the rows have not been deleted.
+func (rowGroup *RowGroup) selectRows(start uint64, end uint64, selection []bool) {
+	for i := range selection[:end-start] {
+		selection[i] = !rowGroup.IsDeleted(start + uint64(i))
+	}
+}
+
+func (rowGroup *RowGroup) Column(index int) *ColumnData {
+	return rowGroup.columns[index]
+}
+
+// Whether rows have been appended, updated or deleted since the row group was last persisted.
+func (rowGroup *RowGroup) dirty() bool {
+	for _, column := range rowGroup.columns {
+		if column.dirty() {
+			return true
+		}
+	}
+
+	return rowGroup.deletesModified
+}
+
+// Append the rows in the range [start, end) of the chunk, which must fit in the row group.
+func (rowGroup *RowGroup) append(chunk *common.DataChunk, start int, end int) {
+	for i, column := range rowGroup.columns {
+		column.append(chunk.Columns[i], start, end)
+	}
+
+	rowGroup.count += uint64(end - start)
+}
+
+// Append the rows in the range [start, end) of the row group (relative to the start of the row group) of the given
+// columns to the chunk.
+func (rowGroup *RowGroup) scan(bufferManager *BufferManager, columnIDs []int, start uint64, end uint64,
+	chunk *common.DataChunk) error {
+	for i, columnID := range columnIDs {
+		if err := rowGroup.columns[columnID].scan(bufferManager, start, end, chunk.Columns[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Whether rows that match all filters may exist in the row group, returns false if the statistics of a column prove
+// that none of its values match.
+func (rowGroup *RowGroup) mayMatch(filters []TableFilter) bool {
+	for i := range filters {
+		if stats := rowGroup.columns[filters[i].ColumnID].Statistics(); stats != nil && !stats.MayMatch(&filters[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Evaluate the filters for the rows in the range [start, end) of the row group (relative to the start of the row
+// group), clearing the selection of the rows that do not match all filters.
+func (rowGroup *RowGroup) filter(bufferManager *BufferManager, filters []TableFilter, start uint64, end uint64,
+	selection []bool) error {
+	for i := range filters {
+		filter := &filters[i]
+
+		if err := rowGroup.columns[filter.ColumnID].filter(bufferManager, start, end, filter, selection); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The pointer to the persisted segments of the row group. The row group must not be dirty.
+func (rowGroup *RowGroup) pointer() RowGroupPointer {
+	pointer := RowGroupPointer{
+		RowStart:   rowGroup.start,
+		TupleCount: rowGroup.count,
+		Columns:    make([][]DataPointer, len(rowGroup.columns)),
+	}
+
+	statistics := make([]*BaseStatistics, len(rowGroup.columns))
+	overflowBlocks := make([][]BlockID, len(rowGroup.columns))
+	metadataBlocks := make([][]BlockID, len(rowGroup.columns))
+	known, overflow, metadata := true, false, false
+
+	for i, column := range rowGroup.columns {
+		pointer.Columns[i] = column.dataPointers()
+		statistics[i] = column.Statistics()
+		known = known && statistics[i] != nil
+		overflowBlocks[i] = column.OverflowBlocks()
+		overflow = overflow || len(overflowBlocks[i]) > 0
+		metadataBlocks[i] = column.MetadataBlocks()
+		metadata = metadata || len(metadataBlocks[i]) > 0
+	}
+
+	// The statistics are only persisted if they are known for every column.
+	if known {
+		pointer.Statistics = statistics
+	}
+
+	if overflow {
+		pointer.OverflowBlocks = overflowBlocks
+	}
+
+	if metadata {
+		pointer.MetadataBlocks = metadataBlocks
+	}
+
+	for row := uint64(0); row < rowGroup.count && rowGroup.deleted != nil; row++ {
+		if rowGroup.deleted[row] {
+			pointer.Deleted = append(pointer.Deleted, row)
+		}
+	}
+
+	return pointer
+}
+
+// The blocks the persisted segments of the row group are stored in. The columns of a row group share blocks, every
+// block is returned once.
+func (rowGroup *RowGroup) blocks() []BlockID {
+	var blocks []BlockID
+	seen := make(map[BlockID]struct{})
+
+	for _, column := range rowGroup.columns {
+		for _, blockID := range column.blocks() {
+			if _, ok := seen[blockID]; !ok {
+				seen[blockID] = struct{}{}
+				blocks = append(blocks, blockID)
+			}
+		}
+	}
+
+	return blocks
+}
@@ -1,28 +1,39 @@
 package storage
 
 import (
-	"encoding/binary"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"unsafe"
 
 	"github.com/goduckdb/common"
 )
 
 const BlockStart = HeaderSize * 3
 
-// SingleFileBlockManager is a implementation for a BlockManager which manages blocks in a single file.
+// SingleFileBlockManager is a implementation for a BlockManager which manages blocks in a single file. Blocks can be
+// read concurrently by many scan threads; checkpoints (writing blocks and the header) are performed by a single thread.
 type SingleFileBlockManager struct {
-	activeHeader   uint8             // The active DatabaseHeader, either 0 (h1) or 1 (h2).
-	path           string            // The path where the file is stored.
-	handle         common.FileHandle // The buffer used to read/write to the headers.
+	activeHeader   uint8               // The active DatabaseHeader, either 0 (h1) or 1 (h2).
+	path           string              // The path where the file is stored.
+	fs             common.FileSystem   // The FileSystem the file is stored in.
+	handle         common.FileHandle   // The buffer used to read/write to the headers.
+	checksumType   common.ChecksumType // The checksum algorithm of the blocks and headers, as recorded in the MainHeader.
 	headerBuffer   *common.FileBuffer
-	freeList       []BlockID // The list of free blocks that can be written to currently.
-	usedBlocks     []BlockID // The list of blocks that are used by the current block manager.
-	metaBlock      BlockID   // The current meta block id.
-	maxBlock       BlockID   // The current maximum block id, this id will be given away first after the free_list runs out.
-	iterationCount uint64    // The current header iteration count.
+	blockLock      sync.Mutex           // Protects the free list, the modified blocks and maxBlock.
+	freeList       []BlockID            // The list of free blocks that can be written to currently, in ascending order.
+	modifiedBlocks map[BlockID]struct{} // The blocks that are used by the active header, but are free after the next checkpoint.
+	freeListBlocks []BlockID            // The blocks the free list of the active header is stored in.
+	metaBlock      BlockID              // The current meta block id.
+	maxBlock       BlockID              // The current maximum block id, this id will be given away first after the free_list runs out.
+	iterationCount uint64               // The current header iteration count.
 }
 
-func NewSingleFileBlockManager(fs *common.FileSystem, path string, readOnly bool, createNew bool) BlockManager {
+// Open the database file at the given path, or create a new one if createNew is set. The blocks of a new file are
+// checksummed with the given checksum algorithm, existing files use the algorithm recorded in their MainHeader.
+func NewSingleFileBlockManager(fs common.FileSystem, path string, readOnly bool, createNew bool,
+	checksumType common.ChecksumType) (BlockManager, error) {
 	var flags common.FileFlags
 	var lock common.FileLockType
 
@@ -40,14 +51,25 @@ func NewSingleFileBlockManager(fs *common.FileSystem, path string, readOnly bool
 
 	// Open the RDBMS handle.
 	headerBuffer := common.NewFileBuffer(HeaderSize)
-	handle := fs.OpenFile(path, flags, lock)
+	handle, err := fs.OpenFile(path, flags, lock)
+
+	if err != nil {
+		return nil, err
+	}
 
 	if createNew {
 		// If we create a new file, we fill the metadata of the file
 		// first fill in the new header.
 		headerBuffer.Clear()
-		binary.LittleEndian.PutUint64(headerBuffer.Buffer(), VersionNo)
-		headerBuffer.Write(handle, 0)
+		mainHeader := MainHeader{MagicBytes: MagicBytes, VersionNo: VersionNo}
+		mainHeader.Flags[ChecksumTypeFlag] = uint64(checksumType)
+		copy(headerBuffer.Buffer(), MainHeaderToBytes(mainHeader))
+
+		if err := headerBuffer.Write(handle, 0, checksumType); err != nil {
+			handle.Close()
+			return nil, err
+		}
+
 		headerBuffer.Clear()
 
 		// Write the database headers.
@@ -62,74 +84,188 @@ func NewSingleFileBlockManager(fs *common.FileSystem, path string, readOnly bool
 		}
 		data := DatabaseHeaderToBytes(databaseHeader)
 		copy(headerBuffer.Buffer(), data)
-		headerBuffer.Write(handle, HeaderSize)
+
+		if err := headerBuffer.Write(handle, HeaderSize, checksumType); err != nil {
+			handle.Close()
+			return nil, err
+		}
 
 		// header 2.
 		databaseHeader.Iteration = 1
 		data = DatabaseHeaderToBytes(databaseHeader)
 		copy(headerBuffer.Buffer(), data)
-		headerBuffer.Write(handle, HeaderSize*2)
+
+		if err := headerBuffer.Write(handle, HeaderSize*2, checksumType); err != nil {
+			handle.Close()
+			return nil, err
+		}
 
 		// Ensure that writing to disk is completed before returning
-		handle.Sync()
+		if err := handle.Sync(); err != nil {
+			handle.Close()
+			return nil, err
+		}
 
 		return &SingleFileBlockManager{
-			activeHeader: 1,
-			path:         path,
-			headerBuffer: headerBuffer,
-			handle:       handle,
-		}
+			activeHeader:   1,
+			path:           path,
+			fs:             fs,
+			headerBuffer:   headerBuffer,
+			handle:         handle,
+			checksumType:   checksumType,
+			modifiedBlocks: make(map[BlockID]struct{}),
+			metaBlock:      InvalidBlock,
+			iterationCount: databaseHeader.Iteration,
+		}, nil
 	} else {
 		// Otherwise, we check the metadata of the file.
-		headerBuffer.Read(handle, 0)
-		mainHeader := BytesToMainHeader(headerBuffer.Buffer())
+		mainHeader, err := readMainHeader(fs, handle, headerBuffer, path, readOnly)
 
-		if mainHeader.VersionNo != VersionNo {
-			panic(fmt.Sprintf("Trying to read a database file with version number %d, but we can only read version %d",
-				mainHeader.VersionNo, VersionNo))
+		if err != nil {
+			handle.Close()
+			return nil, err
 		}
 
+		checksumType = mainHeader.ChecksumType()
+
 		var activeHeader uint8
-		// Read the database headers from disk.
-		headerBuffer.Read(handle, HeaderSize)
-		databaseHeader1 := BytesToDatabaseHeader(headerBuffer.Buffer())
-		headerBuffer.Read(handle, HeaderSize*2)
-		databaseHeader2 := BytesToDatabaseHeader(headerBuffer.Buffer())
+		// Read the database headers from disk. A crash while writing a header can leave it torn, in which case its
+		// checksum does not match and we use the other header.
+		databaseHeader1, err1 := readDatabaseHeader(handle, headerBuffer, HeaderSize, checksumType)
+		databaseHeader2, err2 := readDatabaseHeader(handle, headerBuffer, HeaderSize*2, checksumType)
+		var corruptionErr *common.CorruptionError
+
+		for _, err := range []error{err1, err2} {
+			if err != nil && !errors.As(err, &corruptionErr) {
+				handle.Close()
+				return nil, err
+			}
+		}
+
+		if err1 != nil && err2 != nil {
+			handle.Close()
+			return nil, err1
+		}
 
 		manager := &SingleFileBlockManager{
-			activeHeader: activeHeader,
-			path:         path,
-			headerBuffer: headerBuffer,
-			handle:       handle,
+			activeHeader:   activeHeader,
+			path:           path,
+			fs:             fs,
+			headerBuffer:   headerBuffer,
+			handle:         handle,
+			checksumType:   checksumType,
+			modifiedBlocks: make(map[BlockID]struct{}),
 		}
 
-		// Check the header with the highest iteration count.
-		if databaseHeader1.Iteration > databaseHeader2.Iteration {
+		// Check the (valid) header with the highest iteration count.
+		if err2 != nil || (err1 == nil && databaseHeader1.Iteration > databaseHeader2.Iteration) {
 			// h1 is ative header.
-			manager.Initialize(databaseHeader1)
+			err = manager.Initialize(databaseHeader1)
 		} else {
 			// h2 is active header.
 			manager.activeHeader = 1
-			manager.Initialize(databaseHeader2)
+			err = manager.Initialize(databaseHeader2)
 		}
 
-		return manager
+		if err != nil {
+			handle.Close()
+			return nil, err
+		}
+
+		return manager, nil
 	}
 }
 
-func (manager *SingleFileBlockManager) Initialize(header DatabaseHeader) {
+// Read the MainHeader of the database file, and verify that this version of goduckdb can open the file: in read-only
+// mode if readOnly is set, otherwise in read-write mode. Returns a NotDatabaseError if the file is not a database file,
+// and a VersionMismatchError if it has a storage version that cannot be opened in the mode.
+func readMainHeader(fs common.FileSystem, handle common.FileHandle, headerBuffer *common.FileBuffer, path string,
+	readOnly bool) (MainHeader, error) {
+	size, err := fs.GetFileSize(handle)
+
+	if err != nil {
+		return MainHeader{}, err
+	}
+
+	if size < BlockStart {
+		return MainHeader{}, &NotDatabaseError{Path: path}
+	}
+
+	// The checksum algorithm is recorded in the MainHeader itself, so it can only be verified after it has been read.
+	if err := headerBuffer.ReadUnchecked(handle, 0); err != nil {
+		return MainHeader{}, err
+	}
+
+	mainHeader, err := parseMainHeader(path, headerBuffer.Buffer())
+
+	if err != nil {
+		return MainHeader{}, err
+	}
+
+	capability := GetStorageCapability(mainHeader.VersionNo)
+
+	if capability == StorageUnsupported || (capability == StorageReadOnly && !readOnly) {
+		return MainHeader{}, &VersionMismatchError{Path: path, Version: mainHeader.VersionNo, Expected: VersionNo}
+	}
+
+	if checksumType := mainHeader.ChecksumType(); !checksumType.Valid() {
+		return MainHeader{}, common.NewCorruptionError(path, 0, fmt.Sprintf("unknown checksum type %d", checksumType))
+	}
+
+	if err := headerBuffer.Verify(path, 0, mainHeader.ChecksumType()); err != nil {
+		return MainHeader{}, err
+	}
+
+	return mainHeader, nil
+}
+
+func readDatabaseHeader(handle common.FileHandle, headerBuffer *common.FileBuffer, offset uint64,
+	checksumType common.ChecksumType) (DatabaseHeader, error) {
+	if err := headerBuffer.Read(handle, offset, checksumType); err != nil {
+		return DatabaseHeader{}, err
+	}
+
+	return BytesToDatabaseHeader(headerBuffer.Buffer()), nil
+}
+
+func (manager *SingleFileBlockManager) Initialize(header DatabaseHeader) error {
 	if header.FreeList != InvalidBlock {
-		reader := NewMetaBlockReader(manager, header.FreeList)
-		freeListCount := reader.Read(uint64(0)).(uint64)
+		reader, err := NewMetaBlockReader(manager, header.FreeList)
+
+		if err != nil {
+			return err
+		}
+
+		freeListCount, err := reader.ReadUint64()
+
+		if err != nil {
+			return err
+		}
+
+		for i := uint64(0); i < freeListCount; i++ {
+			blockID, err := reader.ReadInt64()
 
-		for i := 0; uint64(i) < freeListCount; i++ {
-			manager.freeList = append(manager.freeList, reader.Read(BlockID(0)).(BlockID))
+			if err != nil {
+				return err
+			}
+
+			if blockID < 0 || uint64(blockID) >= header.BlockCount {
+				return common.NewCorruptionError(manager.path, 0, fmt.Sprintf("free list contains invalid block %d", blockID))
+			}
+
+			manager.freeList = append(manager.freeList, BlockID(blockID))
 		}
+
+		sort.Slice(manager.freeList, func(i, j int) bool { return manager.freeList[i] < manager.freeList[j] })
+		// The blocks of the free list itself are in use until the next checkpoint writes a new free list.
+		manager.freeListBlocks = reader.Blocks()
 	}
 
 	manager.metaBlock = header.MetaBlock
 	manager.iterationCount = header.Iteration
 	manager.maxBlock = BlockID(header.BlockCount)
+
+	return nil
 }
 
 func (manager *SingleFileBlockManager) CreateBlock() *Block {
@@ -138,12 +274,16 @@ func (manager *SingleFileBlockManager) CreateBlock() *Block {
 	return NewBlock(bid)
 }
 
+// Return the id of a block that can be written to: the lowest free block, or a new block at the end of the file.
 func (manager *SingleFileBlockManager) GetFreeBlockID() BlockID {
+	manager.blockLock.Lock()
+	defer manager.blockLock.Unlock()
+
 	var blockID BlockID
 
-	if size := len(manager.freeList); size > 0 {
-		blockID = manager.freeList[size-1]
-		manager.freeList = manager.freeList[:size-1]
+	if len(manager.freeList) > 0 {
+		blockID = manager.freeList[0]
+		manager.freeList = manager.freeList[1:]
 	} else {
 		blockID = manager.maxBlock
 		manager.maxBlock++
@@ -152,59 +292,252 @@ func (manager *SingleFileBlockManager) GetFreeBlockID() BlockID {
 	return blockID
 }
 
+// Mark a block as free right away. This must only be used for blocks that are not referenced by the active header, e.g.
+// blocks that were written since the last checkpoint and are no longer needed.
+func (manager *SingleFileBlockManager) MarkBlockAsFree(blockID BlockID) {
+	manager.blockLock.Lock()
+	defer manager.blockLock.Unlock()
+
+	if _, ok := manager.modifiedBlocks[blockID]; ok {
+		panic(fmt.Sprintf("Block %d is freed after it has been marked as modified", blockID))
+	}
+
+	manager.freeList = insertBlock(manager.freeList, blockID)
+}
+
+// Mark a block that is referenced by the active header as modified: its content has been written elsewhere, so it is
+// free once the next checkpoint has been written. Until then it must not be reused, as a crash would leave the active
+// header pointing to overwritten data.
+func (manager *SingleFileBlockManager) MarkBlockAsModified(blockID BlockID) {
+	manager.blockLock.Lock()
+	defer manager.blockLock.Unlock()
+
+	if index := searchBlock(manager.freeList, blockID); index < len(manager.freeList) && manager.freeList[index] == blockID {
+		panic(fmt.Sprintf("Block %d is marked as modified while it is free", blockID))
+	}
+
+	manager.modifiedBlocks[blockID] = struct{}{}
+}
+
+// Insert a block into the sorted list of blocks, panics if the block is already in the list.
+func insertBlock(blocks []BlockID, blockID BlockID) []BlockID {
+	index := searchBlock(blocks, blockID)
+
+	if index < len(blocks) && blocks[index] == blockID {
+		panic(fmt.Sprintf("Block %d is freed twice", blockID))
+	}
+
+	blocks = append(blocks, 0)
+	copy(blocks[index+1:], blocks[index:])
+	blocks[index] = blockID
+
+	return blocks
+}
+
+// Move live blocks to lower free blocks, so that the free blocks end up at the end of the file, where the next checkpoint
+// truncates them. Blocks are moved from the end of the file to the lowest free blocks for as long as that moves them
+// forward. Returns the new id of every moved block: the caller has to rewrite the references to the moved blocks before
+// it writes the header. The old blocks are marked as modified, as they are referenced by the active header.
+func (manager *SingleFileBlockManager) RelocateBlocks(blocks []BlockID) (map[BlockID]BlockID, error) {
+	live := append([]BlockID(nil), blocks...)
+	sort.Slice(live, func(i, j int) bool { return live[i] > live[j] })
+	relocated := make(map[BlockID]BlockID)
+	block := NewBlock(InvalidBlock)
+
+	for _, blockID := range live {
+		manager.blockLock.Lock()
+
+		if len(manager.freeList) == 0 || manager.freeList[0] > blockID {
+			manager.blockLock.Unlock()
+			break
+		}
+
+		newBlockID := manager.freeList[0]
+		manager.freeList = manager.freeList[1:]
+		manager.blockLock.Unlock()
+
+		block.ID = blockID
+
+		if err := manager.Read(block); err != nil {
+			return nil, err
+		}
+
+		block.ID = newBlockID
+
+		if err := manager.Write(block); err != nil {
+			return nil, err
+		}
+
+		manager.MarkBlockAsModified(blockID)
+		relocated[blockID] = newBlockID
+	}
+
+	return relocated, nil
+}
+
+// Return the index of the first block in the sorted list of blocks that is not smaller than the given block.
+func searchBlock(blocks []BlockID, blockID BlockID) int {
+	return sort.Search(len(blocks), func(i int) bool { return blocks[i] >= blockID })
+}
+
+// The checksum algorithm of the blocks and headers of the file.
+func (manager *SingleFileBlockManager) ChecksumType() common.ChecksumType {
+	return manager.checksumType
+}
+
 func (manager *SingleFileBlockManager) GetMetaBlock() BlockID {
 	return manager.metaBlock
 }
 
-func (blockManager *SingleFileBlockManager) Read(block *Block) {
-	// TODO: duplicate block ids
-	blockManager.usedBlocks = append(blockManager.usedBlocks, block.ID)
-	block.Read(blockManager.handle, uint64(BlockStart+block.ID*BlockSize))
+func (blockManager *SingleFileBlockManager) Read(block *Block) error {
+	return block.Read(blockManager.handle, uint64(BlockStart+block.ID*BlockSize), blockManager.checksumType)
 }
 
-func (blockManager *SingleFileBlockManager) Write(block *Block) {
-	block.Write(blockManager.handle, uint64(BlockStart+block.ID*BlockSize))
+func (blockManager *SingleFileBlockManager) Write(block *Block) error {
+	return block.Write(blockManager.handle, uint64(BlockStart+block.ID*BlockSize), blockManager.checksumType)
 }
 
-// TODO: how it works?
-func (manager *SingleFileBlockManager) WriteHeader(header DatabaseHeader) {
-	// Set the iteration count.
-	header.Iteration = manager.iterationCount
-	manager.iterationCount++
+// Write the header, which commits the checkpoint. The free list of the new header holds the free blocks and the blocks
+// that were modified since the previous checkpoint; the modified blocks are only reused once the header is written.
+func (manager *SingleFileBlockManager) WriteHeader(header DatabaseHeader) error {
+	// Set the iteration count, the new header has to win over the active header on startup.
+	header.Iteration = manager.iterationCount + 1
+
+	manager.blockLock.Lock()
+	// The blocks of the free list of the active header are replaced by the new free list.
+	for _, blockID := range manager.freeListBlocks {
+		manager.modifiedBlocks[blockID] = struct{}{}
+	}
+
+	freeListBlocks, freeList, blockCount := manager.reserveFreeListBlocks()
+	// All blocks that were handed out (including the free list blocks) are part of the file as of this header, except
+	// for the free blocks at the end of the file, which are truncated once the header is written.
+	header.BlockCount = uint64(blockCount)
+	manager.blockLock.Unlock()
 
 	// Now handle the free list.
-	if len(manager.usedBlocks) > 0 {
+	if len(freeListBlocks) > 0 {
 		// There are blocks in the free list.
 		// Write them to the file.
-		writer := NewMetaBlockWriter(manager)
-		header.FreeList = writer.block.ID
-		writer.Write(len(manager.usedBlocks))
+		writer := newMetaBlockWriterForBlocks(manager, freeListBlocks)
+		header.FreeList = writer.BlockID()
+
+		if err := writer.WriteUint64(uint64(len(freeList))); err != nil {
+			return err
+		}
+
+		for _, blockID := range freeList {
+			if err := writer.WriteInt64(int64(blockID)); err != nil {
+				return err
+			}
+		}
 
-		for _, blockID := range manager.usedBlocks {
-			writer.Write(blockID)
+		if err := writer.Flush(); err != nil {
+			return err
 		}
-		writer.Flush()
 	} else {
 		// No block in the free list.
 		header.FreeList = InvalidBlock
 	}
 
+	// We need to fsync BEFORE we write the header to ensure that all the previous blocks are written as well: if the
+	// header reaches the disk before a block it refers to, a crash leaves the database corrupt.
+	if err := manager.handle.Sync(); err != nil {
+		return err
+	}
+
 	// Set the header inside the buffer.
 	manager.headerBuffer.Clear()
 	data := DatabaseHeaderToBytes(header)
 	copy(manager.headerBuffer.Buffer(), data)
 	// Now write the header to the file, active_header determines whether we write to h1 or h2.
 	// Note that if active_header is h1 we write to h2, and vice versa.
+	var err error
+
 	if manager.activeHeader == 1 {
-		manager.headerBuffer.Write(manager.handle, HeaderSize)
+		err = manager.headerBuffer.Write(manager.handle, HeaderSize, manager.checksumType)
 	} else {
-		manager.headerBuffer.Write(manager.handle, HeaderSize*2)
+		err = manager.headerBuffer.Write(manager.handle, HeaderSize*2, manager.checksumType)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Ensure the header to the other header.
+	if err := manager.handle.Sync(); err != nil {
+		return err
 	}
+
 	// Switch active header to the other header.
 	manager.activeHeader = 1 - manager.activeHeader
-	// Ensure the header to the other header.
-	manager.handle.Sync()
+	manager.metaBlock = header.MetaBlock
+	manager.iterationCount = header.Iteration
+
+	// The checkpoint is committed: the modified blocks are no longer referenced and can be reused, and the free blocks at
+	// the end of the file are no longer part of it.
+	manager.blockLock.Lock()
+	manager.freeList = freeList
+	manager.modifiedBlocks = make(map[BlockID]struct{})
+	manager.freeListBlocks = freeListBlocks
+	truncate := manager.maxBlock > blockCount
+	manager.maxBlock = blockCount
+	manager.blockLock.Unlock()
+
+	if truncate {
+		// If truncating fails, the file keeps the free blocks at its end. That is not an error: the blocks after the
+		// BlockCount of the header are implicitly free, and are overwritten when the file grows again.
+		manager.fs.Truncate(manager.handle, int64(BlockStart+blockCount*BlockSize))
+	}
+
+	return nil
+}
+
+// Reserve the blocks the new free list is written to. Returns the reserved blocks, the free list to write and the
+// number of blocks in the file. The free list holds the free blocks that remain after the reservation and the modified
+// blocks, except for the free blocks at the end of the file: these are not part of the file as of the new header. The
+// free list blocks are taken from the free list themselves, so that the list shrinks while it is reserved; if that
+// empties the free list, an empty free list is written to the reserved blocks, which are freed again by the next
+// checkpoint. Called with the blockLock held.
+func (manager *SingleFileBlockManager) reserveFreeListBlocks() ([]BlockID, []BlockID, BlockID) {
+	var reserved []BlockID
+
+	for {
+		freeList := make([]BlockID, 0, len(manager.freeList)+len(manager.modifiedBlocks))
+		freeList = append(freeList, manager.freeList...)
+
+		for blockID := range manager.modifiedBlocks {
+			freeList = append(freeList, blockID)
+		}
+
+		sort.Slice(freeList, func(i, j int) bool { return freeList[i] < freeList[j] })
+
+		// Cut off the free blocks at the end of the file.
+		blockCount := manager.maxBlock
+
+		for len(freeList) > 0 && freeList[len(freeList)-1] == blockCount-1 {
+			freeList = freeList[:len(freeList)-1]
+			blockCount--
+		}
+
+		// The free list is written as its count followed by the block ids, every block holds the id of the next block.
+		size := uint64(unsafe.Sizeof(uint64(0))) * uint64(len(freeList)+1)
+		capacity := uint64(BlockSize) - common.FileBufferHeaderSize - uint64(unsafe.Sizeof(BlockID(0)))
+
+		if (len(freeList) == 0 && len(reserved) == 0) || uint64(len(reserved))*capacity >= size {
+			return reserved, freeList, blockCount
+		}
+
+		if len(manager.freeList) > 0 {
+			reserved = append(reserved, manager.freeList[0])
+			manager.freeList = manager.freeList[1:]
+		} else {
+			reserved = append(reserved, manager.maxBlock)
+			manager.maxBlock++
+		}
+	}
+}
 
-	// The free list is now equal to the blocks that were used by previous iteration.
-	manager.freeList = manager.usedBlocks
+func (manager *SingleFileBlockManager) Close() error {
+	return manager.handle.Close()
 }
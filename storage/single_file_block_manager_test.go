@@ -0,0 +1,591 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/goduckdb/common"
+)
+
+func TestSingleFileBlockManagerVersionMismatch(t *testing.T) {
+	fs := common.NewLocalFileSystem()
+	path := filepath.Join(t.TempDir(), "version.db")
+
+	manager, err := NewSingleFileBlockManager(fs, path, false, true, common.DefaultChecksumType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Overwrite the main header with a version number we cannot read.
+	handle := manager.(*SingleFileBlockManager).handle
+	headerBuffer := common.NewFileBuffer(HeaderSize)
+	copy(headerBuffer.Buffer(), MainHeaderToBytes(MainHeader{MagicBytes: MagicBytes, VersionNo: VersionNo + 1}))
+
+	if err := headerBuffer.Write(handle, 0, common.DefaultChecksumType); err != nil {
+		t.Fatal(err)
+	}
+
+	handle.Close()
+
+	_, err = NewSingleFileBlockManager(fs, path, true, false, common.DefaultChecksumType)
+	var versionErr *VersionMismatchError
+
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("Expect a VersionMismatchError, got %v", err)
+	}
+
+	if versionErr.Version != VersionNo+1 || versionErr.Expected != VersionNo {
+		t.Errorf("Expect version %d (expected %d), got %d (expected %d)",
+			VersionNo+1, VersionNo, versionErr.Version, versionErr.Expected)
+	}
+}
+
+func TestSingleFileBlockManagerConcurrentReads(t *testing.T) {
+	fs := common.NewLocalFileSystem()
+	path := filepath.Join(t.TempDir(), "concurrent.db")
+	manager, err := NewSingleFileBlockManager(fs, path, false, true, common.DefaultChecksumType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	const blockCount = 16
+	const threadCount = 8
+
+	for i := 0; i < blockCount; i++ {
+		block := manager.CreateBlock()
+
+		for j := range block.Buffer() {
+			block.Buffer()[j] = byte(int(block.ID) + j)
+		}
+
+		if err := manager.Write(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, threadCount)
+
+	for thread := 0; thread < threadCount; thread++ {
+		wg.Add(1)
+
+		go func(thread int) {
+			defer wg.Done()
+
+			block := NewBlock(InvalidBlock)
+
+			// Every thread scans the blocks in a different order.
+			for i := 0; i < blockCount*4; i++ {
+				block.ID = BlockID((i*(thread+1) + thread) % blockCount)
+
+				if err := manager.Read(block); err != nil {
+					errs <- err
+					return
+				}
+
+				for j, b := range block.Buffer() {
+					if b != byte(int(block.ID)+j) {
+						errs <- fmt.Errorf("block %d: expect byte %d at offset %d, got %d", block.ID, byte(int(block.ID)+j), j, b)
+						return
+					}
+				}
+			}
+		}(thread)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestSingleFileBlockManagerChecksumTypes(t *testing.T) {
+	for _, checksumType := range []common.ChecksumType{common.ChecksumDJB2, common.ChecksumCRC32C, common.ChecksumXXHash64} {
+		fs := common.NewMemoryFileSystem()
+		path := "/checksum.db"
+
+		// The checksum type passed when opening an existing file is ignored in favor of the one in its MainHeader.
+		if err := writeBlockValue(fs, path, checksumType, true, 42); err != nil {
+			t.Fatalf("%v: %v", checksumType, err)
+		}
+
+		if err := writeBlockValue(fs, path, common.DefaultChecksumType, false, 43); err != nil {
+			t.Fatalf("%v: %v", checksumType, err)
+		}
+
+		manager, err := NewSingleFileBlockManager(fs, path, true, false, common.DefaultChecksumType)
+
+		if err != nil {
+			t.Fatalf("%v: %v", checksumType, err)
+		}
+
+		if actual := manager.(*SingleFileBlockManager).checksumType; actual != checksumType {
+			t.Errorf("Expect checksum type %v, got %v", checksumType, actual)
+		}
+
+		block := NewBlock(manager.GetMetaBlock())
+
+		if err := manager.Read(block); err != nil {
+			t.Fatalf("%v: %v", checksumType, err)
+		}
+
+		if value := binary.LittleEndian.Uint64(block.Buffer()); value != 43 {
+			t.Errorf("%v: expect 43, got %d", checksumType, value)
+		}
+
+		manager.Close()
+	}
+}
+
+func TestSingleFileBlockManagerUnknownChecksumType(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/checksum.db"
+
+	if err := writeBlockValue(fs, path, common.DefaultChecksumType, true, 42); err != nil {
+		t.Fatal(err)
+	}
+
+	handle, err := fs.OpenFile(path, common.WriteOnly, common.NoLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerBuffer := common.NewFileBuffer(HeaderSize)
+	mainHeader := MainHeader{MagicBytes: MagicBytes, VersionNo: VersionNo}
+	mainHeader.Flags[ChecksumTypeFlag] = 255
+	copy(headerBuffer.Buffer(), MainHeaderToBytes(mainHeader))
+
+	if err := headerBuffer.Write(handle, 0, common.DefaultChecksumType); err != nil {
+		t.Fatal(err)
+	}
+
+	handle.Close()
+
+	_, err = NewSingleFileBlockManager(fs, path, true, false, common.DefaultChecksumType)
+	var corruptionErr *common.CorruptionError
+
+	if !errors.As(err, &corruptionErr) {
+		t.Errorf("Expect a CorruptionError, got %v", err)
+	}
+}
+
+// Write the value to a new block and checkpoint a header that points to it.
+func writeBlockValue(fs common.FileSystem, path string, checksumType common.ChecksumType, createNew bool, value uint64) error {
+	manager, err := NewSingleFileBlockManager(fs, path, false, createNew, checksumType)
+
+	if err != nil {
+		return err
+	}
+	defer manager.Close()
+
+	block := manager.CreateBlock()
+	binary.LittleEndian.PutUint64(block.Buffer(), value)
+
+	if err := manager.Write(block); err != nil {
+		return err
+	}
+
+	return manager.WriteHeader(DatabaseHeader{MetaBlock: block.ID})
+}
+
+func BenchmarkBlockRead(b *testing.B) {
+	for _, checksumType := range []common.ChecksumType{common.ChecksumDJB2, common.ChecksumCRC32C, common.ChecksumXXHash64} {
+		b.Run(checksumType.String(), func(b *testing.B) {
+			fs := common.NewMemoryFileSystem()
+
+			if err := writeBlockValue(fs, "/bench.db", checksumType, true, 42); err != nil {
+				b.Fatal(err)
+			}
+
+			manager, err := NewSingleFileBlockManager(fs, "/bench.db", true, false, checksumType)
+
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer manager.Close()
+
+			block := NewBlock(manager.GetMetaBlock())
+			b.SetBytes(BlockSize)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if err := manager.Read(block); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// Write a block with the given value and return its id.
+func writeBlock(t *testing.T, manager BlockManager, value uint64) BlockID {
+	block := manager.CreateBlock()
+	binary.LittleEndian.PutUint64(block.Buffer(), value)
+
+	if err := manager.Write(block); err != nil {
+		t.Fatal(err)
+	}
+
+	return block.ID
+}
+
+func TestSingleFileBlockManagerModifiedBlocks(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	manager, err := NewSingleFileBlockManager(fs, "/free.db", false, true, common.DefaultChecksumType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	metaBlock := writeBlock(t, manager, 1)
+
+	if err := manager.WriteHeader(DatabaseHeader{MetaBlock: metaBlock}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The block is still referenced by the active header, so it must not be reused before the next checkpoint.
+	manager.MarkBlockAsModified(metaBlock)
+	newMetaBlock := writeBlock(t, manager, 2)
+
+	if newMetaBlock == metaBlock {
+		t.Fatalf("Expect block %d referenced by the active header not to be reused", metaBlock)
+	}
+
+	// A block that was never part of a checkpoint can be reused right away.
+	unused := writeBlock(t, manager, 3)
+	manager.MarkBlockAsFree(unused)
+
+	if blockID := manager.GetFreeBlockID(); blockID != unused {
+		t.Errorf("Expect free block %d to be reused, got %d", unused, blockID)
+	}
+
+	if err := manager.WriteHeader(DatabaseHeader{MetaBlock: newMetaBlock}); err != nil {
+		t.Fatal(err)
+	}
+
+	// After the checkpoint, the modified block is free.
+	if blockID := manager.GetFreeBlockID(); blockID != metaBlock {
+		t.Errorf("Expect modified block %d to be reused after the checkpoint, got %d", metaBlock, blockID)
+	}
+}
+
+func TestSingleFileBlockManagerFreeListPersists(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/free.db"
+	manager, err := NewSingleFileBlockManager(fs, path, false, true, common.DefaultChecksumType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var blocks []BlockID
+
+	for i := 0; i < 8; i++ {
+		blocks = append(blocks, writeBlock(t, manager, uint64(i)))
+	}
+
+	if err := manager.WriteHeader(DatabaseHeader{MetaBlock: blocks[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Free every other block.
+	for i := 1; i < len(blocks); i += 2 {
+		manager.MarkBlockAsModified(blocks[i])
+	}
+
+	if err := manager.WriteHeader(DatabaseHeader{MetaBlock: blocks[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.Close()
+
+	manager, err = NewSingleFileBlockManager(fs, path, false, false, common.DefaultChecksumType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	// The free list was loaded, except for the block it is stored in, which is in use until the next checkpoint.
+	freeListBlocks := manager.(*SingleFileBlockManager).freeListBlocks
+	used := map[BlockID]bool{blocks[0]: true, blocks[2]: true, blocks[4]: true, blocks[6]: true}
+
+	for _, blockID := range freeListBlocks {
+		used[blockID] = true
+	}
+
+	var reused []BlockID
+
+	for i := 0; i < 4; i++ {
+		blockID := manager.GetFreeBlockID()
+
+		if used[blockID] {
+			t.Fatalf("Expect block %d that is in use not to be reused", blockID)
+		}
+
+		reused = append(reused, blockID)
+	}
+
+	for i := 1; i < len(reused); i++ {
+		if reused[i] <= reused[i-1] {
+			t.Errorf("Expect the lowest free blocks to be reused first, got %v", reused)
+		}
+	}
+
+	for _, blockID := range reused {
+		manager.MarkBlockAsFree(blockID)
+	}
+
+	// The next checkpoint frees the blocks of the old free list.
+	if err := manager.WriteHeader(DatabaseHeader{MetaBlock: blocks[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	freeList := manager.(*SingleFileBlockManager).freeList
+	maxBlock := manager.(*SingleFileBlockManager).maxBlock
+
+	for _, blockID := range freeListBlocks {
+		free := blockID >= maxBlock // Free blocks at the end of the file are truncated.
+
+		if index := searchBlock(freeList, blockID); index < len(freeList) && freeList[index] == blockID {
+			free = true
+		}
+
+		if !free {
+			t.Errorf("Expect free list block %d of the previous checkpoint to be free", blockID)
+		}
+	}
+}
+
+func TestSingleFileBlockManagerDoubleFree(t *testing.T) {
+	manager, err := NewSingleFileBlockManager(common.NewMemoryFileSystem(), "/free.db", false, true, common.DefaultChecksumType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	blockID := writeBlock(t, manager, 1)
+	manager.MarkBlockAsFree(blockID)
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expect freeing a block twice to panic")
+		}
+	}()
+
+	manager.MarkBlockAsFree(blockID)
+}
+
+// Write the list of data blocks to a new meta block chain and checkpoint a header that points to it. The meta blocks of
+// the previous checkpoint are marked as modified.
+func checkpointBlockList(t *testing.T, manager BlockManager, metaBlocks []BlockID, dataBlocks []BlockID) []BlockID {
+	for _, blockID := range metaBlocks {
+		manager.MarkBlockAsModified(blockID)
+	}
+
+	writer := NewMetaBlockWriter(manager)
+	writer.WriteList(len(dataBlocks), func(index int) error { return writer.WriteInt64(int64(dataBlocks[index])) })
+
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := manager.WriteHeader(DatabaseHeader{MetaBlock: writer.Blocks()[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	return writer.Blocks()
+}
+
+func fileBlockCount(t *testing.T, fs common.FileSystem, manager BlockManager) int64 {
+	size, err := fs.GetFileSize(manager.(*SingleFileBlockManager).handle)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if (size-BlockStart)%BlockSize != 0 {
+		t.Fatalf("Expect the file to hold whole blocks, got %d bytes", size)
+	}
+
+	return (size - BlockStart) / BlockSize
+}
+
+func TestSingleFileBlockManagerTruncate(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/truncate.db"
+	manager, err := NewSingleFileBlockManager(fs, path, false, true, common.DefaultChecksumType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dataBlocks []BlockID
+
+	for i := 0; i < 10; i++ {
+		dataBlocks = append(dataBlocks, writeBlock(t, manager, uint64(i)))
+	}
+
+	metaBlocks := checkpointBlockList(t, manager, nil, dataBlocks)
+
+	// Drop the data blocks at the end of the file.
+	for _, blockID := range dataBlocks[4:] {
+		manager.MarkBlockAsModified(blockID)
+	}
+
+	metaBlocks = checkpointBlockList(t, manager, metaBlocks, dataBlocks[:4])
+
+	// The new meta block and free list were written after the end of the file, as the dropped blocks are only free once
+	// the checkpoint is committed.
+	if count := fileBlockCount(t, fs, manager); count != 13 {
+		t.Errorf("Expect the file to hold 13 blocks, got %d", count)
+	}
+
+	// The next checkpoint writes its meta block to the lowest free block (4). All blocks after it are free, so the file
+	// is truncated and no free list is needed.
+	checkpointBlockList(t, manager, metaBlocks, dataBlocks[:4])
+
+	if count := fileBlockCount(t, fs, manager); count != 5 {
+		t.Errorf("Expect the file to be truncated to 5 blocks, got %d", count)
+	}
+
+	manager.Close()
+	manager, err = NewSingleFileBlockManager(fs, path, false, false, common.DefaultChecksumType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	if maxBlock := manager.(*SingleFileBlockManager).maxBlock; maxBlock != 5 {
+		t.Errorf("Expect the BlockCount of the header to be 5, got %d", maxBlock)
+	}
+
+	if blockID := manager.GetFreeBlockID(); blockID != 5 {
+		t.Errorf("Expect new blocks to be appended after the truncated file, got %d", blockID)
+	}
+}
+
+func TestSingleFileBlockManagerVacuum(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/vacuum.db"
+	manager, err := NewSingleFileBlockManager(fs, path, false, true, common.DefaultChecksumType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dataBlocks []BlockID
+
+	for i := 0; i < 20; i++ {
+		dataBlocks = append(dataBlocks, writeBlock(t, manager, uint64(i)))
+	}
+
+	metaBlocks := checkpointBlockList(t, manager, nil, dataBlocks)
+
+	// Drop the data blocks at the front of the file: the file cannot be truncated.
+	for _, blockID := range dataBlocks[:15] {
+		manager.MarkBlockAsModified(blockID)
+	}
+
+	dataBlocks = dataBlocks[15:]
+	metaBlocks = checkpointBlockList(t, manager, metaBlocks, dataBlocks)
+	sizeBefore := fileBlockCount(t, fs, manager)
+
+	// Vacuum: move the live blocks to the front, rewrite the references and checkpoint twice, the second checkpoint
+	// frees the free list blocks of the first.
+	relocated, err := manager.RelocateBlocks(dataBlocks)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, blockID := range dataBlocks {
+		if newBlockID, ok := relocated[blockID]; ok {
+			dataBlocks[i] = newBlockID
+		}
+	}
+
+	metaBlocks = checkpointBlockList(t, manager, metaBlocks, dataBlocks)
+	metaBlocks = checkpointBlockList(t, manager, metaBlocks, dataBlocks)
+
+	if sizeAfter := fileBlockCount(t, fs, manager); sizeAfter >= sizeBefore || sizeAfter > 8 {
+		t.Errorf("Expect vacuum to shrink the file from %d blocks to at most 8, got %d", sizeBefore, sizeAfter)
+	}
+
+	manager.Close()
+	manager, err = NewSingleFileBlockManager(fs, path, true, false, common.DefaultChecksumType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer manager.Close()
+
+	// The relocated blocks hold their data, as referenced by the new meta blocks.
+	reader, err := NewMetaBlockReader(manager, manager.GetMetaBlock())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i := 15
+	err = reader.ReadList(func(index int) error {
+		blockID, err := reader.ReadInt64()
+
+		if err != nil {
+			return err
+		}
+
+		block := NewBlock(BlockID(blockID))
+
+		if err := manager.Read(block); err != nil {
+			return err
+		}
+
+		if value := binary.LittleEndian.Uint64(block.Buffer()); value != uint64(i) {
+			t.Errorf("Expect block %d to contain %d, got %d", blockID, i, value)
+		}
+
+		i++
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSingleFileBlockManagerNotDatabase(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+
+	for path, content := range map[string][]byte{
+		"/empty.db": nil,
+		"/small.db": []byte("DUCK"),
+		"/text.db":  []byte(strings.Repeat("this is not a database file\n", 1000)),
+	} {
+		writeTestFile(t, fs, path, content)
+
+		for _, readOnly := range []bool{true, false} {
+			_, err := NewSingleFileBlockManager(fs, path, readOnly, false, common.DefaultChecksumType)
+			var notDatabaseErr *NotDatabaseError
+
+			if !errors.As(err, &notDatabaseErr) || notDatabaseErr.Path != path {
+				t.Errorf("Expect a NotDatabaseError for %s, got %v", path, err)
+			}
+		}
+	}
+}
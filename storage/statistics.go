@@ -0,0 +1,522 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/goduckdb/common"
+)
+
+// The BaseStatistics describe the values of a column segment, or of a column of a row group: the minimum and maximum
+// (the zone map), the number of NULL values and an estimate of the number of distinct values. They are persisted with
+// the DataPointers and RowGroupPointers, so that scans can skip segments and row groups whose values cannot match a
+// filter without reading them, and so that the planner can estimate the cardinality of a filter.
+type BaseStatistics struct {
+	Type      common.TypeID
+	Count     uint64      // The number of rows.
+	NullCount uint64      // The number of NULL values.
+	Min       interface{} // A lower bound of the values, or nil if there is none (e.g. no values are known).
+	Max       interface{} // An upper bound of the values, or nil if there is none.
+	distinct  hyperLogLog
+}
+
+// String bounds are truncated to this many bytes, so that long strings do not bloat the metadata.
+const statisticsStringLimit = 32
+
+// Create the statistics of an empty column of the given type.
+func NewBaseStatistics(typ common.TypeID) *BaseStatistics {
+	return &BaseStatistics{Type: typ}
+}
+
+// Compute the statistics of the values of the vector.
+func newVectorStatistics(vector *common.Vector) *BaseStatistics {
+	stats := NewBaseStatistics(vector.Type())
+	stats.Update(vector)
+
+	return stats
+}
+
+// The estimated number of distinct values, which is never larger than the number of non-NULL values.
+func (stats *BaseStatistics) DistinctCount() uint64 {
+	estimate := stats.distinct.estimate()
+
+	if valid := stats.Count - stats.NullCount; estimate > valid {
+		return valid
+	}
+
+	return estimate
+}
+
+func (stats *BaseStatistics) Copy() *BaseStatistics {
+	result := *stats
+	return &result
+}
+
+// Update the statistics with the values of the vector. NULL values are counted, but do not affect the bounds and the
+// distinct count.
+func (stats *BaseStatistics) Update(vector *common.Vector) {
+	count := vector.Len()
+	nullCount := vector.Validity().NullCount(count)
+
+	if nullCount > 0 {
+		valid := common.NewVector(vector.Type(), count-nullCount)
+		valid.AppendVector(vector, 0, count)
+		selection := make([]bool, count)
+
+		for i := range selection {
+			selection[i] = !vector.IsNull(i)
+		}
+
+		valid.Filter(selection)
+		vector = valid
+	}
+
+	if vector.Len() == 0 {
+		stats.merge(&BaseStatistics{Type: stats.Type, Count: uint64(count), NullCount: uint64(nullCount)})
+		return
+	}
+
+	min, max := vectorMinMax(vector)
+	stats.merge(&BaseStatistics{Type: stats.Type, Count: uint64(count), NullCount: uint64(nullCount), Min: min,
+		Max: max})
+
+	hashes := make([]uint64, vector.Len())
+	common.HashVector(vector.Data(), hashes)
+
+	for _, hash := range hashes {
+		stats.distinct.add(hash)
+	}
+}
+
+// Merge the statistics of other rows into the statistics.
+func (stats *BaseStatistics) Merge(other *BaseStatistics) {
+	stats.merge(other)
+	stats.distinct.merge(&other.distinct)
+}
+
+func (stats *BaseStatistics) merge(other *BaseStatistics) {
+	// A bound is only known if it is known for the values of both sides that are not NULL.
+	stats.Min = mergeBound(stats.Min, stats.Count-stats.NullCount, other.Min, other.Count-other.NullCount, -1)
+	stats.Max = mergeBound(stats.Max, stats.Count-stats.NullCount, other.Max, other.Count-other.NullCount, 1)
+	stats.Count += other.Count
+	stats.NullCount += other.NullCount
+}
+
+// Merge the bounds of two sets of values, direction is -1 for the minimum and 1 for the maximum.
+func mergeBound(bound interface{}, count uint64, otherBound interface{}, otherCount uint64, direction int) interface{} {
+	switch {
+	case otherCount == 0:
+		return bound
+	case count == 0:
+		return otherBound
+	case bound == nil || otherBound == nil:
+		return nil
+	case compareValues(otherBound, bound)*direction > 0:
+		return otherBound
+	default:
+		return bound
+	}
+}
+
+// Whether rows with values that match the filter may exist, returns false if the statistics prove that no value
+// matches.
+func (stats *BaseStatistics) MayMatch(filter *TableFilter) bool {
+	if stats.Count == stats.NullCount {
+		// NULL values never match a comparison.
+		return false
+	}
+
+	min, max := stats.Min, stats.Max
+
+	switch filter.Comparison {
+	case CompareEqual:
+		return (min == nil || compareValues(min, filter.Constant) <= 0) &&
+			(max == nil || compareValues(max, filter.Constant) >= 0)
+	case CompareNotEqual:
+		return min == nil || max == nil || compareValues(min, filter.Constant) != 0 ||
+			compareValues(max, filter.Constant) != 0
+	case CompareLessThan:
+		return min == nil || compareValues(min, filter.Constant) < 0
+	case CompareLessThanOrEqual:
+		return min == nil || compareValues(min, filter.Constant) <= 0
+	case CompareGreaterThan:
+		return max == nil || compareValues(max, filter.Constant) > 0
+	default:
+		return max == nil || compareValues(max, filter.Constant) >= 0
+	}
+}
+
+// The default selectivity of a filter that cannot be estimated from the statistics.
+const defaultSelectivity = 0.2
+
+// Estimate the fraction of the rows that match the filter, assuming that the values are uniformly distributed between
+// the minimum and the maximum.
+func (stats *BaseStatistics) Selectivity(filter *TableFilter) float64 {
+	if stats.Count == 0 || !stats.MayMatch(filter) {
+		return 0
+	}
+
+	valid := float64(stats.Count-stats.NullCount) / float64(stats.Count)
+	equal := valid / math.Max(float64(stats.DistinctCount()), 1)
+
+	switch filter.Comparison {
+	case CompareEqual:
+		return equal
+	case CompareNotEqual:
+		return valid - equal
+	}
+
+	min, minOK := numericValue(stats.Min)
+	max, maxOK := numericValue(stats.Max)
+	constant, constantOK := numericValue(filter.Constant)
+
+	if !minOK || !maxOK || !constantOK || !(max > min) {
+		return valid * defaultSelectivity
+	}
+
+	// The fraction of the range that is below the constant.
+	below := math.Min(math.Max((constant-min)/(max-min), 0), 1)
+
+	if filter.Comparison == CompareLessThan || filter.Comparison == CompareLessThanOrEqual {
+		return valid * below
+	}
+
+	return valid * (1 - below)
+}
+
+// The value as a float64, if it is a number.
+func numericValue(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float32:
+		return float64(v), !math.IsNaN(float64(v))
+	case float64:
+		return v, !math.IsNaN(v)
+	default:
+		return 0, false
+	}
+}
+
+// Compare two values of the same type, in the order of TableFilter comparisons.
+func compareValues(a interface{}, b interface{}) int {
+	switch a := a.(type) {
+	case bool:
+		return compareOrdered(boolToInt(a), boolToInt(b.(bool)))
+	case int8:
+		return compareOrdered(a, b.(int8))
+	case int16:
+		return compareOrdered(a, b.(int16))
+	case int32:
+		return compareOrdered(a, b.(int32))
+	case int64:
+		return compareOrdered(a, b.(int64))
+	case float32:
+		return compareOrdered(a, b.(float32))
+	case float64:
+		return compareOrdered(a, b.(float64))
+	case string:
+		return compareOrdered(a, b.(string))
+	case []byte:
+		return bytes.Compare(a, b.([]byte))
+	default:
+		panic(fmt.Sprintf("Cannot compare %T", a))
+	}
+}
+
+// The minimum and maximum of the values of a non-empty vector. String bounds are truncated, the maximum is nil if it
+// cannot be truncated.
+func vectorMinMax(vector *common.Vector) (interface{}, interface{}) {
+	switch values := vector.Data().(type) {
+	case []bool:
+		min, max := sliceMinMax(values, func(a bool, b bool) int { return compareOrdered(boolToInt(a), boolToInt(b)) })
+		return min, max
+	case []int8:
+		return sliceMinMax(values, compareOrdered[int8])
+	case []int16:
+		return sliceMinMax(values, compareOrdered[int16])
+	case []int32:
+		return sliceMinMax(values, compareOrdered[int32])
+	case []int64:
+		return sliceMinMax(values, compareOrdered[int64])
+	case []float32:
+		return sliceMinMax(values, compareOrdered[float32])
+	case []float64:
+		return sliceMinMax(values, compareOrdered[float64])
+	case []string:
+		min, max := sliceMinMax(values, compareOrdered[string])
+		minBound, maxBound := truncateMin([]byte(min)), truncateMax([]byte(max))
+
+		if maxBound == nil {
+			return string(minBound), nil
+		}
+
+		return string(minBound), string(maxBound)
+	case [][]byte:
+		min, max := sliceMinMax(values, bytes.Compare)
+		minBound, maxBound := truncateMin(min), truncateMax(max)
+
+		if maxBound == nil {
+			return minBound, nil
+		}
+
+		return minBound, maxBound
+	default:
+		panic(fmt.Sprintf("Cannot compute the statistics of %T", values))
+	}
+}
+
+func sliceMinMax[T any](values []T, compare func(a T, b T) int) (T, T) {
+	min, max := values[0], values[0]
+
+	for _, value := range values[1:] {
+		if compare(value, min) < 0 {
+			min = value
+		}
+
+		if compare(value, max) > 0 {
+			max = value
+		}
+	}
+
+	return min, max
+}
+
+// A lower bound of the value of at most statisticsStringLimit bytes: a prefix of the value.
+func truncateMin(value []byte) []byte {
+	if len(value) > statisticsStringLimit {
+		value = value[:statisticsStringLimit]
+	}
+
+	return append([]byte{}, value...)
+}
+
+// An upper bound of the value of at most statisticsStringLimit bytes: a prefix of the value with its last byte
+// incremented. Returns nil if there is no such bound, because the prefix consists of 0xFF bytes.
+func truncateMax(value []byte) []byte {
+	if len(value) <= statisticsStringLimit {
+		return append([]byte{}, value...)
+	}
+
+	bound := append([]byte{}, value[:statisticsStringLimit]...)
+
+	for i := len(bound) - 1; i >= 0; i-- {
+		if bound[i] != 0xFF {
+			bound[i]++
+			return bound[:i+1]
+		}
+	}
+
+	return nil
+}
+
+func (stats *BaseStatistics) Serialize(serializer common.Serializer) error {
+	writer := common.NewFieldWriter(serializer)
+
+	if err := writer.WriteField(1, func(s common.Serializer) error { return s.WriteUint8(uint8(stats.Type)) }); err != nil {
+		return err
+	}
+
+	if err := writer.WriteField(2, func(s common.Serializer) error { return s.WriteVarint(stats.Count) }); err != nil {
+		return err
+	}
+
+	err := writer.WriteFieldWithDefault(3, stats.NullCount == 0, func(s common.Serializer) error {
+		return s.WriteVarint(stats.NullCount)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteFieldWithDefault(4, stats.Min == nil, func(s common.Serializer) error {
+		return writeValue(s, stats.Min)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteFieldWithDefault(5, stats.Max == nil, func(s common.Serializer) error {
+		return writeValue(s, stats.Max)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	err = writer.WriteField(6, func(s common.Serializer) error { return s.WriteBytes(stats.distinct[:]) })
+
+	if err != nil {
+		return err
+	}
+
+	return writer.Finalize()
+}
+
+func (stats *BaseStatistics) Deserialize(deserializer common.Deserializer) error {
+	reader := common.NewFieldReader(deserializer)
+
+	if err := reader.ReadField(1, func(d common.Deserializer) error {
+		typ, err := d.ReadUint8()
+		stats.Type = common.TypeID(typ)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if !stats.Type.Valid() {
+		return common.NewSerializationError(fmt.Sprintf("invalid statistics type %s", stats.Type))
+	}
+
+	if err := reader.ReadField(2, func(d common.Deserializer) (err error) {
+		stats.Count, err = d.ReadVarint()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if _, err := reader.ReadFieldWithDefault(3, func(d common.Deserializer) (err error) {
+		stats.NullCount, err = d.ReadVarint()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if _, err := reader.ReadFieldWithDefault(4, func(d common.Deserializer) (err error) {
+		stats.Min, err = readValue(d, stats.Type)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if _, err := reader.ReadFieldWithDefault(5, func(d common.Deserializer) (err error) {
+		stats.Max, err = readValue(d, stats.Type)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := reader.ReadField(6, func(d common.Deserializer) error {
+		registers, err := d.ReadBytes()
+
+		if err == nil && len(registers) != len(stats.distinct) {
+			return common.NewSerializationError(fmt.Sprintf("invalid distinct count sketch of %d bytes", len(registers)))
+		}
+
+		copy(stats.distinct[:], registers)
+
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return reader.Finalize()
+}
+
+func writeValue(serializer common.Serializer, value interface{}) error {
+	switch v := value.(type) {
+	case bool:
+		return serializer.WriteBool(v)
+	case int8:
+		return serializer.WriteInt8(v)
+	case int16:
+		return serializer.WriteInt16(v)
+	case int32:
+		return serializer.WriteInt32(v)
+	case int64:
+		return serializer.WriteInt64(v)
+	case float32:
+		return serializer.WriteFloat32(v)
+	case float64:
+		return serializer.WriteFloat64(v)
+	case string:
+		return serializer.WriteString(v)
+	case []byte:
+		return serializer.WriteBytes(v)
+	default:
+		panic(fmt.Sprintf("Cannot serialize a %T statistics value", v))
+	}
+}
+
+func readValue(deserializer common.Deserializer, typ common.TypeID) (interface{}, error) {
+	switch typ {
+	case common.Boolean:
+		return deserializer.ReadBool()
+	case common.TinyInt:
+		return deserializer.ReadInt8()
+	case common.SmallInt:
+		return deserializer.ReadInt16()
+	case common.Integer:
+		return deserializer.ReadInt32()
+	case common.BigInt, common.Timestamp:
+		return deserializer.ReadInt64()
+	case common.Float:
+		return deserializer.ReadFloat32()
+	case common.Double:
+		return deserializer.ReadFloat64()
+	case common.Varchar:
+		return deserializer.ReadString()
+	default:
+		return deserializer.ReadBytes()
+	}
+}
+
+// The hyperLogLog estimates the number of distinct values from their hashes (Flajolet et al., 2007): every register
+// holds the maximum number of leading zeros (plus one) of the hashes that map to it. Sketches of different rows are
+// merged by taking the maximum of every register, so the distinct count of a row group can be estimated from the
+// sketches of its segments.
+type hyperLogLog [hyperLogLogRegisters]uint8
+
+const (
+	hyperLogLogBits      = 6
+	hyperLogLogRegisters = 1 << hyperLogLogBits
+)
+
+func (sketch *hyperLogLog) add(hash uint64) {
+	register := hash & (hyperLogLogRegisters - 1)
+	rank := uint8(bits.LeadingZeros64(hash>>hyperLogLogBits) - hyperLogLogBits + 1)
+
+	if rank > sketch[register] {
+		sketch[register] = rank
+	}
+}
+
+func (sketch *hyperLogLog) merge(other *hyperLogLog) {
+	for i, rank := range other {
+		if rank > sketch[i] {
+			sketch[i] = rank
+		}
+	}
+}
+
+func (sketch *hyperLogLog) estimate() uint64 {
+	const m = float64(hyperLogLogRegisters)
+	sum := 0.0
+	zeros := 0
+
+	for _, rank := range sketch {
+		sum += math.Ldexp(1, -int(rank))
+
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	estimate := 0.709 * m * m / sum
+
+	// Use linear counting for small cardinalities, for which the HyperLogLog estimate is biased.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(math.Round(estimate))
+}
@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goduckdb/common"
+)
+
+func TestStatisticsRoundTrip(t *testing.T) {
+	for _, vector := range []*common.Vector{
+		common.NewVectorFromSlice(common.Boolean, []bool{true, true}),
+		common.NewVectorFromSlice(common.Integer, []int32{7, -3, 12, 7}),
+		common.NewVectorFromSlice(common.Double, []float64{0.5, math.NaN(), -1}),
+		common.NewVectorFromSlice(common.Varchar, []string{"b", "a", strings.Repeat("z", 40)}),
+		common.NewVectorFromSlice(common.Blob, [][]byte{{2}, {1, 2}}),
+	} {
+		stats := newVectorStatistics(vector)
+		serializer := common.NewBufferedSerializer()
+
+		if err := serializer.WriteObject(stats); err != nil {
+			t.Fatal(err)
+		}
+
+		var result BaseStatistics
+
+		if err := common.NewBufferedDeserializer(serializer.Data()).ReadObject(&result); err != nil {
+			t.Fatal(err)
+		}
+
+		// NaN is the maximum of the doubles, and does not equal itself.
+		if vector.Type() == common.Double {
+			if !math.IsNaN(result.Max.(float64)) || result.Min != -1.0 {
+				t.Errorf("Expect the doubles to range from -1 to NaN, got %v and %v", result.Min, result.Max)
+			}
+
+			continue
+		}
+
+		if !reflect.DeepEqual(&result, stats) {
+			t.Errorf("Expect %+v, got %+v", stats, result)
+		}
+	}
+}
+
+func TestStatisticsMayMatch(t *testing.T) {
+	stats := newVectorStatistics(common.NewVectorFromSlice(common.Integer, []int32{10, 20, 15}))
+
+	for _, test := range []struct {
+		comparison ComparisonType
+		constant   int32
+		expected   bool
+	}{
+		{CompareEqual, 15, true},
+		{CompareEqual, 21, false},
+		{CompareNotEqual, 10, true},
+		{CompareLessThan, 10, false},
+		{CompareLessThanOrEqual, 10, true},
+		{CompareGreaterThan, 20, false},
+		{CompareGreaterThanOrEqual, 20, true},
+	} {
+		filter := TableFilter{Comparison: test.comparison, Constant: test.constant}
+
+		if result := stats.MayMatch(&filter); result != test.expected {
+			t.Errorf("Expect the filter %s %d to match %v, got %v", test.comparison, test.constant, test.expected, result)
+		}
+	}
+
+	constant := newVectorStatistics(common.NewVectorFromSlice(common.Integer, []int32{5, 5}))
+
+	if constant.MayMatch(&TableFilter{Comparison: CompareNotEqual, Constant: int32(5)}) {
+		t.Errorf("Expect a column of equal values not to match a filter for other values")
+	}
+
+	if NewBaseStatistics(common.Integer).MayMatch(&TableFilter{Comparison: CompareNotEqual, Constant: int32(5)}) {
+		t.Errorf("Expect an empty column not to match any filter")
+	}
+
+	// Long strings are truncated to bounds that still contain every value.
+	long := strings.Repeat("a", 50)
+	bounds := newVectorStatistics(common.NewVectorFromSlice(common.Varchar, []string{long + "b", long + "c"}))
+
+	if len(bounds.Min.(string)) > statisticsStringLimit || len(bounds.Max.(string)) > statisticsStringLimit {
+		t.Errorf("Expect the string bounds to be truncated, got %q and %q", bounds.Min, bounds.Max)
+	}
+
+	if !bounds.MayMatch(&TableFilter{Comparison: CompareEqual, Constant: long + "c"}) ||
+		bounds.MayMatch(&TableFilter{Comparison: CompareGreaterThan, Constant: "b"}) {
+		t.Errorf("Expect the truncated bounds to contain the values")
+	}
+}
+
+func TestDistinctCountEstimate(t *testing.T) {
+	for _, distinct := range []int{1, 10, 1000, 100000} {
+		values := make([]int64, 200000)
+
+		for i := range values {
+			values[i] = int64(i % distinct)
+		}
+
+		// The sketches of parts of the values merge into the sketch of all values.
+		stats := newVectorStatistics(common.NewVectorFromSlice(common.BigInt, values[:50000]))
+		stats.Merge(newVectorStatistics(common.NewVectorFromSlice(common.BigInt, values[50000:])))
+		estimate := float64(stats.DistinctCount())
+
+		if math.Abs(estimate-float64(distinct)) > 0.4*float64(distinct) {
+			t.Errorf("Expect about %d distinct values, got %v", distinct, estimate)
+		}
+	}
+}
+
+func TestZoneMapPruning(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/events.db"
+	storageManager := openTestStorage(t, fs, path)
+	info := TableInfo{Name: "events", Columns: []ColumnDefinition{
+		{Name: "ts", Type: common.Timestamp},
+		{Name: "key", Type: common.Varchar},
+	}}
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Three row groups of events, one per second, the last row group starts in 2026.
+	count := 3 * RowGroupSize
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).Add(-2 * RowGroupSize * time.Second).UnixMicro()
+	chunk := common.NewDataChunk(info.Types(), count)
+
+	for i := 0; i < count; i++ {
+		chunk.Columns[0].Append(start + int64(i)*1000000)
+		chunk.Columns[1].Append(fmt.Sprintf("%08d-%s", i, strings.Repeat("x", 24)))
+	}
+
+	if err := table.Append(chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	storageManager = openTestStorage(t, fs, path)
+	defer storageManager.Close()
+
+	table = storageManager.GetTable("events")
+	newYear := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).UnixMicro()
+	filters := []TableFilter{{ColumnID: 0, Comparison: CompareGreaterThan, Constant: newYear}}
+	rows := 0
+	misses := storageManager.BufferManager().Metrics().Misses
+
+	err = table.ScanWithFilters([]int{0}, filters, func(chunk *common.DataChunk) error {
+		rows += chunk.Len()
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rows != RowGroupSize-1 {
+		t.Errorf("Expect %d rows after the new year, got %d", RowGroupSize-1, rows)
+	}
+
+	// Only the blocks of the last row group are read.
+	misses = storageManager.BufferManager().Metrics().Misses - misses
+
+	if blocks := table.RowGroups()[2].Column(0).blocks(); misses != uint64(len(blocks)) {
+		t.Errorf("Expect only the %d blocks of the timestamps of the last row group to be read, got %d", len(blocks),
+			misses)
+	}
+
+	// A point filter on the keys, which span several segments per row group, only matches a single segment.
+	key := fmt.Sprintf("%08d-%s", 1234, strings.Repeat("x", 24))
+	filter := TableFilter{ColumnID: 1, Comparison: CompareEqual, Constant: key}
+	matching := 0
+	segments := table.RowGroups()[0].Column(1).Segments()
+
+	for _, segment := range segments {
+		if segment.Statistics().MayMatch(&filter) {
+			matching++
+		}
+	}
+
+	if len(segments) < 2 || matching != 1 {
+		t.Errorf("Expect a single one of %d segments to match the key, got %d", len(segments), matching)
+	}
+
+	// The statistics are exposed for cardinality estimation.
+	stats, err := table.Statistics(0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Min != start || stats.Max != start+int64(count-1)*1000000 || stats.Count != uint64(count) {
+		t.Errorf("Expect the timestamps to range from %d to %d, got %v and %v", start, start+int64(count-1)*1000000,
+			stats.Min, stats.Max)
+	}
+
+	for _, test := range []struct {
+		filters  []TableFilter
+		expected float64
+	}{
+		{filters, RowGroupSize},
+		{[]TableFilter{filter}, 1},
+		{[]TableFilter{{ColumnID: 0, Comparison: CompareLessThan, Constant: start}}, 0},
+		{nil, float64(count)},
+	} {
+		estimate, err := table.EstimateCardinality(test.filters)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if math.Abs(float64(estimate)-test.expected) > 0.4*test.expected+1 {
+			t.Errorf("Expect about %v rows to match %v, got %d", test.expected, test.filters, estimate)
+		}
+	}
+}
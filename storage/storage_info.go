@@ -1,8 +1,11 @@
 package storage
 
 import (
+	"bytes"
 	"encoding/binary"
 	"unsafe"
+
+	"github.com/goduckdb/common"
 )
 
 // Size of a memory slot managed by the StorageManager. This is the quantum of allocation for Blocks on DuckDB. We
@@ -11,14 +14,60 @@ const (
 	BlockSize    = 262144
 	HeaderSize   = 4096
 	InvalidBlock = -1
-	VersionNo    = 1
+	VersionNo    = 2 // The storage version of the files that are written.
+)
+
+// The MagicBytes that every database file starts with, from storage version 2 on.
+var MagicBytes = [4]byte{'D', 'U', 'C', 'K'}
+
+// A StorageCapability describes what this version of goduckdb can do with the database files of a storage version.
+type StorageCapability uint8
+
+const (
+	StorageUnsupported StorageCapability = iota // The files cannot be opened, e.g. they were written by a newer version.
+	StorageReadOnly                             // The files can be read, but must be migrated before they are written.
+	StorageReadWrite                            // The files can be read and written.
 )
 
+func (capability StorageCapability) String() string {
+	switch capability {
+	case StorageReadOnly:
+		return "read-only"
+	case StorageReadWrite:
+		return "read-write"
+	default:
+		return "unsupported"
+	}
+}
+
+// The storage versions that this version of goduckdb can open, and what it can do with them. The versions differ in:
+//   - 1: the MainHeader starts with the version number, without MagicBytes.
+//   - 2: the MainHeader starts with the MagicBytes.
+var storageVersions = map[uint64]StorageCapability{
+	1: StorageReadOnly,
+	2: StorageReadWrite,
+}
+
+// Returns what this version of goduckdb can do with the database files of the given storage version.
+func GetStorageCapability(version uint64) StorageCapability {
+	return storageVersions[version]
+}
+
+// The index of the MainHeader flag that records the ChecksumType of the blocks and headers in the file. Files that
+// were written before the checksum type was recorded store 0, which is common.ChecksumDJB2.
+const ChecksumTypeFlag = 0
+
 // The MainHeader is the first header in the storage file.
 // The MainHeader is typically written only once for a database file.
 type MainHeader struct {
-	VersionNo uint64 // The version of the database.
-	Flags     [4]uint64
+	MagicBytes [4]byte // The MagicBytes, which identify the file as a database file.
+	VersionNo  uint64  // The version of the database.
+	Flags      [4]uint64
+}
+
+// The checksum algorithm used for the blocks and headers of the file.
+func (header MainHeader) ChecksumType() common.ChecksumType {
+	return common.ChecksumType(header.Flags[ChecksumTypeFlag])
 }
 
 // The DatabaseHeader contains information about the current state of the database. Every storage file has two
@@ -51,17 +100,26 @@ func BytesToDatabaseHeader(buffer []byte) DatabaseHeader {
 	var header DatabaseHeader
 	header.Iteration = binary.LittleEndian.Uint64(buffer)
 	buffer = buffer[unsafe.Sizeof(header.Iteration):]
-	header.MetaBlock = BlockID(binary.LittleEndian.Uint32(buffer))
+	header.MetaBlock = BlockID(binary.LittleEndian.Uint64(buffer))
 	buffer = buffer[unsafe.Sizeof(header.MetaBlock):]
-	header.FreeList = BlockID(binary.LittleEndian.Uint32(buffer))
+	header.FreeList = BlockID(binary.LittleEndian.Uint64(buffer))
 	buffer = buffer[unsafe.Sizeof(header.FreeList):]
 	header.BlockCount = binary.LittleEndian.Uint64(buffer)
 
 	return header
 }
 
+func MainHeaderToBytes(header MainHeader) []byte {
+	buffer := new(ByteSlice)
+	binary.Write(buffer, binary.LittleEndian, header)
+
+	return []byte(*buffer)
+}
+
 func BytesToMainHeader(buffer []byte) MainHeader {
 	var header MainHeader
+	copy(header.MagicBytes[:], buffer)
+	buffer = buffer[len(header.MagicBytes):]
 	header.VersionNo = binary.LittleEndian.Uint64(buffer)
 	buffer = buffer[unsafe.Sizeof(header.VersionNo):]
 
@@ -72,3 +130,26 @@ func BytesToMainHeader(buffer []byte) MainHeader {
 
 	return header
 }
+
+// Parse the MainHeader of a database file, in the layout of any supported storage version. Returns a NotDatabaseError
+// if the buffer does not hold the MainHeader of a database file.
+func parseMainHeader(path string, buffer []byte) (MainHeader, error) {
+	if bytes.Equal(buffer[:len(MagicBytes)], MagicBytes[:]) {
+		return BytesToMainHeader(buffer), nil
+	}
+
+	// Files of version 1 do not have MagicBytes: the MainHeader starts with the version number, followed by the flags.
+	if binary.LittleEndian.Uint64(buffer) == 1 {
+		header := MainHeader{VersionNo: 1}
+		buffer = buffer[unsafe.Sizeof(header.VersionNo):]
+
+		for i := range header.Flags {
+			header.Flags[i] = binary.LittleEndian.Uint64(buffer)
+			buffer = buffer[unsafe.Sizeof(header.Flags[i]):]
+		}
+
+		return header, nil
+	}
+
+	return MainHeader{}, &NotDatabaseError{Path: path}
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDatabaseHeaderEncoding(t *testing.T) {
+	header := DatabaseHeader{
+		Iteration:  1<<40 + 1,
+		MetaBlock:  1<<33 + 2,
+		FreeList:   InvalidBlock,
+		BlockCount: 1<<35 + 3,
+	}
+
+	if result := BytesToDatabaseHeader(DatabaseHeaderToBytes(header)); result != header {
+		t.Errorf("Expect %+v, got %+v", header, result)
+	}
+}
+
+func TestMainHeaderEncoding(t *testing.T) {
+	header := MainHeader{MagicBytes: MagicBytes, VersionNo: VersionNo, Flags: [4]uint64{2, 0, 1 << 40, 7}}
+	buffer := make([]byte, HeaderSize)
+	copy(buffer, MainHeaderToBytes(header))
+
+	if result, err := parseMainHeader("/test.db", buffer); err != nil || result != header {
+		t.Errorf("Expect %+v, got %+v: %v", header, result, err)
+	}
+
+	// Version 1 headers start with the version number.
+	legacy := make([]byte, HeaderSize)
+	binary.LittleEndian.PutUint64(legacy, 1)
+	binary.LittleEndian.PutUint64(legacy[8:], 2)
+
+	if result, err := parseMainHeader("/test.db", legacy); err != nil || result.VersionNo != 1 || result.ChecksumType() != 2 {
+		t.Errorf("Expect a version 1 header with checksum type 2, got %+v: %v", result, err)
+	}
+
+	var notDatabaseErr *NotDatabaseError
+
+	text := []byte(strings.Repeat("SQLite format 3\x00", 10))
+
+	if _, err := parseMainHeader("/test.db", text); !errors.As(err, &notDatabaseErr) {
+		t.Errorf("Expect a NotDatabaseError, got %v", err)
+	}
+
+	for version, expected := range map[uint64]StorageCapability{
+		0: StorageUnsupported, 1: StorageReadOnly, VersionNo: StorageReadWrite, VersionNo + 1: StorageUnsupported,
+	} {
+		if capability := GetStorageCapability(version); capability != expected {
+			t.Errorf("Expect version %d to be %v, got %v", version, expected, capability)
+		}
+	}
+}
@@ -1,5 +1,562 @@
 package storage
 
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/goduckdb/common"
+)
+
+// The path of a database that is kept in memory only.
+const InMemoryPath = ":memory:"
+
+// The Options the storage of a database is opened with.
+type Options struct {
+	ReadOnly     bool                // Whether the database is opened in read-only mode.
+	ChecksumType common.ChecksumType // The checksum algorithm of newly created database files.
+	MemoryLimit  uint64              // The maximum amount of memory the BufferManager keeps blocks in.
+	// The directory evicted temporary blocks are spilled to, spilling is disabled if it is empty.
+	TempDirectory string
+	// The size of the write-ahead log in bytes after which a commit triggers a checkpoint, automatic checkpoints are
+	// disabled if it is 0.
+	CheckpointThreshold uint64
+}
+
+// The default checkpoint threshold: 16MB.
+const DefaultCheckpointThreshold = 16 << 20
+
+// Returns the Options of a read-write database with the default checksum algorithm and checkpoint threshold, without
+// spilling.
+func DefaultOptions() Options {
+	return Options{
+		ChecksumType:        common.DefaultChecksumType,
+		MemoryLimit:         DefaultMemoryLimit,
+		CheckpointThreshold: DefaultCheckpointThreshold,
+	}
+}
+
+// Returns the default temporary directory of the database at the given path: the path with a ".tmp" suffix. An
+// in-memory database does not spill by default, so that it does not write to the working directory.
+func DefaultTempDirectory(path string) string {
+	if path == "" || path == InMemoryPath {
+		return ""
+	}
+
+	return path + ".tmp"
+}
+
 // StorageManager is responsible for managing the physical storage of the
 // database on disk.
-type StorageManager struct{}
+type StorageManager struct {
+	fs            common.FileSystem
+	path          string         // The path of the database file, or InMemoryPath.
+	options       Options        // The options the database is opened with.
+	blockManager  BlockManager   // The BlockManager the blocks of the database are stored in.
+	bufferManager *BufferManager // The BufferManager that caches the blocks of the BlockManager.
+	wal           *WriteAheadLog // The log changes are written to, nil for in-memory and read-only databases.
+	transactions  *transactionManager
+	// Held by checkpoints, and while tables are created or dropped. Protects tables, metadataBlocks and tablesModified.
+	lock           sync.Mutex
+	tables         map[string]*DataTable
+	metadataBlocks []BlockID // The blocks the table metadata of the active header is stored in.
+	tablesModified bool      // Whether tables have been created or dropped since the last checkpoint.
+}
+
+func NewStorageManager(fs common.FileSystem, path string, options Options) *StorageManager {
+	sm := &StorageManager{
+		fs:      fs,
+		path:    path,
+		options: options,
+		tables:  make(map[string]*DataTable),
+	}
+	sm.transactions = newTransactionManager(options.CheckpointThreshold, sm.lockAndCheckpoint)
+
+	return sm
+}
+
+// Initialize the storage: an in-memory database is backed by an InMemoryBlockManager, otherwise the database file is
+// opened, or created if it does not exist yet.
+func (sm *StorageManager) Initialize() error {
+	if sm.InMemory() {
+		if sm.options.ReadOnly {
+			return errors.New("cannot launch in-memory database in read-only mode")
+		}
+
+		blockManager, err := NewInMemoryBlockManager()
+
+		if err != nil {
+			return err
+		}
+
+		sm.blockManager = blockManager
+		sm.bufferManager = NewBufferManager(blockManager, sm.options.MemoryLimit, sm.temporaryFileManager())
+
+		return nil
+	}
+
+	exists, err := sm.fs.FileExists(sm.path)
+
+	if err != nil {
+		return err
+	}
+
+	if !exists && sm.options.ReadOnly {
+		return common.NewIOError("open database file in read-only mode", sm.path, os.ErrNotExist)
+	}
+
+	blockManager, err := NewSingleFileBlockManager(sm.fs, sm.path, sm.options.ReadOnly, !exists, sm.options.ChecksumType)
+
+	if err != nil {
+		return err
+	}
+
+	temporaryFiles := sm.temporaryFileManager()
+
+	// Other databases may share the temporary directory, only the files that they do not use any longer are removed.
+	if temporaryFiles != nil && !sm.options.ReadOnly {
+		if err := temporaryFiles.RemoveStaleFiles(); err != nil {
+			blockManager.Close()
+			return err
+		}
+	}
+
+	sm.blockManager = blockManager
+	sm.bufferManager = NewBufferManager(blockManager, sm.options.MemoryLimit, temporaryFiles)
+
+	if err := sm.loadTables(); err != nil {
+		sm.Close()
+		return err
+	}
+
+	if err := sm.replayWAL(!exists); err != nil {
+		sm.Close()
+		return err
+	}
+
+	return nil
+}
+
+// Load the tables that were persisted by the last checkpoint.
+func (sm *StorageManager) loadTables() error {
+	tables, metadataBlocks, err := newCheckpointManager(sm.blockManager, sm.bufferManager).loadFromStorage(sm.options.ReadOnly)
+
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if _, ok := sm.tables[table.info.Name]; ok {
+			return common.NewSerializationError(fmt.Sprintf("duplicate table %q", table.info.Name))
+		}
+
+		sm.tables[table.info.Name] = table
+	}
+
+	sm.metadataBlocks = metadataBlocks
+
+	return nil
+}
+
+// Replay the committed changes of the write-ahead log into the tables. The replayed changes are checkpointed, which
+// truncates the log; a read-only database keeps them in memory, and does not change the log. The log of a database
+// file that has just been created was left behind by a database that has been removed, so it is discarded.
+func (sm *StorageManager) replayWAL(created bool) error {
+	path := WALPath(sm.path)
+	exists, err := sm.fs.FileExists(path)
+
+	if err != nil || (!exists && sm.options.ReadOnly) {
+		return err
+	}
+
+	if exists && created {
+		if err := sm.fs.RemoveFile(path); err != nil {
+			return err
+		}
+	}
+
+	checksumType := sm.blockManager.(*SingleFileBlockManager).ChecksumType()
+	wal, err := OpenWriteAheadLog(sm.fs, path, sm.options.ReadOnly, checksumType)
+
+	if err != nil {
+		return err
+	}
+
+	if err := wal.replay(sm.blockManager.GetMetaBlock(), sm.applyCommit); err != nil {
+		wal.Close()
+		return err
+	}
+
+	if sm.options.ReadOnly {
+		return wal.Close()
+	}
+
+	sm.wal = wal
+	sm.transactions.wal = wal
+
+	for _, table := range sm.tables {
+		table.transactions = sm.transactions
+	}
+
+	if wal.Size() > 0 {
+		return sm.Checkpoint()
+	}
+
+	return nil
+}
+
+// Apply the records of a commit that is replayed from the write-ahead log.
+func (sm *StorageManager) applyCommit(records []walRecord) error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	for _, record := range records {
+		switch record := record.(type) {
+		case *walCreateTable:
+			if _, ok := sm.tables[record.info.Name]; ok {
+				return common.NewSerializationError(fmt.Sprintf("created table %q already exists", record.info.Name))
+			}
+
+			info := record.info
+			sm.tables[info.Name] = newDataTable(&info, sm.bufferManager, sm.options.ReadOnly)
+			sm.tablesModified = true
+		case *walDropTable:
+			table, ok := sm.tables[record.table]
+
+			if !ok {
+				return common.NewSerializationError(fmt.Sprintf("dropped table %q does not exist", record.table))
+			}
+
+			sm.dropTable(table)
+		case *walInsert, *walDelete, *walUpdate:
+			if err := sm.applyTableChange(record); err != nil {
+				return err
+			}
+		default:
+			return common.NewSerializationError(fmt.Sprintf("cannot replay a %s entry", record.walType()))
+		}
+	}
+
+	return nil
+}
+
+// Apply a replayed change of the rows of a table. Called with the lock held.
+func (sm *StorageManager) applyTableChange(record walRecord) error {
+	var name string
+
+	switch record := record.(type) {
+	case *walInsert:
+		name = record.table
+	case *walDelete:
+		name = record.table
+	case *walUpdate:
+		name = record.table
+	}
+
+	table, ok := sm.tables[name]
+
+	if !ok {
+		return common.NewSerializationError(fmt.Sprintf("changed table %q does not exist", name))
+	}
+
+	table.lock.Lock()
+	defer table.lock.Unlock()
+
+	if err := table.verifyChange(record, &pendingChanges{}); err != nil {
+		return common.NewSerializationError(err.Error())
+	}
+
+	table.applyChange(record)
+
+	return nil
+}
+
+func (sm *StorageManager) temporaryFileManager() *TemporaryFileManager {
+	if sm.options.TempDirectory == "" {
+		return nil
+	}
+
+	return NewTemporaryFileManager(sm.fs, sm.options.TempDirectory)
+}
+
+// Whether the database is kept in memory only.
+func (sm *StorageManager) InMemory() bool {
+	return sm.path == "" || sm.path == InMemoryPath
+}
+
+func (sm *StorageManager) BlockManager() BlockManager {
+	return sm.blockManager
+}
+
+func (sm *StorageManager) BufferManager() *BufferManager {
+	return sm.bufferManager
+}
+
+// Create a new, empty table.
+func (sm *StorageManager) CreateTable(info *TableInfo) (*DataTable, error) {
+	if sm.options.ReadOnly {
+		return nil, errors.New("cannot create a table in a read-only database")
+	}
+
+	if err := info.Validate(); err != nil {
+		return nil, err
+	}
+
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	if _, ok := sm.tables[info.Name]; ok {
+		return nil, fmt.Errorf("table %q already exists", info.Name)
+	}
+
+	if err := sm.wal.commit(&walCreateTable{info: *info}); err != nil {
+		return nil, err
+	}
+
+	table := newDataTable(info, sm.bufferManager, false)
+	table.transactions = sm.transactions
+	sm.tables[info.Name] = table
+	sm.tablesModified = true
+
+	return table, nil
+}
+
+// Returns the table with the given name, or nil if it does not exist.
+func (sm *StorageManager) GetTable(name string) *DataTable {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	return sm.tables[name]
+}
+
+// The tables of the database, ordered by name.
+func (sm *StorageManager) Tables() []*DataTable {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	return sm.sortedTables()
+}
+
+// Drop a table. Its blocks are freed by the next checkpoint.
+func (sm *StorageManager) DropTable(name string) error {
+	if sm.options.ReadOnly {
+		return errors.New("cannot drop a table in a read-only database")
+	}
+
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	table, ok := sm.tables[name]
+
+	if !ok {
+		return fmt.Errorf("table %q does not exist", name)
+	}
+
+	if err := sm.wal.commit(&walDropTable{table: name}); err != nil {
+		return err
+	}
+
+	sm.dropTable(table)
+
+	return nil
+}
+
+// Called with the lock held.
+func (sm *StorageManager) dropTable(table *DataTable) {
+	table.lock.Lock()
+	table.dropped = true
+	table.lock.Unlock()
+
+	newCheckpointManager(sm.blockManager, sm.bufferManager).freeBlocks(table.blocks())
+	delete(sm.tables, table.info.Name)
+	sm.tablesModified = true
+}
+
+// Start a transaction. Its changes are committed together, or not at all.
+func (sm *StorageManager) BeginTransaction() *Transaction {
+	return sm.transactions.begin()
+}
+
+// Checkpoint the database: the rows that are kept in memory are written to column segments, and the metadata of all
+// tables is written and committed with a new DatabaseHeader. The checkpoint waits for the running transactions to
+// finish, and new transactions wait for the checkpoint; it must not be called while the caller runs a transaction.
+func (sm *StorageManager) Checkpoint() error {
+	return sm.runCheckpoint(false)
+}
+
+// Checkpoint the database like Checkpoint, but abort the running transactions instead of waiting for them. Only the
+// transactions that are committing are waited for.
+func (sm *StorageManager) ForceCheckpoint() error {
+	return sm.runCheckpoint(true)
+}
+
+func (sm *StorageManager) runCheckpoint(force bool) error {
+	if sm.options.ReadOnly {
+		return errors.New("cannot checkpoint a read-only database")
+	}
+
+	sm.transactions.beginCheckpoint(force)
+	defer sm.transactions.endCheckpoint()
+
+	return sm.lockAndCheckpoint()
+}
+
+func (sm *StorageManager) lockAndCheckpoint() error {
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	return sm.checkpoint()
+}
+
+// Called with the lock held. The tables are locked during the checkpoint, so that every change that is written to the
+// write-ahead log is either persisted by the checkpoint, or written after the log has been truncated.
+func (sm *StorageManager) checkpoint() error {
+	tables := sm.sortedTables()
+
+	for _, table := range tables {
+		table.lock.Lock()
+		defer table.lock.Unlock()
+	}
+
+	metadataBlocks, err := newCheckpointManager(sm.blockManager, sm.bufferManager).createCheckpoint(tables,
+		sm.metadataBlocks, sm.wal)
+
+	if err != nil {
+		return err
+	}
+
+	sm.metadataBlocks = metadataBlocks
+	sm.tablesModified = false
+
+	return sm.wal.Truncate()
+}
+
+// Vacuum the database file: the blocks of the tables are moved to the lowest free blocks, so that the checkpoints that
+// follow can truncate the file. The first checkpoint commits the moved blocks, which frees the blocks they were moved
+// from; the second checkpoint truncates the blocks that have become free at the end of the file.
+func (sm *StorageManager) Vacuum() error {
+	if sm.options.ReadOnly {
+		return errors.New("cannot vacuum a read-only database")
+	}
+
+	sm.transactions.beginCheckpoint(false)
+	defer sm.transactions.endCheckpoint()
+
+	sm.lock.Lock()
+	defer sm.lock.Unlock()
+
+	tables := sm.sortedTables()
+	var blocks []BlockID
+
+	for _, table := range tables {
+		blocks = append(blocks, table.blocks()...)
+	}
+
+	relocated, err := sm.blockManager.RelocateBlocks(blocks)
+
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		table.relocateBlocks(relocated)
+	}
+
+	for blockID := range relocated {
+		sm.bufferManager.UnregisterBlock(blockID)
+	}
+
+	if err := sm.checkpoint(); err != nil {
+		return err
+	}
+
+	return sm.checkpoint()
+}
+
+// Whether there are changes that have not been persisted by a checkpoint. Called with the lock held.
+func (sm *StorageManager) modified() bool {
+	if sm.tablesModified {
+		return true
+	}
+
+	for _, table := range sm.tables {
+		if table.dirty() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Called with the lock held.
+func (sm *StorageManager) sortedTables() []*DataTable {
+	tables := make([]*DataTable, 0, len(sm.tables))
+
+	for _, table := range sm.tables {
+		tables = append(tables, table)
+	}
+
+	sort.Slice(tables, func(i, j int) bool { return tables[i].info.Name < tables[j].info.Name })
+
+	return tables
+}
+
+// Close the storage. Running transactions are aborted, and changes to a database file that have not been persisted yet
+// are checkpointed.
+func (sm *StorageManager) Close() error {
+	if sm.blockManager == nil {
+		return nil
+	}
+
+	var err error
+
+	sm.transactions.beginCheckpoint(true)
+
+	if !sm.options.ReadOnly && !sm.InMemory() {
+		sm.lock.Lock()
+
+		if sm.modified() {
+			err = sm.checkpoint()
+		}
+
+		sm.lock.Unlock()
+	}
+
+	sm.transactions.endCheckpoint()
+
+	if closeErr := sm.closeWAL(); err == nil {
+		err = closeErr
+	}
+
+	if closeErr := sm.bufferManager.Close(); err == nil {
+		err = closeErr
+	}
+
+	if closeErr := sm.blockManager.Close(); err == nil {
+		err = closeErr
+	}
+
+	sm.blockManager = nil
+	sm.bufferManager = nil
+
+	return err
+}
+
+// Close the write-ahead log, and remove it if all changes have been checkpointed.
+func (sm *StorageManager) closeWAL() error {
+	if sm.wal == nil {
+		return nil
+	}
+
+	empty := sm.wal.Size() == 0
+	err := sm.wal.Close()
+	sm.wal = nil
+
+	if err == nil && empty {
+		err = sm.fs.RemoveFile(WALPath(sm.path))
+	}
+
+	return err
+}
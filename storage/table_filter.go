@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/goduckdb/common"
+)
+
+// The ComparisonType is the comparison of a TableFilter.
+type ComparisonType uint8
+
+const (
+	CompareEqual ComparisonType = iota
+	CompareNotEqual
+	CompareLessThan
+	CompareLessThanOrEqual
+	CompareGreaterThan
+	CompareGreaterThanOrEqual
+)
+
+var comparisonNames = [...]string{
+	CompareEqual:              "=",
+	CompareNotEqual:           "<>",
+	CompareLessThan:           "<",
+	CompareLessThanOrEqual:    "<=",
+	CompareGreaterThan:        ">",
+	CompareGreaterThanOrEqual: ">=",
+}
+
+func (comparison ComparisonType) String() string {
+	if int(comparison) < len(comparisonNames) {
+		return comparisonNames[comparison]
+	}
+
+	return fmt.Sprintf("ComparisonType(%d)", uint8(comparison))
+}
+
+// Whether the comparison holds for the result of comparing a value to the constant (negative if the value is smaller,
+// 0 if it is equal, positive if it is larger).
+func (comparison ComparisonType) matches(result int) bool {
+	switch comparison {
+	case CompareEqual:
+		return result == 0
+	case CompareNotEqual:
+		return result != 0
+	case CompareLessThan:
+		return result < 0
+	case CompareLessThanOrEqual:
+		return result <= 0
+	case CompareGreaterThan:
+		return result > 0
+	default:
+		return result >= 0
+	}
+}
+
+// A TableFilter restricts a scan to the rows for which the value of a column compares to a constant, e.g.
+// "value > 10". Filters are pushed into the scan, so that compressed segments can evaluate them without decompressing
+// the values.
+type TableFilter struct {
+	ColumnID   int
+	Comparison ComparisonType
+	Constant   interface{} // A value of the Go type of the column type, e.g. int32 for an INTEGER column.
+}
+
+func (filter *TableFilter) verify(info *TableInfo) error {
+	if filter.ColumnID < 0 || filter.ColumnID >= len(info.Columns) {
+		return fmt.Errorf("table %q does not have a column %d", info.Name, filter.ColumnID)
+	}
+
+	if int(filter.Comparison) >= len(comparisonNames) {
+		return fmt.Errorf("invalid comparison %s", filter.Comparison)
+	}
+
+	if column := info.Columns[filter.ColumnID]; !column.Type.IsValue(filter.Constant) {
+		return fmt.Errorf("cannot compare column %q of type %s to a %T constant", column.Name, column.Type,
+			filter.Constant)
+	}
+
+	return nil
+}
+
+// Evaluate the filter for the values of the vector, clearing the selection of the values that do not match.
+func (filter *TableFilter) evaluate(vector *common.Vector, selection []bool) {
+	switch values := vector.Data().(type) {
+	case []bool:
+		constant := filter.Constant.(bool)
+		selectMatching(values, selection, filter.Comparison, func(value bool) int {
+			return compareOrdered(boolToInt(value), boolToInt(constant))
+		})
+	case []int8:
+		selectMatching(values, selection, filter.Comparison, orderedComparator(filter.Constant.(int8)))
+	case []int16:
+		selectMatching(values, selection, filter.Comparison, orderedComparator(filter.Constant.(int16)))
+	case []int32:
+		selectMatching(values, selection, filter.Comparison, orderedComparator(filter.Constant.(int32)))
+	case []int64:
+		selectMatching(values, selection, filter.Comparison, orderedComparator(filter.Constant.(int64)))
+	case []float32:
+		selectMatching(values, selection, filter.Comparison, orderedComparator(filter.Constant.(float32)))
+	case []float64:
+		selectMatching(values, selection, filter.Comparison, orderedComparator(filter.Constant.(float64)))
+	case []string:
+		selectMatching(values, selection, filter.Comparison, orderedComparator(filter.Constant.(string)))
+	case [][]byte:
+		constant := filter.Constant.([]byte)
+		selectMatching(values, selection, filter.Comparison, func(value []byte) int {
+			return bytes.Compare(value, constant)
+		})
+	default:
+		panic(fmt.Sprintf("Cannot filter %T", values))
+	}
+
+	// NULL values do not match any comparison.
+	if validity := vector.Validity(); !validity.AllValid() {
+		for i := range selection {
+			if !validity.IsValid(i) {
+				selection[i] = false
+			}
+		}
+	}
+}
+
+func selectMatching[T any](values []T, selection []bool, comparison ComparisonType, compare func(value T) int) {
+	for i, value := range values {
+		if selection[i] && !comparison.matches(compare(value)) {
+			selection[i] = false
+		}
+	}
+}
+
+func orderedComparator[T int8 | int16 | int32 | int64 | float32 | float64 | string](constant T) func(value T) int {
+	return func(value T) int { return compareOrdered(value, constant) }
+}
+
+// Compare two values. NaN is larger than any other floating-point value and equal to itself, so that floating-point
+// values are totally ordered.
+func compareOrdered[T int8 | int16 | int32 | int64 | float32 | float64 | string](a T, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	case a == b:
+		return 0
+	}
+
+	// At least one of the values is NaN.
+	switch aNaN, bNaN := a != a, b != b; {
+	case aNaN && bNaN:
+		return 0
+	case aNaN:
+		return 1
+	default:
+		return -1
+	}
+}
+
+func boolToInt(value bool) int8 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
+
+// The number of selected rows.
+func selectionCount(selection []bool) int {
+	count := 0
+
+	for _, selected := range selection {
+		if selected {
+			count++
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/goduckdb/common"
+)
+
+// A ColumnDefinition describes a column of a table.
+type ColumnDefinition struct {
+	Name string
+	Type common.TypeID
+}
+
+func (column *ColumnDefinition) Serialize(serializer common.Serializer) error {
+	writer := common.NewFieldWriter(serializer)
+
+	if err := writer.WriteField(1, func(s common.Serializer) error { return s.WriteString(column.Name) }); err != nil {
+		return err
+	}
+
+	if err := writer.WriteField(2, func(s common.Serializer) error { return s.WriteUint8(uint8(column.Type)) }); err != nil {
+		return err
+	}
+
+	return writer.Finalize()
+}
+
+func (column *ColumnDefinition) Deserialize(deserializer common.Deserializer) error {
+	reader := common.NewFieldReader(deserializer)
+
+	if err := reader.ReadField(1, func(d common.Deserializer) (err error) {
+		column.Name, err = d.ReadString()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := reader.ReadField(2, func(d common.Deserializer) error {
+		typ, err := d.ReadUint8()
+		column.Type = common.TypeID(typ)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if !column.Type.Valid() {
+		return common.NewSerializationError(fmt.Sprintf("column %q has unknown type %d", column.Name, column.Type))
+	}
+
+	return reader.Finalize()
+}
+
+// The TableInfo describes a table: its name and its columns.
+type TableInfo struct {
+	Name    string
+	Columns []ColumnDefinition
+}
+
+// The types of the columns of the table.
+func (info *TableInfo) Types() []common.TypeID {
+	types := make([]common.TypeID, len(info.Columns))
+
+	for i, column := range info.Columns {
+		types[i] = column.Type
+	}
+
+	return types
+}
+
+// Check that the table has a name and at least one column, and that the columns have distinct names and valid types.
+func (info *TableInfo) Validate() error {
+	if info.Name == "" {
+		return errors.New("table name cannot be empty")
+	}
+
+	if len(info.Columns) == 0 {
+		return fmt.Errorf("table %q must have at least one column", info.Name)
+	}
+
+	names := make(map[string]struct{}, len(info.Columns))
+
+	for _, column := range info.Columns {
+		if _, ok := names[column.Name]; ok {
+			return fmt.Errorf("table %q has duplicate column %q", info.Name, column.Name)
+		}
+
+		if !column.Type.Valid() {
+			return fmt.Errorf("column %q of table %q has invalid type %s", column.Name, info.Name, column.Type)
+		}
+
+		names[column.Name] = struct{}{}
+	}
+
+	return nil
+}
+
+func (info *TableInfo) Serialize(serializer common.Serializer) error {
+	writer := common.NewFieldWriter(serializer)
+
+	if err := writer.WriteField(1, func(s common.Serializer) error { return s.WriteString(info.Name) }); err != nil {
+		return err
+	}
+
+	if err := writer.WriteField(2, func(s common.Serializer) error {
+		return s.WriteList(len(info.Columns), func(i int) error { return s.WriteObject(&info.Columns[i]) })
+	}); err != nil {
+		return err
+	}
+
+	return writer.Finalize()
+}
+
+func (info *TableInfo) Deserialize(deserializer common.Deserializer) error {
+	reader := common.NewFieldReader(deserializer)
+
+	if err := reader.ReadField(1, func(d common.Deserializer) (err error) {
+		info.Name, err = d.ReadString()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := reader.ReadField(2, func(d common.Deserializer) error {
+		info.Columns = nil
+
+		return d.ReadList(func(int) error {
+			info.Columns = append(info.Columns, ColumnDefinition{})
+			return d.ReadObject(&info.Columns[len(info.Columns)-1])
+		})
+	}); err != nil {
+		return err
+	}
+
+	return reader.Finalize()
+}
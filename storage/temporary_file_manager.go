@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/goduckdb/common"
+)
+
+// The prefix of the files the TemporaryFileManager creates in the temporary directory. Files with this prefix that do
+// not belong to an open database are removed on startup, as they can only be left behind by a crash.
+const TemporaryFilePrefix = "duckdb_temp_"
+
+// The number of TemporaryFileManagers that were created by the process, which makes the names of their files unique.
+var temporaryFileCount atomic.Uint64
+
+// The TemporaryFileManager spills temporary blocks (e.g. sort runs or hash tables) that are evicted by the
+// BufferManager to a file in the temporary directory. The file is divided into slots of one block each; the slot of a
+// block is freed when the block is loaded again or destroyed, and freed slots are reused before the file grows. The
+// directory and file are only created once the first block is spilled. Every TemporaryFileManager spills to a file of
+// its own, so that databases can share a temporary directory.
+type TemporaryFileManager struct {
+	lock             sync.Mutex
+	fs               common.FileSystem
+	directory        string
+	name             string // The name of the temporary file.
+	createdDirectory bool   // Whether the directory was created by the TemporaryFileManager, and should be removed on close.
+	handle           common.FileHandle
+	slots            map[BlockID]uint64 // The slot every spilled block is stored in.
+	freeSlots        []uint64           // The freed slots, in ascending order.
+	slotCount        uint64             // The number of slots in the file.
+}
+
+func NewTemporaryFileManager(fs common.FileSystem, directory string) *TemporaryFileManager {
+	return &TemporaryFileManager{
+		fs:        fs,
+		directory: directory,
+		name:      fmt.Sprintf("%s%d.tmp", processTemporaryFilePrefix(), temporaryFileCount.Add(1)),
+		slots:     make(map[BlockID]uint64),
+	}
+}
+
+// Remove the temporary files that were left behind in the directory by databases that crashed. The files of open
+// databases are kept: the files of this process are recognized by their name, the files of other processes by the
+// write lock that their TemporaryFileManager holds on them.
+func (manager *TemporaryFileManager) RemoveStaleFiles() error {
+	var files []string
+	processPrefix := processTemporaryFilePrefix()
+
+	exists, err := manager.fs.ListFiles(manager.directory, func(name string) {
+		if strings.HasPrefix(name, TemporaryFilePrefix) && !strings.HasPrefix(name, processPrefix) {
+			files = append(files, name)
+		}
+	})
+
+	if err != nil || !exists {
+		return err
+	}
+
+	for _, name := range files {
+		path := manager.fs.JoinPath(manager.directory, name)
+		// File locks only conflict between processes, and closing any handle of a file releases all locks of the
+		// process on it: this is why the files of this process must not be opened here.
+		handle, err := manager.fs.OpenFile(path, common.WriteOnly, common.WriteLock)
+		var lockErr *common.LockConflictError
+
+		if errors.As(err, &lockErr) || errors.Is(err, os.ErrNotExist) {
+			// The file is in use by an open database, or was removed by its database in the meantime.
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		handle.Close()
+
+		if err := manager.fs.RemoveFile(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Write the block to a free slot of the temporary file.
+func (manager *TemporaryFileManager) WriteTemporaryBlock(block *Block) error {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	if _, ok := manager.slots[block.ID]; ok {
+		return fmt.Errorf("temporary block %d has already been written", block.ID)
+	}
+
+	if err := manager.open(); err != nil {
+		return err
+	}
+
+	var slot uint64
+
+	if len(manager.freeSlots) > 0 {
+		slot = manager.freeSlots[0]
+		manager.freeSlots = manager.freeSlots[1:]
+	} else {
+		slot = manager.slotCount
+		manager.slotCount++
+	}
+
+	if err := block.Write(manager.handle, slot*BlockSize, common.DefaultChecksumType); err != nil {
+		manager.freeSlot(slot)
+		return err
+	}
+
+	manager.slots[block.ID] = slot
+
+	return nil
+}
+
+// Read the block back from the temporary file, and free its slot.
+func (manager *TemporaryFileManager) ReadTemporaryBlock(block *Block) error {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	slot, ok := manager.slots[block.ID]
+
+	if !ok {
+		return fmt.Errorf("temporary block %d has not been written", block.ID)
+	}
+
+	if err := block.Read(manager.handle, slot*BlockSize, common.DefaultChecksumType); err != nil {
+		return err
+	}
+
+	delete(manager.slots, block.ID)
+	manager.freeSlot(slot)
+
+	return nil
+}
+
+// Free the slot of a block that is destroyed while it is spilled.
+func (manager *TemporaryFileManager) DeleteTemporaryBlock(blockID BlockID) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	if slot, ok := manager.slots[blockID]; ok {
+		delete(manager.slots, blockID)
+		manager.freeSlot(slot)
+	}
+}
+
+// Whether the block is stored in the temporary file.
+func (manager *TemporaryFileManager) HasTemporaryBlock(blockID BlockID) bool {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	_, ok := manager.slots[blockID]
+
+	return ok
+}
+
+// Close and remove the temporary file, and the directory if it was created by the TemporaryFileManager and no other
+// database has files in it.
+func (manager *TemporaryFileManager) Close() error {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	if manager.handle == nil {
+		return nil
+	}
+
+	err := manager.handle.Close()
+	manager.handle = nil
+
+	if removeErr := manager.fs.RemoveFile(manager.Path()); err == nil {
+		err = removeErr
+	}
+
+	if manager.createdDirectory {
+		empty := true
+		_, listErr := manager.fs.ListFiles(manager.directory, func(string) { empty = false })
+
+		if listErr != nil && err == nil {
+			err = listErr
+		} else if listErr == nil && empty {
+			if removeErr := manager.fs.RemoveDirectory(manager.directory); err == nil {
+				err = removeErr
+			}
+		}
+	}
+
+	manager.slots = make(map[BlockID]uint64)
+	manager.freeSlots = nil
+	manager.slotCount = 0
+
+	return err
+}
+
+// Create the directory and the temporary file if they do not exist yet. Called with the lock held.
+func (manager *TemporaryFileManager) open() error {
+	if manager.handle != nil {
+		return nil
+	}
+
+	if !manager.fs.DirectoryExists(manager.directory) {
+		if err := manager.fs.CreateDirectory(manager.directory); err != nil {
+			return err
+		}
+
+		manager.createdDirectory = true
+	}
+
+	handle, err := manager.fs.OpenFile(manager.Path(), common.WriteOnly|common.Create|common.DirectIO, common.WriteLock)
+
+	if err != nil {
+		return err
+	}
+
+	manager.handle = handle
+
+	return nil
+}
+
+// Return the slot to the free slots, keeping them sorted so that the file stays as small as possible. Called with the
+// lock held.
+func (manager *TemporaryFileManager) freeSlot(slot uint64) {
+	index := sort.Search(len(manager.freeSlots), func(i int) bool { return manager.freeSlots[i] >= slot })
+	manager.freeSlots = append(manager.freeSlots, 0)
+	copy(manager.freeSlots[index+1:], manager.freeSlots[index:])
+	manager.freeSlots[index] = slot
+}
+
+// The prefix of the names of the temporary files of this process.
+func processTemporaryFilePrefix() string {
+	return fmt.Sprintf("%sstorage_%d_", TemporaryFilePrefix, os.Getpid())
+}
+
+// The path of the temporary file.
+func (manager *TemporaryFileManager) Path() string {
+	return manager.fs.JoinPath(manager.directory, manager.name)
+}
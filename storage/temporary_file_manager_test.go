@@ -0,0 +1,297 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/goduckdb/common"
+)
+
+func TestBufferManagerSpilling(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	blockManager := newTestBlocks(t, 0)
+	defer blockManager.Close()
+	temporaryFiles := NewTemporaryFileManager(fs, "/spill")
+	bufferManager := NewBufferManager(blockManager, 2*BlockSize, temporaryFiles)
+
+	// Allocate more temporary blocks than fit in memory.
+	var blockIDs []BlockID
+
+	for i := 0; i < 5; i++ {
+		handle, err := bufferManager.Allocate()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		binary.LittleEndian.PutUint64(handle.Block().Buffer(), uint64(i))
+		blockIDs = append(blockIDs, handle.ID())
+		handle.Unpin()
+	}
+
+	if metrics := bufferManager.Metrics(); metrics.Spills != 3 || metrics.UsedMemory > 2*BlockSize {
+		t.Errorf("Expect 3 spilled blocks within the memory limit, got %+v", metrics)
+	}
+
+	if exists, _ := fs.FileExists(temporaryFiles.Path()); !exists {
+		t.Fatalf("Expect the temporary file to be created")
+	}
+
+	// The spilled blocks are read back when they are pinned.
+	for i, blockID := range blockIDs {
+		handle, err := bufferManager.Pin(blockID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value := binary.LittleEndian.Uint64(handle.Block().Buffer()); value != uint64(i) {
+			t.Errorf("Expect temporary block %d to contain %d, got %d", blockID, i, value)
+		}
+
+		handle.Unpin()
+	}
+
+	for _, blockID := range blockIDs {
+		if err := bufferManager.Destroy(blockID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if metrics := bufferManager.Metrics(); metrics.UsedMemory != 0 {
+		t.Errorf("Expect all memory to be released, %d bytes used", metrics.UsedMemory)
+	}
+
+	if err := bufferManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if fs.DirectoryExists("/spill") {
+		t.Errorf("Expect the temporary directory to be removed on close")
+	}
+}
+
+func TestTemporaryFileSlotReuse(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	temporaryFiles := NewTemporaryFileManager(fs, "/spill")
+	defer temporaryFiles.Close()
+
+	for id := BlockID(1); id <= 3; id++ {
+		block := NewBlock(TemporaryBlockStart + id)
+		binary.LittleEndian.PutUint64(block.Buffer(), uint64(id))
+
+		if err := temporaryFiles.WriteTemporaryBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Reading block 2 back frees its slot, which is reused by the next block.
+	block := NewBlock(TemporaryBlockStart + 2)
+
+	if err := temporaryFiles.ReadTemporaryBlock(block); err != nil {
+		t.Fatal(err)
+	}
+
+	if value := binary.LittleEndian.Uint64(block.Buffer()); value != 2 {
+		t.Errorf("Expect temporary block 2 to contain 2, got %d", value)
+	}
+
+	if temporaryFiles.HasTemporaryBlock(block.ID) {
+		t.Errorf("Expect the slot of a block that was read back to be freed")
+	}
+
+	if err := temporaryFiles.WriteTemporaryBlock(NewBlock(TemporaryBlockStart + 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := fs.GetFileSize(temporaryFiles.handle)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size != 3*BlockSize {
+		t.Errorf("Expect the temporary file to hold 3 slots, got %d bytes", size)
+	}
+}
+
+func TestRemoveStaleTemporaryFiles(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	path := "/test.db"
+	directory := DefaultTempDirectory(path)
+
+	if err := fs.CreateDirectory(directory); err != nil {
+		t.Fatal(err)
+	}
+
+	// A temporary file left behind by a crash, and a file that does not belong to goduckdb.
+	stale := fmt.Sprintf("%sstorage_%d_1.tmp", TemporaryFilePrefix, os.Getpid()+1)
+
+	for _, name := range []string{stale, "user.csv"} {
+		handle, err := fs.OpenFile(fs.JoinPath(directory, name), common.WriteOnly|common.Create, common.NoLock)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		handle.Close()
+	}
+
+	// The temporary file of a database of another process, which holds the write lock on it.
+	live := fmt.Sprintf("%sstorage_%d_2.tmp", TemporaryFilePrefix, os.Getpid()+1)
+	liveHandle, err := fs.OpenFile(fs.JoinPath(directory, live), common.WriteOnly|common.Create, common.WriteLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer liveHandle.Close()
+
+	options := DefaultOptions()
+	options.TempDirectory = directory
+	storageManager := NewStorageManager(fs, path, options)
+
+	if err := storageManager.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer storageManager.Close()
+
+	if exists, _ := fs.FileExists(fs.JoinPath(directory, stale)); exists {
+		t.Errorf("Expect the stale temporary file to be removed on startup")
+	}
+
+	if exists, _ := fs.FileExists(fs.JoinPath(directory, live)); !exists {
+		t.Errorf("Expect the temporary file of an open database to be kept")
+	}
+
+	if exists, _ := fs.FileExists(fs.JoinPath(directory, "user.csv")); !exists {
+		t.Errorf("Expect other files in the temporary directory to be kept")
+	}
+}
+
+func TestSharedTemporaryDirectory(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	options := DefaultOptions()
+	options.MemoryLimit = 2 * BlockSize
+	options.TempDirectory = "/spill"
+	open := func(path string) *StorageManager {
+		storageManager := NewStorageManager(fs, path, options)
+
+		if err := storageManager.Initialize(); err != nil {
+			t.Fatal(err)
+		}
+
+		return storageManager
+	}
+
+	first := open("/first.db")
+	var blockIDs []BlockID
+
+	for i := 0; i < 5; i++ {
+		handle, err := first.BufferManager().Allocate()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		binary.LittleEndian.PutUint64(handle.Block().Buffer(), uint64(i))
+		blockIDs = append(blockIDs, handle.ID())
+		handle.Unpin()
+	}
+
+	if spills := first.BufferManager().Metrics().Spills; spills != 3 {
+		t.Fatalf("Expect 3 spilled blocks, got %d", spills)
+	}
+
+	// Opening a second database with the same temporary directory keeps the file of the first.
+	second := open("/second.db")
+
+	for i, blockID := range blockIDs {
+		handle, err := first.BufferManager().Pin(blockID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value := binary.LittleEndian.Uint64(handle.Block().Buffer()); value != uint64(i) {
+			t.Errorf("Expect temporary block %d to contain %d, got %d", blockID, i, value)
+		}
+
+		handle.Unpin()
+	}
+
+	for _, storageManager := range []*StorageManager{first, second} {
+		if err := storageManager.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestInMemorySpilling(t *testing.T) {
+	if directory := DefaultTempDirectory(InMemoryPath); directory != "" {
+		t.Errorf("Expect in-memory databases not to spill by default, got directory %q", directory)
+	}
+
+	// Two in-memory databases that share a temporary directory spill to files of their own.
+	fs := common.NewMemoryFileSystem()
+	options := DefaultOptions()
+	options.MemoryLimit = 2 * BlockSize
+	options.TempDirectory = "/spill"
+	var storageManagers []*StorageManager
+	var blockIDs [][]BlockID
+
+	for i := 0; i < 2; i++ {
+		storageManager := NewStorageManager(fs, InMemoryPath, options)
+
+		if err := storageManager.Initialize(); err != nil {
+			t.Fatal(err)
+		}
+
+		storageManagers = append(storageManagers, storageManager)
+		blockIDs = append(blockIDs, nil)
+	}
+
+	for j := 0; j < 5; j++ {
+		for i, storageManager := range storageManagers {
+			handle, err := storageManager.BufferManager().Allocate()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			binary.LittleEndian.PutUint64(handle.Block().Buffer(), uint64(10*i+j))
+			blockIDs[i] = append(blockIDs[i], handle.ID())
+			handle.Unpin()
+		}
+	}
+
+	for _, storageManager := range storageManagers {
+		if spills := storageManager.BufferManager().Metrics().Spills; spills != 3 {
+			t.Fatalf("Expect 3 spilled blocks, got %d", spills)
+		}
+	}
+
+	// Closing the first database removes its file, but not the file of the second.
+	if err := storageManagers[0].Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for j, blockID := range blockIDs[1] {
+		handle, err := storageManagers[1].BufferManager().Pin(blockID)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value := binary.LittleEndian.Uint64(handle.Block().Buffer()); value != uint64(10+j) {
+			t.Errorf("Expect temporary block %d to contain %d, got %d", blockID, 10+j, value)
+		}
+
+		handle.Unpin()
+	}
+
+	if err := storageManagers[1].Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/goduckdb/common"
+)
+
+// ErrTransactionAborted is returned for a transaction that has been aborted by a forced checkpoint.
+var ErrTransactionAborted = errors.New("transaction has been aborted by a forced checkpoint")
+
+type transactionState uint8
+
+const (
+	transactionActive     transactionState = iota
+	transactionCommitting                  // The changes are being written to the log and applied.
+	transactionAborted                     // The transaction was aborted by a forced checkpoint.
+	transactionDone                        // The transaction was committed or rolled back.
+)
+
+// A Transaction groups changes of tables that are committed together: they are written to the write-ahead log with a
+// single sync, and applied at once when the transaction commits. The changes are not visible before the commit, also
+// not to the transaction itself. A transaction must only be used by a single goroutine.
+type Transaction struct {
+	manager *transactionManager
+	changes []transactionChange
+	state   transactionState // Protected by the lock of the manager.
+}
+
+type transactionChange struct {
+	table  *DataTable
+	record walRecord
+}
+
+// Append the rows of the chunk to the table when the transaction commits. The chunk is copied.
+func (tx *Transaction) Append(table *DataTable, chunk *common.DataChunk) error {
+	if err := table.verifyChunk(chunk); err != nil {
+		return err
+	}
+
+	return tx.add(table, &walInsert{table: table.info.Name, chunk: copyChunk(chunk)})
+}
+
+// Delete the rows with the given row numbers from the table when the transaction commits.
+func (tx *Transaction) Delete(table *DataTable, rows []uint64) error {
+	return tx.add(table, &walDelete{table: table.info.Name, rows: append([]uint64(nil), rows...)})
+}
+
+// Replace the values of the given columns of the rows of the table when the transaction commits, like
+// DataTable.Update. The chunk is copied.
+func (tx *Transaction) Update(table *DataTable, columnIDs []int, rows []uint64, chunk *common.DataChunk) error {
+	return tx.add(table, &walUpdate{
+		table:     table.info.Name,
+		columnIDs: append([]int(nil), columnIDs...),
+		rows:      append([]uint64(nil), rows...),
+		chunk:     copyChunk(chunk),
+	})
+}
+
+// Add a change of the table to the transaction, unless the transaction has been aborted. The change is added with the
+// lock of the manager held, so that a forced checkpoint cannot abort the transaction in between.
+func (tx *Transaction) add(table *DataTable, record walRecord) error {
+	if table.readOnly {
+		return errors.New("cannot change a table of a read-only database")
+	}
+
+	tx.manager.lock.Lock()
+	defer tx.manager.lock.Unlock()
+
+	if err := tx.verifyActive(); err != nil {
+		return err
+	}
+
+	tx.changes = append(tx.changes, transactionChange{table, record})
+
+	return nil
+}
+
+// Called with the lock of the manager held.
+func (tx *Transaction) verifyActive() error {
+	switch tx.state {
+	case transactionActive:
+		return nil
+	case transactionAborted:
+		return ErrTransactionAborted
+	default:
+		return errors.New("transaction has already been committed or rolled back")
+	}
+}
+
+// Commit the changes of the transaction. The changes are verified first, every change against the table as it is
+// after the changes before it: if one of them cannot be applied, none of them is. Commits that grow the write-ahead log
+// beyond the checkpoint threshold trigger a checkpoint.
+func (tx *Transaction) Commit() error {
+	_, err := tx.commit()
+	return err
+}
+
+// Commit the changes, and return the number of rows that every change changed.
+func (tx *Transaction) commit() ([]uint64, error) {
+	manager := tx.manager
+	manager.lock.Lock()
+
+	if err := tx.verifyActive(); err != nil {
+		tx.changes = nil
+		manager.lock.Unlock()
+
+		return nil, err
+	}
+
+	tx.state = transactionCommitting
+	manager.lock.Unlock()
+
+	counts, err := tx.apply()
+	manager.end(tx)
+
+	if err == nil {
+		manager.checkpointIfNeeded()
+	}
+
+	return counts, err
+}
+
+// Discard the changes of the transaction.
+func (tx *Transaction) Rollback() {
+	tx.manager.lock.Lock()
+	active := tx.state == transactionActive
+
+	if tx.state == transactionAborted {
+		tx.changes = nil
+	}
+
+	tx.manager.lock.Unlock()
+
+	if active {
+		tx.manager.end(tx)
+	}
+}
+
+// Lock the changed tables, verify the changes, write them to the log and apply them.
+func (tx *Transaction) apply() ([]uint64, error) {
+	tables := make([]*DataTable, 0, len(tx.changes))
+	locked := make(map[*DataTable]bool)
+
+	for _, change := range tx.changes {
+		if !locked[change.table] {
+			locked[change.table] = true
+			tables = append(tables, change.table)
+		}
+	}
+
+	// Tables are locked in order of their names, like checkpoints lock them.
+	sort.SliceStable(tables, func(i, j int) bool { return tables[i].info.Name < tables[j].info.Name })
+
+	for _, table := range tables {
+		table.lock.Lock()
+		defer table.lock.Unlock()
+	}
+
+	records := make([]walRecord, len(tx.changes))
+	pending := make(map[*DataTable]*pendingChanges, len(tables))
+
+	for _, table := range tables {
+		pending[table] = &pendingChanges{}
+	}
+
+	for i, change := range tx.changes {
+		if change.table.dropped {
+			return nil, fmt.Errorf("table %q has been dropped", change.table.info.Name)
+		}
+
+		if err := change.table.verifyChange(change.record, pending[change.table]); err != nil {
+			return nil, err
+		}
+
+		records[i] = change.record
+	}
+
+	if len(records) > 0 {
+		if err := tx.manager.wal.commit(records...); err != nil {
+			return nil, err
+		}
+	}
+
+	counts := make([]uint64, len(tx.changes))
+
+	for i, change := range tx.changes {
+		counts[i] = change.table.applyChange(change.record)
+	}
+
+	return counts, nil
+}
+
+func copyChunk(chunk *common.DataChunk) *common.DataChunk {
+	result := common.NewDataChunk(chunk.Types(), chunk.Len())
+
+	for i, column := range chunk.Columns {
+		result.Columns[i].AppendVector(column, 0, column.Len())
+	}
+
+	return result
+}
+
+// The transactionManager keeps track of the running transactions, so that checkpoints can wait for them or abort them,
+// and triggers automatic checkpoints when the write-ahead log grows beyond the checkpoint threshold.
+type transactionManager struct {
+	lock          sync.Mutex
+	changed       *sync.Cond // Signalled when a transaction ends, or a checkpoint finishes.
+	active        map[*Transaction]struct{}
+	checkpointing bool           // Whether a checkpoint is waiting or running, new transactions wait for it.
+	wal           *WriteAheadLog // The log commits are written to, nil if they are not logged.
+	// The size of the log after which a commit triggers a checkpoint, 0 disables automatic checkpoints.
+	threshold  uint64
+	checkpoint func() error // Checkpoint the database, called without locks held.
+}
+
+func newTransactionManager(threshold uint64, checkpoint func() error) *transactionManager {
+	manager := &transactionManager{active: make(map[*Transaction]struct{}), threshold: threshold, checkpoint: checkpoint}
+	manager.changed = sync.NewCond(&manager.lock)
+
+	return manager
+}
+
+// Start a transaction, waiting for a running checkpoint to finish.
+func (manager *transactionManager) begin() *Transaction {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	for manager.checkpointing {
+		manager.changed.Wait()
+	}
+
+	tx := &Transaction{manager: manager}
+	manager.active[tx] = struct{}{}
+
+	return tx
+}
+
+// Finish a transaction that was committed or rolled back.
+func (manager *transactionManager) end(tx *Transaction) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	tx.state = transactionDone
+	tx.changes = nil
+	delete(manager.active, tx)
+	manager.changed.Broadcast()
+}
+
+// Wait until no other checkpoint is running and no transaction is running, and block new transactions until
+// endCheckpoint is called. If force is set, transactions that are not committing are aborted instead of waited for.
+func (manager *transactionManager) beginCheckpoint(force bool) {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	for manager.checkpointing {
+		manager.changed.Wait()
+	}
+
+	manager.checkpointing = true
+
+	for len(manager.active) > 0 {
+		if force {
+			for tx := range manager.active {
+				// The changes are discarded by the goroutine of the transaction, which fails to commit it.
+				if tx.state == transactionActive {
+					tx.state = transactionAborted
+					delete(manager.active, tx)
+				}
+			}
+
+			if len(manager.active) == 0 {
+				break
+			}
+		}
+
+		manager.changed.Wait()
+	}
+}
+
+func (manager *transactionManager) endCheckpoint() {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	manager.checkpointing = false
+	manager.changed.Broadcast()
+}
+
+// Checkpoint the database if the log has grown beyond the threshold, unless transactions are running. A failed
+// checkpoint leaves the changes in the log, so it is retried after the next commit.
+func (manager *transactionManager) checkpointIfNeeded() {
+	if manager.wal == nil || manager.threshold == 0 || manager.wal.Size() < manager.threshold {
+		return
+	}
+
+	manager.lock.Lock()
+
+	if manager.checkpointing || len(manager.active) > 0 {
+		manager.lock.Unlock()
+		return
+	}
+
+	manager.checkpointing = true
+	manager.lock.Unlock()
+
+	_ = manager.checkpoint()
+	manager.endCheckpoint()
+}
@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/goduckdb/common"
+)
+
+func TestTransactionCommit(t *testing.T) {
+	storageManager := openTestStorage(t, common.NewMemoryFileSystem(), "/transaction.db")
+	defer storageManager.Close()
+
+	info := testTableInfo
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := storageManager.BeginTransaction()
+	chunk := testChunk(0, 100)
+
+	if err := tx.Append(table, chunk); err != nil {
+		t.Fatal(err)
+	}
+
+	// The chunk is copied, and the changes are not visible before the commit.
+	chunk.Reset()
+
+	if err := tx.Delete(table, []uint64{5}); err != nil {
+		t.Fatal(err)
+	}
+
+	if table.Count() != 0 {
+		t.Errorf("Expect the changes to be invisible before the commit, got %d rows", table.Count())
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if table.Count() != 99 {
+		t.Errorf("Expect 99 rows after the commit, got %d", table.Count())
+	}
+
+	if err := tx.Commit(); err == nil {
+		t.Errorf("Expect a transaction cannot be committed twice")
+	}
+
+	// If one change cannot be applied, none of the changes is applied.
+	tx = storageManager.BeginTransaction()
+
+	if err := tx.Append(table, testChunk(100, 200)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Delete(table, []uint64{1000}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Commit(); err == nil {
+		t.Errorf("Expect deleting a row that does not exist to fail")
+	}
+
+	// Rolled back changes are discarded.
+	tx = storageManager.BeginTransaction()
+
+	if err := tx.Delete(table, []uint64{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx.Rollback()
+
+	if err := tx.Commit(); err == nil {
+		t.Errorf("Expect a rolled back transaction cannot be committed")
+	}
+
+	if table.Count() != 99 {
+		t.Errorf("Expect 99 rows, got %d", table.Count())
+	}
+}
+
+func TestAutomaticCheckpoint(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	options := DefaultOptions()
+	options.CheckpointThreshold = 64 * 1024
+	storageManager := NewStorageManager(fs, "/threshold.db", options)
+
+	if err := storageManager.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer storageManager.Close()
+
+	info := testTableInfo
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.Append(testChunk(0, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	if size := storageManager.wal.Size(); size == 0 || size >= options.CheckpointThreshold {
+		t.Fatalf("Expect the log to stay below the threshold, got %d bytes", size)
+	}
+
+	metaBlock := storageManager.BlockManager().GetMetaBlock()
+
+	// A commit that grows the log beyond the threshold triggers a checkpoint, which truncates the log.
+	if err := table.Append(testChunk(100, 5000)); err != nil {
+		t.Fatal(err)
+	}
+
+	if size := storageManager.wal.Size(); size != 0 {
+		t.Errorf("Expect the log to be truncated by an automatic checkpoint, got %d bytes", size)
+	}
+
+	if storageManager.BlockManager().GetMetaBlock() == metaBlock {
+		t.Errorf("Expect a new header to be written by an automatic checkpoint")
+	}
+
+	// The checkpoint is skipped while other transactions are running.
+	tx := storageManager.BeginTransaction()
+
+	if err := table.Append(testChunk(5000, 10000)); err != nil {
+		t.Fatal(err)
+	}
+
+	if size := storageManager.wal.Size(); size < options.CheckpointThreshold {
+		t.Errorf("Expect no checkpoint while a transaction is running, got %d bytes", size)
+	}
+
+	tx.Rollback()
+	verifyTestTable(t, table, 10000)
+}
+
+func TestCheckpointTransactions(t *testing.T) {
+	storageManager := openTestStorage(t, common.NewMemoryFileSystem(), "/checkpoint.db")
+	defer storageManager.Close()
+
+	info := testTableInfo
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A checkpoint waits for the running transactions.
+	tx := storageManager.BeginTransaction()
+
+	if err := tx.Append(table, testChunk(0, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+
+	go func() {
+		done <- storageManager.Checkpoint()
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Expect the checkpoint to wait for the transaction, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if size := storageManager.wal.Size(); size != 0 {
+		t.Errorf("Expect the committed changes to be checkpointed, got %d bytes in the log", size)
+	}
+
+	// A forced checkpoint aborts the running transactions.
+	tx = storageManager.BeginTransaction()
+
+	if err := tx.Delete(table, []uint64{0}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.ForceCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.Delete(table, []uint64{1}); !errors.Is(err, ErrTransactionAborted) {
+		t.Errorf("Expect changing an aborted transaction to fail, got %v", err)
+	}
+
+	if err := tx.Commit(); !errors.Is(err, ErrTransactionAborted) {
+		t.Errorf("Expect committing an aborted transaction to fail, got %v", err)
+	}
+
+	verifyTestTable(t, table, 100)
+}
+
+func TestForceCheckpointConcurrentAppends(t *testing.T) {
+	storageManager := openTestStorage(t, common.NewMemoryFileSystem(), "/force.db")
+	defer storageManager.Close()
+
+	info := testTableInfo
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Transactions keep appending while forced checkpoints abort them. Every committed append is kept, and no change is
+	// added to a transaction that has been aborted.
+	done := make(chan struct{})
+	committed := make(chan int)
+
+	go func() {
+		count := 0
+
+		for {
+			select {
+			case <-done:
+				committed <- count
+				return
+			default:
+			}
+
+			tx := storageManager.BeginTransaction()
+			aborted := false
+
+			for i := 0; i < 10 && !aborted; i++ {
+				if err := tx.Append(table, testChunk(count, count+1)); errors.Is(err, ErrTransactionAborted) {
+					aborted = true
+				} else if err != nil {
+					t.Error(err)
+				}
+			}
+
+			if err := tx.Commit(); err == nil {
+				count += 10
+			} else if !errors.Is(err, ErrTransactionAborted) {
+				t.Error(err)
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		if err := storageManager.ForceCheckpoint(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	close(done)
+	count := <-committed
+
+	if table.Count() != uint64(count) {
+		t.Errorf("Expect %d committed rows, got %d", count, table.Count())
+	}
+}
@@ -0,0 +1,763 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/goduckdb/common"
+)
+
+// The WALType is the type of an entry of the WriteAheadLog.
+type WALType uint8
+
+const (
+	WALInvalid     WALType = iota
+	WALCreateTable         // A table was created.
+	WALDropTable           // A table was dropped.
+	WALInsert              // Rows were appended to a table.
+	WALDelete              // Rows of a table were deleted.
+	WALUpdate              // Values of rows of a table were updated.
+	WALCheckpoint          // A checkpoint that includes all preceding entries is about to be committed.
+	WALFlush               // The preceding entries are committed.
+)
+
+func (walType WALType) String() string {
+	switch walType {
+	case WALCreateTable:
+		return "CREATE_TABLE"
+	case WALDropTable:
+		return "DROP_TABLE"
+	case WALInsert:
+		return "INSERT"
+	case WALDelete:
+		return "DELETE"
+	case WALUpdate:
+		return "UPDATE"
+	case WALCheckpoint:
+		return "CHECKPOINT"
+	case WALFlush:
+		return "FLUSH"
+	default:
+		return fmt.Sprintf("WALType(%d)", uint8(walType))
+	}
+}
+
+// The path of the write-ahead log of the database at the given path.
+func WALPath(path string) string {
+	return path + ".wal"
+}
+
+// The size of the header of a WAL entry: the uint64 length of the entry and the uint64 checksum of the entry.
+const walEntryHeaderSize = 16
+
+// The header of the log: the walMagicBytes, the uint32 version of the log format and the uint64 ChecksumType of the
+// entries, which is the checksum algorithm of the database file.
+const (
+	walHeaderSize = 16
+	walVersion    = 1
+)
+
+var walMagicBytes = [4]byte{'D', 'W', 'A', 'L'}
+
+// The WriteAheadLog makes changes durable without writing the tables: every change is appended to the log, and the
+// changes of a commit are followed by a flush entry and synced to disk before the commit returns. At startup, the
+// committed changes are replayed into the tables that were loaded from the last checkpoint. Once a checkpoint has
+// persisted the tables, the log is truncated.
+//
+// The log starts with a header that records the checksum algorithm of the entries. An entry is stored as its length
+// and the checksum of its data, followed by the data: the WALType of the entry and the serialized record.
+type WriteAheadLog struct {
+	fs           common.FileSystem
+	path         string
+	handle       common.FileHandle
+	checksumType common.ChecksumType // The checksum algorithm of the entries.
+	lock         sync.Mutex          // Held while entries are written, protects size.
+	size         uint64              // The size of the log file, entries are appended at this offset.
+}
+
+// Open the write-ahead log at the given path, creating it if it does not exist unless it is opened in read-only mode.
+// The entries are checksummed with the given checksum algorithm, the algorithm of the database file: a log that was
+// written with another algorithm cannot be opened. The log is not locked: it is only used while the database file is
+// locked.
+func OpenWriteAheadLog(fs common.FileSystem, path string, readOnly bool,
+	checksumType common.ChecksumType) (*WriteAheadLog, error) {
+	flags := common.WriteOnly | common.Create
+
+	if readOnly {
+		flags = common.ReadOnly
+	}
+
+	handle, err := fs.OpenFile(path, flags, common.NoLock)
+
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := fs.GetFileSize(handle)
+
+	if err != nil {
+		handle.Close()
+		return nil, err
+	}
+
+	wal := &WriteAheadLog{fs: fs, path: path, handle: handle, checksumType: checksumType, size: uint64(size)}
+
+	if err := wal.initialize(readOnly); err != nil {
+		handle.Close()
+		return nil, err
+	}
+
+	return wal, nil
+}
+
+// Verify the header of the log, or write it if the log does not have a complete header yet. The header is synced
+// before any entry is written, so an incomplete header was torn while the log was created, and the log is empty.
+func (wal *WriteAheadLog) initialize(readOnly bool) error {
+	if wal.size < walHeaderSize {
+		if readOnly {
+			wal.size = walHeaderSize
+			return nil
+		}
+
+		header := make([]byte, walHeaderSize)
+		copy(header, walMagicBytes[:])
+		binary.LittleEndian.PutUint32(header[4:], walVersion)
+		binary.LittleEndian.PutUint64(header[8:], uint64(wal.checksumType))
+
+		if err := wal.fs.Truncate(wal.handle, 0); err != nil {
+			return err
+		}
+
+		wal.size = 0
+
+		return wal.write(header)
+	}
+
+	header := make([]byte, walHeaderSize)
+
+	if err := wal.handle.Read(header, 0); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(header[:len(walMagicBytes)], walMagicBytes[:]) {
+		return common.NewCorruptionError(wal.path, 0, "the file is not a write-ahead log")
+	}
+
+	if version := binary.LittleEndian.Uint32(header[4:]); version != walVersion {
+		return common.NewCorruptionError(wal.path, 0, fmt.Sprintf("unsupported WAL version %d", version))
+	}
+
+	if checksumType := common.ChecksumType(binary.LittleEndian.Uint64(header[8:])); checksumType != wal.checksumType {
+		return common.NewCorruptionError(wal.path, 0, fmt.Sprintf(
+			"the WAL entries are checksummed with %s, but the database file uses %s", checksumType, wal.checksumType))
+	}
+
+	return nil
+}
+
+func (wal *WriteAheadLog) Path() string {
+	return wal.path
+}
+
+// The size of the entries of the log in bytes.
+func (wal *WriteAheadLog) Size() uint64 {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	return wal.size - walHeaderSize
+}
+
+// A walRecord is the record of a change that is written to the log.
+type walRecord interface {
+	common.Serializable
+	common.Deserializable
+	walType() WALType
+}
+
+// Write the records followed by a flush entry, and sync the log. Once commit returns, the changes survive a crash. A
+// nil log (of an in-memory database) ignores the records.
+func (wal *WriteAheadLog) commit(records ...walRecord) error {
+	if wal == nil {
+		return nil
+	}
+
+	var data []byte
+
+	for _, record := range records {
+		entry, err := wal.encodeEntry(record.walType(), record)
+
+		if err != nil {
+			return err
+		}
+
+		data = append(data, entry...)
+	}
+
+	flush, err := wal.encodeEntry(WALFlush, nil)
+
+	if err != nil {
+		return err
+	}
+
+	return wal.write(append(data, flush...))
+}
+
+// Write a checkpoint entry with the meta block of the checkpoint, and sync the log. If the database crashes after the
+// header of the checkpoint has been written, but before the log has been truncated, the entry shows that the changes
+// in the log are already part of the database.
+func (wal *WriteAheadLog) writeCheckpoint(metaBlock BlockID) error {
+	if wal == nil {
+		return nil
+	}
+
+	entry, err := wal.encodeEntry(WALCheckpoint, &walCheckpoint{metaBlock: metaBlock})
+
+	if err != nil {
+		return err
+	}
+
+	return wal.write(entry)
+}
+
+// Append the data to the log and sync it.
+func (wal *WriteAheadLog) write(data []byte) error {
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	if err := wal.handle.Write(data, wal.size); err != nil {
+		return err
+	}
+
+	if err := wal.handle.Sync(); err != nil {
+		return err
+	}
+
+	wal.size += uint64(len(data))
+
+	return nil
+}
+
+// Remove all entries from the log, after a checkpoint has persisted them. The header is kept.
+func (wal *WriteAheadLog) Truncate() error {
+	if wal == nil {
+		return nil
+	}
+
+	wal.lock.Lock()
+	defer wal.lock.Unlock()
+
+	if err := wal.fs.Truncate(wal.handle, walHeaderSize); err != nil {
+		return err
+	}
+
+	if err := wal.handle.Sync(); err != nil {
+		return err
+	}
+
+	wal.size = walHeaderSize
+
+	return nil
+}
+
+func (wal *WriteAheadLog) Close() error {
+	if wal == nil {
+		return nil
+	}
+
+	return wal.handle.Close()
+}
+
+func (wal *WriteAheadLog) encodeEntry(walType WALType, record common.Serializable) ([]byte, error) {
+	serializer := common.NewBufferedSerializer()
+
+	if err := serializer.WriteUint8(uint8(walType)); err != nil {
+		return nil, err
+	}
+
+	if record != nil {
+		if err := record.Serialize(serializer); err != nil {
+			return nil, err
+		}
+	}
+
+	entry := make([]byte, walEntryHeaderSize, walEntryHeaderSize+len(serializer.Data()))
+	binary.LittleEndian.PutUint64(entry, uint64(len(serializer.Data())))
+	binary.LittleEndian.PutUint64(entry[8:], common.ComputeChecksum(wal.checksumType, serializer.Data()))
+
+	return append(entry, serializer.Data()...), nil
+}
+
+// Read the entries of the log, and call fn with the records of every commit, in the order in which they were
+// committed. Records that are not followed by a flush entry were not committed, and are skipped; so is a torn tail of
+// the log. The commits that precede a checkpoint entry for the given meta block, the meta block of the active header,
+// are already part of the database, and are skipped as well.
+func (wal *WriteAheadLog) replay(metaBlock BlockID, fn func(records []walRecord) error) error {
+	start := uint64(walHeaderSize)
+
+	err := wal.forEachEntry(walHeaderSize, func(end uint64, walType WALType, data []byte) error {
+		if walType != WALCheckpoint {
+			return nil
+		}
+
+		_, record, err := decodeWALEntry(data)
+
+		if err == nil && record.(*walCheckpoint).metaBlock == metaBlock && metaBlock != InvalidBlock {
+			start = end
+		}
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	var records []walRecord
+
+	return wal.forEachEntry(start, func(end uint64, walType WALType, data []byte) error {
+		switch walType {
+		case WALFlush:
+			if err := fn(records); err != nil {
+				return err
+			}
+
+			records = nil
+		case WALCheckpoint:
+		default:
+			_, record, err := decodeWALEntry(data)
+
+			if err != nil {
+				return err
+			}
+
+			records = append(records, record)
+		}
+
+		return nil
+	})
+}
+
+// Call fn with the type and the data of every entry from the given offset, and the offset at which the entry ends. The
+// entries end at the first torn entry: the rest of the log was not synced when the database crashed, so it does not
+// hold committed changes.
+func (wal *WriteAheadLog) forEachEntry(offset uint64, fn func(end uint64, walType WALType, data []byte) error) error {
+	for offset < wal.size {
+		data, err := wal.readEntry(offset)
+
+		if err != nil || data == nil {
+			return err
+		}
+
+		end := offset + walEntryHeaderSize + uint64(len(data))
+
+		if err := fn(end, WALType(data[0]), data); err != nil {
+			var serializationError *common.SerializationError
+
+			if errors.As(err, &serializationError) {
+				return common.NewCorruptionError(wal.path, offset, err.Error())
+			}
+
+			return err
+		}
+
+		offset = end
+	}
+
+	return nil
+}
+
+// Read the data of the entry at the given offset, verifying its checksum. Returns nil if the entry is torn: it extends
+// past the end of the log, or its checksum does not match, because the database crashed while it was written.
+func (wal *WriteAheadLog) readEntry(offset uint64) ([]byte, error) {
+	if offset+walEntryHeaderSize > wal.size {
+		return nil, nil
+	}
+
+	header := make([]byte, walEntryHeaderSize)
+
+	if err := wal.handle.Read(header, offset); err != nil {
+		return nil, err
+	}
+
+	length := binary.LittleEndian.Uint64(header)
+
+	// Every entry starts with its type, so an empty entry is torn as well.
+	if length == 0 || length > wal.size-offset-walEntryHeaderSize {
+		return nil, nil
+	}
+
+	data := make([]byte, length)
+
+	if err := wal.handle.Read(data, offset+walEntryHeaderSize); err != nil {
+		return nil, err
+	}
+
+	if common.ComputeChecksum(wal.checksumType, data) != binary.LittleEndian.Uint64(header[8:]) {
+		return nil, nil
+	}
+
+	return data, nil
+}
+
+func decodeWALEntry(data []byte) (WALType, walRecord, error) {
+	deserializer := common.NewBufferedDeserializer(data)
+	typ, err := deserializer.ReadUint8()
+
+	if err != nil {
+		return WALInvalid, nil, err
+	}
+
+	var record walRecord
+
+	switch walType := WALType(typ); walType {
+	case WALCreateTable:
+		record = &walCreateTable{}
+	case WALDropTable:
+		record = &walDropTable{}
+	case WALInsert:
+		record = &walInsert{}
+	case WALDelete:
+		record = &walDelete{}
+	case WALUpdate:
+		record = &walUpdate{}
+	case WALCheckpoint:
+		record = &walCheckpoint{}
+	case WALFlush:
+	default:
+		return WALInvalid, nil, common.NewSerializationError(fmt.Sprintf("unknown WAL entry type %d", typ))
+	}
+
+	if record != nil {
+		if err := record.Deserialize(deserializer); err != nil {
+			return WALInvalid, nil, err
+		}
+	}
+
+	if remaining := deserializer.Remaining(); remaining > 0 {
+		return WALInvalid, nil, common.NewSerializationError(fmt.Sprintf("%d trailing bytes after %s WAL entry",
+			remaining, WALType(typ)))
+	}
+
+	return WALType(typ), record, nil
+}
+
+type walCreateTable struct {
+	info TableInfo
+}
+
+func (record *walCreateTable) walType() WALType {
+	return WALCreateTable
+}
+
+func (record *walCreateTable) Serialize(serializer common.Serializer) error {
+	return record.info.Serialize(serializer)
+}
+
+func (record *walCreateTable) Deserialize(deserializer common.Deserializer) error {
+	return record.info.Deserialize(deserializer)
+}
+
+type walDropTable struct {
+	table string
+}
+
+func (record *walDropTable) walType() WALType {
+	return WALDropTable
+}
+
+func (record *walDropTable) Serialize(serializer common.Serializer) error {
+	writer := common.NewFieldWriter(serializer)
+
+	if err := writer.WriteField(1, func(s common.Serializer) error { return s.WriteString(record.table) }); err != nil {
+		return err
+	}
+
+	return writer.Finalize()
+}
+
+func (record *walDropTable) Deserialize(deserializer common.Deserializer) error {
+	reader := common.NewFieldReader(deserializer)
+
+	if err := reader.ReadField(1, func(d common.Deserializer) (err error) {
+		record.table, err = d.ReadString()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return reader.Finalize()
+}
+
+type walInsert struct {
+	table string
+	chunk *common.DataChunk
+}
+
+func (record *walInsert) walType() WALType {
+	return WALInsert
+}
+
+func (record *walInsert) Serialize(serializer common.Serializer) error {
+	writer := common.NewFieldWriter(serializer)
+
+	if err := writer.WriteField(1, func(s common.Serializer) error { return s.WriteString(record.table) }); err != nil {
+		return err
+	}
+
+	if err := writer.WriteField(2, func(s common.Serializer) error { return writeChunk(s, record.chunk) }); err != nil {
+		return err
+	}
+
+	return writer.Finalize()
+}
+
+func (record *walInsert) Deserialize(deserializer common.Deserializer) error {
+	reader := common.NewFieldReader(deserializer)
+
+	if err := reader.ReadField(1, func(d common.Deserializer) (err error) {
+		record.table, err = d.ReadString()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := reader.ReadField(2, func(d common.Deserializer) (err error) {
+		record.chunk, err = readChunk(d)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return reader.Finalize()
+}
+
+type walDelete struct {
+	table string
+	rows  []uint64
+}
+
+func (record *walDelete) walType() WALType {
+	return WALDelete
+}
+
+func (record *walDelete) Serialize(serializer common.Serializer) error {
+	writer := common.NewFieldWriter(serializer)
+
+	if err := writer.WriteField(1, func(s common.Serializer) error { return s.WriteString(record.table) }); err != nil {
+		return err
+	}
+
+	if err := writer.WriteField(2, func(s common.Serializer) error { return writeRows(s, record.rows) }); err != nil {
+		return err
+	}
+
+	return writer.Finalize()
+}
+
+func (record *walDelete) Deserialize(deserializer common.Deserializer) error {
+	reader := common.NewFieldReader(deserializer)
+
+	if err := reader.ReadField(1, func(d common.Deserializer) (err error) {
+		record.table, err = d.ReadString()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := reader.ReadField(2, func(d common.Deserializer) (err error) {
+		record.rows, err = readRows(d)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return reader.Finalize()
+}
+
+type walUpdate struct {
+	table     string
+	columnIDs []int
+	rows      []uint64
+	chunk     *common.DataChunk // The new values of the columns, with a row for every updated row.
+}
+
+func (record *walUpdate) walType() WALType {
+	return WALUpdate
+}
+
+func (record *walUpdate) Serialize(serializer common.Serializer) error {
+	writer := common.NewFieldWriter(serializer)
+
+	if err := writer.WriteField(1, func(s common.Serializer) error { return s.WriteString(record.table) }); err != nil {
+		return err
+	}
+
+	err := writer.WriteField(2, func(s common.Serializer) error {
+		return s.WriteList(len(record.columnIDs), func(i int) error { return s.WriteVarint(uint64(record.columnIDs[i])) })
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := writer.WriteField(3, func(s common.Serializer) error { return writeRows(s, record.rows) }); err != nil {
+		return err
+	}
+
+	if err := writer.WriteField(4, func(s common.Serializer) error { return writeChunk(s, record.chunk) }); err != nil {
+		return err
+	}
+
+	return writer.Finalize()
+}
+
+func (record *walUpdate) Deserialize(deserializer common.Deserializer) error {
+	reader := common.NewFieldReader(deserializer)
+
+	if err := reader.ReadField(1, func(d common.Deserializer) (err error) {
+		record.table, err = d.ReadString()
+		return err
+	}); err != nil {
+		return err
+	}
+
+	err := reader.ReadField(2, func(d common.Deserializer) error {
+		record.columnIDs = nil
+
+		return d.ReadList(func(int) error {
+			columnID, err := d.ReadVarint()
+			record.columnIDs = append(record.columnIDs, int(columnID))
+
+			return err
+		})
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := reader.ReadField(3, func(d common.Deserializer) (err error) {
+		record.rows, err = readRows(d)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	if err := reader.ReadField(4, func(d common.Deserializer) (err error) {
+		record.chunk, err = readChunk(d)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return reader.Finalize()
+}
+
+type walCheckpoint struct {
+	metaBlock BlockID // The meta block the header of the checkpoint points to.
+}
+
+func (record *walCheckpoint) walType() WALType {
+	return WALCheckpoint
+}
+
+func (record *walCheckpoint) Serialize(serializer common.Serializer) error {
+	writer := common.NewFieldWriter(serializer)
+
+	if err := writer.WriteField(1, func(s common.Serializer) error { return s.WriteInt64(int64(record.metaBlock)) }); err != nil {
+		return err
+	}
+
+	return writer.Finalize()
+}
+
+func (record *walCheckpoint) Deserialize(deserializer common.Deserializer) error {
+	reader := common.NewFieldReader(deserializer)
+
+	if err := reader.ReadField(1, func(d common.Deserializer) error {
+		metaBlock, err := d.ReadInt64()
+		record.metaBlock = BlockID(metaBlock)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	return reader.Finalize()
+}
+
+func writeRows(serializer common.Serializer, rows []uint64) error {
+	return serializer.WriteList(len(rows), func(i int) error { return serializer.WriteVarint(rows[i]) })
+}
+
+func readRows(deserializer common.Deserializer) ([]uint64, error) {
+	var rows []uint64
+
+	err := deserializer.ReadList(func(int) error {
+		row, err := deserializer.ReadVarint()
+		rows = append(rows, row)
+
+		return err
+	})
+
+	return rows, err
+}
+
+// Write the columns of the chunk: the type of every column, followed by its values, which are absent for NULL.
+func writeChunk(serializer common.Serializer, chunk *common.DataChunk) error {
+	return serializer.WriteList(len(chunk.Columns), func(i int) error {
+		column := chunk.Columns[i]
+
+		if err := serializer.WriteUint8(uint8(column.Type())); err != nil {
+			return err
+		}
+
+		return serializer.WriteList(column.Len(), func(j int) error {
+			return serializer.WriteOptional(!column.IsNull(j), func() error { return writeValue(serializer, column.Value(j)) })
+		})
+	})
+}
+
+func readChunk(deserializer common.Deserializer) (*common.DataChunk, error) {
+	chunk := &common.DataChunk{}
+
+	err := deserializer.ReadList(func(int) error {
+		typ, err := deserializer.ReadUint8()
+
+		if err != nil {
+			return err
+		}
+
+		if !common.TypeID(typ).Valid() {
+			return common.NewSerializationError(fmt.Sprintf("unknown column type %d", typ))
+		}
+
+		column := common.NewVector(common.TypeID(typ), 0)
+		chunk.Columns = append(chunk.Columns, column)
+
+		return deserializer.ReadList(func(int) error {
+			var value interface{}
+
+			_, err := deserializer.ReadOptional(func() (err error) {
+				value, err = readValue(deserializer, column.Type())
+				return err
+			})
+
+			column.Append(value)
+
+			return err
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := chunk.Verify(); err != nil {
+		return nil, common.NewSerializationError(err.Error())
+	}
+
+	return chunk, nil
+}
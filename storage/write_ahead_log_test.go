@@ -0,0 +1,424 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/goduckdb/common"
+)
+
+// Simulate a crash of the database: the writes that were not synced are lost, and nothing is checkpointed on close.
+func crashTestStorage(t *testing.T, fs *common.FaultInjectionFileSystem, storageManager *StorageManager) {
+	t.Helper()
+	fs.Crash()
+	storageManager.Close()
+
+	if err := fs.Restart(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteAheadLogReplay(t *testing.T) {
+	fs := common.NewFaultInjectionFileSystem(common.NewMemoryFileSystem())
+	path := "/wal.db"
+	storageManager := openTestStorage(t, fs, path)
+	info := testTableInfo
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.Append(testChunk(0, 5000)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	if size := storageManager.wal.Size(); size != 0 {
+		t.Errorf("Expect the log to be truncated by a checkpoint, got %d bytes", size)
+	}
+
+	// Changes after the checkpoint are only persisted by the log.
+	if err := table.Append(testChunk(5000, 6000)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := table.Delete([]uint64{1, 5500}); err != nil {
+		t.Fatal(err)
+	}
+
+	values := common.NewDataChunk([]common.TypeID{common.Varchar}, 2)
+	values.Columns[0].Append("updated")
+	values.Columns[0].Append(nil)
+
+	if err := table.Update([]int{4}, []uint64{2, 5600}, values); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"dropped", "created"} {
+		created := TableInfo{Name: name, Columns: []ColumnDefinition{{Name: "id", Type: common.Integer}}}
+		table, err := storageManager.CreateTable(&created)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chunk := &common.DataChunk{Columns: []*common.Vector{common.NewVectorFromSlice(common.Integer, []int32{1, 2, 3})}}
+
+		if err := table.Append(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dropped := storageManager.GetTable("dropped")
+
+	if err := storageManager.DropTable("dropped"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := dropped.Delete([]uint64{0}); err == nil {
+		t.Errorf("Expect changing a dropped table to fail")
+	}
+
+	if exists, _ := fs.FileExists(WALPath(path)); !exists || storageManager.wal.Size() == 0 {
+		t.Fatalf("Expect the changes to be written to %s", WALPath(path))
+	}
+
+	crashTestStorage(t, fs, storageManager)
+	storageManager = openTestStorage(t, fs, path)
+
+	// The replayed changes are checkpointed, which truncates the log.
+	if size := storageManager.wal.Size(); size != 0 {
+		t.Errorf("Expect the log to be truncated after the replay, got %d bytes", size)
+	}
+
+	table = storageManager.GetTable(info.Name)
+
+	if table.Count() != 5998 {
+		t.Errorf("Expect 5998 rows, got %d", table.Count())
+	}
+
+	chunk, err := table.Fetch([]int{0, 4}, []uint64{2, 3, 5600, 5999})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(chunk.Columns[0].Data(), []int64{2, 3, 5600, 5999}) || chunk.Columns[1].Value(0) != "updated" ||
+		chunk.Columns[1].Value(1) != "name-3" || chunk.Columns[1].Value(2) != nil {
+		t.Errorf("Expect the updates to be replayed, got %v", chunk.Columns[1].Data())
+	}
+
+	if _, err := table.Fetch([]int{0}, []uint64{5500}); err == nil {
+		t.Errorf("Expect the deletes to be replayed")
+	}
+
+	if storageManager.GetTable("dropped") != nil || storageManager.GetTable("created").Count() != 3 {
+		t.Errorf("Expect the created and dropped tables to be replayed")
+	}
+
+	// A clean shutdown checkpoints all changes and removes the log.
+	if err := storageManager.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, _ := fs.FileExists(WALPath(path)); exists {
+		t.Errorf("Expect the log to be removed on close")
+	}
+
+	storageManager = openTestStorage(t, fs, path)
+	defer storageManager.Close()
+
+	if table := storageManager.GetTable(info.Name); table.Count() != 5998 {
+		t.Errorf("Expect 5998 rows after reopening, got %d", table.Count())
+	}
+}
+
+func TestWriteAheadLogCheckpointEntry(t *testing.T) {
+	fs := common.NewMemoryFileSystem()
+	wal, err := OpenWriteAheadLog(fs, "/test.wal", false, common.DefaultChecksumType)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wal.Close()
+
+	commit := func(name string) {
+		if err := wal.commit(&walDropTable{table: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commit("a")
+
+	if err := wal.writeCheckpoint(7); err != nil {
+		t.Fatal(err)
+	}
+
+	commit("b")
+
+	// Uncommitted records are not replayed.
+	entry, err := wal.encodeEntry(WALDropTable, &walDropTable{table: "c"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wal.write(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	// The commits before the checkpoint entry are only replayed if the checkpoint was not committed.
+	for _, test := range []struct {
+		metaBlock BlockID
+		expected  []string
+	}{
+		{7, []string{"b"}},
+		{8, []string{"a", "b"}},
+		{InvalidBlock, []string{"a", "b"}},
+	} {
+		var tables []string
+
+		err := wal.replay(test.metaBlock, func(records []walRecord) error {
+			for _, record := range records {
+				tables = append(tables, record.(*walDropTable).table)
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(tables, test.expected) {
+			t.Errorf("Expect %v to be replayed for meta block %d, got %v", test.expected, test.metaBlock, tables)
+		}
+	}
+}
+
+func readTestFile(t *testing.T, fs common.FileSystem, path string) []byte {
+	t.Helper()
+	handle, err := fs.OpenFile(path, common.ReadOnly, common.NoLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	size, err := fs.GetFileSize(handle)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, size)
+
+	if err := handle.Read(data, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func writeTestFile(t *testing.T, fs common.FileSystem, path string, data []byte) {
+	t.Helper()
+	handle, err := fs.OpenFile(path, common.WriteOnly|common.Create, common.NoLock)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	if err := handle.Write(data, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := handle.Sync(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The ids of the rows of the table, in row order.
+func scanTestIDs(t *testing.T, table *DataTable) []int32 {
+	t.Helper()
+	ids := []int32{}
+
+	err := table.Scan([]int{0}, func(chunk *common.DataChunk) error {
+		ids = append(ids, chunk.Columns[0].Data().([]int32)...)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ids
+}
+
+func TestWriteAheadLogTornTail(t *testing.T) {
+	fs := common.NewFaultInjectionFileSystem(common.NewMemoryFileSystem())
+	path := "/torn.db"
+	storageManager := openTestStorage(t, fs, path)
+	info := TableInfo{Name: "t", Columns: []ColumnDefinition{{Name: "id", Type: common.Integer}}}
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storageManager.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := func(values ...int32) *common.DataChunk {
+		return &common.DataChunk{Columns: []*common.Vector{common.NewVectorFromSlice(common.Integer, values)}}
+	}
+
+	// Every commit is followed by the ids of the table, and the size of the log file once it has been committed.
+	commits := []func() error{
+		func() error { return table.Append(ids(1, 2, 3)) },
+		func() error {
+			tx := storageManager.BeginTransaction()
+
+			if err := tx.Append(table, ids(4, 5)); err != nil {
+				return err
+			}
+
+			if err := tx.Delete(table, []uint64{0}); err != nil {
+				return err
+			}
+
+			return tx.Commit()
+		},
+		func() error { return table.Update([]int{0}, []uint64{1}, ids(30)) },
+		func() error { return table.Append(ids(6)) },
+	}
+	expected := [][]int32{{}}
+	ends := []uint64{walHeaderSize}
+
+	for _, commit := range commits {
+		if err := commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		expected = append(expected, scanTestIDs(t, table))
+		ends = append(ends, walHeaderSize+storageManager.wal.Size())
+	}
+
+	crashTestStorage(t, fs, storageManager)
+	database := readTestFile(t, fs, path)
+	wal := readTestFile(t, fs, WALPath(path))
+
+	if uint64(len(wal)) != ends[len(ends)-1] {
+		t.Fatalf("Expect a log of %d bytes, got %d", ends[len(ends)-1], len(wal))
+	}
+
+	// A flush entry that does not match its checksum was torn, so its commit is discarded.
+	fs = common.NewFaultInjectionFileSystem(common.NewMemoryFileSystem())
+	corrupted := append([]byte(nil), wal...)
+	corrupted[len(corrupted)-1] ^= 0xFF
+	writeTestFile(t, fs, path, database)
+	writeTestFile(t, fs, WALPath(path), corrupted)
+	storageManager = openTestStorage(t, fs, path)
+
+	if actual := scanTestIDs(t, storageManager.GetTable("t")); !reflect.DeepEqual(actual, expected[len(commits)-1]) {
+		t.Errorf("Expect ids %v for a torn flush entry, got %v", expected[len(commits)-1], actual)
+	}
+
+	storageManager.Close()
+
+	// Cut the log at every offset: the database opens with exactly the commits that fit before the cut.
+	for offset := 0; offset <= len(wal); offset++ {
+		fs := common.NewFaultInjectionFileSystem(common.NewMemoryFileSystem())
+		writeTestFile(t, fs, path, database)
+		writeTestFile(t, fs, WALPath(path), wal[:offset])
+		committed := 0
+
+		for committed+1 < len(ends) && ends[committed+1] <= uint64(offset) {
+			committed++
+		}
+
+		// A read-only database replays the log without changing it.
+		options := DefaultOptions()
+		options.ReadOnly = true
+		storageManager := NewStorageManager(fs, path, options)
+
+		if err := storageManager.Initialize(); err != nil {
+			t.Fatalf("Expect a log cut at %d to be opened: %v", offset, err)
+		}
+
+		if actual := scanTestIDs(t, storageManager.GetTable("t")); !reflect.DeepEqual(actual, expected[committed]) {
+			t.Fatalf("Expect ids %v for a log cut at %d, got %v", expected[committed], offset, actual)
+		}
+
+		storageManager.Close()
+
+		// The torn tail is discarded, so that the commits that follow are replayed after a crash.
+		storageManager = openTestStorage(t, fs, path)
+
+		if err := storageManager.GetTable("t").Append(ids(100)); err != nil {
+			t.Fatal(err)
+		}
+
+		crashTestStorage(t, fs, storageManager)
+		storageManager = openTestStorage(t, fs, path)
+		actual := scanTestIDs(t, storageManager.GetTable("t"))
+		storageManager.Close()
+
+		if !reflect.DeepEqual(actual, append(append([]int32{}, expected[committed]...), 100)) {
+			t.Fatalf("Expect ids %v and 100 after a crash with a log cut at %d, got %v", expected[committed], offset, actual)
+		}
+	}
+}
+
+func TestWriteAheadLogChecksumType(t *testing.T) {
+	fs := common.NewFaultInjectionFileSystem(common.NewMemoryFileSystem())
+	path := "/checksum.db"
+	options := DefaultOptions()
+	options.ChecksumType = common.ChecksumXXHash64
+
+	storageManager := NewStorageManager(fs, path, options)
+
+	if err := storageManager.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	info := testTableInfo
+	table, err := storageManager.CreateTable(&info)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := table.Append(testChunk(0, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	crashTestStorage(t, fs, storageManager)
+	wal := readTestFile(t, fs, WALPath(path))
+
+	// A log that records another checksum algorithm than the database file is rejected, instead of being discarded as
+	// a torn log.
+	corrupted := append([]byte(nil), wal...)
+	binary.LittleEndian.PutUint64(corrupted[8:], uint64(common.DefaultChecksumType))
+	writeTestFile(t, fs, WALPath(path), corrupted)
+	storageManager = NewStorageManager(fs, path, options)
+	var corruptionErr *common.CorruptionError
+
+	if err := storageManager.Initialize(); !errors.As(err, &corruptionErr) {
+		t.Fatalf("Expect a CorruptionError for a log with another checksum type, got %v", err)
+	}
+
+	// The entries are checksummed with the algorithm of the database file, not the default algorithm.
+	writeTestFile(t, fs, WALPath(path), wal)
+	storageManager = openTestStorage(t, fs, path)
+	defer storageManager.Close()
+
+	verifyTestTable(t, storageManager.GetTable(info.Name), 100)
+}